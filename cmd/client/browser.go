@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/listing"
+)
+
+//////// server browser
+//////// lists the servers a master server knows of, typing narrows the list
+//////// down to those whose name, region or mode match, Enter joins one
+
+const (
+	browserKey       = rl.KeyF1
+	browserRefresh   = rl.KeyF5
+	browserLength    = 12 // servers shown at once
+	maxFilterLength  = 16
+	browserLineSpace = scoreboardLineSpace
+)
+
+type fetchResult struct {
+	servers []listing.Server
+	err     error
+}
+
+type browser struct {
+	master   string // URL of the master server, empty if there is none
+	servers  []listing.Server
+	filter   string
+	selected int // in the filtered servers
+	status   string
+	fetching bool
+	fetched  chan fetchResult
+}
+
+func newBrowser(master string) *browser {
+	return &browser{master: strings.TrimSuffix(master, "/"), fetched: make(chan fetchResult, 1)}
+}
+
+func fetchServers(master string) ([]listing.Server, error) {
+	client := http.Client{Timeout: 5 * time.Second}
+	response, err := client.Get(master + "/servers")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Master server responded with %s", response.Status)
+	}
+
+	var servers []listing.Server
+	if err := json.NewDecoder(response.Body).Decode(&servers); err != nil {
+		return nil, err
+	}
+	return servers, nil
+}
+
+// fetch the list again in the background
+func (browser *browser) refresh() {
+	if browser.master == "" {
+		browser.status = "No master server, see -master"
+		return
+	}
+	if browser.fetching {
+		return
+	}
+	browser.fetching = true
+	browser.status = "Fetching servers"
+	go func() {
+		servers, err := fetchServers(browser.master)
+		browser.fetched <- fetchResult{servers: servers, err: err}
+	}()
+}
+
+// the servers matching the filter
+func (browser *browser) filtered() []listing.Server {
+	filter := strings.ToLower(browser.filter)
+	servers := make([]listing.Server, 0, len(browser.servers))
+	for _, server := range browser.servers {
+		text := strings.ToLower(server.Name + " " + server.Region + " " + server.Mode)
+		if strings.Contains(text, filter) {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
+
+// move through and filter the list, returning the address of the server
+// picked, if one was
+func (browser *browser) update() (string, bool) {
+	select {
+	case result := <-browser.fetched:
+		browser.fetching = false
+		if result.err != nil {
+			browser.status = result.err.Error()
+		} else {
+			browser.servers = result.servers
+			browser.status = fmt.Sprintf("%d servers", len(result.servers))
+		}
+	default:
+	}
+
+	if rl.IsKeyPressed(browserRefresh) {
+		browser.refresh()
+	}
+	if rl.IsKeyPressed(rl.KeyBackspace) && browser.filter != "" {
+		_, size := utf8.DecodeLastRuneInString(browser.filter)
+		browser.filter = browser.filter[:len(browser.filter)-size]
+	}
+	for char := rl.GetCharPressed(); char != 0; char = rl.GetCharPressed() {
+		if len(browser.filter)+utf8.RuneLen(char) <= maxFilterLength {
+			browser.filter += string(char)
+		}
+	}
+
+	servers := browser.filtered()
+	switch {
+	case rl.IsKeyPressed(rl.KeyDown):
+		browser.selected++
+	case rl.IsKeyPressed(rl.KeyUp):
+		browser.selected--
+	}
+	browser.selected = min(max(browser.selected, 0), max(len(servers)-1, 0))
+	if rl.IsKeyPressed(rl.KeyEnter) && browser.selected < len(servers) {
+		return servers[browser.selected].Address, true
+	}
+	return "", false
+}
+
+func (browser *browser) draw(font rl.Font) {
+	rl.ClearBackground(rl.RayWhite)
+	rl.DrawTextEx(font, "SERVERS::"+browser.filter, rl.Vector2{X: leftMargin, Y: topMargin}, fontSize, 0, rl.Black)
+	rl.DrawTextEx(font, "F1::BACK  F5::REFRESH  ENTER::JOIN  "+browser.status, rl.Vector2{X: leftMargin, Y: topMargin + lineSpace}, scoreboardFontSize, 0, rl.Gray)
+
+	// scroll so the selected server is always shown
+	servers := browser.filtered()
+	first := max(0, browser.selected-browserLength+1)
+	for i, server := range servers[first:min(len(servers), first+browserLength)] {
+		marker := " "
+		if first+i == browser.selected {
+			marker = ">"
+		}
+		lock := ""
+		if server.Password {
+			lock = " PASSWORD"
+		}
+		line := fmt.Sprintf("%s%-20.20s %-8.8s %-4.4s %2d PLAYING%s", marker, server.Name, server.Region, server.Mode, server.Players, lock)
+		rl.DrawTextEx(font, line, rl.Vector2{X: leftMargin, Y: topMargin + float32(lineSpace*2+browserLineSpace*i)}, scoreboardFontSize, 0, rl.Black)
+	}
+}
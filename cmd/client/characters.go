@@ -0,0 +1,160 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// characters
+//////// other players are drawn as boxes for a head, body, arms and legs,
+//////// posed by what the server tells us they are doing; every part is the
+//////// same unit cube, scaled and turned into place
+
+const (
+	characterMoveSpeed = 1                      // units per second, slower than this is standing still
+	characterShootTime = 250 * time.Millisecond // how long the arms stay up after a shot
+	characterDeathTime = 400 * time.Millisecond // how long falling over takes
+	characterLegSwing  = 35                     // degrees either way of upright at full stride
+	characterArmSwing  = 20
+	characterReloadArm = 45  // degrees forward the arms are held while reloading
+	characterSwapArm   = -30 // and back, reaching for the other gun, while swapping
+
+	// the parts of a standing player, who faces along the X axis with their
+	// feet at the origin, the head matches the head hit box
+	characterHipHeight      = 0.9
+	characterShoulderHeight = 1.55
+	characterLegLength      = characterHipHeight
+	characterArmLength      = 0.7
+	characterLimbWidth      = 0.2
+	characterBodyDepth      = 0.35
+	characterBodyWidth      = 0.6
+	characterHeadSize       = protocol.HeadHeight
+)
+
+var (
+	characterColours = [2]rl.Color{
+		protocol.A: rl.NewColor(90, 170, 160, 255),
+		protocol.B: rl.NewColor(200, 120, 80, 255),
+	}
+	characterDeadColour    = rl.NewColor(120, 120, 120, 255)
+	characterSkinColour    = rl.NewColor(230, 190, 160, 255)
+	characterOutlineColour = rl.NewColor(40, 40, 40, 255)
+)
+
+type pose int
+
+const (
+	idlePose pose = iota
+	runPose
+	shootPose
+	reloadPose
+	swapPose
+	deadPose
+)
+
+// what the player looks to be doing, from their state, how fast they are going
+// and when they last shot
+func (otherPlayer *otherPlayer) pose() pose {
+	switch {
+	case otherPlayer.otherPlayerState == dead:
+		return deadPose
+	case time.Since(otherPlayer.shotAt) < characterShootTime:
+		return shootPose
+	case time.Now().Before(otherPlayer.actionEnds) && otherPlayer.action == protocol.Reload:
+		return reloadPose
+	case time.Now().Before(otherPlayer.actionEnds) && otherPlayer.action == protocol.Swap:
+		return swapPose
+	case rl.Vector2Length(rl.Vector2{X: otherPlayer.velocity.X, Y: otherPlayer.velocity.Z}) > characterMoveSpeed:
+		return runPose
+	}
+	return idlePose
+}
+
+func (playerWorld *playerWorld) drawCharacter(otherPlayer *otherPlayer, team protocol.Team) {
+	pose := otherPlayer.pose()
+	colour := characterColours[team]
+	if pose == deadPose {
+		colour = characterDeadColour
+	}
+
+	// legs swing in step with the footsteps, whatever the arms are doing
+	var legSwing, armSwing float32
+	if pose != deadPose {
+		speed := rl.Vector2Length(rl.Vector2{X: otherPlayer.velocity.X, Y: otherPlayer.velocity.Z})
+		if speed > characterMoveSpeed {
+			phase := float32(math.Sin(rl.GetTime() * math.Pi * float64(speed) / footstepStride))
+			legSwing = phase * characterLegSwing
+			armSwing = -phase * characterArmSwing
+		}
+	}
+
+	rl.PushMatrix()
+	defer rl.PopMatrix()
+	rl.Translatef(otherPlayer.position.X, otherPlayer.position.Y, otherPlayer.position.Z)
+	rl.Rotatef(-otherPlayer.yaw*rl.Rad2deg, 0, 1, 0)
+	if pose == deadPose {
+		fallen := min(float32(time.Since(otherPlayer.diedAt))/float32(characterDeathTime), 1)
+		rl.Rotatef(90*fallen, 0, 0, 1)
+	}
+	rl.Scalef(1, otherPlayer.height()/float32(otherPlayerHeight), 1)
+
+	// legs and arms hang from their joints, so are turned about them
+	for _, side := range [2]float32{-1, 1} {
+		playerWorld.drawLimb(rl.Vector3{Z: side * characterBodyWidth / 4, Y: characterHipHeight}, side*legSwing, characterLegLength, colour)
+	}
+	for _, side := range [2]float32{-1, 1} {
+		swing := side * armSwing
+		switch pose {
+		case shootPose:
+			swing = 90 + otherPlayer.pitch*rl.Rad2deg
+		case reloadPose:
+			swing = characterReloadArm
+		case swapPose:
+			swing = characterSwapArm
+		}
+		playerWorld.drawLimb(rl.Vector3{Z: side * (characterBodyWidth + characterLimbWidth) / 2, Y: characterShoulderHeight}, swing, characterArmLength, colour)
+	}
+
+	bodyHeight := float32(characterShoulderHeight + characterLimbWidth/2 - characterHipHeight)
+	playerWorld.drawCharacterPart(rl.Vector3{Y: characterHipHeight + bodyHeight/2}, rl.Vector3{X: characterBodyDepth, Y: bodyHeight, Z: characterBodyWidth}, colour)
+	playerWorld.drawCharacterPart(rl.Vector3{Y: float32(otherPlayerHeight) - characterHeadSize/2}, rl.Vector3{X: characterHeadSize, Y: characterHeadSize, Z: characterHeadSize}, characterSkinColour)
+}
+
+// a limb hanging down from a joint, swung forwards by some degrees
+func (playerWorld *playerWorld) drawLimb(joint rl.Vector3, swing, length float32, colour rl.Color) {
+	rl.PushMatrix()
+	defer rl.PopMatrix()
+	rl.Translatef(joint.X, joint.Y, joint.Z)
+	rl.Rotatef(swing, 0, 0, 1)
+	playerWorld.drawCharacterPart(rl.Vector3{Y: -length / 2}, rl.Vector3{X: characterLimbWidth, Y: length, Z: characterLimbWidth}, colour)
+}
+
+func (playerWorld *playerWorld) drawCharacterPart(centre, size rl.Vector3, colour rl.Color) {
+	rl.DrawModelEx(playerWorld.characterModel, centre, rl.Vector3{Y: 1}, 0, size, colour)
+	rl.DrawModelWiresEx(playerWorld.characterModel, centre, rl.Vector3{Y: 1}, 0, size, characterOutlineColour)
+}
+
+// another player started reloading or swapping guns, which takes them as long
+// as it would take us, and can be heard nearby like their footsteps
+func (playerWorld *playerWorld) otherPlayerAction(id int, action protocol.Action, gun protocol.Gun) {
+	otherPlayer := &playerWorld.otherPlayers[id]
+	otherPlayer.action = action
+	sound := playerWorld.swapSounds[id]
+	duration := time.Duration(swapTime) * time.Second
+	if action == protocol.Reload {
+		sound = playerWorld.reloadSounds[id]
+		duration = time.Duration(playerWorld.gunOfKind(gun).reloadTime) * time.Second
+	}
+	otherPlayer.actionEnds = time.Now().Add(duration)
+
+	distance := rl.Vector3Distance(playerWorld.camera.Position, otherPlayer.position)
+	if distance >= footstepRange {
+		return
+	}
+	playerWorld.settings.setEffectVolume(sound, 1-distance/footstepRange)
+	rl.SetSoundPan(sound, playerWorld.panTowards(otherPlayer.position))
+	rl.PlaySound(sound)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+//////// clock sync
+//////// the server stamps locations and pongs with how long its lobby has been
+//////// around, and each pong is a sample of when that clock started on ours,
+//////// taken to be halfway through the round trip; the sample with the
+//////// shortest round trip of the last few is the one least thrown off by
+//////// the network, as NTP does, so it is the one used to put locations,
+//////// the killcam and hits on the server's timeline
+
+const clockSamples = 8
+
+type clockSample struct {
+	start   time.Time     // when the server's clock read zero, on ours
+	latency time.Duration // half the round trip
+}
+
+type serverClock struct {
+	samples []clockSample // the latest, oldest first
+	best    clockSample   // the one with the shortest round trip
+	mutex   sync.Mutex
+}
+
+// a pong sent at serverTime answered a ping we sent at sentAt
+func (clock *serverClock) sample(sentAt, receivedAt time.Time, serverTime time.Duration) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	latency := receivedAt.Sub(sentAt) / 2
+	clock.samples = append(clock.samples, clockSample{start: sentAt.Add(latency - serverTime), latency: latency})
+	if len(clock.samples) > clockSamples {
+		clock.samples = clock.samples[1:]
+	}
+	clock.best = clock.samples[0]
+	for _, sample := range clock.samples {
+		if sample.latency < clock.best.latency {
+			clock.best = sample
+		}
+	}
+}
+
+// when something the server sent at serverTime was sent, on our clock, or
+// when it arrived if the server's clock cannot be told, as before the first
+// pong or while watching a demo
+func (clock *serverClock) local(serverTime time.Duration, arrived time.Time) time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	if len(clock.samples) == 0 {
+		return arrived
+	}
+	return clock.best.start.Add(serverTime)
+}
+
+// what the server's clock read at a time on ours, 0 if it cannot be told
+func (clock *serverClock) at(local time.Time) time.Duration {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	if len(clock.samples) == 0 {
+		return 0
+	}
+	return max(local.Sub(clock.best.start), 0)
+}
+
+// how long what the server sends takes to get here, as far as can be told
+func (clock *serverClock) latency() time.Duration {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return clock.best.latency
+}
+
+// how far in the past other players are drawn: what the server sent is
+// stamped with when it was sent, which is already a trip behind, and the
+// jitter buffer is on top of that
+func (playerWorld *playerWorld) renderDelay() time.Duration {
+	return playerWorld.serverClock.latency() + playerWorld.jitterBuffer.currentDelay()
+}
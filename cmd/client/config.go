@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// config
+//////// the settings, key bindings and last server are kept in a JSON file in
+//////// the user's config directory, read at startup and written whenever
+//////// they change; anything left out of the file keeps its default
+
+type config struct {
+	Sensitivity       float32           `json:"sensitivity"`
+	ScopedSensitivity float32           `json:"scoped_sensitivity"`
+	InvertY           bool              `json:"invert_y"`
+	Fov               float32           `json:"fov"`
+	Volume            float32           `json:"volume"`
+	SfxVolume         float32           `json:"sfx_volume"` // gunshots, footsteps and the rest of the sound effects
+	MusicVolume       float32           `json:"music_volume"`
+	VoiceVolume       float32           `json:"voice_volume"`
+	UiScale           float32           `json:"ui_scale"`        // how big the HUD is drawn
+	Display           string            `json:"display"`         // windowed, borderless or fullscreen
+	Monitor           int               `json:"monitor"`         // counting from 0
+	IntegerScaling    bool              `json:"integer_scaling"` // only scale the picture up by whole numbers
+	FpsCap            int32             `json:"fps_cap"`         // 0 for no cap
+	Vsync             bool              `json:"vsync"`
+	PostProcessing    bool              `json:"post_processing"`  // chromatic aberration over the whole picture
+	Lighting          bool              `json:"lighting"`         // the sun shading the world and casting shadows
+	SoundIndicators   bool              `json:"sound_indicators"` // show where gunshots and footsteps come from
+	Impacts           int               `json:"impacts"`          // how many particles, and bullet holes, there can be at once
+	Crosshair         crosshairConfig   `json:"crosshair"`
+	Keys              map[string]string `json:"keys"` // binding name to key name
+	LastServer        string            `json:"last_server"`
+	MasterServer      string            `json:"master_server"` // URL of the master server listing public servers
+	ResourcePack      string            `json:"resource_pack"` // directory of resources used in place of those built in
+}
+
+type crosshairConfig struct {
+	Length float32  `json:"length"`
+	Width  float32  `json:"width"`
+	Colour [4]uint8 `json:"colour"` // red, green, blue, alpha
+}
+
+func defaultConfig() config {
+	return config{
+		Sensitivity:       defaultLookSensitivity,
+		ScopedSensitivity: defaultScopedSensitivity,
+		Fov:               defaultFovy,
+		Volume:            1,
+		SfxVolume:         1,
+		MusicVolume:       1,
+		VoiceVolume:       1,
+		UiScale:           1,
+		Display:           windowedDisplay,
+		FpsCap:            30,
+		PostProcessing:    true,
+		Lighting:          true,
+		Impacts:           128,
+		Crosshair:         crosshairConfig{Length: 5, Width: 2, Colour: [4]uint8{0, 0, 0, 255}},
+	}
+}
+
+func (crosshair crosshairConfig) colour() rl.Color {
+	return rl.NewColor(crosshair.Colour[0], crosshair.Colour[1], crosshair.Colour[2], crosshair.Colour[3])
+}
+
+func configPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "shooter", "config.json"), nil
+}
+
+// the stored config, or the defaults if there is none yet, with its key
+// bindings put in place
+func loadConfig() (config, error) {
+	config := defaultConfig()
+	path, err := configPath()
+	if err != nil {
+		return config, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	} else if err != nil {
+		return config, fmt.Errorf("Could not read config: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("Could not parse config %s: %w", path, err)
+	}
+	if err := bindKeys(config.Keys); err != nil {
+		return config, fmt.Errorf("Bad key bindings in config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+func saveConfig(config config) {
+	path, err := configPath()
+	if err != nil {
+		slog.Warn("Could not save config", "error", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		slog.Warn("Could not save config", "error", err)
+		return
+	}
+	config.Keys = boundKeys()
+	data, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		slog.Warn("Could not save config", "error", err)
+		return
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		slog.Warn("Could not save config", "error", err)
+	}
+}
+
+//////// key bindings
+
+// the keys that can be bound, by the name they go by in the config
+var keyBindings = map[string]*int32{
+	"forward":    &forwardKey,
+	"back":       &backKey,
+	"left":       &leftKey,
+	"right":      &rightKey,
+	"jump":       &jumpKey,
+	"slow":       &slowKey,
+	"crouch":     &crouchKey,
+	"reload":     &reloadKey,
+	"use":        &useKey,
+	"mark":       &markKey,
+	"swap":       &swapKey,
+	"buy":        &buyMenuKey,
+	"scoreboard": &scoreboardKey,
+	"minimap":    &minimapKey,
+	"netstats":   &netStatsKey,
+	"settings":   &settingsMenuKey,
+	"talk":       &talkKey,
+	"vote":       &voteMenuKey,
+	"frag":       &grenadeKeys[protocol.Frag],
+	"smoke":      &grenadeKeys[protocol.Smoke],
+	"flash":      &grenadeKeys[protocol.Flash],
+}
+
+// letters and digits go by themselves, the rest by these names
+var keyNames = map[string]int32{
+	"SPACE":         rl.KeySpace,
+	"TAB":           rl.KeyTab,
+	"ENTER":         rl.KeyEnter,
+	"BACKSPACE":     rl.KeyBackspace,
+	"LEFT_SHIFT":    rl.KeyLeftShift,
+	"RIGHT_SHIFT":   rl.KeyRightShift,
+	"LEFT_CONTROL":  rl.KeyLeftControl,
+	"RIGHT_CONTROL": rl.KeyRightControl,
+	"LEFT_ALT":      rl.KeyLeftAlt,
+	"RIGHT_ALT":     rl.KeyRightAlt,
+	"UP":            rl.KeyUp,
+	"DOWN":          rl.KeyDown,
+	"LEFT":          rl.KeyLeft,
+	"RIGHT":         rl.KeyRight,
+}
+
+func init() {
+	for key := rl.KeyA; key <= rl.KeyZ; key++ {
+		keyNames[string(rune(key))] = int32(key)
+	}
+	for key := rl.KeyZero; key <= rl.KeyNine; key++ {
+		keyNames[string(rune(key))] = int32(key)
+	}
+}
+
+// rebind the keys named in a config
+func bindKeys(keys map[string]string) error {
+	for binding, name := range keys {
+		key, ok := keyNames[name]
+		if !ok {
+			return fmt.Errorf("Unknown key %q", name)
+		}
+		bound, ok := keyBindings[binding]
+		if !ok {
+			return fmt.Errorf("Unknown binding %q", binding)
+		}
+		*bound = key
+	}
+	return nil
+}
+
+// every binding by the name of the key it is bound to
+func boundKeys() map[string]string {
+	names := make(map[int32]string, len(keyNames))
+	for name, key := range keyNames {
+		names[key] = name
+	}
+	keys := make(map[string]string, len(keyBindings))
+	for binding, key := range keyBindings {
+		keys[binding] = names[*key]
+	}
+	return keys
+}
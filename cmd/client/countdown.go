@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+//////// round start countdown
+//////// the server says how long is left before a round that has just started
+//////// is played, which counts down in the middle of the screen so no one has
+//////// to find out they cannot move yet, and LIVE flashes up once the play
+//////// message arrives
+
+const (
+	liveFlashTime     = time.Second
+	countdownFontSize = 40
+)
+
+var liveColour = rl.NewColor(0, 160, 60, 255)
+
+// written by the message receiver, read when drawing
+type countdown struct {
+	playsAt time.Time // zero unless counting down
+	liveAt  time.Time // when the round was last played
+	mutex   sync.Mutex
+}
+
+// the server says how long is left before the round is played
+func (countdown *countdown) set(left time.Duration) {
+	countdown.mutex.Lock()
+	defer countdown.mutex.Unlock()
+
+	countdown.playsAt = time.Now().Add(left)
+}
+
+// the round is being played
+func (countdown *countdown) live() {
+	countdown.mutex.Lock()
+	defer countdown.mutex.Unlock()
+
+	countdown.playsAt, countdown.liveAt = time.Time{}, time.Now()
+}
+
+func (countdown *countdown) get() (playsAt, liveAt time.Time) {
+	countdown.mutex.Lock()
+	defer countdown.mutex.Unlock()
+
+	return countdown.playsAt, countdown.liveAt
+}
+
+// the whole seconds left until the round is played, counting down to one,
+// then LIVE growing and fading out
+func (playerWorld *playerWorld) drawCountdown() {
+	playsAt, liveAt := playerWorld.countdown.get()
+	text, colour, size := "", rl.Black, float32(countdownFontSize)
+	switch {
+	case !playsAt.IsZero():
+		left := max(time.Until(playsAt), 0)
+		text = fmt.Sprint(max(int((left+time.Second-1)/time.Second), 1))
+	case !liveAt.IsZero() && time.Since(liveAt) < liveFlashTime:
+		since := float32(time.Since(liveAt)) / float32(liveFlashTime)
+		text, colour, size = "LIVE", rl.Fade(liveColour, 1-since), size*(1+since/2)
+	default:
+		return
+	}
+	width := rl.MeasureTextEx(playerWorld.font, text, size, 0).X
+	rl.DrawTextEx(playerWorld.font, text, rl.Vector2{X: centerX - width/2, Y: centerY - lineSpace*8 - size/2}, size, 0, colour)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math/rand/v2"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// taking damage
+//////// besides the red flash, being hit plays a pain sound and shakes the
+//////// camera for a moment, the edges of the screen redden the less health is
+//////// left, and a heartbeat loops while we are down to our last point
+
+const (
+	shakeTime     = 250 * time.Millisecond
+	shakeAngle    = 0.04 // the most the camera is knocked aside, in radians
+	lowHealth     = 1    // the heartbeat plays at this health or below
+	vignetteAlpha = 200  // at the edges, with one point of health left
+	vignetteDepth = 0.3  // of the screen's height, from each edge
+)
+
+var vignetteColour = rl.NewColor(160, 0, 0, 255)
+
+func (playerWorld *playerWorld) takeDamage() {
+	playerWorld.damagedAt = time.Now()
+	playerWorld.settings.setEffectVolume(playerWorld.painSound, 1)
+	rl.SetSoundPan(playerWorld.painSound, 0.5)
+	rl.PlaySound(playerWorld.painSound)
+}
+
+// the camera the world is drawn from, knocked aside less and less as the
+// shake wears off, without moving where we look
+func (playerWorld *playerWorld) shakenCamera() rl.Camera3D {
+	camera := playerWorld.camera
+	since := time.Since(playerWorld.damagedAt)
+	if since >= shakeTime {
+		return camera
+	}
+	strength := shakeAngle * float32(shakeTime-since) / float32(shakeTime)
+	forward := rl.Vector3Subtract(camera.Target, camera.Position)
+	forward = rl.Vector3RotateByAxisAngle(forward, camera.Up, strength*(rand.Float32()*2-1))
+	right := rl.Vector3CrossProduct(forward, camera.Up)
+	forward = rl.Vector3RotateByAxisAngle(forward, right, strength*(rand.Float32()*2-1))
+	camera.Target = rl.Vector3Add(camera.Position, forward)
+	return camera
+}
+
+func (playerWorld *playerWorld) hurt() bool {
+	return playerWorld.playerState == normal && !playerWorld.watching() && playerWorld.health < protocol.MaxHealth
+}
+
+// reddens the edges of the screen, more the less health is left
+func (playerWorld *playerWorld) drawVignette() {
+	if !playerWorld.hurt() || playerWorld.health <= 0 {
+		return
+	}
+	lost := float32(protocol.MaxHealth-playerWorld.health) / float32(protocol.MaxHealth-1)
+	edge := vignetteColour
+	edge.A = uint8(min(1, lost) * vignetteAlpha)
+	depth := int32(internalWindowHeight * vignetteDepth)
+	rl.DrawRectangleGradientV(0, 0, internalWindowWidth, depth, edge, rl.Blank)
+	rl.DrawRectangleGradientV(0, internalWindowHeight-depth, internalWindowWidth, depth, rl.Blank, edge)
+	rl.DrawRectangleGradientH(0, 0, depth, internalWindowHeight, edge, rl.Blank)
+	rl.DrawRectangleGradientH(internalWindowWidth-depth, 0, depth, internalWindowHeight, rl.Blank, edge)
+}
+
+// keep the heartbeat going while on low health, called each frame
+func (playerWorld *playerWorld) playHeartbeat() {
+	low := playerWorld.hurt() && 0 < playerWorld.health && playerWorld.health <= lowHealth
+	if !low {
+		if rl.IsSoundPlaying(playerWorld.heartbeatSound) {
+			rl.StopSound(playerWorld.heartbeatSound)
+		}
+		return
+	}
+	if !rl.IsSoundPlaying(playerWorld.heartbeatSound) {
+		playerWorld.settings.setEffectVolume(playerWorld.heartbeatSound, 1)
+		rl.PlaySound(playerWorld.heartbeatSound)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// datagrams
+//////// with -udp, the server is asked to send locations over UDP, where one
+//////// that is lost or late does not hold up those behind it, by saying hello
+//////// with our session token every so often; locations keep coming over the
+//////// websocket until the server hears us, and any that arrive after a later
+//////// one over UDP are dropped
+
+// one message from either the websocket or UDP
+type receivedMessage struct {
+	messageType int
+	message     []byte
+	err         error
+}
+
+// passes on messages from the websocket with locations from UDP mixed in
+type datagramReader struct {
+	conn      *net.UDPConn
+	received  chan receivedMessage
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newDatagramReader(messages messageReader, address string, token []byte) (*datagramReader, error) {
+	serverAddress, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, serverAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &datagramReader{
+		conn:     conn,
+		received: make(chan receivedMessage),
+		done:     make(chan struct{}),
+	}
+	go reader.readMessages(messages)
+	go reader.readDatagrams()
+	go reader.sayHello(token)
+	return reader, nil
+}
+
+func (reader *datagramReader) ReadMessage() (int, []byte, error) {
+	select {
+	case received := <-reader.received:
+		return received.messageType, received.message, received.err
+	case <-reader.done:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+// stop asking for and reading locations over UDP
+func (reader *datagramReader) Close() {
+	reader.closeOnce.Do(func() {
+		close(reader.done)
+		reader.conn.Close()
+	})
+}
+
+func (reader *datagramReader) pass(received receivedMessage) bool {
+	select {
+	case reader.received <- received:
+		return true
+	case <-reader.done:
+		return false
+	}
+}
+
+// the websocket cannot be read from again after an error, which is passed on
+func (reader *datagramReader) readMessages(messages messageReader) {
+	for {
+		messageType, message, err := messages.ReadMessage()
+		if !reader.pass(receivedMessage{messageType, message, err}) || err != nil {
+			return
+		}
+	}
+}
+
+func (reader *datagramReader) readDatagrams() {
+	buffer := make([]byte, protocol.MaxDatagramSize)
+	var latest protocol.Sequence
+	heard := false
+	for {
+		size, err := reader.conn.Read(buffer)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		// a server without UDP on refuses each hello, which shows up here
+		if err != nil {
+			continue
+		}
+		sequence, locations, err := protocol.DecodeLocationsDatagram(buffer[:size])
+		if err != nil {
+			slog.Warn("Bad datagram", "error", err)
+			continue
+		}
+		if heard && !sequence.After(latest) {
+			continue
+		}
+		latest, heard = sequence, true
+		if !reader.pass(receivedMessage{websocket.BinaryMessage, append([]byte(nil), locations...), nil}) {
+			return
+		}
+	}
+}
+
+// keep reminding the server where to send locations
+func (reader *datagramReader) sayHello(token []byte) {
+	ticker := time.NewTicker(protocol.DatagramHelloInterval)
+	defer ticker.Stop()
+
+	hello := protocol.EncodeHello(token)
+	for {
+		if _, err := reader.conn.Write(hello); err != nil && !errors.Is(err, net.ErrClosed) {
+			slog.Debug("Could not say hello", "error", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-reader.done:
+			return
+		}
+	}
+}
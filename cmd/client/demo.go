@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// demo
+//////// a recording of every message the server sent during a match, which
+//////// can be played back later to watch the match again
+////////
+//////// file layout: magic, version, player id, team, tick rate, team size,
+//////// map name length, map name, then for each message: milliseconds since recording started,
+//////// message length, message; numbers are big endian uint32s
+
+const demoVersion = 5
+
+var demoMagic = []byte("SHDM")
+
+// where messages from the server come from, the connection itself or a demo
+type messageReader interface {
+	ReadMessage() (messageType int, message []byte, err error)
+}
+
+// what a demo needs to know about the player who recorded it
+type demoHeader struct {
+	id int
+	protocol.Team
+	tickRate int
+	teamSize int
+	mapName  string
+}
+
+//////// recording
+
+// passes messages through from the connection, writing each one to the demo
+type demoRecorder struct {
+	messages messageReader
+	file     *os.File
+	writer   *bufio.Writer
+	start    time.Time
+	mutex    sync.Mutex
+}
+
+func newDemoRecorder(path string, messages messageReader, header demoHeader) (*demoRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer := bufio.NewWriter(file)
+	writer.Write(demoMagic)
+	writer.WriteByte(demoVersion)
+	writer.WriteByte(byte(header.id))
+	writer.WriteByte(byte(header.Team))
+	writer.WriteByte(byte(header.tickRate))
+	writer.WriteByte(byte(header.teamSize))
+	writer.WriteByte(byte(len(header.mapName)))
+	writer.WriteString(header.mapName)
+
+	return &demoRecorder{
+		messages: messages,
+		file:     file,
+		writer:   writer,
+		start:    time.Now(),
+	}, nil
+}
+
+func (recorder *demoRecorder) ReadMessage() (int, []byte, error) {
+	messageType, message, err := recorder.messages.ReadMessage()
+	if err != nil || messageType != websocket.BinaryMessage {
+		return messageType, message, err
+	}
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	if recorder.writer != nil {
+		binary.Write(recorder.writer, binary.BigEndian, uint32(time.Since(recorder.start).Milliseconds()))
+		binary.Write(recorder.writer, binary.BigEndian, uint32(len(message)))
+		recorder.writer.Write(message)
+	}
+	return messageType, message, nil
+}
+
+// finish writing the demo, later messages are no longer recorded
+func (recorder *demoRecorder) Close() error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	err := recorder.writer.Flush()
+	recorder.writer = nil
+	if closeErr := recorder.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+//////// playback
+
+// hands out the messages of a demo at the pace they were recorded
+type demoPlayer struct {
+	reader  *bufio.Reader
+	file    *os.File
+	start   time.Time
+	skipped time.Duration // time before the first round, which is not waited through
+	started bool
+}
+
+func openDemo(path string) (*demoPlayer, demoHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, demoHeader{}, err
+	}
+	reader := bufio.NewReader(file)
+
+	fixed := make([]byte, len(demoMagic)+6)
+	if _, err := io.ReadFull(reader, fixed); err != nil {
+		file.Close()
+		return nil, demoHeader{}, fmt.Errorf("Could not read demo header: %w", err)
+	}
+	if string(fixed[:len(demoMagic)]) != string(demoMagic) {
+		file.Close()
+		return nil, demoHeader{}, errors.New("Not a demo file")
+	}
+	fields := fixed[len(demoMagic):]
+	if fields[0] != demoVersion {
+		file.Close()
+		return nil, demoHeader{}, fmt.Errorf("Unsupported demo version %d", fields[0])
+	}
+	mapName := make([]byte, fields[5])
+	if _, err := io.ReadFull(reader, mapName); err != nil {
+		file.Close()
+		return nil, demoHeader{}, fmt.Errorf("Could not read demo header: %w", err)
+	}
+
+	header := demoHeader{id: int(fields[1]), Team: protocol.Team(fields[2]), tickRate: int(fields[3]), teamSize: int(fields[4]), mapName: string(mapName)}
+	if !protocol.ValidTeamSize(header.teamSize) {
+		file.Close()
+		return nil, demoHeader{}, errors.New("Invalid team size in demo header")
+	}
+	if !protocol.ValidId(header.id) || 2*header.teamSize <= header.id {
+		file.Close()
+		return nil, demoHeader{}, errors.New("Invalid player id in demo header")
+	}
+	if header.tickRate < 1 || protocol.MaxTickRate < header.tickRate {
+		file.Close()
+		return nil, demoHeader{}, errors.New("Invalid tick rate in demo header")
+	}
+	return &demoPlayer{reader: reader, file: file, start: time.Now()}, header, nil
+}
+
+// blocks until the next message is due, io.EOF once the demo is over
+func (player *demoPlayer) ReadMessage() (int, []byte, error) {
+	var timestamp, length uint32
+	if err := binary.Read(player.reader, binary.BigEndian, &timestamp); err != nil {
+		return 0, nil, err
+	}
+	if err := binary.Read(player.reader, binary.BigEndian, &length); err != nil {
+		return 0, nil, err
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(player.reader, message); err != nil {
+		return 0, nil, err
+	}
+
+	// nobody wants to watch the lobby fill up, so playing starts at the
+	// first round
+	recordedAt := time.Duration(timestamp) * time.Millisecond
+	if !player.started {
+		player.skipped = recordedAt - time.Since(player.start)
+		player.started = len(message) > 0 && protocol.MessageHeader(message[0]) == protocol.NextRoundHeader
+	}
+	time.Sleep(time.Until(player.start.Add(recordedAt - player.skipped)))
+	return websocket.BinaryMessage, message, nil
+}
+
+func (player *demoPlayer) Close() error {
+	return player.file.Close()
+}
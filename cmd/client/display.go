@@ -0,0 +1,114 @@
+package main
+
+import (
+	"math"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+//////// display
+//////// everything is drawn to a small render texture, which is scaled up to
+//////// fit a window, a borderless window or the full screen of a monitor
+
+const (
+	windowedDisplay   = "windowed"
+	borderlessDisplay = "borderless"
+	fullscreenDisplay = "fullscreen"
+)
+
+var (
+	displayModes = []string{windowedDisplay, borderlessDisplay, fullscreenDisplay}
+	fpsCaps      = []int32{30, 60, 120, 0} // 0 for no cap
+)
+
+// put the window on the configured monitor in the configured display mode
+func applyDisplay(config config) {
+	if rl.IsWindowFullscreen() {
+		rl.ToggleFullscreen()
+	}
+	if rl.IsWindowState(rl.FlagBorderlessWindowedMode) {
+		rl.ToggleBorderlessWindowed()
+	}
+
+	monitor := min(max(config.Monitor, 0), rl.GetMonitorCount()-1)
+	rl.SetWindowMonitor(monitor)
+	width, height := rl.GetMonitorWidth(monitor), rl.GetMonitorHeight(monitor)
+	switch config.Display {
+	case fullscreenDisplay:
+		rl.SetWindowSize(width, height)
+		rl.ToggleFullscreen()
+	case borderlessDisplay:
+		rl.ToggleBorderlessWindowed()
+	default:
+		// a whole multiple of the render texture that leaves room around it
+		scale := max(min(width/internalWindowWidth, height/internalWindowHeight)-1, 1)
+		windowWidth, windowHeight := internalWindowWidth*scale, internalWindowHeight*scale
+		position := rl.GetMonitorPosition(monitor)
+		rl.SetWindowSize(windowWidth, windowHeight)
+		rl.SetWindowPosition(int(position.X)+(width-windowWidth)/2, int(position.Y)+(height-windowHeight)/2)
+	}
+}
+
+// cap the frame rate, and wait for the monitor to draw each frame if asked
+func applyFrameRate(config config) {
+	rl.SetTargetFPS(config.FpsCap)
+	if config.Vsync {
+		rl.SetWindowState(rl.FlagVsyncHint)
+	} else {
+		rl.ClearWindowState(rl.FlagVsyncHint)
+	}
+}
+
+// draw a frame to the render texture, then scale it up to fit the window,
+// after reloading any resources that changed in developer mode and streaming
+// a little more of the music
+func drawFrame(resources *resources, settings *settings, draw func()) {
+	resources.files.reloadChanged()
+	resources.streamMusic(settings)
+	rl.BeginTextureMode(resources.renderTexture)
+	draw()
+	rl.EndTextureMode()
+
+	internalWindowRectangle := rl.Rectangle{
+		Width:  float32(resources.renderTexture.Texture.Width),
+		Height: float32(-resources.renderTexture.Texture.Height),
+	}
+	rl.BeginDrawing()
+	rl.ClearBackground(rl.Black)
+	// post processing can be turned off for weak graphics cards, or for those
+	// who find it uncomfortable
+	if settings.PostProcessing {
+		rl.BeginShaderMode(resources.chromaticAberration)
+	}
+	rl.DrawTexturePro(resources.renderTexture.Texture, internalWindowRectangle, calculateScreenRectangle(settings.IntegerScaling), rl.Vector2Zero(), 0, rl.White)
+	if settings.PostProcessing {
+		rl.EndShaderMode()
+	}
+	rl.EndDrawing()
+}
+
+// the biggest rectangle in the middle of the window the render texture fits,
+// only scaled by whole numbers if asked, so every pixel is the same size
+func calculateScreenRectangle(integerScaling bool) rl.Rectangle {
+	scale := min(float32(rl.GetScreenWidth())/internalWindowWidth, float32(rl.GetScreenHeight())/internalWindowHeight)
+	if integerScaling {
+		scale = max(float32(math.Floor(float64(scale))), 1)
+	}
+	rectangle := rl.Rectangle{
+		X:      (float32(rl.GetScreenWidth()) - float32(internalWindowWidth)*scale) * 0.5,
+		Y:      (float32(rl.GetScreenHeight()) - float32(internalWindowHeight)*scale) * 0.5,
+		Width:  internalWindowWidth * scale,
+		Height: internalWindowHeight * scale,
+	}
+	return rectangle
+}
+
+// where the mouse is on the render texture
+func internalMousePosition(integerScaling bool) rl.Vector2 {
+	screenRectangle := calculateScreenRectangle(integerScaling)
+	mouse := rl.GetMousePosition()
+	return rl.Vector2{
+		X: (mouse.X - screenRectangle.X) * internalWindowWidth / screenRectangle.Width,
+		Y: (mouse.Y - screenRectangle.Y) * internalWindowHeight / screenRectangle.Height,
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"sync"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// doors
+//////// the server decides which doors are open, we ask it to open or close
+//////// the one in front of us, and treat the closed ones as blocks
+
+var useKey int32 = rl.KeyE
+
+var openDoorColour = rl.NewColor(80, 60, 40, 255) // the outline left where an open door was
+
+// which of the current map's doors are open, the map's doors are only known
+// to the world
+type doors struct {
+	open  []bool // indexed like the current map's doors
+	mutex sync.Mutex
+}
+
+// every door goes back the way the map has it at the start of a round
+func (doors *doors) reset(mapDoors []maps.Door) {
+	doors.mutex.Lock()
+	defer doors.mutex.Unlock()
+
+	doors.open = make([]bool, len(mapDoors))
+	for door, mapDoor := range mapDoors {
+		doors.open[door] = mapDoor.Open
+	}
+}
+
+func (doors *doors) set(door int, open bool) {
+	doors.mutex.Lock()
+	defer doors.mutex.Unlock()
+
+	if door < len(doors.open) {
+		doors.open[door] = open
+	}
+}
+
+// the server tells us the whole lot when we join part way through
+func (doors *doors) setOpen(open []int) {
+	doors.mutex.Lock()
+	defer doors.mutex.Unlock()
+
+	clear(doors.open)
+	for _, door := range open {
+		if door < len(doors.open) {
+			doors.open[door] = true
+		}
+	}
+}
+
+func (doors *doors) isOpen(door int) bool {
+	doors.mutex.Lock()
+	defer doors.mutex.Unlock()
+
+	return door < len(doors.open) && doors.open[door]
+}
+
+// ask the server to open or close the door in front of us, it works out which
+func (playerWorld *playerWorld) useDoor() {
+	if !rl.IsKeyPressed(useKey) || len(playerWorld.doorBlocks) == 0 {
+		return
+	}
+	playerWorld.connMutex.Lock()
+	if err := writeMessage(playerWorld.conn, protocol.EncodeUse()); err != nil {
+		slog.Warn("Could not send message", "header", protocol.UseMessage, "error", err)
+	}
+	playerWorld.connMutex.Unlock()
+}
+
+func (playerWorld *playerWorld) closedDoors() []*block {
+	var closed []*block
+	for door, block := range playerWorld.doorBlocks {
+		if !playerWorld.doors.isOpen(door) {
+			closed = append(closed, block)
+		}
+	}
+	return closed
+}
+
+// how far along a ray the nearest closed door is, or infinity if it misses
+// them all
+func (playerWorld *playerWorld) closedDoorDistance(ray rl.Ray) float32 {
+	nearest := float32(math.Inf(1))
+	for _, block := range playerWorld.closedDoors() {
+		if collision := rl.GetRayCollisionBox(ray, block.boundingBox); collision.Hit {
+			nearest = min(nearest, collision.Distance)
+		}
+	}
+	return nearest
+}
+
+// what grenades bounce off, the map's blocks and whichever doors are closed
+func (playerWorld *playerWorld) solidMapBlocks() []maps.Block {
+	if len(playerWorld.mapDoors) == 0 {
+		return playerWorld.mapBlocks
+	}
+	blocks := append(make([]maps.Block, 0, len(playerWorld.mapBlocks)+len(playerWorld.mapDoors)), playerWorld.mapBlocks...)
+	for door, mapDoor := range playerWorld.mapDoors {
+		if !playerWorld.doors.isOpen(door) {
+			blocks = append(blocks, mapDoor.Block)
+		}
+	}
+	return blocks
+}
+
+// closed doors are drawn like blocks, open ones as an outline of the doorway
+func (playerWorld *playerWorld) drawDoors() {
+	for door, block := range playerWorld.doorBlocks {
+		if playerWorld.doors.isOpen(door) {
+			rl.DrawBoundingBox(block.boundingBox, openDoorColour)
+		} else {
+			block.draw(rl.White)
+		}
+	}
+}
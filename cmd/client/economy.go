@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// economy
+//////// the server keeps our money and decides what we may buy, we only ask
+
+var buyMenuKey int32 = rl.KeyB
+
+// keys buying each item while the buy menu is open, in the order of items
+var buyKeys = [protocol.Items]int32{rl.KeyOne, rl.KeyTwo, rl.KeyThree, rl.KeyFour, rl.KeyFive, rl.KeySix, rl.KeySeven, rl.KeyEight}
+
+// open or close the buy menu, and ask to buy whatever is picked from it
+func (playerWorld *playerWorld) updateBuyMenu() {
+	if !playerWorld.buyPhase {
+		playerWorld.buyMenuOpen = false
+		return
+	}
+	if rl.IsKeyPressed(buyMenuKey) {
+		playerWorld.buyMenuOpen = !playerWorld.buyMenuOpen
+	}
+	if !playerWorld.buyMenuOpen {
+		return
+	}
+
+	for item, key := range buyKeys {
+		if !rl.IsKeyPressed(key) {
+			continue
+		}
+		playerWorld.connMutex.Lock()
+		if err := writeMessage(playerWorld.conn, protocol.EncodeBuy(protocol.Item(item))); err != nil {
+			slog.Warn("Could not send message", "header", protocol.BuyMessage, "error", err)
+		}
+		playerWorld.connMutex.Unlock()
+	}
+}
+
+// take on what the server says we have
+func (playerWorld *playerWorld) applyInventory(inventory protocol.Inventory) {
+	playerWorld.money = inventory.Money
+	playerWorld.armor = inventory.Armor
+	playerWorld.grenadesLeft = inventory.Grenades
+	playerWorld.setPrimary(inventory.Primary)
+}
+
+func (playerWorld *playerWorld) drawBuyMenu() {
+	if !playerWorld.buyPhase {
+		return
+	}
+	if !playerWorld.buyMenuOpen {
+		rl.DrawTextEx(playerWorld.font, "B::BUY", rl.Vector2{X: textXLocation, Y: textYLocation}, fontSize, 0, rl.Black)
+		return
+	}
+
+	for i := range int(protocol.Items) {
+		item := protocol.Item(i)
+		marker := " "
+		if item == playerWorld.primary {
+			marker = ">"
+		}
+		colour := rl.Black
+		if playerWorld.money < protocol.Prices[item] {
+			colour = rl.Gray
+		}
+		rl.DrawTextEx(playerWorld.font, fmt.Sprintf("%s%d::%-13s $%d", marker, i+1, item, protocol.Prices[item]), rl.Vector2{X: textXLocation, Y: textYLocation + float32(lineSpace*i)}, fontSize, 0, colour)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/grenade"
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// grenades
+//////// grenades are stepped along by the client the same way the server does
+//////// it, and put back in line with the server whenever they bounce
+
+const (
+	explosionDuration  = 400 * time.Millisecond
+	explosionSmokeTime = 500 * time.Millisecond // how long an explosion keeps throwing out smoke
+
+	smokePuffs = 14
+
+	// looking this close to straight at a flashbang blinds completely,
+	// otherwise it only dazzles
+	flashViewCosine      = 0.5
+	flashGlanceIntensity = 0.2
+)
+
+var (
+	grenadeKeys    = [protocol.GrenadeKinds]int32{protocol.Frag: rl.KeyG, protocol.Smoke: rl.KeyC, protocol.Flash: rl.KeyF}
+	grenadeColours = [protocol.GrenadeKinds]rl.Color{protocol.Frag: rl.DarkGreen, protocol.Smoke: rl.Gray, protocol.Flash: rl.LightGray}
+
+	// what is left of an explosion once the fireball is gone, see particles.go
+	fireEmitter = emitter{
+		burst:    12,
+		lifetime: 300 * time.Millisecond,
+		speed:    6,
+		spread:   1,
+		drag:     3,
+		size:     0.6,
+		endSize:  0.2,
+		colour:   rl.Orange,
+		look:     glowParticle,
+		blend:    rl.BlendAdditive,
+	}
+	debrisEmitter = emitter{
+		burst:    16,
+		lifetime: time.Second,
+		speed:    8,
+		spread:   1,
+		gravity:  -9,
+		size:     0.06,
+		endSize:  0.06,
+		colour:   rl.DarkGray,
+	}
+	explosionSmokeEmitter = emitter{
+		rate:     30,
+		lifetime: 1500 * time.Millisecond,
+		speed:    1,
+		spread:   1,
+		gravity:  0.5,
+		drag:     1,
+		size:     0.5,
+		endSize:  1.5,
+		colour:   rl.Gray,
+		look:     smokeParticle,
+	}
+)
+
+// written by the message receiver, stepped and drawn on the main thread
+type thrownGrenades struct {
+	flying     map[byte]*flyingGrenade
+	explosions []explosion
+	smokes     []smokeCloud // oldest first
+	flashedAt  time.Time
+	flash      float32 // how blinded we were by the last flashbang, 0 to 1
+	mutex      sync.Mutex
+}
+
+type flyingGrenade struct {
+	grenade.Grenade
+	kind      protocol.GrenadeKind
+	sinceStep float32 // seconds since it was last stepped
+}
+
+type explosion struct {
+	position rl.Vector3
+	at       time.Time
+}
+
+type smokeCloud struct {
+	position rl.Vector3
+	at       time.Time
+	puffs    [smokePuffs]rl.Vector3 // where each billboard sits in a cloud of radius 1
+}
+
+// someone threw a grenade
+func (thrownGrenades *thrownGrenades) throw(kind protocol.GrenadeKind, state protocol.GrenadeState) {
+	thrownGrenades.mutex.Lock()
+	defer thrownGrenades.mutex.Unlock()
+
+	if thrownGrenades.flying == nil {
+		thrownGrenades.flying = make(map[byte]*flyingGrenade)
+	}
+	thrownGrenades.flying[state.Id] = &flyingGrenade{Grenade: grenade.FromState(state), kind: kind}
+}
+
+// a grenade bounced and the server says where it is now
+func (thrownGrenades *thrownGrenades) bounce(state protocol.GrenadeState) {
+	thrownGrenades.mutex.Lock()
+	defer thrownGrenades.mutex.Unlock()
+
+	if flying, ok := thrownGrenades.flying[state.Id]; ok {
+		flying.Grenade = grenade.FromState(state)
+		flying.sinceStep = 0
+	}
+}
+
+func (thrownGrenades *thrownGrenades) explode(id byte, position rl.Vector3) {
+	thrownGrenades.mutex.Lock()
+	defer thrownGrenades.mutex.Unlock()
+
+	delete(thrownGrenades.flying, id)
+	thrownGrenades.explosions = append(thrownGrenades.explosions, explosion{position: position, at: time.Now()})
+}
+
+// fire, debris and a plume of smoke thrown out by an explosion
+func (playerWorld *playerWorld) explosionParticles(position rl.Vector3) {
+	up := rl.Vector3{Y: 1}
+	playerWorld.particles.burst(&fireEmitter, position, up)
+	playerWorld.particles.burst(&debrisEmitter, position, up)
+	playerWorld.particles.stream(&explosionSmokeEmitter, position, up, explosionSmokeTime)
+}
+
+func (thrownGrenades *thrownGrenades) smoke(id byte, position rl.Vector3) {
+	thrownGrenades.mutex.Lock()
+	defer thrownGrenades.mutex.Unlock()
+
+	delete(thrownGrenades.flying, id)
+	cloud := smokeCloud{position: position, at: time.Now()}
+	for i := range cloud.puffs {
+		cloud.puffs[i] = rl.Vector3{X: rand.Float32()*2 - 1, Y: rand.Float32() * 0.8, Z: rand.Float32()*2 - 1}
+	}
+	thrownGrenades.smokes = append(thrownGrenades.smokes, cloud)
+}
+
+func (thrownGrenades *thrownGrenades) blind(id byte, intensity float32) {
+	thrownGrenades.mutex.Lock()
+	defer thrownGrenades.mutex.Unlock()
+
+	delete(thrownGrenades.flying, id)
+	if intensity > thrownGrenades.currentFlash() {
+		thrownGrenades.flash = intensity
+		thrownGrenades.flashedAt = time.Now()
+	}
+}
+
+// how blinded we still are, the mutex must be held
+func (thrownGrenades *thrownGrenades) currentFlash() float32 {
+	return thrownGrenades.flash * max(0, 1-float32(time.Since(thrownGrenades.flashedAt))/float32(grenade.FlashDuration))
+}
+
+// grenades still in the air when a round ends are duds, and the air clears
+func (thrownGrenades *thrownGrenades) clear() {
+	thrownGrenades.mutex.Lock()
+	defer thrownGrenades.mutex.Unlock()
+
+	clear(thrownGrenades.flying)
+	thrownGrenades.explosions = nil
+	thrownGrenades.smokes = nil
+	thrownGrenades.flash = 0
+}
+
+// whether a smoke cloud hides one point from another
+func (thrownGrenades *thrownGrenades) hides(from, to rl.Vector3) bool {
+	thrownGrenades.mutex.Lock()
+	defer thrownGrenades.mutex.Unlock()
+
+	for _, cloud := range thrownGrenades.smokes {
+		radius := grenade.SmokeCloudRadius(time.Since(cloud.at))
+		if grenade.SmokeBlocks(vectorToMap(cloud.position), radius, vectorToMap(from), vectorToMap(to)) {
+			return true
+		}
+	}
+	return false
+}
+
+// move each grenade on by however many ticks fit in the last frame
+func (thrownGrenades *thrownGrenades) step(blocks []maps.Block, deltaTime float32) {
+	thrownGrenades.mutex.Lock()
+	defer thrownGrenades.mutex.Unlock()
+
+	for _, flying := range thrownGrenades.flying {
+		flying.sinceStep += deltaTime
+		for flying.sinceStep >= 1.0/grenade.TickRate {
+			flying.Step(blocks)
+			flying.sinceStep -= 1.0 / grenade.TickRate
+		}
+	}
+
+	for len(thrownGrenades.explosions) > 0 && time.Since(thrownGrenades.explosions[0].at) > explosionDuration {
+		thrownGrenades.explosions = thrownGrenades.explosions[1:]
+	}
+	for len(thrownGrenades.smokes) > 0 && time.Since(thrownGrenades.smokes[0].at) > grenade.SmokeDuration {
+		thrownGrenades.smokes = thrownGrenades.smokes[1:]
+	}
+}
+
+// must be called in 3D mode
+func (thrownGrenades *thrownGrenades) draw(camera rl.Camera, smokeTexture rl.Texture2D) {
+	thrownGrenades.mutex.Lock()
+	defer thrownGrenades.mutex.Unlock()
+
+	for _, flying := range thrownGrenades.flying {
+		rl.DrawSphere(mapVector(flying.Position), grenade.Radius, grenadeColours[flying.kind])
+	}
+
+	// a fireball grows out to the edge of the blast and fades away
+	for _, explosion := range thrownGrenades.explosions {
+		progress := float32(time.Since(explosion.at)) / float32(explosionDuration)
+		rl.DrawSphere(explosion.position, grenade.ExplosionRadius*progress, rl.Fade(rl.Orange, 1-progress))
+	}
+
+	// puffs of smoke are drawn furthest first, so the nearer ones cover them
+	var puffs []rl.Vector3
+	var sizes []float32
+	for _, cloud := range thrownGrenades.smokes {
+		radius := grenade.SmokeCloudRadius(time.Since(cloud.at))
+		for _, puff := range cloud.puffs {
+			puffs = append(puffs, rl.Vector3Add(cloud.position, rl.Vector3Scale(puff, radius)))
+			sizes = append(sizes, radius*1.5)
+		}
+	}
+	order := make([]int, len(puffs))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int {
+		distanceA, distanceB := rl.Vector3Distance(camera.Position, puffs[a]), rl.Vector3Distance(camera.Position, puffs[b])
+		switch {
+		case distanceA > distanceB:
+			return -1
+		case distanceA < distanceB:
+			return 1
+		}
+		return 0
+	})
+	for _, i := range order {
+		rl.DrawBillboard(camera, smokeTexture, puffs[i], sizes[i], rl.White)
+	}
+}
+
+// white out the screen while blinded by a flashbang
+func (thrownGrenades *thrownGrenades) drawFlash() {
+	thrownGrenades.mutex.Lock()
+	defer thrownGrenades.mutex.Unlock()
+
+	if flash := thrownGrenades.currentFlash(); flash > 0 {
+		rl.DrawRectangle(0, 0, internalWindowWidth, internalWindowHeight, rl.Fade(rl.White, flash))
+	}
+}
+
+// how badly a flashbang going off blinds us, worst when we are close and
+// looking right at it, not at all when it is out of sight
+func (playerWorld *playerWorld) flashIntensity(location rl.Vector3) float32 {
+	distance := rl.Vector3Distance(playerWorld.camera.Position, location)
+	if distance >= grenade.FlashRange || !playerWorld.canSee(location) {
+		return 0
+	}
+	intensity := 1 - distance/grenade.FlashRange
+
+	forward := rl.Vector3Normalize(rl.Vector3Subtract(playerWorld.camera.Target, playerWorld.camera.Position))
+	toFlash := rl.Vector3Normalize(rl.Vector3Subtract(location, playerWorld.camera.Position))
+	if rl.Vector3DotProduct(forward, toFlash) < flashViewCosine {
+		intensity *= flashGlanceIntensity
+	}
+	return intensity
+}
+
+// throw a grenade the way we are looking if its key was pressed, the server
+// decides where it goes; reports whether one was thrown
+func (playerWorld *playerWorld) throwGrenade() bool {
+	for kind, key := range grenadeKeys {
+		if !rl.IsKeyPressed(key) || playerWorld.grenadesLeft[kind] < 1 {
+			continue
+		}
+		playerWorld.grenadesLeft[kind]--
+
+		direction := rl.Vector3Scale(rl.Vector3Normalize(rl.Vector3Subtract(playerWorld.camera.Target, playerWorld.camera.Position)), 127)
+		playerWorld.connMutex.Lock()
+		if err := writeMessage(playerWorld.conn, protocol.EncodeThrow(protocol.GrenadeKind(kind), int8(direction.X), int8(direction.Y), int8(direction.Z))); err != nil {
+			slog.Warn("Could not send message", "header", protocol.ThrowMessage, "error", err)
+		}
+		playerWorld.connMutex.Unlock()
+		return true
+	}
+	return false
+}
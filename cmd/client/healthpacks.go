@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+//////// health packs
+//////// the server decides who gets each health pack, we only show which
+//////// ones are still there
+
+const (
+	healthPackSize      = 0.5
+	healthPackCrossSize = 0.16
+	healthPackBob       = 0.1 // how far health packs float up and down
+	healedDisplayTime   = time.Second
+)
+
+// the health packs of the current map that somebody has taken, the map's
+// health packs are only known to the world
+type healthPacks struct {
+	taken map[int]bool
+	mutex sync.Mutex
+}
+
+func (healthPacks *healthPacks) take(pack int) {
+	healthPacks.mutex.Lock()
+	defer healthPacks.mutex.Unlock()
+
+	if healthPacks.taken == nil {
+		healthPacks.taken = make(map[int]bool)
+	}
+	healthPacks.taken[pack] = true
+}
+
+// the server tells us the whole lot when one comes back
+func (healthPacks *healthPacks) setTaken(taken []int) {
+	healthPacks.mutex.Lock()
+	defer healthPacks.mutex.Unlock()
+
+	healthPacks.taken = make(map[int]bool, len(taken))
+	for _, pack := range taken {
+		healthPacks.taken[pack] = true
+	}
+}
+
+// every health pack is back at the start of a round
+func (healthPacks *healthPacks) clear() {
+	healthPacks.mutex.Lock()
+	defer healthPacks.mutex.Unlock()
+
+	healthPacks.taken = nil
+}
+
+// a white box with a red cross on each side
+func (playerWorld *playerWorld) drawHealthPacks() {
+	playerWorld.healthPacks.mutex.Lock()
+	defer playerWorld.healthPacks.mutex.Unlock()
+
+	bob := healthPackBob * float32(math.Sin(rl.GetTime()*2))
+	for pack, position := range playerWorld.healthPackLocations {
+		if playerWorld.healthPacks.taken[pack] {
+			continue
+		}
+		centre := rl.Vector3Add(position, rl.Vector3{Y: healthPackSize + bob})
+		rl.DrawCube(centre, healthPackSize, healthPackSize, healthPackSize, rl.White)
+		rl.DrawCube(centre, healthPackSize+0.01, healthPackCrossSize, healthPackSize+0.01, rl.Red)
+		rl.DrawCube(centre, healthPackCrossSize, healthPackSize+0.01, healthPackSize+0.01, rl.Red)
+		rl.DrawCube(centre, healthPackSize+0.01, healthPackSize+0.01, healthPackCrossSize, rl.Red)
+	}
+}
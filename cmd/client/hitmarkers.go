@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// hit feedback
+//////// once the server confirms a hit, a hitmarker shows around the crosshair
+//////// and the damage done floats up from where the shot landed, gold for a
+//////// headshot and red and bigger for a kill
+
+const (
+	hitmarkerTime       = 200 * time.Millisecond
+	hitmarkerGap        = 4 // from the middle of the crosshair to the marker's lines
+	hitmarkerLength     = 4
+	killHitmarkerLength = 6
+	hitmarkerLineWidth  = 1.5
+	damageNumberTime    = 800 * time.Millisecond
+	damageNumberRise    = 0.6 // how far a number floats up over its time, in units
+	killNumberFontSize  = 16
+	maxDamageNumbers    = 16
+)
+
+var headshotColour = rl.NewColor(230, 170, 0, 255)
+
+// how a confirmed hit is shown
+type hitKind int
+
+const (
+	bodyHit hitKind = iota
+	headHit
+	killHit
+)
+
+func (kind hitKind) colour() rl.Color {
+	switch kind {
+	case headHit:
+		return headshotColour
+	case killHit:
+		return rl.Red
+	}
+	return rl.Black
+}
+
+type damageNumber struct {
+	point  rl.Vector3
+	damage int
+	kind   hitKind
+	at     time.Time
+}
+
+type hitFeedback struct {
+	aimedAt    [protocol.MaxPlayers]rl.Vector3 // where our latest shot at each player landed, until the server answers
+	numbers    []damageNumber
+	markedAt   time.Time
+	markerKind hitKind
+	mutex      sync.Mutex
+}
+
+// remember where a shot at a player landed, for its damage to float up from
+func (feedback *hitFeedback) aim(id int, point rl.Vector3) {
+	feedback.mutex.Lock()
+	defer feedback.mutex.Unlock()
+
+	feedback.aimedAt[id] = point
+}
+
+func (feedback *hitFeedback) confirm(confirmation protocol.HitConfirmation) {
+	feedback.mutex.Lock()
+	defer feedback.mutex.Unlock()
+
+	kind := bodyHit
+	switch {
+	case confirmation.Health == 0:
+		kind = killHit
+	case confirmation.Headshot:
+		kind = headHit
+	}
+	now := time.Now()
+	feedback.markedAt, feedback.markerKind = now, kind
+	if len(feedback.numbers) == maxDamageNumbers {
+		feedback.numbers = feedback.numbers[1:]
+	}
+	feedback.numbers = append(feedback.numbers, damageNumber{point: feedback.aimedAt[confirmation.PlayerId], damage: confirmation.Damage, kind: kind, at: now})
+}
+
+// the marker around the crosshair and the numbers floating up, called
+// between the 3D world and the HUD
+func (playerWorld *playerWorld) drawHitFeedback() {
+	feedback := &playerWorld.hitFeedback
+	feedback.mutex.Lock()
+	defer feedback.mutex.Unlock()
+
+	now := time.Now()
+	forward := rl.Vector3Subtract(playerWorld.camera.Target, playerWorld.camera.Position)
+	live := feedback.numbers[:0]
+	for _, number := range feedback.numbers {
+		age := now.Sub(number.at)
+		if age >= damageNumberTime {
+			continue
+		}
+		live = append(live, number)
+		progress := float32(age) / float32(damageNumberTime)
+		point := rl.Vector3Add(number.point, rl.Vector3{Y: damageNumberRise * progress})
+		if rl.Vector3DotProduct(forward, rl.Vector3Subtract(point, playerWorld.camera.Position)) <= 0 {
+			continue
+		}
+		size := float32(scoreboardFontSize)
+		if number.kind == killHit {
+			size = killNumberFontSize
+		}
+		text := strconv.Itoa(number.damage)
+		screenPosition := rl.GetWorldToScreenEx(point, playerWorld.camera, internalWindowWidth, internalWindowHeight)
+		width := rl.MeasureTextEx(playerWorld.font, text, size, 0).X
+		rl.DrawTextEx(playerWorld.font, text, rl.Vector2{X: screenPosition.X - width/2, Y: screenPosition.Y}, size, 0, rl.Fade(number.kind.colour(), 1-progress))
+	}
+	feedback.numbers = live
+
+	if now.Sub(feedback.markedAt) >= hitmarkerTime {
+		return
+	}
+	length := float32(hitmarkerLength)
+	if feedback.markerKind == killHit {
+		length = killHitmarkerLength
+	}
+	colour := feedback.markerKind.colour()
+	for _, corner := range []rl.Vector2{{X: -1, Y: -1}, {X: 1, Y: -1}, {X: -1, Y: 1}, {X: 1, Y: 1}} {
+		start := rl.Vector2{X: crosshairXLocation + corner.X*hitmarkerGap, Y: crosshairYLocation + corner.Y*hitmarkerGap}
+		end := rl.Vector2Add(start, rl.Vector2Scale(corner, length))
+		rl.DrawLineEx(start, end, hitmarkerLineWidth, colour)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+//////// impacts
+//////// shots that strike a block throw up sparks and dust where they land, see
+//////// particles.go, and leave a bullet hole on its face for a while; how many
+//////// holes there can be at once is the impacts setting, the oldest making way
+//////// for the newest, so busy fights cost no more to draw than quiet ones
+
+const (
+	decalTime = 10 * time.Second
+	decalSize = 0.08
+	decalLift = 0.005 // off the face, so it is drawn over it
+)
+
+var (
+	decalColour = rl.NewColor(30, 30, 30, 255)
+	impactPools = []int{0, 32, 128, 512} // 0 for no impacts
+
+	sparkEmitter = emitter{
+		burst:    4,
+		lifetime: 300 * time.Millisecond,
+		speed:    3,
+		spread:   1,
+		gravity:  -9,
+		size:     0.02,
+		endSize:  0.02,
+		colour:   rl.NewColor(255, 200, 80, 255),
+		blend:    rl.BlendAdditive,
+	}
+	dustEmitter = emitter{
+		burst:    3,
+		lifetime: 700 * time.Millisecond,
+		speed:    0.6,
+		spread:   1,
+		gravity:  -2,
+		drag:     1,
+		size:     0.05,
+		endSize:  0.1,
+		colour:   rl.NewColor(120, 110, 100, 255),
+	}
+)
+
+type decal struct {
+	position, normal rl.Vector3
+	at               time.Time
+}
+
+type impacts struct {
+	decals []decal
+	mutex  sync.Mutex
+}
+
+// sparks and dust off a face, and a hole in it if it stays where it is
+func (playerWorld *playerWorld) impact(point, normal rl.Vector3, hole bool) {
+	playerWorld.particles.burst(&sparkEmitter, point, normal)
+	playerWorld.particles.burst(&dustEmitter, point, normal)
+	if hole {
+		playerWorld.impacts.add(point, normal, playerWorld.settings.Impacts)
+	}
+}
+
+func (impacts *impacts) add(point, normal rl.Vector3, pool int) {
+	impacts.mutex.Lock()
+	defer impacts.mutex.Unlock()
+
+	if pool == 0 {
+		return
+	}
+	impacts.decals = append(impacts.decals, decal{position: rl.Vector3Add(point, rl.Vector3Scale(normal, decalLift)), normal: normal, at: time.Now()})
+	if over := len(impacts.decals) - pool; over > 0 {
+		impacts.decals = impacts.decals[over:]
+	}
+}
+
+// let the old holes go, called each frame
+func (impacts *impacts) step() {
+	impacts.mutex.Lock()
+	defer impacts.mutex.Unlock()
+
+	now := time.Now()
+	first := 0
+	for first < len(impacts.decals) && now.Sub(impacts.decals[first].at) >= decalTime {
+		first++
+	}
+	impacts.decals = impacts.decals[first:]
+}
+
+func (impacts *impacts) clear() {
+	impacts.mutex.Lock()
+	defer impacts.mutex.Unlock()
+
+	impacts.decals = nil
+}
+
+// in 3D mode, the holes flat against the faces they are on, which are all
+// square to the axes
+func (impacts *impacts) draw() {
+	impacts.mutex.Lock()
+	defer impacts.mutex.Unlock()
+
+	now := time.Now()
+	for _, decal := range impacts.decals {
+		size := rl.Vector3{X: decalSize, Y: decalSize, Z: decalSize}
+		switch {
+		case decal.normal.X != 0:
+			size.X = 0
+		case decal.normal.Y != 0:
+			size.Y = 0
+		default:
+			size.Z = 0
+		}
+		// fading over the last fifth of their time
+		fade := min(1, 5*(1-float32(now.Sub(decal.at))/float32(decalTime)))
+		rl.DrawCubeV(decal.position, size, rl.Fade(decalColour, fade))
+	}
+}
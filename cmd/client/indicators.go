@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+//////// sound indicators
+//////// for those who cannot hear them, gunshots and footsteps are shown as
+//////// arrows at the edge of the screen pointing the way they came from
+
+type soundKind int
+
+const (
+	gunshotSound soundKind = iota
+	footstepSound
+)
+
+const (
+	indicatorEdge             = 15 // how far in from the edge of the screen the arrows are
+	indicatorSize             = 6
+	minIndicatorFade          = 0.3 // far away sounds are faint but still seen
+	gunshotIndicatorDuration  = time.Second
+	footstepIndicatorDuration = 500 * time.Millisecond
+	maxSoundIndicators        = 16
+)
+
+var (
+	indicatorDurations = [...]time.Duration{gunshotSound: gunshotIndicatorDuration, footstepSound: footstepIndicatorDuration}
+	indicatorColours   = [...]rl.Color{gunshotSound: rl.Red, footstepSound: rl.DarkGray}
+)
+
+type soundIndicator struct {
+	kind     soundKind
+	location rl.Vector3
+	loudness float32 // 0 to 1, like the volume the sound is played at
+	at       time.Time
+}
+
+// written by the message receiver and the main thread, read when drawing
+type soundIndicators struct {
+	indicators []soundIndicator // oldest first
+	mutex      sync.Mutex
+}
+
+func (soundIndicators *soundIndicators) add(kind soundKind, location rl.Vector3, loudness float32) {
+	soundIndicators.mutex.Lock()
+	defer soundIndicators.mutex.Unlock()
+
+	soundIndicators.indicators = append(soundIndicators.indicators, soundIndicator{kind: kind, location: location, loudness: loudness, at: time.Now()})
+	if len(soundIndicators.indicators) > maxSoundIndicators {
+		soundIndicators.indicators = soundIndicators.indicators[len(soundIndicators.indicators)-maxSoundIndicators:]
+	}
+}
+
+// an arrow for each sound heard lately, around the middle of the screen in the
+// direction the sound came from, straight up being in front of us
+func (soundIndicators *soundIndicators) draw(camera *rl.Camera) {
+	soundIndicators.mutex.Lock()
+	defer soundIndicators.mutex.Unlock()
+
+	// drop the sounds that have been shown long enough
+	soundIndicators.indicators = slices.DeleteFunc(soundIndicators.indicators, func(indicator soundIndicator) bool {
+		return time.Since(indicator.at) > indicatorDurations[indicator.kind]
+	})
+
+	forward := rl.GetCameraForward(camera)
+	forward.Y = 0
+	forward = rl.Vector3Normalize(forward)
+	right := rl.GetCameraRight(camera)
+	for _, indicator := range soundIndicators.indicators {
+		toSound := rl.Vector3Subtract(indicator.location, camera.Position)
+		toSound.Y = 0
+		if rl.Vector3Length(toSound) == 0 {
+			continue
+		}
+		angle := math.Atan2(float64(rl.Vector3DotProduct(toSound, right)), float64(rl.Vector3DotProduct(toSound, forward)))
+		direction := rl.Vector2{X: float32(math.Sin(angle)), Y: float32(-math.Cos(angle))}
+
+		tip := rl.Vector2{
+			X: centerX + direction.X*(centerX-indicatorEdge),
+			Y: centerY + direction.Y*(centerY-indicatorEdge),
+		}
+		across := rl.Vector2{X: -direction.Y * indicatorSize / 2, Y: direction.X * indicatorSize / 2}
+		back := rl.Vector2Subtract(tip, rl.Vector2Scale(direction, indicatorSize))
+
+		age := float32(time.Since(indicator.at)) / float32(indicatorDurations[indicator.kind])
+		colour := rl.Fade(indicatorColours[indicator.kind], (1-age)*max(indicator.loudness, minIndicatorFade))
+		rl.DrawTriangle(tip, rl.Vector2Subtract(back, across), rl.Vector2Add(back, across), colour)
+	}
+}
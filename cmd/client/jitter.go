@@ -0,0 +1,72 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+//////// jitter buffer
+//////// other players are drawn a little in the past, so there is usually a
+//////// newer location to move them towards; the less evenly locations
+//////// arrive, the further back that has to be for them not to stutter, so
+//////// the delay follows the jitter measured between arrivals, growing
+//////// quickly when updates turn uneven and shrinking slowly once they settle
+
+const (
+	// each arrival moves the jitter this fraction of the way to its deviation
+	jitterSmoothing = 16
+	// the delay is an update interval, plus this many times the jitter
+	jitterMargin   = 3
+	maxJitterDelay = 250 * time.Millisecond
+	// longer gaps between arrivals are the server pausing, between rounds or
+	// maps, rather than jitter
+	maxArrivalGap = time.Second
+	// how far the delay goes towards where it should be with each arrival
+	bufferGrowRate   = 0.25
+	bufferShrinkRate = 0.02
+)
+
+type jitterBuffer struct {
+	interval    time.Duration // between updates, if they all arrived on time
+	lastArrival time.Time
+	jitter      time.Duration // how far the time between arrivals is from the interval, on average
+	delay       time.Duration // how far in the past other players are drawn
+	mutex       sync.Mutex
+}
+
+func newJitterBuffer(interval time.Duration) *jitterBuffer {
+	return &jitterBuffer{interval: interval, delay: interval * 3 / 2}
+}
+
+// a location update arrived
+func (buffer *jitterBuffer) arrived(at time.Time) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	gap := at.Sub(buffer.lastArrival)
+	buffer.lastArrival = at
+	if gap > maxArrivalGap {
+		return
+	}
+	buffer.jitter += ((gap - buffer.interval).Abs() - buffer.jitter) / jitterSmoothing
+
+	// players jump back when the delay grows, and speed up when it shrinks,
+	// so it is eased towards where it should be rather than set
+	target := buffer.interval + min(jitterMargin*buffer.jitter, maxJitterDelay)
+	rate := bufferShrinkRate
+	if target > buffer.delay {
+		rate = bufferGrowRate
+	}
+	buffer.delay += time.Duration(float64(target-buffer.delay) * rate)
+}
+
+func (buffer *jitterBuffer) stats() (jitter, delay time.Duration) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return buffer.jitter, buffer.delay
+}
+
+func (buffer *jitterBuffer) currentDelay() time.Duration {
+	_, delay := buffer.stats()
+	return delay
+}
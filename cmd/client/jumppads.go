@@ -0,0 +1,85 @@
+package main
+
+import (
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/maps"
+)
+
+//////// jump pads and teleporters
+//////// we launch ourselves off a jump pad the moment we step onto it, like
+//////// the server will; teleporters are left to the server, which moves us
+//////// and corrects where we think we are
+
+var (
+	jumpPadColour    = rl.NewColor(240, 200, 40, 120)
+	teleporterColour = rl.NewColor(140, 60, 220, 120)
+)
+
+// launch off a jump pad we have just stepped onto
+func (playerWorld *playerWorld) launchFromJumpPads() {
+	box := playerWorld.boundingBox
+	feet := maps.Vector3{(box.Min.X + box.Max.X) / 2, box.Min.Y, (box.Min.Z + box.Max.Z) / 2}
+
+	onJumpPad := false
+	for _, jumpPad := range playerWorld.jumpPads {
+		if !jumpPad.Contains(feet) {
+			continue
+		}
+		onJumpPad = true
+		if !playerWorld.onJumpPad {
+			playerWorld.velocity = mapVector(jumpPad.Launch)
+		}
+		break
+	}
+	playerWorld.onJumpPad = onJumpPad
+}
+
+// someone else was launched off a jump pad, which can be heard nearby like
+// their footsteps
+func (playerWorld *playerWorld) otherPlayerLaunched(id, pad int) {
+	if pad >= len(playerWorld.jumpPads) {
+		return
+	}
+	location := mapVector(volumeCentre(playerWorld.jumpPads[pad].Volume))
+	distance := rl.Vector3Distance(playerWorld.camera.Position, location)
+	if distance >= footstepRange {
+		return
+	}
+	sound := playerWorld.footstepSounds[id]
+	playerWorld.settings.setEffectVolume(sound, 1-distance/footstepRange)
+	rl.SetSoundPan(sound, playerWorld.panTowards(location))
+	rl.PlaySound(sound)
+	playerWorld.soundIndicators.add(footstepSound, location, 1-distance/footstepRange)
+}
+
+// someone else went through a teleporter, so they are shown where it leads as
+// soon as an update has them there, rather than sliding across the map
+func (playerWorld *playerWorld) otherPlayerTeleported(id, teleporter int) {
+	if teleporter >= len(playerWorld.teleporters) {
+		return
+	}
+	arrival := mapVector(playerWorld.teleporters[teleporter].To)
+	playerWorld.otherPlayers[id].arrival = &arrival
+}
+
+func (playerWorld *playerWorld) drawJumpPads() {
+	for _, jumpPad := range playerWorld.jumpPads {
+		drawVolume(jumpPad.Volume, jumpPadColour)
+	}
+	for _, teleporter := range playerWorld.teleporters {
+		drawVolume(teleporter.Volume, teleporterColour)
+	}
+}
+
+func drawVolume(volume maps.Volume, colour rl.Color) {
+	size := rl.Vector3Subtract(mapVector(volume.Max), mapVector(volume.Min))
+	rl.DrawCubeV(mapVector(volumeCentre(volume)), size, colour)
+}
+
+func volumeCentre(volume maps.Volume) maps.Vector3 {
+	return maps.Vector3{
+		(volume.Min[0] + volume.Max[0]) / 2,
+		(volume.Min[1] + volume.Max[1]) / 2,
+		(volume.Min[2] + volume.Max[2]) / 2,
+	}
+}
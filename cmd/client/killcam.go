@@ -0,0 +1,175 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+//////// killcam
+//////// the last few seconds of where everyone was and where they looked are
+//////// kept, so when we are killed they can be played back from the eyes of
+//////// whoever killed us before we are left in limbo, showing where the shot
+//////// came from
+
+const killcamLength = 3 * time.Second
+
+// where a player was and which way they looked in a location update, and
+// when it was sent, on our clock
+type view struct {
+	location   rl.Vector3
+	yaw, pitch float32
+	crouching  bool
+	sentAt     time.Time
+}
+
+// written by the message receiver, read when drawing
+type killcam struct {
+	histories [][]view // by slot, oldest first, no longer than killcamLength
+	replay    [][]view // the histories when we were killed
+	killerId  int
+	killedAt  time.Time // zero unless a replay is playing
+	mutex     sync.Mutex
+}
+
+func (killcam *killcam) record(id int, latest view) {
+	killcam.mutex.Lock()
+	defer killcam.mutex.Unlock()
+
+	history := append(killcam.histories[id], latest)
+	for len(history) > 0 && latest.sentAt.Sub(history[0].sentAt) > killcamLength {
+		history = history[1:]
+	}
+	killcam.histories[id] = history
+}
+
+// play back the last few seconds from the killer's eyes, if they were seen
+func (killcam *killcam) start(killerId int) {
+	killcam.mutex.Lock()
+	defer killcam.mutex.Unlock()
+
+	if len(killcam.histories[killerId]) == 0 {
+		return
+	}
+	for id, history := range killcam.histories {
+		killcam.replay[id] = slices.Clone(history)
+	}
+	killcam.killerId = killerId
+	killcam.killedAt = time.Now()
+}
+
+// stop any replay and forget everything seen, for a new round where everyone
+// has moved to their spawn
+func (killcam *killcam) reset() {
+	killcam.mutex.Lock()
+	defer killcam.mutex.Unlock()
+
+	clear(killcam.histories)
+	killcam.killedAt = time.Time{}
+}
+
+// whether a replay is playing, ending it once it has played through
+func (killcam *killcam) playing() bool {
+	killcam.mutex.Lock()
+	defer killcam.mutex.Unlock()
+
+	if !killcam.killedAt.IsZero() && time.Since(killcam.killedAt) > killcamLength {
+		killcam.killedAt = time.Time{}
+	}
+	return !killcam.killedAt.IsZero()
+}
+
+// every player seen at the point the replay has reached, drawn as far in the
+// past as other players are, with how fast they were moving
+func (killcam *killcam) views(delay time.Duration) (views []*view, velocities []rl.Vector3, killerId int) {
+	killcam.mutex.Lock()
+	defer killcam.mutex.Unlock()
+
+	views = make([]*view, len(killcam.replay))
+	velocities = make([]rl.Vector3, len(killcam.replay))
+	replayTime := killcam.killedAt.Add(time.Since(killcam.killedAt) - killcamLength - delay)
+	for id, history := range killcam.replay {
+		if len(history) == 0 || replayTime.Before(history[0].sentAt) {
+			continue
+		}
+		latest := history[len(history)-1]
+		views[id] = &latest
+		for i := 1; i < len(history); i++ {
+			previous, next := history[i-1], history[i]
+			if replayTime.After(next.sentAt) {
+				continue
+			}
+			interval := next.sentAt.Sub(previous.sentAt)
+			if interval <= 0 {
+				break
+			}
+			amount := float32(replayTime.Sub(previous.sentAt)) / float32(interval)
+			views[id] = &view{
+				location:  rl.Vector3Lerp(previous.location, next.location, amount),
+				yaw:       lerpAngle(previous.yaw, next.yaw, amount),
+				pitch:     previous.pitch + (next.pitch-previous.pitch)*amount,
+				crouching: next.crouching,
+			}
+			velocities[id] = rl.Vector3Scale(rl.Vector3Subtract(next.location, previous.location), float32(time.Second)/float32(interval))
+			break
+		}
+	}
+	return views, velocities, killcam.killerId
+}
+
+// turn the shorter way between two yaws
+func lerpAngle(from, to, amount float32) float32 {
+	difference := math.Remainder(float64(to-from), 2*math.Pi)
+	return from + float32(difference)*amount
+}
+
+// the world as it was, through the eyes of whoever killed us, us included
+func (playerWorld *playerWorld) drawKillcam() {
+	views, velocities, killerId := playerWorld.killcam.views(playerWorld.renderDelay())
+	killer := views[killerId]
+	if killer == nil {
+		return
+	}
+
+	eyeHeight := float32(cameraHeight)
+	if killer.crouching {
+		eyeHeight = crouchCameraHeight
+	}
+	yaw, pitch := float64(killer.yaw), float64(killer.pitch)
+	look := rl.Vector3{
+		X: float32(math.Cos(yaw) * math.Cos(pitch)),
+		Y: float32(math.Sin(pitch)),
+		Z: float32(math.Sin(yaw) * math.Cos(pitch)),
+	}
+	camera := playerWorld.camera
+	camera.Fovy = playerWorld.settings.Fov
+	camera.Position = rl.Vector3Add(killer.location, rl.Vector3{Y: eyeHeight})
+	camera.Target = rl.Vector3Add(camera.Position, look)
+
+	rl.BeginMode3D(camera)
+	playerWorld.drawWorld()
+	playerWorld.drawHealthPacks()
+	for id, seen := range views {
+		if seen == nil || id == killerId {
+			continue
+		}
+		character := otherPlayer{otherPlayerState: alive, velocity: velocities[id], crouching: seen.crouching, yaw: seen.yaw, pitch: seen.pitch}
+		character.setOtherPlayerLocation(seen.location)
+		playerWorld.drawCharacter(&character, playerWorld.teamOf(id))
+	}
+	playerWorld.thrownGrenades.draw(camera, playerWorld.smokeTexture)
+	rl.EndMode3D()
+
+	playerWorld.drawScaled(rl.Vector2{X: internalWindowWidth, Y: 0}, func() {
+		playerWorld.killFeed.draw(playerWorld.font)
+	})
+	playerWorld.drawScaled(rl.Vector2{X: internalWindowWidth, Y: internalWindowHeight}, func() {
+		text := "KILLCAM::" + playerWorld.playerName(killerId)
+		width := rl.MeasureTextEx(playerWorld.font, text, fontSize, 0).X
+		rl.DrawTextEx(playerWorld.font, text, rl.Vector2{X: internalWindowWidth - leftMargin - width, Y: internalWindowHeight - topMargin - fontSize}, fontSize, 0, rl.Red)
+	})
+	playerWorld.settings.draw(playerWorld.font)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// kill feed
+//////// the latest kills are listed in the top right corner for a while, with
+//////// the weapon each was made with between the killer and the killed
+
+const (
+	killFeedLength   = 4
+	killFeedDuration = 5 * time.Second
+	killFeedFontSize = 16
+	headshotIconSize = 12 // a crosshair over the killed player's name
+)
+
+type killFeedEntry struct {
+	killer, killed string
+	weapon         protocol.Weapon
+	headshot       bool
+	at             time.Time
+}
+
+// written by the message receiver, read when drawing
+type killFeed struct {
+	entries []killFeedEntry // oldest first
+	mutex   sync.Mutex
+}
+
+func (killFeed *killFeed) add(killer, killed string, weapon protocol.Weapon, headshot bool) {
+	killFeed.mutex.Lock()
+	defer killFeed.mutex.Unlock()
+
+	killFeed.entries = append(killFeed.entries, killFeedEntry{killer: killer, killed: killed, weapon: weapon, headshot: headshot, at: time.Now()})
+	if len(killFeed.entries) > killFeedLength {
+		killFeed.entries = killFeed.entries[len(killFeed.entries)-killFeedLength:]
+	}
+}
+
+func (killFeed *killFeed) draw(font rl.Font) {
+	killFeed.mutex.Lock()
+	defer killFeed.mutex.Unlock()
+
+	// drop the kills that have been shown long enough
+	for len(killFeed.entries) > 0 && time.Since(killFeed.entries[0].at) > killFeedDuration {
+		killFeed.entries = killFeed.entries[1:]
+	}
+
+	for i, entry := range killFeed.entries {
+		y := topMargin + float32(lineSpace*i)
+		right := float32(internalWindowWidth - leftMargin)
+
+		killedWidth := rl.MeasureTextEx(font, entry.killed, killFeedFontSize, 0).X
+		rl.DrawTextEx(font, entry.killed, rl.Vector2{X: right - killedWidth, Y: y}, killFeedFontSize, 0, rl.Black)
+		right -= killedWidth
+		if entry.headshot {
+			drawHeadshotIcon(rl.Vector2{X: right - headshotIconSize/2, Y: y + killFeedFontSize/2})
+			right -= headshotIconSize
+		}
+
+		weapon := fmt.Sprintf(" [%s] ", strings.ToUpper(entry.weapon.String()))
+		width := rl.MeasureTextEx(font, weapon, killFeedFontSize, 0).X
+		rl.DrawTextEx(font, weapon, rl.Vector2{X: right - width, Y: y}, killFeedFontSize, 0, rl.DarkGray)
+		right -= width
+
+		width = rl.MeasureTextEx(font, entry.killer, killFeedFontSize, 0).X
+		rl.DrawTextEx(font, entry.killer, rl.Vector2{X: right - width, Y: y}, killFeedFontSize, 0, rl.Black)
+	}
+}
+
+func drawHeadshotIcon(centre rl.Vector2) {
+	radius := float32(headshotIconSize) / 2
+	rl.DrawCircleLinesV(centre, radius-2, rl.Red)
+	rl.DrawLineV(rl.Vector2{X: centre.X - radius, Y: centre.Y}, rl.Vector2{X: centre.X + radius, Y: centre.Y}, rl.Red)
+	rl.DrawLineV(rl.Vector2{X: centre.X, Y: centre.Y - radius}, rl.Vector2{X: centre.X, Y: centre.Y + radius}, rl.Red)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// how many players the end screen lists
+const leaderboardLength = 10
+
+type leaderboardEntry struct {
+	Name    string  `json:"name"`
+	Matches int     `json:"matches"`
+	Wins    int     `json:"wins"`
+	WinRate float64 `json:"win_rate"`
+	Kills   int     `json:"kills"`
+	Deaths  int     `json:"deaths"`
+}
+
+// fetch the server's leaderboard, which includes the match just finished
+func fetchLeaderboard(address string) ([]leaderboardEntry, error) {
+	client := http.Client{Timeout: 5 * time.Second}
+	response, err := client.Get(fmt.Sprintf("http://%s/leaderboard", address))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Server responded with %s", response.Status)
+	}
+
+	var entries []leaderboardEntry
+	if err := json.NewDecoder(response.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func printLeaderboard(entries []leaderboardEntry) {
+	fmt.Println("  LEADERBOARD")
+	for i, entry := range entries[:min(len(entries), leaderboardLength)] {
+		fmt.Printf("  %2d %-16s WINS: %d/%d (%.0f%%), KILLS: %d, DEATHS: %d\n", i+1, entry.Name, entry.Wins, entry.Matches, entry.WinRate*100, entry.Kills, entry.Deaths)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"slices"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/maps"
+)
+
+//////// lighting
+//////// a sun shines on the world from one direction, faces turned away from
+//////// it are darker, and blocks and players cast shadows straight along it
+//////// onto whatever they stand on; all of it can be turned off in the
+//////// settings for weak graphics cards
+
+// the way the sunlight travels, the same as in lighting.fs
+var sunDirection = rl.Vector3{X: -0.4, Y: -1, Z: -0.25}
+
+const (
+	shadowLift         = 0.01 // above the floor, so the shadow is not drawn inside it
+	playerShadowRadius = 0.4
+)
+
+var shadowColour = rl.NewColor(0, 0, 0, 90)
+
+// the shadow a block casts onto the height it stands on, as the corners of a
+// polygon on that height, or nil for flat blocks such as the floor, and for
+// ramps, which lie too close to what they stand on to need one
+func blockShadow(mapBlock *maps.Block) []rl.Vector3 {
+	base := mapBlock.Min[1]
+	height := mapBlock.Max[1] - base
+	if height <= 0 || mapBlock.Rise != "" || sunDirection.Y >= 0 {
+		return nil
+	}
+
+	// the box's corners slid along the sunlight down to its base
+	reach := rl.Vector3Scale(sunDirection, height/-sunDirection.Y)
+	var points []rl.Vector2
+	for _, x := range []float32{mapBlock.Min[0], mapBlock.Max[0]} {
+		for _, z := range []float32{mapBlock.Min[2], mapBlock.Max[2]} {
+			points = append(points, rl.Vector2{X: x, Y: z}, rl.Vector2{X: x + reach.X, Y: z + reach.Z})
+		}
+	}
+	hull := convexHull(points)
+	shadow := make([]rl.Vector3, len(hull))
+	for i, point := range hull {
+		shadow[i] = rl.Vector3{X: point.X, Y: base + shadowLift, Z: point.Y}
+	}
+	return shadow
+}
+
+// the points around the edge of a set of points, in order, by Andrew's
+// monotone chain
+func convexHull(points []rl.Vector2) []rl.Vector2 {
+	points = slices.Clone(points)
+	slices.SortFunc(points, func(a, b rl.Vector2) int {
+		if a.X != b.X {
+			return compareFloats(a.X, b.X)
+		}
+		return compareFloats(a.Y, b.Y)
+	})
+	cross := func(o, a, b rl.Vector2) float32 {
+		return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+	}
+
+	hull := make([]rl.Vector2, 0, 2*len(points))
+	for _, pass := range [2]bool{false, true} {
+		start := len(hull)
+		for i := range points {
+			point := points[i]
+			if pass {
+				point = points[len(points)-1-i]
+			}
+			for len(hull) >= start+2 && cross(hull[len(hull)-2], hull[len(hull)-1], point) <= 0 {
+				hull = hull[:len(hull)-1]
+			}
+			hull = append(hull, point)
+		}
+		// the last point of each half is the first of the other
+		hull = hull[:len(hull)-1]
+	}
+	return hull
+}
+
+func compareFloats(a, b float32) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// light the blocks and doors with the sun, or draw them flat
+func (playerWorld *playerWorld) applyLighting() {
+	for _, blocks := range [][]*block{playerWorld.blocks, playerWorld.doorBlocks} {
+		for _, block := range blocks {
+			shader := block.unlit
+			if playerWorld.settings.Lighting {
+				shader = *playerWorld.lightingShader
+			}
+			block.model.GetMaterials()[0].Shader = shader
+		}
+	}
+}
+
+// the shadows of the blocks, and a round one under each player standing on
+// the map
+func (playerWorld *playerWorld) drawShadows() {
+	if !playerWorld.settings.Lighting {
+		return
+	}
+	for _, shadow := range playerWorld.shadows {
+		// drawn both ways round, so they show whichever way they wind
+		for i := 1; i+1 < len(shadow); i++ {
+			rl.DrawTriangle3D(shadow[0], shadow[i], shadow[i+1], shadowColour)
+			rl.DrawTriangle3D(shadow[0], shadow[i+1], shadow[i], shadowColour)
+		}
+	}
+	for i := range playerWorld.otherPlayers {
+		otherPlayer := &playerWorld.otherPlayers[i]
+		if otherPlayer.otherPlayerState != alive || i == playerWorld.following {
+			continue
+		}
+		rl.DrawCylinder(otherPlayer.position, playerShadowRadius, playerShadowRadius, shadowLift, 12, shadowColour)
+	}
+}
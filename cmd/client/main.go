@@ -2,82 +2,271 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/logging"
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/protocol"
 )
 
 func main() {
+	// the config gives the defaults of the command-line arguments
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
 	// command-line arguments
-	if len(os.Args) != 4 {
-		fmt.Printf("Usage: %s [IP] [port] [ID]\n", os.Args[0])
+	lobby := flag.String("lobby", "default", "name of the lobby to join")
+	mapDirectory := flag.String("maps-dir", maps.DefaultDirectory, "directory the map files are in")
+	resourceDirectory := flag.String("resources", config.ResourcePack, "resource pack, a directory of textures, sounds, music, fonts and shaders to use in place of those built in")
+	developer := flag.Bool("dev", false, "developer mode, reload textures and shaders as they change in the resources directory")
+	password := flag.String("password", "", "password of the server, if it has one")
+	name := flag.String("name", "", "name to play under, by default the server names us after our slot")
+	recordPath := flag.String("record", "", "file to record a demo of the match to")
+	playbackPath := flag.String("playback", "", "demo file to watch instead of joining a server")
+	observe := flag.Bool("observe", false, "watch the match as an observer instead of playing in it")
+	tv := flag.Bool("tv", false, "watch the match behind time through the server's shooterTV relay, as an observer")
+	voiceCapture := flag.String("voice-capture", "", "command that records our voice for voice chat, see the README")
+	showLeaderboard := flag.Bool("leaderboard", false, "show the server's leaderboard once the match is over")
+	sensitivity := flag.Float64("sensitivity", float64(config.Sensitivity), "how fast the mouse turns the camera, can be changed in game")
+	scopedSensitivity := flag.Float64("scoped-sensitivity", float64(config.ScopedSensitivity), "fraction of the sensitivity used while scoped, can be changed in game")
+	invertY := flag.Bool("invert-y", config.InvertY, "look down when moving the mouse up, can be changed in game")
+	master := flag.String("master", config.MasterServer, "URL of the master server to browse public servers from")
+	protocolName := flag.String("protocol", "binary", "how messages are sent: binary, or json for debugging")
+	udp := flag.Bool("udp", false, "ask the server to send locations over UDP, if it can")
+	logFlags := logging.RegisterFlags()
+	flag.Usage = func() {
+		fmt.Printf("Usage: %s [options] [IP (optional)] [port (optional)] [ID (optional)]\n", os.Args[0])
+		fmt.Printf("       %s [options] -playback [demo]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// a server given on the command line is joined straight away, otherwise
+	// the menu starts out with the last one
+	address := config.LastServer
+	joinNow := false
+	id := protocol.AnyId
+	switch flag.NArg() {
+	case 0:
+	case 2, 3:
+		address = net.JoinHostPort(flag.Arg(0), flag.Arg(1))
+		joinNow = true
+	default:
+		flag.Usage()
 		return
 	}
 
-	ip := os.Args[1]
-	portString := os.Args[2]
-	idString := os.Args[3]
+	if *tv {
+		*observe = true
+		serverPath = "/tv"
+	}
 
-	port, err := strconv.Atoi(portString)
-	if err != nil {
-		fmt.Println("Port needs to be a number:", err)
+	// without an ID the server picks a slot for us
+	if flag.NArg() == 3 && *observe {
+		fmt.Println("Observers do not take an ID")
 		return
 	}
+	if *observe && *recordPath != "" {
+		fmt.Println("Demos can only be recorded by players")
+		return
+	}
+	if *observe {
+		id = protocol.ObserverId
+	}
+	if flag.NArg() == 3 {
+		id, err = strconv.Atoi(flag.Arg(2))
+		if err != nil {
+			fmt.Println("ID needs to be a number:", err)
+			return
+		}
 
-	id, err := strconv.Atoi(idString)
-	if err != nil {
-		fmt.Println("ID needs to be a number:", err)
+		if !protocol.ValidId(id) {
+			fmt.Printf("ID must be between 0 and %d, inclusive\n", protocol.MaxPlayers-1)
+			return
+		}
+	}
+
+	if err := logFlags.Setup(); err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	if id < 0 || maxPlayers - 1 < id {
-		fmt.Println("ID must be between 0 and 5, inclusive")
+	// a pack that would break the game is turned away before it is loaded
+	if *resourceDirectory != "" {
+		if err := checkResourcePack(*resourceDirectory); err != nil {
+			fmt.Println("Invalid resource pack:", err)
+			return
+		}
+	}
+
+	if !protocol.ValidName(*name) {
+		fmt.Printf("Name must be at most %d bytes of printable characters\n", protocol.MaxNameLength)
+		return
+	}
+
+	if encoding, err = protocol.ParseEncoding(*protocolName); err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	// establish connection
-	meta := newMeta(id)
-	if err := meta.connectToServer(fmt.Sprintf("ws://%s:%d/ws", ip, port)); err != nil {
-		log.Fatal(err)
+	config.Sensitivity = float32(*sensitivity)
+	config.ScopedSensitivity = float32(*scopedSensitivity)
+	config.InvertY = *invertY
+	config.MasterServer = *master
+	config.ResourcePack = *resourceDirectory
+	settings, err := newSettings(config)
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
 
-	// initialise game
+	// the window opens straight away, on the menu
+	// raylib only says why a shader would not compile to developers
 	rl.SetTraceLogLevel(rl.LogNone)
+	if *developer {
+		rl.SetTraceLogLevel(rl.LogWarning)
+	}
 	rl.SetConfigFlags(rl.FlagWindowResizable)
 	rl.InitWindow(0, 0, "shooter")
 	defer rl.CloseWindow()
 	rl.SetWindowMinSize(internalWindowWidth, internalWindowHeight)
-	rl.SetTargetFPS(30)
-	rl.DisableCursor()
+	applyDisplay(settings.config)
+	applyFrameRate(settings.config)
 
 	// load resources
-	resources := resources{}
+	resources := resources{files: newResourceFiles(*resourceDirectory, *developer)}
 	resources.loadResources()
 	defer resources.unloadResources()
+	rl.SetMasterVolume(settings.Volume)
 
-	// screen rectangles
-	internalWindowRectangle := rl.Rectangle{
-		X:      0,
-		Y:      0,
-		Width:  float32(resources.textures.renderTexture.Texture.Width),
-		Height: float32(-resources.textures.renderTexture.Texture.Height),
+	options := matchOptions{
+		address:         address,
+		joinNow:         joinNow,
+		id:              id,
+		name:            *name,
+		lobby:           *lobby,
+		password:        *password,
+		master:          *master,
+		mapDirectory:    *mapDirectory,
+		recordPath:      *recordPath,
+		playbackPath:    *playbackPath,
+		voiceCapture:    *voiceCapture,
+		showLeaderboard: *showLeaderboard,
+		udp:             *udp,
+	}
+	// a rematch joins the same server and lobby again straight away, as does
+	// a spectator who has been given a slot
+	for playMatch(&resources, settings, &options) {
+		options.joinNow = true
+	}
+}
+
+// what a match is joined with, from the command line and the menu
+type matchOptions struct {
+	address, name, lobby, password, master string
+	joinNow                                bool
+	id                                     int
+	mapDirectory                           string
+	recordPath, playbackPath               string
+	voiceCapture                           string
+	showLeaderboard, udp                   bool
+}
+
+// join and play a match through to the end, true if it is to be joined again,
+// for a rematch or to take a slot given while spectating
+func playMatch(resources *resources, settings *settings, options *matchOptions) bool {
+	var meta *meta
+	if options.playbackPath != "" {
+		demo, header, err := openDemo(options.playbackPath)
+		if err != nil {
+			fmt.Println("Could not open demo:", err)
+			return false
+		}
+		defer demo.Close()
+		meta = newPlaybackMeta(header, demo)
+	} else {
+		meta, options.address = runMenu(resources, settings, options.address, options.name, options.id, options.lobby, options.password, options.master, options.joinNow)
+		if meta == nil {
+			return false
+		}
+		options.name = meta.name
+		settings.LastServer = options.address
+		saveConfig(settings.config)
+		// the connection may have been replaced by the time we leave
+		defer func() {
+			disconnect(meta.conn)
+		}()
+
+		// a connection that drops is made again, see reconnect.go
+		reconnecting := newReconnectingReader(meta)
+		defer reconnecting.Close()
+		meta.messages = reconnecting
+
+		// observers have no token to say hello with, and are only sent
+		// locations over the websocket
+		if options.udp && meta.token != nil {
+			datagrams, err := newDatagramReader(meta.messages, options.address, meta.token)
+			if err != nil {
+				fmt.Println("Could not open UDP:", err)
+				return false
+			}
+			defer datagrams.Close()
+			meta.messages = datagrams
+		}
+
+		if options.recordPath != "" {
+			recorder, err := newDemoRecorder(options.recordPath, meta.messages, demoHeader{id: meta.id, Team: meta.Team, tickRate: meta.tickRate, teamSize: meta.teamSize, mapName: meta.mapName})
+			if err != nil {
+				fmt.Println("Could not record demo:", err)
+				return false
+			}
+			defer func() {
+				if err := recorder.Close(); err != nil {
+					slog.Error("Could not save demo", "error", err)
+				}
+			}()
+			meta.messages = recorder
+		}
+	}
+
+	// the server tells us which map is being played
+	gameMap, err := resources.files.loadMap(options.mapDirectory, meta.mapName)
+	if err != nil {
+		fmt.Println("Could not load map:", err)
+		return false
 	}
-	destinationRectangle := calculateScreenRectangle()
 
 	// game objects
-	playerWorld := newPlayerWorld(&resources, meta)
+	playerWorld := newPlayerWorld(resources, gameMap, options.mapDirectory, meta, settings)
 	defer playerWorld.cleanUp()
-	defer disconnect(playerWorld.conn)
 	context, cancel := context.WithCancel(context.Background())
 	go playerWorld.receiveMessages(context)
+	if !playerWorld.watching() {
+		go playerWorld.measurePing(context)
+	}
 
-	// wait until the game starts before we make a window
-	playerWorld.waitUntilGameStarts()
+	// wait in the lobby until the game starts
+	if !playerWorld.waitUntilGameStarts(resources, settings) {
+		cancel()
+		return false
+	}
+	rl.DisableCursor()
 
-	go playerWorld.sendServerLocation()
+	if !playerWorld.watching() {
+		go playerWorld.sendServerLocation()
+		go playerWorld.captureVoice(context, options.voiceCapture)
+	}
 
 	// game loop
 	for !rl.WindowShouldClose() {
@@ -85,70 +274,83 @@ func main() {
 		playerWorld.update()
 
 		// exit if requested
-		if playerWorld.exitRequested {
+		if playerWorld.exitRequested || playerWorld.connectionLost || playerWorld.promoted {
 			break
 		}
 
-		// draw to render texture
-		rl.BeginTextureMode(resources.renderTexture)
-		playerWorld.draw()
-		rl.EndTextureMode()
-
-		// recalculate screen output rectangle if screen dimensions changed
-		if rl.IsWindowResized() {
-			destinationRectangle = calculateScreenRectangle()
-		}
-
-		// draw to screen
-		rl.BeginDrawing()
-		rl.ClearBackground(rl.Black)
-		rl.BeginShaderMode(resources.chromaticAberration)
-		rl.DrawTexturePro(resources.renderTexture.Texture, internalWindowRectangle, destinationRectangle, rl.Vector2Zero(), 0, rl.White)
-		rl.EndShaderMode()
-		rl.EndDrawing()
+		resources.playMusic(resources.matchMusic(playerWorld.round))
+		drawFrame(resources, settings, playerWorld.draw)
 	}
 
 	// close the message receiver
 	cancel()
 
-	// print result to console
-	switch {
-	case playerWorld.teamAPoints == playerWorld.teamBPoints:
-		fmt.Println("  DRAW")
-	case playerWorld.team == a && playerWorld.teamAPoints > playerWorld.teamBPoints:
-		fmt.Println("  CONGRATULATIONS::TEAM A WON")
-	case playerWorld.team == a && playerWorld.teamAPoints < playerWorld.teamBPoints:
-		fmt.Println("  DEFEAT::TEAM B WON")
-	case playerWorld.team == b && playerWorld.teamBPoints > playerWorld.teamAPoints:
-		fmt.Println("  CONGRATULATIONS::TEAM B WON")
-	case playerWorld.team == b && playerWorld.teamBPoints < playerWorld.teamAPoints:
-		fmt.Println("  DEFEAT::TEAM A WON")
+	// a spectator given a slot joins again to take it, see observer.go
+	if playerWorld.promoted {
+		options.id = protocol.AnyId
+		return true
+	}
+
+	// the match is over, so there is nothing left to rejoin
+	if playerWorld.exitRequested && !playerWorld.watching() {
+		clearSession()
+	}
+
+	if playerWorld.connectionLost && !playerWorld.playback {
+		fmt.Println("  LOST CONNECTION TO SERVER")
+		return false
 	}
+
+	// print result to console
+	fmt.Println("  " + playerWorld.resultText())
 	fmt.Printf("  TEAM A POINTS::%d\n", playerWorld.teamAPoints)
-	for i, otherPlayer := range playerWorld.otherPlayers[:maxTeamPlayers] {
+	for i, otherPlayer := range playerWorld.otherPlayers[:playerWorld.teamSize] {
 		if i == playerWorld.id {
-			fmt.Printf("> %d KILLS: %d, DEATHS: %d\n", i, playerWorld.killAmount, playerWorld.deathAmount)
+			fmt.Printf("> %s KILLS: %d, DEATHS: %d, ASSISTS: %d\n", playerWorld.playerName(i), playerWorld.killAmount, playerWorld.deathAmount, playerWorld.assistAmount)
 		} else {
-			fmt.Printf("  %d KILLS: %d, DEATHS: %d\n", i, otherPlayer.killAmount, otherPlayer.deathAmount)
+			fmt.Printf("  %s KILLS: %d, DEATHS: %d, ASSISTS: %d\n", playerWorld.playerName(i), otherPlayer.killAmount, otherPlayer.deathAmount, otherPlayer.assistAmount)
 		}
 	}
 	fmt.Printf("  TEAM B POINTS::%d\n", playerWorld.teamBPoints)
-	for i, otherPlayer := range playerWorld.otherPlayers[maxTeamPlayers:] {
-		if i + maxTeamPlayers == playerWorld.id {
-			fmt.Printf("> %d KILLS: %d, DEATHS: %d\n", i + maxTeamPlayers, playerWorld.killAmount, playerWorld.deathAmount)
+	for i, otherPlayer := range playerWorld.otherPlayers[playerWorld.teamSize:] {
+		if i+playerWorld.teamSize == playerWorld.id {
+			fmt.Printf("> %s KILLS: %d, DEATHS: %d, ASSISTS: %d\n", playerWorld.playerName(i+playerWorld.teamSize), playerWorld.killAmount, playerWorld.deathAmount, playerWorld.assistAmount)
+		} else {
+			fmt.Printf("  %s KILLS: %d, DEATHS: %d, ASSISTS: %d\n", playerWorld.playerName(i+playerWorld.teamSize), otherPlayer.killAmount, otherPlayer.deathAmount, otherPlayer.assistAmount)
+		}
+	}
+
+	if options.showLeaderboard && !playerWorld.playback {
+		entries, err := fetchLeaderboard(options.address)
+		if err != nil {
+			slog.Warn("Could not fetch leaderboard", "error", err)
 		} else {
-			fmt.Printf("  %d KILLS: %d, DEATHS: %d\n", i + maxTeamPlayers, otherPlayer.killAmount, otherPlayer.deathAmount)
+			printLeaderboard(entries)
 		}
 	}
+
+	// the end screen is only shown once the match has finished, a rematch is
+	// not offered if a demo would be recorded over, or is being played back
+	if !playerWorld.exitRequested {
+		return false
+	}
+	return playerWorld.runSummary(resources, options.recordPath == "" && !playerWorld.playback)
 }
 
-func calculateScreenRectangle() rl.Rectangle {
-	scale := min(float32(rl.GetScreenWidth())/internalWindowWidth, float32(rl.GetScreenHeight())/internalWindowHeight)
-	rectangle := rl.Rectangle{
-		X:      (float32(rl.GetScreenWidth()) - float32(internalWindowWidth)*scale) * 0.5,
-		Y:      (float32(rl.GetScreenHeight()) - float32(internalWindowHeight)*scale) * 0.5,
-		Width:  internalWindowWidth * scale,
-		Height: internalWindowHeight * scale,
+// where on the server matches are joined, set to watch shooterTV by -tv
+var serverPath = "/ws"
+
+// connect to a server at host:port and ask for a slot, or any slot
+func joinServer(address string, id int, lobby, name, password string) (*meta, error) {
+	if _, port, err := net.SplitHostPort(address); err != nil {
+		return nil, err
+	} else if _, err := strconv.Atoi(port); err != nil {
+		return nil, errors.New("Port needs to be a number")
+	}
+
+	meta := newMeta(id, name, password)
+	if err := meta.connectToServer(fmt.Sprintf("ws://%s%s?lobby=%s", address, serverPath, url.QueryEscape(lobby))); err != nil {
+		return nil, err
 	}
-	return rectangle
+	return meta, nil
 }
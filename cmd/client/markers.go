@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// markers
+//////// the mark key marks the first block or closed door under the crosshair
+//////// for our team; the server passes it on to our teammates and back to us,
+//////// and each teammate's latest marker stands there for a few seconds as a
+//////// pin in the world, labelled with who placed it and how far away it is,
+//////// and as a ring on the minimap
+
+var markKey int32 = rl.KeyZ
+
+const (
+	markerTime          = 5 * time.Second
+	markerFadeTime      = time.Second // at the end of its time
+	markerHeight        = 0.6
+	markerRadius        = 0.15
+	minimapMarkerRadius = 3
+)
+
+var markerColour = rl.NewColor(255, 200, 0, 255)
+
+type marker struct {
+	position rl.Vector3
+	at       time.Time
+}
+
+// written by the message receiver, read when drawing
+type markers struct {
+	list  [protocol.MaxPlayers]marker // each player's latest, by slot
+	mutex sync.Mutex
+}
+
+func (markers *markers) set(id int, position rl.Vector3) {
+	markers.mutex.Lock()
+	defer markers.mutex.Unlock()
+
+	markers.list[id] = marker{position: position, at: time.Now()}
+}
+
+func (markers *markers) clear() {
+	markers.mutex.Lock()
+	defer markers.mutex.Unlock()
+
+	markers.list = [protocol.MaxPlayers]marker{}
+}
+
+// a marker still standing, with the slot of whoever placed it and how
+// strongly it is drawn as it fades
+type standingMarker struct {
+	id       int
+	position rl.Vector3
+	strength float32
+}
+
+func (markers *markers) standing() []standingMarker {
+	markers.mutex.Lock()
+	defer markers.mutex.Unlock()
+
+	var standing []standingMarker
+	for id, marker := range markers.list {
+		age := time.Since(marker.at)
+		if marker.at.IsZero() || age >= markerTime {
+			continue
+		}
+		standing = append(standing, standingMarker{id: id, position: marker.position, strength: min(1, float32(markerTime-age)/float32(markerFadeTime))})
+	}
+	return standing
+}
+
+// ask the server to mark what we are looking at for our team
+func (playerWorld *playerWorld) mark() {
+	if !rl.IsKeyPressed(markKey) {
+		return
+	}
+	ray := rl.Ray{Position: playerWorld.camera.Position, Direction: rl.GetCameraForward(&playerWorld.camera)}
+	impact, _ := playerWorld.shotImpact(ray)
+	if !impact.Hit {
+		return
+	}
+	x, y, z := protocol.Float32ScaleToInt8(impact.Point.X), protocol.Float32ScaleToInt8(impact.Point.Y), protocol.Float32ScaleToInt8(impact.Point.Z)
+	playerWorld.connMutex.Lock()
+	if err := writeMessage(playerWorld.conn, protocol.EncodeMark(x, y, z)); err != nil {
+		slog.Warn("Could not send message", "header", protocol.MarkMessage, "error", err)
+	}
+	playerWorld.connMutex.Unlock()
+}
+
+// a pin standing on each marked spot, point down, in 3D mode
+func (playerWorld *playerWorld) drawMarkers() {
+	for _, marker := range playerWorld.markers.standing() {
+		rl.DrawCylinder(marker.position, markerRadius, 0, markerHeight, 8, rl.Fade(markerColour, marker.strength))
+	}
+}
+
+// who placed each marker and how far away it is, over the pin, called
+// between the 3D world and the HUD
+func (playerWorld *playerWorld) drawMarkerLabels() {
+	forward := rl.Vector3Subtract(playerWorld.camera.Target, playerWorld.camera.Position)
+	for _, marker := range playerWorld.markers.standing() {
+		top := rl.Vector3Add(marker.position, rl.Vector3{Y: markerHeight})
+		if rl.Vector3DotProduct(forward, rl.Vector3Subtract(top, playerWorld.camera.Position)) <= 0 {
+			continue
+		}
+		text := fmt.Sprintf("%s %.0fm", playerWorld.playerName(marker.id), rl.Vector3Distance(playerWorld.camera.Position, top))
+		screenPosition := rl.GetWorldToScreenEx(top, playerWorld.camera, internalWindowWidth, internalWindowHeight)
+		width := rl.MeasureTextEx(playerWorld.font, text, scoreboardFontSize, 0).X
+		rl.DrawTextEx(playerWorld.font, text, rl.Vector2{X: screenPosition.X - width/2, Y: screenPosition.Y - scoreboardFontSize}, scoreboardFontSize, 0, rl.Fade(markerColour, marker.strength))
+	}
+}
+
+// a ring on the minimap around each marked spot
+func (playerWorld *playerWorld) drawMinimapMarkers(toMinimap func(rl.Vector3) rl.Vector2) {
+	for _, marker := range playerWorld.markers.standing() {
+		point := toMinimap(marker.position)
+		rl.DrawCircleLines(int32(point.X), int32(point.Y), minimapMarkerRadius, rl.Fade(markerColour, marker.strength))
+	}
+}
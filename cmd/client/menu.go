@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// menu
+//////// the window opens on a menu where the server and our name are typed in,
+//////// after joining we wait on a lobby screen until the match starts
+
+const (
+	maxAddressLength = 64
+	menuSettingsKey  = rl.KeyF2 // letters are typed into the fields
+)
+
+type menuField int
+
+const (
+	addressField menuField = iota
+	nameField
+	menuFieldCount
+)
+
+var menuFieldNames = [menuFieldCount]string{addressField: "SERVER", nameField: "NAME"}
+
+type joinResult struct {
+	meta *meta
+	err  error
+}
+
+type menu struct {
+	fields     [menuFieldCount]string
+	selected   menuField
+	status     string // how the last try to join went
+	connecting bool
+	joined     chan joinResult
+	browser    *browser
+	browsing   bool
+	settings   *settings
+	id         int
+	lobby      string
+	password   string
+}
+
+// show the menu until we have joined a server, straight away if told to;
+// nil if the window was closed first
+func runMenu(resources *resources, settings *settings, address, name string, id int, lobby, password, master string, joinNow bool) (*meta, string) {
+	menu := &menu{
+		fields:   [menuFieldCount]string{addressField: address, nameField: name},
+		joined:   make(chan joinResult, 1),
+		browser:  newBrowser(master),
+		settings: settings,
+		id:       id,
+		lobby:    lobby,
+		password: password,
+	}
+	if joinNow {
+		menu.join()
+	}
+
+	resources.playMusic(&resources.lobbyMusic)
+	for !rl.WindowShouldClose() {
+		select {
+		case result := <-menu.joined:
+			menu.connecting = false
+			if result.err == nil {
+				return result.meta, menu.fields[addressField]
+			}
+			menu.status = result.err.Error()
+		default:
+		}
+
+		if menu.browsing {
+			menu.updateBrowser()
+			drawFrame(resources, settings, func() {
+				menu.browser.draw(resources.mainFont)
+			})
+			continue
+		}
+		if settings.menuOpen {
+			menu.updateSettings()
+			drawFrame(resources, settings, func() {
+				menu.drawSettings(resources.mainFont)
+			})
+			continue
+		}
+		menu.update()
+		drawFrame(resources, settings, func() {
+			menu.draw(resources.mainFont)
+		})
+	}
+	return nil, ""
+}
+
+// try to join the server in the background, so the menu keeps drawing
+func (menu *menu) join() {
+	address, name := menu.fields[addressField], menu.fields[nameField]
+	if !protocol.ValidName(name) {
+		menu.status = fmt.Sprintf("Name must be at most %d bytes of printable characters", protocol.MaxNameLength)
+		return
+	}
+	menu.connecting = true
+	menu.status = "Connecting to " + address
+	go func() {
+		meta, err := joinServer(address, menu.id, menu.lobby, name, menu.password)
+		menu.joined <- joinResult{meta: meta, err: err}
+	}()
+}
+
+// type into the picked field, nothing can change while connecting
+func (menu *menu) update() {
+	if menu.connecting {
+		return
+	}
+
+	switch {
+	case rl.IsKeyPressed(browserKey):
+		menu.browsing = true
+		menu.browser.refresh()
+		return
+	case rl.IsKeyPressed(menuSettingsKey):
+		menu.settings.menuOpen = true
+		return
+	case rl.IsKeyPressed(rl.KeyTab), rl.IsKeyPressed(rl.KeyDown):
+		menu.selected = (menu.selected + 1) % menuFieldCount
+	case rl.IsKeyPressed(rl.KeyUp):
+		menu.selected = (menu.selected + menuFieldCount - 1) % menuFieldCount
+	case rl.IsKeyPressed(rl.KeyEnter):
+		menu.join()
+		return
+	}
+
+	field := &menu.fields[menu.selected]
+	if rl.IsKeyPressed(rl.KeyBackspace) && *field != "" {
+		_, size := utf8.DecodeLastRuneInString(*field)
+		*field = (*field)[:len(*field)-size]
+	}
+	maxLength := maxAddressLength
+	if menu.selected == nameField {
+		maxLength = protocol.MaxNameLength
+	}
+	for char := rl.GetCharPressed(); char != 0; char = rl.GetCharPressed() {
+		if len(*field)+utf8.RuneLen(char) <= maxLength {
+			*field += string(char)
+		}
+	}
+}
+
+// pick a server from the browser to join, or go back to the menu
+func (menu *menu) updateBrowser() {
+	if rl.IsKeyPressed(browserKey) {
+		menu.browsing = false
+		return
+	}
+	if address, ok := menu.browser.update(); ok {
+		menu.fields[addressField] = address
+		menu.browsing = false
+		menu.join()
+	}
+}
+
+// change the settings, or go back to the menu
+func (menu *menu) updateSettings() {
+	if rl.IsKeyPressed(menuSettingsKey) {
+		menu.settings.menuOpen = false
+		return
+	}
+	menu.settings.update()
+}
+
+func (menu *menu) drawSettings(font rl.Font) {
+	rl.ClearBackground(rl.RayWhite)
+	rl.DrawTextEx(font, "SETTINGS", rl.Vector2{X: leftMargin, Y: topMargin}, fontSize, 0, rl.Black)
+	rl.DrawTextEx(font, "F2::BACK  ARROWS::CHANGE", rl.Vector2{X: leftMargin, Y: topMargin + lineSpace}, scoreboardFontSize, 0, rl.Gray)
+	menu.settings.draw(font)
+}
+
+func (menu *menu) draw(font rl.Font) {
+	rl.ClearBackground(rl.RayWhite)
+	rl.DrawTextEx(font, "SHOOTER", rl.Vector2{X: leftMargin, Y: topMargin}, fontSize, 0, rl.Black)
+
+	for i, value := range menu.fields {
+		marker := " "
+		if menuField(i) == menu.selected && !menu.connecting {
+			marker = ">"
+		}
+		text := fmt.Sprintf("%s%s::%s", marker, menuFieldNames[i], value)
+		rl.DrawTextEx(font, text, rl.Vector2{X: leftMargin, Y: topMargin + float32(lineSpace*(2+i))}, fontSize, 0, rl.Black)
+	}
+
+	help := "ENTER::JOIN  TAB::NEXT  F1::SERVERS"
+	if menu.connecting {
+		help = "CONNECTING..."
+	}
+	rl.DrawTextEx(font, help, rl.Vector2{X: leftMargin, Y: topMargin + float32(lineSpace*5)}, fontSize, 0, rl.Black)
+	rl.DrawTextEx(font, "F2::SETTINGS", rl.Vector2{X: leftMargin, Y: topMargin + float32(lineSpace*7)}, scoreboardFontSize, 0, rl.Gray)
+	rl.DrawTextEx(font, menu.status, rl.Vector2{X: leftMargin, Y: topMargin + float32(lineSpace*6)}, scoreboardFontSize, 0, rl.Gray)
+}
+
+//////// lobby
+
+// show who is in the lobby until the first round starts; false if the window
+// was closed first
+func (playerWorld *playerWorld) waitUntilGameStarts(resources *resources, settings *settings) bool {
+	resources.playMusic(&resources.lobbyMusic)
+	for !rl.WindowShouldClose() {
+		if playerWorld.round > 0 || playerWorld.warmup || playerWorld.connectionLost {
+			return true
+		}
+		drawFrame(resources, settings, playerWorld.drawLobby)
+	}
+	return false
+}
+
+func (playerWorld *playerWorld) drawLobby() {
+	rl.ClearBackground(rl.RayWhite)
+	rl.DrawTextEx(playerWorld.font, "WAITING FOR THE MATCH TO START", rl.Vector2{X: leftMargin, Y: topMargin}, fontSize, 0, rl.Black)
+
+	columnWidth := float32(internalWindowWidth-3*leftMargin) / 2
+	for _, team := range [2]protocol.Team{protocol.A, protocol.B} {
+		x := leftMargin + float32(team)*(columnWidth+leftMargin)
+		y := float32(topMargin + lineSpace*2)
+		rl.DrawTextEx(playerWorld.font, "TEAM "+scoreboardTeamNames[team], rl.Vector2{X: x, Y: y}, fontSize, 0, characterColours[team])
+		for id := range playerWorld.slots() {
+			if playerWorld.teamOf(id) != team || (!playerWorld.hasPlayer(id) && id != playerWorld.id) {
+				continue
+			}
+			y += scoreboardLineSpace
+			marker := " "
+			if id == playerWorld.id && !playerWorld.watching() {
+				marker = ">"
+			}
+			rl.DrawTextEx(playerWorld.font, marker+playerWorld.playerName(id), rl.Vector2{X: x, Y: y}, scoreboardFontSize, 0, rl.Black)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+//////// minimap
+//////// a top down view of the map's walls in the bottom left corner, with X
+//////// to the right and Z downwards, showing us, our teammates, enemies for
+//////// a moment after they shoot, and our team's markers
+
+var minimapKey int32 = rl.KeyM
+
+const (
+	minimapSize       = 64 // pixels, the longer side of the map fits in this
+	minimapEnemyTime  = 2 * time.Second
+	minimapWallHeight = 0.5 // blocks lower than this are floor, and left off
+	minimapDotRadius  = 2
+	minimapArrowSize  = 5
+)
+
+var (
+	minimapBackground = rl.NewColor(230, 230, 230, 200)
+	minimapWallColour = rl.NewColor(60, 60, 60, 255)
+)
+
+// the corner of the map that is drawn top left, and how many pixels a unit
+// takes up, worked out from the blocks of the current map
+func (world *world) minimapScale() (rl.Vector2, float32) {
+	low := rl.Vector2{X: math.MaxFloat32, Y: math.MaxFloat32}
+	high := rl.Vector2{X: -math.MaxFloat32, Y: -math.MaxFloat32}
+	for _, block := range world.blocks {
+		low.X, low.Y = min(low.X, block.boundingBox.Min.X), min(low.Y, block.boundingBox.Min.Z)
+		high.X, high.Y = max(high.X, block.boundingBox.Max.X), max(high.Y, block.boundingBox.Max.Z)
+	}
+	extent := max(high.X-low.X, high.Y-low.Y)
+	if extent <= 0 {
+		return low, 0
+	}
+	return low, minimapSize / extent
+}
+
+func (playerWorld *playerWorld) drawMinimap() {
+	if playerWorld.minimapHidden {
+		return
+	}
+	corner, scale := playerWorld.minimapScale()
+	if scale == 0 {
+		return
+	}
+	origin := rl.Vector2{X: leftMargin, Y: internalWindowHeight - leftMargin - minimapSize}
+	toMinimap := func(location rl.Vector3) rl.Vector2 {
+		return rl.Vector2{X: origin.X + (location.X-corner.X)*scale, Y: origin.Y + (location.Z-corner.Y)*scale}
+	}
+
+	rl.DrawRectangleV(origin, rl.Vector2{X: minimapSize, Y: minimapSize}, minimapBackground)
+	for _, block := range playerWorld.blocks {
+		if block.boundingBox.Max.Y-block.boundingBox.Min.Y < minimapWallHeight {
+			continue
+		}
+		topLeft := toMinimap(block.boundingBox.Min)
+		bottomRight := toMinimap(block.boundingBox.Max)
+		rl.DrawRectangleV(topLeft, rl.Vector2Subtract(bottomRight, topLeft), minimapWallColour)
+	}
+
+	for i := range playerWorld.otherPlayers {
+		otherPlayer := &playerWorld.otherPlayers[i]
+		if i == playerWorld.id || otherPlayer.otherPlayerState != alive {
+			continue
+		}
+		team := playerWorld.teamOf(i)
+		if team != playerWorld.Team && !playerWorld.observing() && time.Since(otherPlayer.shotAt) > minimapEnemyTime {
+			continue
+		}
+		rl.DrawCircleV(toMinimap(otherPlayer.position), minimapDotRadius, characterColours[team])
+	}
+	playerWorld.drawMinimapMarkers(toMinimap)
+
+	// we are an arrow pointing the way we look
+	forward := rl.Vector3Subtract(playerWorld.camera.Target, playerWorld.camera.Position)
+	direction := rl.Vector2Normalize(rl.Vector2{X: forward.X, Y: forward.Z})
+	side := rl.Vector2{X: -direction.Y, Y: direction.X}
+	centre := toMinimap(playerWorld.camera.Position)
+	tip := rl.Vector2Add(centre, rl.Vector2Scale(direction, minimapArrowSize))
+	back := rl.Vector2Subtract(centre, rl.Vector2Scale(direction, minimapArrowSize/2))
+	left := rl.Vector2Add(back, rl.Vector2Scale(side, minimapArrowSize/2))
+	right := rl.Vector2Subtract(back, rl.Vector2Scale(side, minimapArrowSize/2))
+	rl.DrawTriangle(tip, right, left, rl.Black)
+	rl.DrawTriangle(tip, left, right, rl.Black)
+}
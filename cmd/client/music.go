@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log/slog"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// music
+//////// lobby music loops on the menu, in the lobby and on the end screen, a
+//////// stinger plays as each round starts, and a theme loops through the last
+//////// round of the match, all at the music volume; music is streamed from
+//////// its file as it plays, a little more each frame
+
+type music struct {
+	lobbyMusic        rl.Music
+	lastRoundMusic    rl.Music
+	roundStartStinger rl.Sound // short enough to load whole
+	musicData         [][]byte // what the streams read from as they play
+	playing           *rl.Music
+}
+
+// music streams from its file's data, which is kept for as long as it plays
+func (resources *resources) loadMusic(name string) rl.Music {
+	data, err := resources.files.read(name)
+	if err != nil || len(data) == 0 {
+		slog.Error("Could not read music", "path", name, "error", err)
+		return rl.Music{}
+	}
+	resources.musicData = append(resources.musicData, data)
+	return rl.LoadMusicStreamFromMemory(fileType(name), data, int32(len(data)))
+}
+
+// switch to a track, or to silence with nil, carrying on with the one playing
+// if it is the same
+func (music *music) playMusic(track *rl.Music) {
+	if track == music.playing {
+		return
+	}
+	if music.playing != nil {
+		rl.StopMusicStream(*music.playing)
+	}
+	if track != nil {
+		rl.PlayMusicStream(*track)
+	}
+	music.playing = track
+}
+
+// keep the track playing, called each frame
+func (music *music) streamMusic(settings *settings) {
+	if music.playing == nil {
+		return
+	}
+	rl.SetMusicVolume(*music.playing, settings.MusicVolume)
+	rl.UpdateMusicStream(*music.playing)
+}
+
+// the last round of the match has its own theme, the others are played
+// without music
+func (music *music) matchMusic(round int) *rl.Music {
+	if round == protocol.LastRound {
+		return &music.lastRoundMusic
+	}
+	return nil
+}
+
+func (playerWorld *playerWorld) playRoundStartStinger() {
+	rl.SetSoundVolume(playerWorld.roundStartStinger, playerWorld.settings.MusicVolume)
+	rl.PlaySound(playerWorld.roundStartStinger)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+//////// network statistics
+//////// the net stats key shows how the connection is doing, for telling what
+//////// is wrong with a laggy match: the ping, the tick rate the server
+//////// promised against the location updates actually arriving, how old the
+//////// latest of them is, the jitter, how far in the past other players are
+//////// drawn, and the bytes coming and going each second; bytes are counted
+//////// as messages, before any JSON encoding and after batches are split
+
+var netStatsKey int32 = rl.KeyN
+
+const (
+	netStatsFontSize  = 12
+	netStatsLineSpace = 11
+	netStatsInterval  = time.Second // rates are counted over
+)
+
+// bytes of every message sent, by writeMessage
+var sentBytes atomic.Int64
+
+// written by the message receiver, read when drawing
+type netStats struct {
+	since       time.Time // the start of the interval being counted
+	received    int       // bytes in the interval
+	updates     int       // location updates in the interval
+	sent        int64     // sentBytes at the start of the interval
+	latestSent  time.Time // when the latest location update was sent, on our clock
+	receiveRate float64   // bytes per second, over the last whole interval
+	updateRate  float64
+	sendRate    float64
+	mutex       sync.Mutex
+}
+
+// close the interval being counted once it has run its length, the mutex
+// must be held
+func (stats *netStats) roll(now time.Time) {
+	elapsed := now.Sub(stats.since)
+	if elapsed < netStatsInterval {
+		return
+	}
+	// the first interval only starts counting
+	if !stats.since.IsZero() {
+		seconds := elapsed.Seconds()
+		sent := sentBytes.Load()
+		stats.receiveRate = float64(stats.received) / seconds
+		stats.updateRate = float64(stats.updates) / seconds
+		stats.sendRate = float64(sent-stats.sent) / seconds
+	}
+	stats.since, stats.received, stats.updates, stats.sent = now, 0, 0, sentBytes.Load()
+}
+
+// a message of size bytes arrived
+func (stats *netStats) receive(size int, at time.Time) {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	stats.roll(at)
+	stats.received += size
+}
+
+// a location update sent at sentAt, on our clock, arrived
+func (stats *netStats) update(sentAt time.Time) {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	stats.updates++
+	stats.latestSent = sentAt
+}
+
+// bytes per second down and up, location updates per second and how old the
+// latest one is, zero if none has arrived
+func (stats *netStats) rates() (down, up, updates float64, age time.Duration) {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	now := time.Now()
+	stats.roll(now)
+	if !stats.latestSent.IsZero() {
+		age = now.Sub(stats.latestSent)
+	}
+	return stats.receiveRate, stats.sendRate, stats.updateRate, age
+}
+
+// under the health, ammo and money in the top left corner
+func (playerWorld *playerWorld) drawNetStats() {
+	if !playerWorld.netStatsShown {
+		return
+	}
+	jitter, buffer := playerWorld.jitterBuffer.stats()
+	down, up, updates, age := playerWorld.netStats.rates()
+	lines := []string{
+		fmt.Sprintf("ping   %4d ms", playerWorld.currentPing().Milliseconds()),
+		fmt.Sprintf("tick   %4d /s", playerWorld.tickRate),
+		fmt.Sprintf("update %4.0f /s", updates),
+		fmt.Sprintf("age    %4d ms", age.Milliseconds()),
+		fmt.Sprintf("jitter %4d ms", jitter.Milliseconds()),
+		fmt.Sprintf("buffer %4d ms", buffer.Milliseconds()),
+		fmt.Sprintf("interp %4d ms", playerWorld.renderDelay().Milliseconds()),
+		fmt.Sprintf("down %6.1f kB/s", down/1000),
+		fmt.Sprintf("up   %6.1f kB/s", up/1000),
+	}
+	for i, line := range lines {
+		rl.DrawTextEx(playerWorld.font, line, rl.Vector2{X: leftMargin, Y: topMargin + lineSpace*3 + float32(netStatsLineSpace*i)}, netStatsFontSize, 0, rl.Black)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// observer
+//////// observers and anyone watching a demo fly around freely, passing
+//////// through walls, and can watch from any player's eyes instead; every
+//////// player is outlined through walls so nobody is lost track of; joining
+//////// a match that is underway spectates it as an observer, until the server
+//////// gives us a slot, which is joined again to take
+
+// following nobody, flying around freely
+const freeCamera = -1
+
+// clicking follows the next or previous player in slot order, 0 goes back to
+// flying freely
+const (
+	followNextButton     = rl.MouseButtonLeft
+	followPreviousButton = rl.MouseButtonRight
+	freeCameraKey        = rl.KeyZero
+)
+
+// an observer, who plays no part in the match
+func (meta *meta) observing() bool {
+	return meta.id == protocol.ObserverId
+}
+
+// only watching the match, either as an observer or in a demo
+func (meta *meta) watching() bool {
+	return meta.playback || meta.observing()
+}
+
+// fly around, or look from the eyes of whoever is being followed
+func (playerWorld *playerWorld) updateObserver() {
+	if rl.IsKeyPressed(freeCameraKey) {
+		playerWorld.following = freeCamera
+	}
+	switch {
+	case rl.IsMouseButtonPressed(followNextButton):
+		playerWorld.following = playerWorld.nextFollowed(1)
+	case rl.IsMouseButtonPressed(followPreviousButton):
+		playerWorld.following = playerWorld.nextFollowed(-1)
+	}
+
+	// the camera stays where they were last seen if they leave
+	if playerWorld.following != freeCamera && playerWorld.otherPlayers[playerWorld.following].otherPlayerState == nonExistent {
+		playerWorld.following = freeCamera
+	}
+	if playerWorld.following == freeCamera {
+		rl.UpdateCamera(&playerWorld.camera, rl.CameraFree)
+		return
+	}
+
+	followed := &playerWorld.otherPlayers[playerWorld.following]
+	eyeHeight := float32(cameraHeight)
+	if followed.crouching {
+		eyeHeight = crouchCameraHeight
+	}
+	yaw, pitch := float64(followed.yaw), float64(followed.pitch)
+	look := rl.Vector3{
+		X: float32(math.Cos(yaw) * math.Cos(pitch)),
+		Y: float32(math.Sin(pitch)),
+		Z: float32(math.Sin(yaw) * math.Cos(pitch)),
+	}
+	playerWorld.camera.Position = rl.Vector3Add(followed.position, rl.Vector3{Y: eyeHeight})
+	playerWorld.camera.Target = rl.Vector3Add(playerWorld.camera.Position, look)
+}
+
+// the next slot along in the given direction with someone in it, wrapping
+// around, from the free camera the first or last; the free camera if there is
+// nobody to follow
+func (playerWorld *playerWorld) nextFollowed(step int) int {
+	slots := playerWorld.slots()
+	id := playerWorld.following
+	if id == freeCamera && step < 0 {
+		id = slots
+	}
+	for range slots {
+		id = (id + step + slots) % slots
+		if playerWorld.otherPlayers[id].otherPlayerState != nonExistent {
+			return id
+		}
+	}
+	return freeCamera
+}
+
+// the slot is held for us until we rejoin, with the session saved as though
+// we had dropped out of it
+func (playerWorld *playerWorld) handlePromoted(event protocol.PromotedEvent) {
+	if !playerWorld.spectating {
+		return
+	}
+	slog.Info("Given a slot", "id", event.PlayerId)
+	saveSession(playerWorld.url, event.PlayerId, event.Token)
+	playerWorld.promoted = true
+}
+
+// who is being watched from, in the bottom right corner
+func (playerWorld *playerWorld) drawFollowing() {
+	text := "FREE CAMERA"
+	if playerWorld.following != freeCamera {
+		text = "WATCHING::" + playerWorld.playerName(playerWorld.following)
+	}
+	width := rl.MeasureTextEx(playerWorld.font, text, fontSize, 0).X
+	rl.DrawTextEx(playerWorld.font, text, rl.Vector2{X: internalWindowWidth - leftMargin - width, Y: internalWindowHeight - topMargin - fontSize}, fontSize, 0, rl.Black)
+
+	if playerWorld.spectating {
+		text = "MATCH IN PROGRESS, SPECTATING"
+		width = rl.MeasureTextEx(playerWorld.font, text, fontSize, 0).X
+		rl.DrawTextEx(playerWorld.font, text, rl.Vector2{X: internalWindowWidth - leftMargin - width, Y: internalWindowHeight - topMargin - fontSize - lineSpace}, fontSize, 0, rl.Black)
+	}
+}
+
+// the box of every living player in their team's colour, seen through walls,
+// must be called in 3D mode
+func (playerWorld *playerWorld) drawOutlines() {
+	// depth testing only changes for what is drawn after the batch so far
+	rl.DrawRenderBatchActive()
+	rl.DisableDepthTest()
+	for id, otherPlayer := range playerWorld.otherPlayers {
+		if otherPlayer.otherPlayerState != alive || id == playerWorld.following {
+			continue
+		}
+		rl.DrawBoundingBox(otherPlayer.boundingBox, characterColours[playerWorld.teamOf(id)])
+	}
+	rl.DrawRenderBatchActive()
+	rl.EnableDepthTest()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+//////// particles
+//////// effects made of many small short lived pieces, sparks, dust, blood,
+//////// shell casings, the debris and smoke of an explosion, are each described
+//////// by an emitter and share one pool of particles; an emitter says how many
+//////// particles it throws out at once or each second, how long they last, how
+//////// fast and how widely they fly, how gravity and the air pull on them,
+//////// what they look like and how they blend with what is behind them; the
+//////// impacts setting is the size of the pool, the oldest particles making
+//////// way for the newest
+
+// how a particle is drawn
+type particleLook int
+
+const (
+	cubeParticle  particleLook = iota // a small cube of its colour
+	smokeParticle                     // a billboard of the smoke texture
+	glowParticle                      // a billboard of the muzzle flash texture
+	particleLooks
+)
+
+type emitter struct {
+	burst         int     // particles thrown out at once
+	rate          float32 // particles a second, while a stream lasts
+	lifetime      time.Duration
+	speed         float32 // the fastest a particle starts, the slowest being half that
+	spread        float32 // how far particles scatter from the direction, 0 for not at all
+	gravity       float32 // up is positive
+	drag          float32 // the share of its speed a particle loses each second
+	size, endSize float32 // growing or shrinking from one to the other over its life
+	colour        rl.Color
+	look          particleLook
+	blend         rl.BlendMode // rl.BlendAdditive for things that give off light
+}
+
+type particle struct {
+	position, velocity rl.Vector3
+	born               time.Time
+	emitter            *emitter
+}
+
+// an emitter throwing out particles from one place for a while
+type stream struct {
+	emitter             *emitter
+	position, direction rl.Vector3
+	until               time.Time
+	owed                float32 // particles due but not yet thrown out
+}
+
+// written by the message receiver, stepped and drawn on the main thread
+type particles struct {
+	list    []particle // oldest first
+	streams []stream
+	pool    int // how many particles there can be at once, 0 for none
+	mutex   sync.Mutex
+}
+
+// throw out an emitter's burst from a point, around a direction
+func (particles *particles) burst(emitter *emitter, position, direction rl.Vector3) {
+	particles.mutex.Lock()
+	defer particles.mutex.Unlock()
+
+	particles.spawn(emitter, position, direction, emitter.burst)
+}
+
+// throw out an emitter's rate of particles from a point for a while
+func (particles *particles) stream(emitter *emitter, position, direction rl.Vector3, duration time.Duration) {
+	particles.mutex.Lock()
+	defer particles.mutex.Unlock()
+
+	particles.streams = append(particles.streams, stream{emitter: emitter, position: position, direction: direction, until: time.Now().Add(duration)})
+}
+
+// the mutex must be held
+func (particles *particles) spawn(emitter *emitter, position, direction rl.Vector3, count int) {
+	if particles.pool == 0 {
+		return
+	}
+	now := time.Now()
+	for range count {
+		scatter := rl.Vector3{X: rand.Float32()*2 - 1, Y: rand.Float32()*2 - 1, Z: rand.Float32()*2 - 1}
+		velocity := rl.Vector3Normalize(rl.Vector3Add(direction, rl.Vector3Scale(scatter, emitter.spread)))
+		velocity = rl.Vector3Scale(velocity, emitter.speed*(0.5+rand.Float32()/2))
+		particles.list = append(particles.list, particle{position: position, velocity: velocity, born: now, emitter: emitter})
+	}
+	if over := len(particles.list) - particles.pool; over > 0 {
+		particles.list = particles.list[over:]
+	}
+}
+
+// keep the streams going, move the particles on and let the old ones go,
+// called each frame with the size of the pool
+func (particles *particles) step(deltaTime float32, pool int) {
+	particles.mutex.Lock()
+	defer particles.mutex.Unlock()
+
+	particles.pool = pool
+	now := time.Now()
+	streams := particles.streams[:0]
+	for _, stream := range particles.streams {
+		if now.After(stream.until) {
+			continue
+		}
+		stream.owed += stream.emitter.rate * deltaTime
+		count := int(stream.owed)
+		stream.owed -= float32(count)
+		particles.spawn(stream.emitter, stream.position, stream.direction, count)
+		streams = append(streams, stream)
+	}
+	particles.streams = streams
+
+	live := particles.list[:0]
+	for _, particle := range particles.list {
+		emitter := particle.emitter
+		if now.Sub(particle.born) >= emitter.lifetime {
+			continue
+		}
+		particle.velocity = rl.Vector3Scale(particle.velocity, max(0, 1-emitter.drag*deltaTime))
+		particle.velocity.Y += emitter.gravity * deltaTime
+		particle.position = rl.Vector3Add(particle.position, rl.Vector3Scale(particle.velocity, deltaTime))
+		live = append(live, particle)
+	}
+	particles.list = live
+}
+
+func (particles *particles) clear() {
+	particles.mutex.Lock()
+	defer particles.mutex.Unlock()
+
+	particles.list = nil
+	particles.streams = nil
+}
+
+// in 3D mode, fading out over their lives, those blended normally first so
+// the light of the others is added over them
+func (particles *particles) draw(camera rl.Camera, billboards [particleLooks]rl.Texture2D) {
+	particles.mutex.Lock()
+	defer particles.mutex.Unlock()
+
+	now := time.Now()
+	for _, blend := range []rl.BlendMode{rl.BlendAlpha, rl.BlendAdditive} {
+		rl.BeginBlendMode(blend)
+		for _, particle := range particles.list {
+			emitter := particle.emitter
+			if emitter.blend != blend {
+				continue
+			}
+			progress := min(1, float32(now.Sub(particle.born))/float32(emitter.lifetime))
+			size := emitter.size + (emitter.endSize-emitter.size)*progress
+			colour := rl.Fade(emitter.colour, 1-progress)
+			if emitter.look == cubeParticle {
+				rl.DrawCubeV(particle.position, rl.Vector3{X: size, Y: size, Z: size}, colour)
+			} else {
+				rl.DrawBillboard(camera, billboards[emitter.look], particle.position, size, colour)
+			}
+		}
+		rl.EndBlendMode()
+	}
+}
@@ -2,13 +2,21 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand/v2"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 	"github.com/gorilla/websocket"
+	"github.com/lezhou8/shooter/internal/connection"
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/protocol"
 )
 
 //////// playerWorld
@@ -17,11 +25,32 @@ import (
 const (
 	moveSpeed                      = 1
 	slowMoveSpeed                  = 0.3
+	crouchMoveSpeed                = 0.4
+	crouchInaccuracy               = 0.4 // crouching steadies the aim, shrinking skew and spread
 	jumpSpeed                      = 1.2
 	gravity                        = -3.5
 	accurateMovementSpeedThreshold = 0.1
 	swapTime                       = 2
-	maxHealth                      = 3
+
+	// the velocity is how far the player moves in a tick, the speeds above were
+	// tuned for this many ticks a second; a frame is stepped through a tick at
+	// a time, so movement feels the same whatever the frame rate
+	movementTickRate = 30
+	maxFrameTime     = 0.25 // a longer frame, like while the window is dragged, is cut short
+)
+
+// the keys for moving and using guns, they can be rebound in the config
+var (
+	forwardKey    int32 = rl.KeyW
+	backKey       int32 = rl.KeyS
+	leftKey       int32 = rl.KeyA
+	rightKey      int32 = rl.KeyD
+	jumpKey       int32 = rl.KeySpace
+	slowKey       int32 = rl.KeyLeftShift
+	crouchKey     int32 = rl.KeyLeftControl
+	reloadKey     int32 = rl.KeyR
+	swapKey       int32 = rl.KeyQ
+	scoreboardKey int32 = rl.KeyTab
 )
 
 var inaccuracySkew = rl.Vector3{X: 0.6, Y: 0.7, Z: 0.4}
@@ -31,89 +60,189 @@ type playerWorld struct {
 	world
 	otherPlayerManager
 	*meta
-	exitRequested bool
-}
-
-func newPlayerWorld(resources *resources, meta *meta) *playerWorld {
-	return &playerWorld{
+	settings        *settings
+	exitRequested   bool
+	connectionLost  bool
+	promoted        bool // given a slot while spectating, which is taken by joining again
+	mapDirectory    string
+	resourceFiles   resourceFiles // where the textures of maps switched to are read from
+	worldChanges    chan worldChange
+	prediction      prediction
+	killFeed        killFeed
+	soundIndicators soundIndicators
+	voice           *voice
+	thrownGrenades  thrownGrenades
+	healthPacks     healthPacks
+	doors           doors
+	hitFeedback     hitFeedback
+	tracers         tracers
+	impacts         impacts
+	particles       particles
+	streakBanner    streakBanner
+	markers         markers
+	roundBanner     roundBanner
+	countdown       countdown
+	following       int // the player being watched from while watching, or freeCamera
+	killcam         killcam
+	votes           votes
+	said            said
+	jitterBuffer    *jitterBuffer
+	statistics      []protocol.PlayerStatistics // everyone's shooting, once the match is over
+}
+
+func newPlayerWorld(resources *resources, gameMap *maps.Map, mapDirectory string, meta *meta, settings *settings) *playerWorld {
+	playerWorld := &playerWorld{
 		player:             *newPlayer(resources),
-		world:              *newWorld(resources),
-		otherPlayerManager: *newOtherPlayerManager(resources),
+		world:              *newWorld(gameMap, resources.files),
+		otherPlayerManager: *newOtherPlayerManager(resources, meta.slots()),
 		meta:               meta,
+		settings:           settings,
+		mapDirectory:       mapDirectory,
+		resourceFiles:      resources.files,
+		worldChanges:       make(chan worldChange),
+		voice:              newVoice(meta.slots()),
+		killcam:            killcam{histories: make([][]view, meta.slots()), replay: make([][]view, meta.slots())},
+		following:          freeCamera,
+		jitterBuffer:       newJitterBuffer(meta.tickInterval()),
+	}
+	playerWorld.doors.reset(gameMap.Doors)
+	return playerWorld
+}
+
+// move the player on by a tick, or the part of one left at the end of a frame
+func (playerWorld *playerWorld) moveTick(direction rl.Vector3, speed, ticks float32, jump bool) {
+	deltaTime := ticks / movementTickRate
+	playerWorld.velocity = rl.Vector3Add(playerWorld.velocity, rl.Vector3Scale(direction, speed*deltaTime))
+
+	// damping
+	playerWorld.velocity = rl.Vector3Scale(playerWorld.velocity, float32(math.Pow(1.0+5.0/movementTickRate, -float64(ticks))))
+
+	// vertical movement
+	playerWorld.velocity.Y += deltaTime * gravity
+	if jump {
+		playerWorld.velocity.Y = jumpSpeed
+	}
+
+	// handle collisions
+	proposedBoundingBox := rl.BoundingBox{
+		Min: rl.Vector3Add(playerWorld.boundingBox.Min, rl.Vector3Scale(playerWorld.velocity, ticks)),
+		Max: rl.Vector3Add(playerWorld.boundingBox.Max, rl.Vector3Scale(playerWorld.velocity, ticks)),
 	}
+	playerWorld.handleCollision(proposedBoundingBox, &playerWorld.velocity)
+
+	// do the movement
+	movement := rl.Vector3Scale(playerWorld.velocity, ticks)
+	playerWorld.camera.Position = rl.Vector3Add(playerWorld.camera.Position, movement)
+	playerWorld.camera.Target = rl.Vector3Add(playerWorld.camera.Target, movement)
+	playerWorld.boundingBox.Min = rl.Vector3Add(playerWorld.boundingBox.Min, movement)
+	playerWorld.boundingBox.Max = rl.Vector3Add(playerWorld.boundingBox.Max, movement)
+	playerWorld.launchFromJumpPads()
 }
 
 // takes responsibility of player movement to handle collisions
 func (playerWorld *playerWorld) update() {
-	// look around
-	mouseDelta := rl.GetMouseDelta()
-	rl.CameraYaw(&playerWorld.camera, -mouseDelta.X*playerWorld.lookSensitivity, 0)
-	rl.CameraPitch(&playerWorld.camera, -mouseDelta.Y*playerWorld.lookSensitivity, 1, 0, 0)
+	// switch maps if the server asked us to
+	select {
+	case change := <-playerWorld.worldChanges:
+		playerWorld.unload()
+		playerWorld.world = *newWorld(change.gameMap, playerWorld.resourceFiles)
+		playerWorld.doors.reset(change.gameMap.Doors)
+		close(change.done)
+	default:
+	}
+
+	playerWorld.interpolateOtherPlayers()
+	playerWorld.thrownGrenades.step(playerWorld.solidMapBlocks(), rl.GetFrameTime())
+	playerWorld.playFootsteps()
+	playerWorld.playVoices()
+	playerWorld.playHeartbeat()
+	playerWorld.impacts.step()
+	playerWorld.particles.step(rl.GetFrameTime(), playerWorld.settings.Impacts)
+
+	// observers and demos are watched with a free camera
+	if playerWorld.watching() {
+		playerWorld.updateObserver()
+	} else {
+		playerWorld.applyCorrection()
+		playerWorld.voice.talking.Store(rl.IsKeyDown(talkKey))
+
+		// look around
+		mouseDelta := rl.GetMouseDelta()
+		sideways, up := playerWorld.settings.sensitivity(playerWorld.scoped)
+		rl.CameraYaw(&playerWorld.camera, -mouseDelta.X*sideways, 0)
+		rl.CameraPitch(&playerWorld.camera, -mouseDelta.Y*up, 1, 0, 0)
+	}
+	playerWorld.settings.update()
 
 	// statistics board
-	if rl.IsKeyDown(rl.KeyTab) {
+	if rl.IsKeyDown(scoreboardKey) {
 		playerWorld.statisticsBoardRequested = true
 	} else {
 		playerWorld.statisticsBoardRequested = false
 	}
 
+	// minimap
+	if rl.IsKeyPressed(minimapKey) {
+		playerWorld.minimapHidden = !playerWorld.minimapHidden
+	}
+	if rl.IsKeyPressed(netStatsKey) {
+		playerWorld.netStatsShown = !playerWorld.netStatsShown
+	}
+	if playerWorld.watching() {
+		return
+	}
+
+	// call votes and have a say in them
+	playerWorld.updateVotes()
+
+	// buy things while waiting for the round to start
+	playerWorld.updateBuyMenu()
+
 	// do not allow movement or shooting if in limbo
 	if playerWorld.playerState == limbo {
 		return
 	}
 
+	playerWorld.updateCrouch()
+	playerWorld.useDoor()
+	playerWorld.mark()
+
 	// input
 	move := rl.Vector3Zero()
-	if rl.IsKeyDown(rl.KeyW) {
+	if rl.IsKeyDown(forwardKey) {
 		move = rl.Vector3Add(move, rl.GetCameraForward(&playerWorld.camera))
 	}
-	if rl.IsKeyDown(rl.KeyS) {
+	if rl.IsKeyDown(backKey) {
 		move = rl.Vector3Subtract(move, rl.GetCameraForward(&playerWorld.camera))
 	}
-	if rl.IsKeyDown(rl.KeyD) {
+	if rl.IsKeyDown(rightKey) {
 		move = rl.Vector3Add(move, rl.GetCameraRight(&playerWorld.camera))
 	}
-	if rl.IsKeyDown(rl.KeyA) {
+	if rl.IsKeyDown(leftKey) {
 		move = rl.Vector3Subtract(move, rl.GetCameraRight(&playerWorld.camera))
 	}
 
 	// speed
 	var speed float32
-	if rl.IsKeyDown(rl.KeyLeftShift) {
+	switch {
+	case rl.IsKeyDown(slowKey):
 		speed = slowMoveSpeed
-	} else {
+	case playerWorld.crouching:
+		speed = crouchMoveSpeed
+	default:
 		speed = moveSpeed
 	}
-	deltaTime := rl.GetFrameTime()
 	move.Y = 0
-	move = rl.Vector3Scale(rl.Vector3Normalize(move), speed*deltaTime)
-	playerWorld.velocity = rl.Vector3Add(playerWorld.velocity, move)
-
-	// damping
-	playerWorld.velocity = rl.Vector3Scale(playerWorld.velocity, 1.0/(1.0+deltaTime*5))
-
-	// vertical movement
-	playerWorld.velocity.Y += deltaTime * gravity
-	if rl.IsKeyPressed(rl.KeySpace) && !playerWorld.inAir {
-		playerWorld.velocity.Y = jumpSpeed
-	}
-
-	// handle collisions
-	proposedBoundingBox := rl.BoundingBox{
-		Min: rl.Vector3Add(playerWorld.boundingBox.Min, playerWorld.velocity),
-		Max: rl.Vector3Add(playerWorld.boundingBox.Max, playerWorld.velocity),
+	move = rl.Vector3Normalize(move)
+	jump := rl.IsKeyPressed(jumpKey) && !playerWorld.inAir && !playerWorld.crouching
+	for ticks := min(rl.GetFrameTime(), maxFrameTime) * movementTickRate; ticks > 0; ticks-- {
+		playerWorld.moveTick(move, speed, min(ticks, 1), jump)
+		jump = false
 	}
-	playerWorld.handleCollision(playerWorld.horizontalPosition(), proposedBoundingBox, &playerWorld.velocity)
 
 	// determine groundedness
 	playerWorld.inAir = playerWorld.velocity.Y != 0
 
-	// do the movement
-	playerWorld.camera.Position = rl.Vector3Add(playerWorld.camera.Position, playerWorld.velocity)
-	playerWorld.camera.Target = rl.Vector3Add(playerWorld.camera.Target, playerWorld.velocity)
-	playerWorld.boundingBox.Min = rl.Vector3Add(playerWorld.boundingBox.Min, playerWorld.velocity)
-	playerWorld.boundingBox.Max = rl.Vector3Add(playerWorld.boundingBox.Max, playerWorld.velocity)
-
 	// movement affects accuracy
 	if rl.Vector3Length(playerWorld.velocity) > accurateMovementSpeedThreshold {
 		playerWorld.isAccurate = false
@@ -128,10 +257,13 @@ func (playerWorld *playerWorld) update() {
 
 	currentGun := &playerWorld.guns.guns[playerWorld.currentGun]
 	switch {
-	case rl.IsMouseButtonDown(rl.MouseButtonLeft) && 0 < currentGun.ammo:
+	case currentGun.triggerPulled() && 0 < currentGun.ammo:
 		currentGun.ammo--
+		playerWorld.settings.setEffectVolume(currentGun.shootSound, 1)
 		rl.PlaySound(currentGun.shootSound)
 		playerWorld.sendShootMessage()
+		playerWorld.firedAt = time.Now()
+		playerWorld.ejectCasing()
 		playerWorld.gunState = shooting
 		currentGun.shootAnimation.setAnimationStart()
 		time.AfterFunc(time.Duration(currentGun.shootTime)*time.Millisecond, func() {
@@ -139,8 +271,8 @@ func (playerWorld *playerWorld) update() {
 		})
 
 		// recoil
-		rl.CameraPitch(&playerWorld.camera, recoilPitchSequence[currentGun.ammo%len(recoilPitchSequence)], 1, 0, 0)
-		rl.CameraYaw(&playerWorld.camera, recoilYawSequence[currentGun.ammo%len(recoilYawSequence)], 0)
+		rl.CameraPitch(&playerWorld.camera, currentGun.recoilPitchSequence[currentGun.ammo%len(currentGun.recoilPitchSequence)], 1, 0, 0)
+		rl.CameraYaw(&playerWorld.camera, currentGun.recoilYawSequence[currentGun.ammo%len(currentGun.recoilYawSequence)], 0)
 
 		// knockback
 		lookDirection := rl.Vector3Subtract(playerWorld.camera.Target, playerWorld.camera.Position)
@@ -155,20 +287,59 @@ func (playerWorld *playerWorld) update() {
 		} else {
 			skew = rl.Vector3Zero()
 		}
+		spread := currentGun.spread
+		if playerWorld.crouching {
+			skew = rl.Vector3Scale(skew, crouchInaccuracy)
+			spread *= crouchInaccuracy
+		}
 		target := rl.Vector3Add(playerWorld.camera.Target, skew)
-		direction := rl.Vector3Normalize(rl.Vector3Subtract(target, playerWorld.camera.Position))
-		ray := rl.Ray{Position: playerWorld.camera.Position, Direction: direction}
-		playerWorld.checkRayOtherPlayersCollision(ray)
-	case rl.IsKeyPressed(rl.KeyR):
+		right := rl.GetCameraRight(&playerWorld.camera)
+		up := rl.GetCameraUp(&playerWorld.camera)
+		pellets, headshots := make([]int, playerWorld.slots()), make([]int, playerWorld.slots())
+		for range currentGun.pellets {
+			// each pellet strays somewhere within the spread
+			angle := rand.Float32() * 2 * math.Pi
+			stray := float32(math.Sqrt(rand.Float64())) * spread
+			pelletTarget := rl.Vector3Add(target, rl.Vector3Add(
+				rl.Vector3Scale(right, stray*float32(math.Cos(float64(angle)))),
+				rl.Vector3Scale(up, stray*float32(math.Sin(float64(angle)))),
+			))
+			direction := rl.Vector3Normalize(rl.Vector3Subtract(pelletTarget, playerWorld.camera.Position))
+			ray := rl.Ray{Position: playerWorld.camera.Position, Direction: direction}
+			hits := playerWorld.checkRayOtherPlayersCollision(ray)
+			playerWorld.addOwnTracer(ray, hits)
+			for _, hit := range hits {
+				pellets[hit.id]++
+				playerWorld.hitFeedback.aim(hit.id, hit.point)
+				if hit.headshot {
+					headshots[hit.id]++
+				}
+			}
+		}
+
+		// one hit for each player, however many pellets landed, the hitmarker
+		// waits for the server to say it did
+		for hitPlayerId, hitPellets := range pellets {
+			if hitPellets == 0 {
+				continue
+			}
+			playerWorld.sendHitMessage(hitPlayerId, currentGun.kind, hitPellets, headshots[hitPlayerId])
+		}
+	case playerWorld.throwGrenade():
+	case rl.IsKeyPressed(reloadKey):
 		playerWorld.gunState = reload
+		playerWorld.settings.setEffectVolume(currentGun.reloadSound, 1)
 		rl.PlaySound(currentGun.reloadSound)
+		playerWorld.sendActionMessage(protocol.Reload, currentGun.kind)
 		time.AfterFunc(time.Duration(currentGun.reloadTime)*time.Second, func() {
 			playerWorld.gunState = idle
 			currentGun.ammo = currentGun.capacity
 		})
-	case rl.IsKeyPressed(rl.KeyQ):
+	case rl.IsKeyPressed(swapKey) && playerWorld.hasPrimary():
 		playerWorld.gunState = swapping
+		playerWorld.settings.setEffectVolume(playerWorld.swapSound, 1)
 		rl.PlaySound(playerWorld.swapSound)
+		playerWorld.sendActionMessage(protocol.Swap, playerWorld.guns.guns[(playerWorld.currentGun+1)%len(playerWorld.guns.guns)].kind)
 		time.AfterFunc(time.Duration(swapTime)*time.Second, func() {
 			playerWorld.gunState = idle
 			playerWorld.currentGun = (playerWorld.currentGun + 1) % len(playerWorld.guns.guns)
@@ -178,39 +349,58 @@ func (playerWorld *playerWorld) update() {
 	// scope
 	if rl.IsMouseButtonDown(rl.MouseButtonRight) && (playerWorld.gunState == idle || playerWorld.gunState == shooting) && currentGun.hasScope {
 		playerWorld.scoped = true
-		playerWorld.lookSensitivity = scopeSensitivity
 	} else {
 		playerWorld.scoped = false
-		playerWorld.lookSensitivity = lookSensitivity
 	}
 }
 
+// tell the server the player started reloading, or swapping to a gun, so
+// other players can see and hear it
+func (playerWorld *playerWorld) sendActionMessage(action protocol.Action, gun protocol.Gun) {
+	playerWorld.connMutex.Lock()
+	if err := writeMessage(playerWorld.conn, protocol.EncodeActionMessage(action, gun)); err != nil {
+		slog.Warn("Could not send message", "header", protocol.ActionMessage, "error", err)
+	}
+	playerWorld.connMutex.Unlock()
+}
+
 // tell the server the player shot a gun, so it can broadcast to other players to let them know and play a gunshot sound
 func (playerWorld *playerWorld) sendShootMessage() {
 	playerWorld.connMutex.Lock()
-	if err := playerWorld.conn.WriteMessage(websocket.BinaryMessage, []byte{byte(shotMessage)}); err != nil {
-		log.Println(err)
+	if err := writeMessage(playerWorld.conn, protocol.EncodeShotMessage()); err != nil {
+		slog.Warn("Could not send message", "header", protocol.ShotMessage, "error", err)
 	}
 	playerWorld.connMutex.Unlock()
 }
 
 // https://github.com/froopy090/fps-game/blob/master/include/Utility/Collision.h#L79
-func (playerWorld *playerWorld) handleCollision(playerHorizontalPosition rl.Vector2, playerBoundingBox rl.BoundingBox, velocity *rl.Vector3) {
-	// use region tree data structure to only fetch the bounding boxes near the player
-	for _, blockBoundingBox := range playerWorld.localBoundingBlocks(playerHorizontalPosition) {
-		if !rl.CheckCollisionBoxes(playerBoundingBox, *blockBoundingBox) {
+func (playerWorld *playerWorld) handleCollision(playerBoundingBox rl.BoundingBox, velocity *rl.Vector3) {
+	// use region tree data structure to only fetch the blocks near the player
+	for _, block := range playerWorld.solidBlocksNear(playerWorld.boundingBox.Min) {
+		if !rl.CheckCollisionBoxes(playerBoundingBox, block.boundingBox) {
 			continue
 		}
+		blockBoundingBox := &block.boundingBox
 
-		// y axis
-		if playerBoundingBox.Min.Y <= blockBoundingBox.Min.Y &&
-			blockBoundingBox.Max.Y <= playerBoundingBox.Max.Y {
-			oldPlayerWorldCameraPositionY := playerWorld.camera.Position.Y
-			playerWorld.camera.Position.Y = blockBoundingBox.Min.Y + cameraHeight
-			playerWorld.camera.Target.Y += playerWorld.camera.Position.Y - oldPlayerWorldCameraPositionY
-			playerWorld.boundingBox.Min.Y = blockBoundingBox.Min.Y
-			playerWorld.boundingBox.Max.Y = blockBoundingBox.Min.Y + playerHeight
+		// y axis, over a ramp only what is under its top is solid
+		top := block.mapBlock.TopUnder(vectorToMap(playerBoundingBox.Min), vectorToMap(playerBoundingBox.Max))
+		if playerBoundingBox.Min.Y >= top {
+			continue
+		}
+		// land on, or step up onto, a top not far above our feet
+		if velocity.Y <= 0 && playerWorld.boundingBox.Min.Y >= top-stepHeight {
+			rise := top - playerWorld.boundingBox.Min.Y
+			playerWorld.camera.Position.Y += rise
+			playerWorld.camera.Target.Y += rise
+			playerWorld.boundingBox.Min.Y = top
+			playerWorld.boundingBox.Max.Y = top + playerWorld.bodyHeight()
+			velocity.Y = 0
+			continue
+		}
+		// bump our head on the underside of a block above us
+		if velocity.Y > 0 && playerWorld.boundingBox.Max.Y <= blockBoundingBox.Min.Y {
 			velocity.Y = 0
+			continue
 		}
 
 		// x z axis
@@ -275,7 +465,6 @@ const (
 	crosshairXLocation = textXLocation
 	crosshairYLocation = textYLocation
 	crossHairWidth     = 2
-	crossHairLength    = 5
 	scopeWidth         = 256
 	scopeHeight        = 256
 	halfScopeWidth     = scopeWidth >> 1
@@ -292,30 +481,55 @@ const (
 func (playerWorld *playerWorld) drawHud() {
 	// optional statistics board
 	if playerWorld.statisticsBoardRequested {
-		// round
-		rl.DrawTextEx(playerWorld.font, fmt.Sprintf("()::%02d", playerWorld.round), rl.Vector2{X: leftMargin, Y: topMargin + (lineSpace * 2)}, fontSize, 0, rl.Black)
+		playerWorld.drawScoreboard()
+	}
 
-		// team A points
-		rl.DrawTextEx(playerWorld.font, fmt.Sprintf("~A::%02d", playerWorld.teamAPoints), rl.Vector2{X: leftMargin, Y: topMargin + (lineSpace * 3)}, fontSize, 0, rl.Black)
+	playerWorld.drawScaled(rl.Vector2{X: internalWindowWidth, Y: 0}, func() {
+		playerWorld.killFeed.draw(playerWorld.font)
+	})
 
-		// team B points
-		rl.DrawTextEx(playerWorld.font, fmt.Sprintf("~B::%02d", playerWorld.teamBPoints), rl.Vector2{X: leftMargin, Y: topMargin + (lineSpace * 4)}, fontSize, 0, rl.Black)
+	// nothing is played for until the match starts
+	if playerWorld.warmup {
+		playerWorld.drawScaled(rl.Vector2{X: centerX, Y: 0}, func() {
+			rl.DrawTextEx(playerWorld.font, "WARMUP", rl.Vector2{X: centerX - 30, Y: topMargin}, fontSize, 0, rl.Black)
+		})
+	}
 
-		// kill death board
-		for i, otherPlayer := range playerWorld.otherPlayers {
-			if playerWorld.id == i {
-				rl.DrawTextEx(playerWorld.font, fmt.Sprintf("%d K:%02d D:%02d", i, playerWorld.killAmount, playerWorld.deathAmount), rl.Vector2{X: leftMargin, Y: topMargin + float32(lineSpace*(5+i))}, fontSize, 0, rl.Black)
-			} else if otherPlayer.otherPlayerState != nonExistent {
-				rl.DrawTextEx(playerWorld.font, fmt.Sprintf("%d K:%02d D:%02d", i, otherPlayer.killAmount, otherPlayer.deathAmount), rl.Vector2{X: leftMargin, Y: topMargin + float32(lineSpace*(5+i))}, fontSize, 0, rl.Black)
-			}
-		}
+	// round timer
+	if left, ok := playerWorld.roundTimeLeft(); ok {
+		seconds := int(left.Seconds() + 0.999)
+		playerWorld.drawScaled(rl.Vector2{X: centerX, Y: 0}, func() {
+			rl.DrawTextEx(playerWorld.font, fmt.Sprintf("%d:%02d", seconds/60, seconds%60), rl.Vector2{X: centerX - 15, Y: topMargin}, fontSize, 0, rl.Black)
+		})
 	}
+	playerWorld.drawScaled(rl.Vector2{X: centerX, Y: 0}, playerWorld.drawScoreTicker)
+	playerWorld.drawScaled(rl.Vector2{X: centerX, Y: centerY}, playerWorld.drawRoundBanner)
+	playerWorld.drawScaled(rl.Vector2{X: centerX, Y: centerY}, playerWorld.drawCountdown)
 
-	// no HUD in limbo mode except statistics board
+	playerWorld.drawVote()
+	playerWorld.drawSaid()
+	playerWorld.drawStreak()
+
+	if playerWorld.watching() {
+		playerWorld.drawScaled(rl.Vector2{X: internalWindowWidth, Y: internalWindowHeight}, playerWorld.drawFollowing)
+	}
+
+	// items to buy before the round starts
+	playerWorld.drawBuyMenu()
+	playerWorld.drawVoteMenu()
+	playerWorld.settings.draw(playerWorld.font)
+	playerWorld.drawScaled(rl.Vector2Zero(), playerWorld.drawNetStats)
+
+	// no HUD in limbo mode except statistics board and kill feed
 	if playerWorld.playerState == limbo {
 		return
 	}
 
+	// where gunshots and footsteps came from, for those who cannot hear them
+	if playerWorld.settings.SoundIndicators {
+		playerWorld.soundIndicators.draw(&playerWorld.camera)
+	}
+
 	currentGun := playerWorld.guns.guns[playerWorld.currentGun]
 
 	// handle scoping
@@ -332,46 +546,78 @@ func (playerWorld *playerWorld) drawHud() {
 		rl.DrawRectangle(centerX+halfScopeWidth, 0, centerX-halfScopeWidth, internalWindowHeight, rl.Black)
 		return
 	} else {
-		playerWorld.camera.Fovy = defaultFovy
+		playerWorld.camera.Fovy = playerWorld.settings.Fov
 	}
 
 	// draw gun depending on its state
 	switch playerWorld.gunState {
 	case idle:
 		if currentGun.hasCrossHair {
-			drawCrosshair()
+			drawCrosshair(playerWorld.settings.Crosshair)
 		}
 		rl.DrawTexturePro(currentGun.shootAnimation.atlas, currentGun.shootAnimation.rectangles[0], swayedGunRectangle(playerWorld.camera.Position, playerWorld.camera.Target, playerWorld.camera.Up, playerWorld.velocity, currentGun.gunRectangle), rl.Vector2Zero(), 0, rl.White)
 	case shooting:
 		if currentGun.hasCrossHair {
-			drawCrosshair()
+			drawCrosshair(playerWorld.settings.Crosshair)
 		}
-		currentGun.shootAnimation.drawSpriteAnimationPro(swayedGunRectangle(playerWorld.camera.Position, playerWorld.camera.Target, playerWorld.camera.Up, playerWorld.velocity, currentGun.gunRectangle))
+		gunRectangle := swayedGunRectangle(playerWorld.camera.Position, playerWorld.camera.Target, playerWorld.camera.Up, playerWorld.velocity, currentGun.gunRectangle)
+		currentGun.shootAnimation.drawSpriteAnimationPro(gunRectangle)
+		playerWorld.drawMuzzleFlash(&currentGun, gunRectangle)
 	case reload:
-		rl.DrawTextEx(playerWorld.font, "RELOADING...", rl.Vector2{X: textXLocation, Y: textYLocation}, 20, 0, rl.Black)
+		playerWorld.drawScaled(rl.Vector2{X: centerX, Y: centerY}, func() {
+			rl.DrawTextEx(playerWorld.font, "RELOADING...", rl.Vector2{X: textXLocation, Y: textYLocation}, 20, 0, rl.Black)
+		})
 	case swapping:
-		rl.DrawTextEx(playerWorld.font, "SWAPPING...", rl.Vector2{X: textXLocation, Y: textYLocation}, 20, 0, rl.Black)
+		playerWorld.drawScaled(rl.Vector2{X: centerX, Y: centerY}, func() {
+			rl.DrawTextEx(playerWorld.font, "SWAPPING...", rl.Vector2{X: textXLocation, Y: textYLocation}, 20, 0, rl.Black)
+		})
 	}
 
+	// where everyone we know of is
+	playerWorld.drawScaled(rl.Vector2{X: 0, Y: internalWindowHeight}, playerWorld.drawMinimap)
+
+	playerWorld.drawScaled(rl.Vector2Zero(), playerWorld.drawStatus)
+}
+
+// health, ammo, grenades, money and armor in the top left corner
+func (playerWorld *playerWorld) drawStatus() {
+	currentGun := playerWorld.guns.guns[playerWorld.currentGun]
+
 	// health
 	rl.DrawTextEx(playerWorld.font, fmt.Sprintf("<3::%02d", playerWorld.health), rl.Vector2{X: leftMargin, Y: topMargin + (lineSpace * 0)}, fontSize, 0, rl.Black)
+	if playerWorld.healed > 0 {
+		rl.DrawTextEx(playerWorld.font, fmt.Sprintf("      +%d", playerWorld.healed), rl.Vector2{X: leftMargin, Y: topMargin + (lineSpace * 0)}, fontSize, 0, rl.Red)
+	}
 
 	// ammo
-	rl.DrawTextEx(playerWorld.font, fmt.Sprintf("==::%02d", currentGun.ammo), rl.Vector2{X: leftMargin, Y: topMargin + (lineSpace * 1)}, fontSize, 0, rl.Black)
+	rl.DrawTextEx(playerWorld.font, fmt.Sprintf("==::%02d o:%d s:%d f:%d", currentGun.ammo, playerWorld.grenadesLeft[protocol.Frag], playerWorld.grenadesLeft[protocol.Smoke], playerWorld.grenadesLeft[protocol.Flash]), rl.Vector2{X: leftMargin, Y: topMargin + (lineSpace * 1)}, fontSize, 0, rl.Black)
+
+	// money and armor
+	rl.DrawTextEx(playerWorld.font, fmt.Sprintf("$::%04d []::%d", playerWorld.money, playerWorld.armor), rl.Vector2{X: leftMargin, Y: topMargin + (lineSpace * 2)}, fontSize, 0, rl.Black)
+}
+
+// draw part of the HUD bigger or smaller by the UI scale, growing away from
+// the point on the edge of the screen it is up against so it stays on screen;
+// the scoreboard and menus already fill the screen, so are left as they are
+func (playerWorld *playerWorld) drawScaled(anchor rl.Vector2, draw func()) {
+	rl.BeginMode2D(rl.Camera2D{Offset: anchor, Target: anchor, Zoom: playerWorld.settings.UiScale})
+	draw()
+	rl.EndMode2D()
 }
 
-func drawCrosshair() {
+// the crosshair's size and colour come from the config
+func drawCrosshair(crosshair crosshairConfig) {
 	rl.DrawLineEx(
-		rl.Vector2{X: float32(crosshairXLocation), Y: float32(crosshairYLocation - crossHairLength)},
-		rl.Vector2{X: float32(crosshairXLocation), Y: float32(crosshairYLocation + crossHairLength)},
-		crossHairWidth,
-		rl.Black,
+		rl.Vector2{X: float32(crosshairXLocation), Y: crosshairYLocation - crosshair.Length},
+		rl.Vector2{X: float32(crosshairXLocation), Y: crosshairYLocation + crosshair.Length},
+		crosshair.Width,
+		crosshair.colour(),
 	)
 	rl.DrawLineEx(
-		rl.Vector2{X: float32(crosshairXLocation - crossHairLength), Y: float32(crosshairYLocation)},
-		rl.Vector2{X: float32(crosshairXLocation + crossHairLength), Y: float32(crosshairYLocation)},
-		crossHairWidth,
-		rl.Black,
+		rl.Vector2{X: crosshairXLocation - crosshair.Length, Y: float32(crosshairYLocation)},
+		rl.Vector2{X: crosshairXLocation + crosshair.Length, Y: float32(crosshairYLocation)},
+		crosshair.Width,
+		crosshair.colour(),
 	)
 }
 
@@ -387,9 +633,13 @@ func swayedGunRectangle(position, target, up, velocity rl.Vector3, gunRectangle
 }
 
 func (playerWorld *playerWorld) drawWorld() {
+	playerWorld.applyLighting()
 	for _, block := range playerWorld.blocks {
-		rl.DrawModel(block.model, block.centrePosition, 1, rl.White)
+		block.draw(rl.White)
 	}
+	playerWorld.drawDoors()
+	playerWorld.drawShadows()
+	playerWorld.drawJumpPads()
 }
 
 func (playerWorld *playerWorld) draw() {
@@ -398,18 +648,37 @@ func (playerWorld *playerWorld) draw() {
 	} else {
 		rl.ClearBackground(rl.SkyBlue)
 	}
-	rl.BeginMode3D(playerWorld.camera)
+	if playerWorld.killcam.playing() {
+		playerWorld.drawKillcam()
+		playerWorld.drawReconnecting()
+		return
+	}
+	rl.BeginMode3D(playerWorld.shakenCamera())
 	playerWorld.drawWorld()
+	playerWorld.drawHealthPacks()
 	playerWorld.drawOtherPlayers()
+	playerWorld.tracers.draw()
+	playerWorld.impacts.draw()
+	playerWorld.thrownGrenades.draw(playerWorld.camera, playerWorld.smokeTexture)
+	playerWorld.particles.draw(playerWorld.camera, [particleLooks]rl.Texture2D{smokeParticle: playerWorld.smokeTexture, glowParticle: playerWorld.muzzleFlashTexture})
+	playerWorld.drawMarkers()
+	if playerWorld.watching() {
+		playerWorld.drawOutlines()
+	}
 	rl.EndMode3D()
+	playerWorld.drawOtherPlayerNames()
+	playerWorld.drawMarkerLabels()
+	playerWorld.drawHitFeedback()
+	playerWorld.drawVignette()
 	playerWorld.drawHud()
+	playerWorld.thrownGrenades.drawFlash()
+	playerWorld.drawReconnecting()
 }
 
-// unload models in world
+// unload models and textures in world
 func (playerWorld *playerWorld) cleanUp() {
-	for _, block := range playerWorld.blocks {
-		rl.UnloadModel(block.model)
-	}
+	playerWorld.unload()
+	playerWorld.voice.unload()
 }
 
 // set the player's location
@@ -440,11 +709,12 @@ const (
 const (
 	cameraHeight         = 1.5
 	playerHeight         = cameraHeight + 0.5
-	lookSensitivity      = 0.005
-	scopeSensitivity     = lookSensitivity / 5
+	crouchCameraHeight   = 0.9
+	crouchHeight         = crouchCameraHeight + 0.4
 	defaultFovy          = 90
 	zoomFovy             = 20
 	boundingBoxHalfWidth = 0.35
+	stepHeight           = 0.5 // the highest ledge walked up onto without jumping
 )
 
 var defaultPlayerPosition = rl.Vector3{X: 0, Y: cameraHeight, Z: 0}
@@ -453,14 +723,31 @@ type player struct {
 	camera                                                 rl.Camera
 	velocity                                               rl.Vector3
 	boundingBox                                            rl.BoundingBox
-	lookSensitivity                                        float32
 	inAir, isAccurate, statisticsBoardRequested, isDamaged bool
+	crouching, minimapHidden, netStatsShown                bool
+	onJumpPad                                              bool      // so a pad only launches us as we step onto it
+	healed                                                 int       // shown next to our health for a moment after healing
+	damagedAt                                              time.Time // when we last lost health, to shake the camera
+	firedAt                                                time.Time // when we last fired, for the muzzle flash
 	guns
-	font              rl.Font
-	genericShootSound rl.Sound
-	hitMarkerSound    rl.Sound
+	font               rl.Font
+	genericShootSounds [protocol.MaxPlayers]rl.Sound
+	hitMarkerSound     rl.Sound
+	headshotSound      rl.Sound
+	explosionSound     rl.Sound
+	healthPackSound    rl.Sound
+	painSound          rl.Sound
+	heartbeatSound     rl.Sound
+	streakSounds       [streakKinds]rl.Sound
+	smokeTexture       rl.Texture2D
+	muzzleFlashTexture rl.Texture2D
+	lightingShader     *rl.Shader // so a reloaded shader is picked up, see reload.go
+	roundStartStinger  rl.Sound
 	playerState
 	health, killAmount, deathAmount int
+	assistAmount                    int
+	grenadesLeft                    [protocol.GrenadeKinds]int
+	money, armor                    int
 }
 
 func newPlayer(resources *resources) *player {
@@ -472,18 +759,67 @@ func newPlayer(resources *resources) *player {
 			Fovy:       90,
 			Projection: rl.CameraPerspective,
 		},
-		boundingBox:       generatePlayerBoundingBox(positionOffsetHeight(defaultPlayerPosition, cameraHeight), boundingBoxHalfWidth, playerHeight),
-		lookSensitivity:   lookSensitivity,
-		guns:              *newGuns(resources),
-		font:              resources.mainFont,
-		genericShootSound: resources.genericShootSound,
-		hitMarkerSound:    resources.hitMarkerSound,
-		health:            maxHealth,
+		boundingBox:        generatePlayerBoundingBox(positionOffsetHeight(defaultPlayerPosition, cameraHeight), boundingBoxHalfWidth, playerHeight),
+		guns:               *newGuns(resources),
+		font:               resources.mainFont,
+		genericShootSounds: resources.genericShootSounds,
+		hitMarkerSound:     resources.hitMarkerSound,
+		headshotSound:      resources.headshotSound,
+		explosionSound:     resources.explosionSound,
+		healthPackSound:    resources.healthPackSound,
+		painSound:          resources.painSound,
+		heartbeatSound:     resources.heartbeatSound,
+		streakSounds:       resources.streakSounds,
+		smokeTexture:       resources.smokeTexture,
+		muzzleFlashTexture: resources.muzzleFlashTexture,
+		lightingShader:     &resources.lighting,
+		roundStartStinger:  resources.roundStartStinger,
+		health:             protocol.MaxHealth,
+		money:              protocol.StartingMoney,
+	}
+}
+
+// how far above the player's feet the camera is
+func (player *player) eyeHeight() float32 {
+	if player.crouching {
+		return crouchCameraHeight
+	}
+	return cameraHeight
+}
+
+func (player *player) bodyHeight() float32 {
+	if player.crouching {
+		return crouchHeight
+	}
+	return playerHeight
+}
+
+// crouch while the crouch key is held, only standing back up if there is
+// room above our head
+func (playerWorld *playerWorld) updateCrouch() {
+	crouching := rl.IsKeyDown(crouchKey)
+	if crouching == playerWorld.crouching {
+		return
+	}
+	if !crouching {
+		// slightly narrower, so walls we are up against do not count
+		head := rl.BoundingBox{
+			Min: rl.Vector3{X: playerWorld.boundingBox.Min.X + 0.01, Y: playerWorld.boundingBox.Max.Y, Z: playerWorld.boundingBox.Min.Z + 0.01},
+			Max: rl.Vector3{X: playerWorld.boundingBox.Max.X - 0.01, Y: playerWorld.boundingBox.Min.Y + playerHeight, Z: playerWorld.boundingBox.Max.Z - 0.01},
+		}
+		for _, block := range playerWorld.solidBlocksNear(playerWorld.boundingBox.Min) {
+			if rl.CheckCollisionBoxes(head, block.boundingBox) {
+				return
+			}
+		}
 	}
-}
 
-func (player *player) horizontalPosition() rl.Vector2 {
-	return rl.Vector2{X: player.camera.Position.X, Y: player.camera.Position.Z}
+	previousEyeHeight := playerWorld.eyeHeight()
+	playerWorld.crouching = crouching
+	rise := playerWorld.eyeHeight() - previousEyeHeight
+	playerWorld.camera.Position.Y += rise
+	playerWorld.camera.Target.Y += rise
+	playerWorld.boundingBox.Max.Y = playerWorld.boundingBox.Min.Y + playerWorld.bodyHeight()
 }
 
 // get position of a player at their feet
@@ -505,391 +841,265 @@ func (playerWorld *playerWorld) reset() {
 	playerWorld.guns.guns[1].ammo = playerWorld.guns.guns[1].capacity
 	playerWorld.playerState = limbo
 	playerWorld.scoped = false
-	playerWorld.health = maxHealth
+	playerWorld.crouching = false
+	playerWorld.health = protocol.MaxHealth
+	playerWorld.thrownGrenades.clear()
+	playerWorld.impacts.clear()
+	playerWorld.particles.clear()
+	playerWorld.markers.clear()
+	playerWorld.healthPacks.clear()
+	playerWorld.doors.reset(playerWorld.mapDoors)
 	for i := range playerWorld.otherPlayers {
 		otherPlayer := &playerWorld.otherPlayers[i]
 		if otherPlayer.otherPlayerState != nonExistent {
 			otherPlayer.otherPlayerState = alive
 		}
+		otherPlayer.healthLost = 0
 	}
 }
 
 //////// world
 
-var (
-	aSpawnLocations = []rl.Vector3{
-		rl.Vector3{X: -10, Y: 0, Z: 5},
-		rl.Vector3{X: -10, Y: 0, Z: 0},
-		rl.Vector3{X: -10, Y: 0, Z: -5},
-	}
-	bSpawnLocations = []rl.Vector3{
-		rl.Vector3{X: 10, Y: 0, Z: 5},
-		rl.Vector3{X: 10, Y: 0, Z: 0},
-		rl.Vector3{X: 10, Y: 0, Z: -5},
-	}
-)
-
 type world struct {
-	blocks []*block
+	name                string
+	blocks              []*block
+	textures            []rl.Texture2D
+	spawnLocations      [2][]rl.Vector3 // indexed by team
+	mapBlocks           []maps.Block    // what grenades bounce off, along with closed doors
+	doorBlocks          []*block        // indexed like the map's doors
+	mapDoors            []maps.Door     // how the doors start each round
+	healthPackLocations []rl.Vector3    // on the floor
+	shadows             [][]rl.Vector3  // cast by the blocks, see lighting.go
+	jumpPads            []maps.JumpPad
+	teleporters         []maps.Teleporter
+	files               resourceFiles // what the textures were read through
 	regionTree
 }
 
-func (world *world) localBoundingBlocks(position rl.Vector2) []*rl.BoundingBox {
-	for _, leaf := range world.regionTree.leaves {
-		if position.X >= leaf.bottomLeft.X && position.X <= leaf.topRight.X &&
-			position.Y >= leaf.bottomLeft.Y && position.Y <= leaf.topRight.Y {
-			return leaf.boundingBoxes
-		}
-	}
-
-	return make([]*rl.BoundingBox, 0)
-}
-
-func newWorld(resources *resources) *world {
-	floorTexture := resources.textures.floorTexture
-	outerWallTexture := resources.textures.outerWallTexture
-	innerWallTexture := resources.textures.innerWallTexture
-
-	floor := newFloor()
-	floor.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = floorTexture
-
-	northBarrier := newNorthOuterWall()
-	northBarrier.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = outerWallTexture
-	southBarrier := newSouthOuterWall()
-	southBarrier.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = outerWallTexture
-	eastBarrier := newEastOuterWall()
-	eastBarrier.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = outerWallTexture
-	westBarrier := newWestOuterWall()
-	westBarrier.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = outerWallTexture
-
-	midAWall := newMidAWall()
-	midAWall.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	botAWall := newBotAWall()
-	botAWall.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	topAWall := newTopAWall()
-	topAWall.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	botAWallComp := newBotAWallComp()
-	botAWallComp.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	topAWallComp := newTopAWallComp()
-	topAWallComp.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	botAWallSide := newBotAWallSide()
-	botAWallSide.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	topAWallSide := newTopAWallSide()
-	topAWallSide.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	botAWallSideComp := newBotAWallSideComp()
-	botAWallSideComp.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	topAWallSideComp := newTopAWallSideComp()
-	topAWallSideComp.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	midBWall := newMidBWall()
-	midBWall.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	botBWall := newBotBWall()
-	botBWall.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	topBWall := newTopBWall()
-	topBWall.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	botBWallComp := newBotBWallComp()
-	botBWallComp.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	topBWallComp := newTopBWallComp()
-	topBWallComp.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	botBWallSide := newBotBWallSide()
-	botBWallSide.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	topBWallSide := newTopBWallSide()
-	topBWallSide.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	botBWallSideComp := newBotBWallSideComp()
-	botBWallSideComp.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	topBWallSideComp := newTopBWallSideComp()
-	topBWallSideComp.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = innerWallTexture
-
-	blocks := []*block{
-		floor,
-		northBarrier, southBarrier, eastBarrier, westBarrier,
-		midAWall, botAWall, topAWall, midBWall, botBWall, topBWall,
-		botAWallComp, topAWallComp, botBWallComp, topBWallComp,
-		botAWallSide, topAWallSide, botBWallSide, topBWallSide,
-		botAWallSideComp, topAWallSideComp, botBWallSideComp, topBWallSideComp,
-	}
-
-	regionTree := newRegionTree()
-	for _, block := range blocks {
-		regionTree.insertBlockIntoTree(block.boundingBox)
-	}
-
-	return &world{
-		blocks:     blocks,
-		regionTree: *regionTree,
-	}
-}
-
-//////// block
-
-const wallHeight = 6
-
-type block struct {
-	boundingBox    rl.BoundingBox
-	model          rl.Model
-	centrePosition rl.Vector3
-}
-
-func newFloor() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: -11.5, Y: 0, Z: -9.5}, rl.Vector3{X: 11.5, Y: 0, Z: 9.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshPlane(23, 19, 1, 1)),
-		centrePosition: rl.Vector3Zero(),
-	}
-}
-
-// outer boundary walls
-func newNorthOuterWall() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: -12.5, Y: 0, Z: 9.5}, rl.Vector3{X: 12.5, Y: wallHeight, Z: 10.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(23, wallHeight, 1)),
-		centrePosition: rl.Vector3{X: 0, Y: wallHeight / 2, Z: 10},
-	}
-}
-
-func newSouthOuterWall() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: -12.5, Y: 0, Z: -10.5}, rl.Vector3{X: 12.5, Y: wallHeight, Z: -9.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(23, wallHeight, 1)),
-		centrePosition: rl.Vector3{X: 0, Y: wallHeight / 2, Z: -10},
-	}
-}
-
-func newEastOuterWall() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: -12.5, Y: 0, Z: -10.5}, rl.Vector3{X: -11.5, Y: wallHeight, Z: 10.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(1, wallHeight, 19)),
-		centrePosition: rl.Vector3{X: -12, Y: wallHeight / 2, Z: 0},
-	}
-}
-
-func newWestOuterWall() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: 11.5, Y: 0, Z: -10.5}, rl.Vector3{X: 12.5, Y: wallHeight, Z: 10.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(1, wallHeight, 19)),
-		centrePosition: rl.Vector3{X: 12, Y: wallHeight / 2, Z: 0},
-	}
-}
-
-// inner walls
-func newMidAWall() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: -9.5, Y: 0, Z: -1.5}, rl.Vector3{X: -8.5, Y: wallHeight, Z: 1.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(1, wallHeight, 3)),
-		centrePosition: rl.Vector3{X: -9, Y: wallHeight / 2, Z: 0},
-	}
+// a map to switch to, and a way to tell the receiver it has been switched to
+type worldChange struct {
+	gameMap *maps.Map
+	done    chan struct{}
 }
 
-func newBotAWall() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: -9.5, Y: 0, Z: -6.5}, rl.Vector3{X: -8.5, Y: wallHeight, Z: -3.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(1, wallHeight, 3)),
-		centrePosition: rl.Vector3{X: -9, Y: wallHeight / 2, Z: -5},
+func (world *world) unload() {
+	for _, block := range world.blocks {
+		rl.UnloadModel(block.model)
 	}
-}
-
-func newTopAWall() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: -9.5, Y: 0, Z: 3.5}, rl.Vector3{X: -8.5, Y: wallHeight, Z: 6.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(1, wallHeight, 3)),
-		centrePosition: rl.Vector3{X: -9, Y: wallHeight / 2, Z: 5},
+	for _, block := range world.doorBlocks {
+		rl.UnloadModel(block.model)
 	}
-}
-
-func newBotAWallComp() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: -9.5, Y: 0, Z: -6.5}, rl.Vector3{X: -6.5, Y: wallHeight, Z: -5.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(2, wallHeight, 1)),
-		centrePosition: rl.Vector3{X: -7.5, Y: wallHeight / 2, Z: -6},
+	for _, texture := range world.textures {
+		world.files.unloadTexture(texture)
 	}
 }
 
-func newTopAWallComp() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: -9.5, Y: 0, Z: 5.5}, rl.Vector3{X: -6.5, Y: wallHeight, Z: 6.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(2, wallHeight, 1)),
-		centrePosition: rl.Vector3{X: -7.5, Y: wallHeight / 2, Z: 6},
+// the blocks in the regions holding someone with their feet at a position,
+// more than one where stacked regions meet
+func (world *world) localBlocks(feet rl.Vector3) []*block {
+	var blocks []*block
+	found := 0
+	for _, leaf := range world.regionTree.leaves {
+		if feet.X >= leaf.bottomLeft.X && feet.X <= leaf.topRight.X &&
+			feet.Z >= leaf.bottomLeft.Y && feet.Z <= leaf.topRight.Y &&
+			feet.Y >= leaf.lowest && feet.Y <= leaf.highest {
+			if found == 0 {
+				blocks = leaf.blocks
+			} else {
+				blocks = append(append(make([]*block, 0, len(blocks)+len(leaf.blocks)), blocks...), leaf.blocks...)
+			}
+			found++
+		}
 	}
+	return blocks
 }
 
-func newBotAWallSide() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: -4.5, Y: 0, Z: -6.5}, rl.Vector3{X: -1.5, Y: wallHeight, Z: -5.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(3, wallHeight, 1)),
-		centrePosition: rl.Vector3{X: -3, Y: wallHeight / 2, Z: -6},
+// the blocks near someone with their feet at a position that cannot be
+// walked through, the blocks in their region and any closed door
+func (playerWorld *playerWorld) solidBlocksNear(feet rl.Vector3) []*block {
+	local := playerWorld.localBlocks(feet)
+	closed := playerWorld.closedDoors()
+	if len(closed) == 0 {
+		return local
 	}
+	return append(append(make([]*block, 0, len(local)+len(closed)), local...), closed...)
 }
 
-func newTopAWallSide() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: -4.5, Y: 0, Z: 5.5}, rl.Vector3{X: -1.5, Y: wallHeight, Z: 6.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(3, wallHeight, 1)),
-		centrePosition: rl.Vector3{X: -3, Y: wallHeight / 2, Z: 6},
+// build the world described by a map file
+func newWorld(gameMap *maps.Map, files resourceFiles) *world {
+	// each texture is loaded once, no matter how many blocks use it
+	textures := make(map[string]rl.Texture2D, len(gameMap.Textures))
+	loadedTextures := make([]rl.Texture2D, 0, len(gameMap.Textures))
+	for name, path := range gameMap.Textures {
+		texture := files.mapTexture(path)
+		textures[name] = texture
+		loadedTextures = append(loadedTextures, texture)
 	}
-}
 
-func newBotAWallSideComp() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: -2.5, Y: 0, Z: -8.5}, rl.Vector3{X: -1.5, Y: wallHeight, Z: -5.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(1, wallHeight, 2)),
-		centrePosition: rl.Vector3{X: -2, Y: wallHeight / 2, Z: -7.5},
+	blocks := make([]*block, 0, len(gameMap.Blocks))
+	for _, mapBlock := range gameMap.Blocks {
+		block := newBlock(&mapBlock)
+		block.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = textures[mapBlock.Texture]
+		blocks = append(blocks, block)
 	}
-}
 
-func newTopAWallSideComp() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: -2.5, Y: 0, Z: 5.5}, rl.Vector3{X: -1.5, Y: wallHeight, Z: 8.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(1, wallHeight, 2)),
-		centrePosition: rl.Vector3{X: -2, Y: wallHeight / 2, Z: 7.5},
+	doorBlocks := make([]*block, 0, len(gameMap.Doors))
+	for _, mapDoor := range gameMap.Doors {
+		block := newBlock(&mapDoor.Block)
+		block.model.GetMaterials()[0].GetMap(rl.MapDiffuse).Texture = textures[mapDoor.Texture]
+		doorBlocks = append(doorBlocks, block)
 	}
-}
 
-func newMidBWall() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: 8.5, Y: 0, Z: -1.5}, rl.Vector3{X: 9.5, Y: wallHeight, Z: 1.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(1, wallHeight, 3)),
-		centrePosition: rl.Vector3{X: 9, Y: wallHeight / 2, Z: 0},
+	var shadows [][]rl.Vector3
+	for _, mapBlock := range gameMap.Blocks {
+		if shadow := blockShadow(&mapBlock); shadow != nil {
+			shadows = append(shadows, shadow)
+		}
 	}
-}
 
-func newBotBWall() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: 8.5, Y: 0, Z: -6.5}, rl.Vector3{X: 9.5, Y: wallHeight, Z: -3.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(1, wallHeight, 3)),
-		centrePosition: rl.Vector3{X: 9, Y: wallHeight / 2, Z: -5},
+	regionTree := newRegionTree(gameMap.Regions)
+	for _, block := range blocks {
+		regionTree.insertBlockIntoTree(block)
 	}
-}
 
-func newTopBWall() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: 8.5, Y: 0, Z: 3.5}, rl.Vector3{X: 9.5, Y: wallHeight, Z: 6.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(1, wallHeight, 3)),
-		centrePosition: rl.Vector3{X: 9, Y: wallHeight / 2, Z: 5},
+	return &world{
+		name:                gameMap.Name,
+		blocks:              blocks,
+		mapBlocks:           gameMap.Blocks,
+		doorBlocks:          doorBlocks,
+		mapDoors:            gameMap.Doors,
+		jumpPads:            gameMap.JumpPads,
+		teleporters:         gameMap.Teleporters,
+		healthPackLocations: mapVectors(gameMap.HealthPacks),
+		shadows:             shadows,
+		textures:            loadedTextures,
+		files:               files,
+		spawnLocations: [2][]rl.Vector3{
+			protocol.A: mapVectors(gameMap.Spawns.A),
+			protocol.B: mapVectors(gameMap.Spawns.B),
+		},
+		regionTree: *regionTree,
 	}
 }
 
-func newBotBWallComp() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: 6.5, Y: 0, Z: -6.5}, rl.Vector3{X: 9.5, Y: wallHeight, Z: -5.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(2, wallHeight, 1)),
-		centrePosition: rl.Vector3{X: 7.5, Y: wallHeight / 2, Z: -6},
-	}
+func mapVector(vector maps.Vector3) rl.Vector3 {
+	return rl.Vector3{X: vector[0], Y: vector[1], Z: vector[2]}
 }
 
-func newTopBWallComp() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: 6.5, Y: 0, Z: 5.5}, rl.Vector3{X: 9.5, Y: wallHeight, Z: 6.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(2, wallHeight, 1)),
-		centrePosition: rl.Vector3{X: 7.5, Y: wallHeight / 2, Z: 6},
-	}
+func vectorToMap(vector rl.Vector3) maps.Vector3 {
+	return maps.Vector3{vector.X, vector.Y, vector.Z}
 }
 
-func newBotBWallSide() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: 1.5, Y: 0, Z: -6.5}, rl.Vector3{X: 4.5, Y: wallHeight, Z: -5.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(3, wallHeight, 1)),
-		centrePosition: rl.Vector3{X: 3, Y: wallHeight / 2, Z: -6},
+func mapVectors(vectors []maps.Vector3) []rl.Vector3 {
+	converted := make([]rl.Vector3, len(vectors))
+	for i, vector := range vectors {
+		converted[i] = mapVector(vector)
 	}
+	return converted
 }
 
-func newTopBWallSide() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: 1.5, Y: 0, Z: 5.5}, rl.Vector3{X: 4.5, Y: wallHeight, Z: 6.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(3, wallHeight, 1)),
-		centrePosition: rl.Vector3{X: 3, Y: wallHeight / 2, Z: 6},
-	}
-}
+//////// block
 
-func newBotBWallSideComp() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: 1.5, Y: 0, Z: -8.5}, rl.Vector3{X: 2.5, Y: wallHeight, Z: -5.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(1, wallHeight, 2)),
-		centrePosition: rl.Vector3{X: 2, Y: wallHeight / 2, Z: -7.5},
+type block struct {
+	boundingBox    rl.BoundingBox
+	model          rl.Model
+	centrePosition rl.Vector3
+	mapBlock       maps.Block // for the top of a ramp
+	unlit          rl.Shader  // what the model is drawn with when lighting is off
+	tiltAxis       rl.Vector3 // a ramp's plane is tilted about this by tiltAngle degrees
+	tiltAngle      float32
+}
+
+func newBlock(mapBlock *maps.Block) *block {
+	// flat blocks such as the floor are planes, ramps are planes tilted to
+	// their slope, everything else is a cube
+	size := mapBlock.MeshSize()
+	block := &block{
+		boundingBox:    rl.NewBoundingBox(mapVector(mapBlock.Min), mapVector(mapBlock.Max)),
+		centrePosition: mapVector(mapBlock.MeshCentre()),
+		mapBlock:       *mapBlock,
+	}
+	var mesh rl.Mesh
+	switch {
+	case mapBlock.Rise != "":
+		run := size[0]
+		block.tiltAxis = rl.Vector3{Z: 1}
+		if mapBlock.Rise == maps.RisePositiveZ || mapBlock.Rise == maps.RiseNegativeZ {
+			run = size[2]
+			block.tiltAxis = rl.Vector3{X: -1}
+		}
+		block.tiltAngle = float32(math.Atan2(float64(size[1]), float64(run))) * rl.Rad2deg
+		if mapBlock.Rise == maps.RiseNegativeX || mapBlock.Rise == maps.RiseNegativeZ {
+			block.tiltAngle = -block.tiltAngle
+		}
+		slope := float32(math.Hypot(float64(run), float64(size[1])))
+		if run == size[0] {
+			mesh = rl.GenMeshPlane(slope, size[2], 1, 1)
+		} else {
+			mesh = rl.GenMeshPlane(size[0], slope, 1, 1)
+		}
+	case size[1] == 0:
+		mesh = rl.GenMeshPlane(size[0], size[2], 1, 1)
+	default:
+		mesh = rl.GenMeshCube(size[0], size[1], size[2])
 	}
+	block.model = rl.LoadModelFromMesh(mesh)
+	block.unlit = block.model.GetMaterials()[0].Shader
+	return block
 }
 
-func newTopBWallSideComp() *block {
-	return &block{
-		boundingBox:    rl.NewBoundingBox(rl.Vector3{X: 1.5, Y: 0, Z: 5.5}, rl.Vector3{X: 2.5, Y: wallHeight, Z: 8.5}),
-		model:          rl.LoadModelFromMesh(rl.GenMeshCube(1, wallHeight, 2)),
-		centrePosition: rl.Vector3{X: 2, Y: wallHeight / 2, Z: 7.5},
+func (block *block) draw(tint rl.Color) {
+	if block.tiltAngle == 0 {
+		rl.DrawModel(block.model, block.centrePosition, 1, tint)
+		return
 	}
+	rl.DrawModelEx(block.model, block.centrePosition, block.tiltAxis, block.tiltAngle, rl.Vector3{X: 1, Y: 1, Z: 1}, tint)
 }
 
 //////// region tree
 //////// data structure to make sure only the regions the player is in gets
-//////// checked for collisions
+//////// checked for collisions, regions stacked over each other split the
+//////// blocks of each floor between them
 
 type regionTree struct {
 	leaves []*regionTreeLeaf
 }
 
 type regionTreeLeaf struct {
-	bottomLeft    rl.Vector2
-	topRight      rl.Vector2
-	boundingBoxes []*rl.BoundingBox
-}
-
-func newRegionTree() *regionTree {
-	return &regionTree{
-		leaves: []*regionTreeLeaf{
-			&regionTreeLeaf{
-				bottomLeft:    rl.NewVector2(-11.5, 2.5),
-				topRight:      rl.NewVector2(0, 9.5),
-				boundingBoxes: make([]*rl.BoundingBox, 0),
-			},
-			&regionTreeLeaf{
-				bottomLeft:    rl.NewVector2(0, 2.5),
-				topRight:      rl.NewVector2(11.5, 9.5),
-				boundingBoxes: make([]*rl.BoundingBox, 0),
-			},
-			&regionTreeLeaf{
-				bottomLeft:    rl.NewVector2(-11.5, -2.5),
-				topRight:      rl.NewVector2(0, 2.5),
-				boundingBoxes: make([]*rl.BoundingBox, 0),
-			},
-			&regionTreeLeaf{
-				bottomLeft:    rl.NewVector2(0, -2.5),
-				topRight:      rl.NewVector2(11.5, 2.5),
-				boundingBoxes: make([]*rl.BoundingBox, 0),
-			},
-			&regionTreeLeaf{
-				bottomLeft:    rl.NewVector2(-11.5, -9.5),
-				topRight:      rl.NewVector2(0, -2.5),
-				boundingBoxes: make([]*rl.BoundingBox, 0),
-			},
-			&regionTreeLeaf{
-				bottomLeft:    rl.NewVector2(0, -9.5),
-				topRight:      rl.NewVector2(11.5, -2.5),
-				boundingBoxes: make([]*rl.BoundingBox, 0),
-			},
-		},
+	bottomLeft      rl.Vector2
+	topRight        rl.Vector2
+	lowest, highest float32 // the heights of the feet of those in it
+	blocks          []*block
+}
+
+func newRegionTree(regions []maps.Region) *regionTree {
+	leaves := make([]*regionTreeLeaf, 0, len(regions))
+	for _, region := range regions {
+		leaf := &regionTreeLeaf{
+			bottomLeft: rl.NewVector2(region.BottomLeft[0], region.BottomLeft[1]),
+			topRight:   rl.NewVector2(region.TopRight[0], region.TopRight[1]),
+			lowest:     float32(math.Inf(-1)),
+			highest:    float32(math.Inf(1)),
+			blocks:     make([]*block, 0),
+		}
+		if region.Heights != nil {
+			leaf.lowest, leaf.highest = region.Heights[0], region.Heights[1]
+		}
+		leaves = append(leaves, leaf)
 	}
+	return &regionTree{leaves: leaves}
 }
 
-// fills the region tree data structure with necessary bounding boxes in each leaf
-func (regionTree *regionTree) insertBlockIntoTree(boundingBox rl.BoundingBox) {
+// fills the region tree data structure with the blocks that someone in each
+// leaf could touch, from the floor under their feet to above their head
+func (regionTree *regionTree) insertBlockIntoTree(block *block) {
+	boundingBox := block.boundingBox
 	for _, leaf := range regionTree.leaves {
 		boundingBoxBottomLeft := rl.NewVector2(boundingBox.Min.X, boundingBox.Min.Z)
 		boundingBoxTopRight := rl.NewVector2(boundingBox.Max.X, boundingBox.Max.Z)
-		if checkRectangleCollision(boundingBoxBottomLeft, boundingBoxTopRight, leaf.bottomLeft, leaf.topRight) {
-			leaf.boundingBoxes = append(leaf.boundingBoxes, &boundingBox)
+		if checkRectangleCollision(boundingBoxBottomLeft, boundingBoxTopRight, leaf.bottomLeft, leaf.topRight) &&
+			boundingBox.Max.Y >= leaf.lowest-playerHeight && boundingBox.Min.Y <= leaf.highest+playerHeight {
+			leaf.blocks = append(leaf.blocks, block)
 		}
 	}
 }
@@ -944,48 +1154,97 @@ const (
 )
 
 type guns struct {
-	guns       [2]gun
+	guns       [2]gun // the handgun, then the primary gun bought, if any
+	primaries  [protocol.Primaries]gun
+	primary    protocol.Item
 	currentGun int
 	gunState
-	scoped    bool
-	swapSound rl.Sound
+	scoped      bool
+	buyPhase    bool // items can be bought until the round starts
+	buyMenuOpen bool
+	swapSound   rl.Sound
 }
 
 func newGuns(resources *resources) *guns {
-	return &guns{
-		guns: [2]gun{
-			*newHandgun(resources),
+	guns := &guns{
+		primaries: [protocol.Primaries]gun{
 			*newSniper(resources),
+			*newShotgun(resources),
+			*newSMG(resources),
+			*newRifle(resources),
 		},
+		primary:   protocol.NoPrimary,
 		swapSound: resources.swapSound,
 	}
+	guns.guns[0] = *newHandgun(resources)
+	return guns
 }
 
-var (
-	recoilPitchSequence = [3]float32{0.05, 0.04, 0.06}
-	recoilYawSequence   = [3]float32{0.02, -0.01, -0.015}
-)
+// our own gun of some kind, or how it would be if we had one
+func (guns *guns) gunOfKind(kind protocol.Gun) *gun {
+	if kind == protocol.Handgun {
+		return &guns.guns[0]
+	}
+	return &guns.primaries[kind]
+}
+
+func (guns *guns) hasPrimary() bool {
+	return guns.primary != protocol.NoPrimary
+}
+
+// swap in a newly bought primary gun, fully loaded and in hand, or fall back
+// to the handgun when we no longer have one
+func (guns *guns) setPrimary(primary protocol.Item) {
+	if primary == guns.primary {
+		return
+	}
+	guns.primary = primary
+	if !guns.hasPrimary() {
+		guns.currentGun = 0
+		guns.scoped = false
+		return
+	}
+	guns.guns[1] = guns.primaries[primary]
+	guns.guns[1].ammo = guns.guns[1].capacity
+	guns.currentGun = 1
+}
 
 type gun struct {
-	capacity, ammo, reloadTime, damage, shootTime int
-	knockback                                     float32
-	shootAnimation                                spriteAnimation
-	gunRectangle                                  rl.Rectangle
-	hasScope                                      bool
-	hasCrossHair                                  bool
-	scopeTexture                                  rl.Texture2D
-	shootSound                                    rl.Sound
-	reloadSound                                   rl.Sound
+	kind                                   protocol.Gun // the server knows how much damage each kind does
+	capacity, ammo, reloadTime, shootTime  int
+	knockback                              float32
+	automatic                              bool    // keeps shooting while the trigger is held
+	pellets                                int     // rays in each shot
+	spread                                 float32 // how far pellets stray from where we aim
+	recoilPitchSequence, recoilYawSequence []float32
+	shootAnimation                         spriteAnimation
+	gunRectangle                           rl.Rectangle
+	muzzle                                 rl.Vector2 // where the barrel ends, as a fraction of the gun rectangle
+	hasScope                               bool
+	hasCrossHair                           bool
+	scopeTexture                           rl.Texture2D
+	shootSound                             rl.Sound
+	reloadSound                            rl.Sound
+}
+
+func (gun *gun) triggerPulled() bool {
+	if gun.automatic {
+		return rl.IsMouseButtonDown(rl.MouseButtonLeft)
+	}
+	return rl.IsMouseButtonPressed(rl.MouseButtonLeft)
 }
 
 func newHandgun(resources *resources) *gun {
 	return &gun{
-		capacity:   30,
-		ammo:       30,
-		reloadTime: 3,
-		damage:     1,
-		shootTime:  190,
-		knockback:  0.05,
+		kind:                protocol.Handgun,
+		capacity:            30,
+		ammo:                30,
+		reloadTime:          3,
+		shootTime:           190,
+		knockback:           0.05,
+		pellets:             1,
+		recoilPitchSequence: []float32{0.05, 0.04, 0.06},
+		recoilYawSequence:   []float32{0.02, -0.01, -0.015},
 		shootAnimation: *newSpriteAnimation(resources.handgunShoot, 24, []rl.Rectangle{
 			rl.Rectangle{X: 0, Y: 0, Width: 128, Height: 128},
 			rl.Rectangle{X: 0, Y: 128, Width: 128, Height: 128},
@@ -994,6 +1253,7 @@ func newHandgun(resources *resources) *gun {
 			rl.Rectangle{X: 0, Y: 512, Width: 128, Height: 128},
 		}),
 		gunRectangle: rl.Rectangle{X: internalWindowWidth>>1 - 48, Y: internalWindowHeight>>1 - 8, Width: 128, Height: 128},
+		muzzle:       rl.Vector2{X: 0.45, Y: 0.21},
 		hasCrossHair: true,
 		shootSound:   resources.handgunShootSound,
 		reloadSound:  resources.handgunReloadSound,
@@ -1002,12 +1262,15 @@ func newHandgun(resources *resources) *gun {
 
 func newSniper(resources *resources) *gun {
 	return &gun{
-		capacity:   1,
-		ammo:       1,
-		reloadTime: 1,
-		damage:     3,
-		shootTime:  380,
-		knockback:  0.25,
+		kind:                protocol.Gun(protocol.Sniper),
+		capacity:            1,
+		ammo:                1,
+		reloadTime:          1,
+		shootTime:           380,
+		knockback:           0.25,
+		pellets:             1,
+		recoilPitchSequence: []float32{0.05, 0.04, 0.06},
+		recoilYawSequence:   []float32{0.02, -0.01, -0.015},
 		shootAnimation: *newSpriteAnimation(resources.sniperShoot, 12, []rl.Rectangle{
 			rl.Rectangle{X: 0, Y: 0, Width: 128, Height: 128},
 			rl.Rectangle{X: 0, Y: 128, Width: 128, Height: 128},
@@ -1016,6 +1279,7 @@ func newSniper(resources *resources) *gun {
 			rl.Rectangle{X: 0, Y: 512, Width: 128, Height: 128},
 		}),
 		gunRectangle: rl.Rectangle{X: internalWindowWidth>>1 - 64, Y: internalWindowHeight>>1 - 48, Width: 192, Height: 192},
+		muzzle:       rl.Vector2{X: 0.4, Y: 0.1},
 		hasScope:     true,
 		scopeTexture: resources.sniperScope,
 		shootSound:   resources.sniperShootSound,
@@ -1023,22 +1287,117 @@ func newSniper(resources *resources) *gun {
 	}
 }
 
-//////// other players
+func newShotgun(resources *resources) *gun {
+	return &gun{
+		kind:                protocol.Gun(protocol.Shotgun),
+		capacity:            6,
+		ammo:                6,
+		reloadTime:          3,
+		shootTime:           700,
+		knockback:           0.2,
+		pellets:             8,
+		spread:              0.12,
+		recoilPitchSequence: []float32{0.12, 0.1},
+		recoilYawSequence:   []float32{0.03, -0.03},
+		shootAnimation: *newSpriteAnimation(resources.shotgunShoot, 12, []rl.Rectangle{
+			rl.Rectangle{X: 0, Y: 0, Width: 128, Height: 128},
+			rl.Rectangle{X: 0, Y: 128, Width: 128, Height: 128},
+			rl.Rectangle{X: 0, Y: 256, Width: 128, Height: 128},
+			rl.Rectangle{X: 0, Y: 384, Width: 128, Height: 128},
+			rl.Rectangle{X: 0, Y: 512, Width: 128, Height: 128},
+		}),
+		gunRectangle: rl.Rectangle{X: internalWindowWidth>>1 - 48, Y: internalWindowHeight>>1 - 16, Width: 144, Height: 144},
+		muzzle:       rl.Vector2{X: 0.39, Y: 0.1},
+		hasCrossHair: true,
+		shootSound:   resources.shotgunShootSound,
+		reloadSound:  resources.sniperReloadSound,
+	}
+}
 
-var (
-	otherPlayerTextureRectangle = rl.Rectangle{X: 0, Y: 0, Width: 32, Height: 64}
-	otherPlayerHeight           = playerHeight
-	otherPlayerWidth            = 1
-)
+func newSMG(resources *resources) *gun {
+	return &gun{
+		kind:                protocol.Gun(protocol.SMG),
+		capacity:            35,
+		ammo:                35,
+		reloadTime:          2,
+		shootTime:           80,
+		knockback:           0.01,
+		automatic:           true,
+		pellets:             1,
+		spread:              0.04,
+		recoilPitchSequence: []float32{0.015, 0.02, 0.01, 0.02, 0.015},
+		recoilYawSequence:   []float32{0.01, -0.015, 0.005, 0.01, -0.01},
+		shootAnimation: *newSpriteAnimation(resources.smgShoot, 60, []rl.Rectangle{
+			rl.Rectangle{X: 0, Y: 0, Width: 128, Height: 128},
+			rl.Rectangle{X: 0, Y: 128, Width: 128, Height: 128},
+			rl.Rectangle{X: 0, Y: 256, Width: 128, Height: 128},
+			rl.Rectangle{X: 0, Y: 384, Width: 128, Height: 128},
+			rl.Rectangle{X: 0, Y: 512, Width: 128, Height: 128},
+		}),
+		gunRectangle: rl.Rectangle{X: internalWindowWidth>>1 - 48, Y: internalWindowHeight>>1 - 8, Width: 128, Height: 128},
+		muzzle:       rl.Vector2{X: 0.42, Y: 0.22},
+		hasCrossHair: true,
+		shootSound:   resources.smgShootSound,
+		reloadSound:  resources.handgunReloadSound,
+	}
+}
 
-type otherPlayerManager struct {
-	otherPlayers        [maxPlayers]otherPlayer
-	otherPlayerATexture rl.Texture2D
-	otherPlayerBTexture rl.Texture2D
-	deadPlayerTexture   rl.Texture2D
+func newRifle(resources *resources) *gun {
+	return &gun{
+		kind:                protocol.Gun(protocol.Rifle),
+		capacity:            20,
+		ammo:                20,
+		reloadTime:          3,
+		shootTime:           220,
+		knockback:           0.04,
+		automatic:           true,
+		pellets:             1,
+		spread:              0.01,
+		recoilPitchSequence: []float32{0.04, 0.05, 0.03, 0.05},
+		recoilYawSequence:   []float32{0.015, -0.02, 0.02, -0.01},
+		shootAnimation: *newSpriteAnimation(resources.rifleShoot, 24, []rl.Rectangle{
+			rl.Rectangle{X: 0, Y: 0, Width: 128, Height: 128},
+			rl.Rectangle{X: 0, Y: 128, Width: 128, Height: 128},
+			rl.Rectangle{X: 0, Y: 256, Width: 128, Height: 128},
+			rl.Rectangle{X: 0, Y: 384, Width: 128, Height: 128},
+			rl.Rectangle{X: 0, Y: 512, Width: 128, Height: 128},
+		}),
+		gunRectangle: rl.Rectangle{X: internalWindowWidth>>1 - 56, Y: internalWindowHeight>>1 - 24, Width: 160, Height: 160},
+		muzzle:       rl.Vector2{X: 0.37, Y: 0.06},
+		hasCrossHair: true,
+		shootSound:   resources.rifleShootSound,
+		reloadSound:  resources.handgunReloadSound,
+	}
 }
 
-type otherPlayerState int
+//////// other players
+
+var (
+	otherPlayerHeight       = playerHeight
+	otherPlayerCrouchHeight = crouchHeight
+)
+
+const (
+	// how long a player keeps moving on their own when their updates are late
+	maxExtrapolation = 250 * time.Millisecond
+	// locations further apart than this are a respawn rather than movement
+	teleportDistance = 3
+	// an update this close to where a teleporter leads has them there
+	arrivalDistance = 1
+	// enough locations to reach back as far as the jitter buffer can, at the
+	// highest tick rate, with one either side
+	snapshotBufferSize = int(maxJitterDelay*protocol.MaxTickRate/time.Second) + 3
+)
+
+type otherPlayerManager struct {
+	otherPlayers   []otherPlayer // by slot
+	characterModel rl.Model
+	footstepSounds [protocol.MaxPlayers]rl.Sound
+	reloadSounds   [protocol.MaxPlayers]rl.Sound
+	swapSounds     [protocol.MaxPlayers]rl.Sound
+}
+
+type otherPlayerState int
 
 const (
 	nonExistent otherPlayerState = iota
@@ -1048,211 +1407,688 @@ const (
 
 type otherPlayer struct {
 	killAmount, deathAmount int
+	assistAmount            int
 	position                rl.Vector3
 	boundingBox             rl.BoundingBox
 	otherPlayerState
+	snapshots     [snapshotBufferSize]locationSnapshot // oldest first
+	snapshotCount int
+	ping          int        // milliseconds
+	velocity      rl.Vector3 // units per second, between the last two updates
+	stepDistance  float32    // how far they have gone since their last footstep
+	crouching     bool
+	yaw, pitch    float32 // which way they are looking, in radians
+	shotAt        time.Time
+	diedAt        time.Time
+	action        protocol.Action // the last thing they did with their gun, until actionEnds
+	actionEnds    time.Time
+	arrival       *rl.Vector3 // where a teleporter is putting them, until an update has them there
+	healthLost    int         // by a teammate, since they last spawned
+}
+
+func (otherPlayer *otherPlayer) height() float32 {
+	if otherPlayer.crouching {
+		return float32(otherPlayerCrouchHeight)
+	}
+	return float32(otherPlayerHeight)
+}
+
+// the player's box split into their head, at the top, and the rest of them
+func (otherPlayer *otherPlayer) hitBoxes() (head, body rl.BoundingBox) {
+	head, body = otherPlayer.boundingBox, otherPlayer.boundingBox
+	head.Min.Y = head.Max.Y - protocol.HeadHeight
+	body.Max.Y = head.Min.Y
+	return head, body
+}
+
+// a location update and when it was sent, on our clock
+type locationSnapshot struct {
+	location rl.Vector3
+	sentAt   time.Time
 }
 
-func newOtherPlayerManager(resources *resources) *otherPlayerManager {
+func newOtherPlayerManager(resources *resources, slots int) *otherPlayerManager {
 	return &otherPlayerManager{
-		otherPlayerATexture: resources.otherPlayerA,
-		otherPlayerBTexture: resources.otherPlayerB,
-		deadPlayerTexture:   resources.deadPlayerTexture,
+		otherPlayers:   make([]otherPlayer, slots),
+		characterModel: resources.characterModel,
+		footstepSounds: resources.footstepSounds,
+		reloadSounds:   resources.reloadSounds,
+		swapSounds:     resources.swapSounds,
 	}
 }
 
 func (playerWorld *playerWorld) drawOtherPlayers() {
+	for i := range playerWorld.otherPlayers {
+		otherPlayer := &playerWorld.otherPlayers[i]
+		if otherPlayer.otherPlayerState == nonExistent || i == playerWorld.following {
+			continue
+		}
+		playerWorld.drawCharacter(otherPlayer, playerWorld.teamOf(i))
+	}
+}
+
+const (
+	footstepStride         = 2.5 // units travelled between footsteps
+	footstepRange          = 30  // units away at which footsteps can no longer be heard
+	footstepSpeedThreshold = 3   // units per second, walking slowly makes no sound
+	footstepMaxFall        = 1   // units per second, anyone falling faster is in the air
+	footstepStaleness      = 500 * time.Millisecond
+)
+
+// play the footsteps of other players on the move, louder the closer they are
+func (playerWorld *playerWorld) playFootsteps() {
+	deltaTime := rl.GetFrameTime()
+	for i := range playerWorld.otherPlayers {
+		otherPlayer := &playerWorld.otherPlayers[i]
+		if otherPlayer.otherPlayerState != alive || otherPlayer.snapshotCount == 0 {
+			continue
+		}
+
+		// standing still, sneaking, in the air, or no longer being heard from
+		speed := rl.Vector2Length(rl.Vector2{X: otherPlayer.velocity.X, Y: otherPlayer.velocity.Z})
+		if speed < footstepSpeedThreshold || math.Abs(float64(otherPlayer.velocity.Y)) > footstepMaxFall ||
+			time.Since(otherPlayer.snapshots[otherPlayer.snapshotCount-1].sentAt) > footstepStaleness {
+			otherPlayer.stepDistance = 0
+			continue
+		}
+
+		otherPlayer.stepDistance += speed * deltaTime
+		if otherPlayer.stepDistance < footstepStride {
+			continue
+		}
+		otherPlayer.stepDistance -= footstepStride
+
+		distance := rl.Vector3Distance(playerWorld.camera.Position, otherPlayer.position)
+		if distance >= footstepRange {
+			continue
+		}
+		playerWorld.settings.setEffectVolume(playerWorld.footstepSounds[i], 1-distance/footstepRange)
+		rl.SetSoundPan(playerWorld.footstepSounds[i], playerWorld.panTowards(otherPlayer.position))
+		rl.PlaySound(playerWorld.footstepSounds[i])
+		playerWorld.soundIndicators.add(footstepSound, otherPlayer.position, 1-distance/footstepRange)
+	}
+}
+
+// gunshots closer than this are at full volume, further away they fade with
+// distance but never quite go silent
+const gunshotFullVolumeDistance = 8
+
+const hitMarkerVolume = 5 // the hit marker is quiet next to everything else
+
+// how a sound should be balanced between the left and right speakers to seem
+// to come from a location, 0.5 being in the middle
+func (playerWorld *playerWorld) panTowards(location rl.Vector3) float32 {
+	toLocation := rl.Vector3Subtract(location, playerWorld.camera.Position)
+	toLocation.Y = 0
+	if rl.Vector3Length(toLocation) == 0 {
+		return 0.5
+	}
+	right := rl.GetCameraRight(&playerWorld.camera)
+	return 0.5 - 0.5*rl.Vector3DotProduct(rl.Vector3Normalize(toLocation), right)
+}
+
+// move other players to where they should be drawn this frame
+func (playerWorld *playerWorld) interpolateOtherPlayers() {
+	renderTime := time.Now().Add(-playerWorld.renderDelay())
+	for i := range playerWorld.otherPlayers {
+		otherPlayer := &playerWorld.otherPlayers[i]
+		if otherPlayer.otherPlayerState == nonExistent || otherPlayer.snapshotCount == 0 {
+			continue
+		}
+		otherPlayer.setOtherPlayerLocation(otherPlayer.interpolatedLocation(renderTime))
+	}
+}
+
+const (
+	nameLabelGap    = 0.3 // how far above a player's head their name is shown
+	healthBarWidth  = 30
+	healthBarHeight = 3
+)
+
+// names over the heads of our teammates, wherever they are, with how much
+// health they have left under them; enemies are never labelled, and those
+// only watching see the names of everyone in sight
+func (playerWorld *playerWorld) drawOtherPlayerNames() {
+	forward := rl.Vector3Subtract(playerWorld.camera.Target, playerWorld.camera.Position)
 	for i, otherPlayer := range playerWorld.otherPlayers {
-		if otherPlayer.otherPlayerState == nonExistent {
+		if otherPlayer.otherPlayerState != alive || (i == playerWorld.id && !playerWorld.playback) || i == playerWorld.following {
 			continue
 		}
-		var otherPlayerTexture rl.Texture2D
-		if otherPlayer.otherPlayerState == dead {
-			otherPlayerTexture = playerWorld.deadPlayerTexture
-		} else if i < maxTeamPlayers {
-			otherPlayerTexture = playerWorld.otherPlayerATexture
-		} else {
-			otherPlayerTexture = playerWorld.otherPlayerBTexture
+		teammate := !playerWorld.watching() && playerWorld.teamOf(i) == playerWorld.Team
+		if !teammate && !playerWorld.watching() {
+			continue
 		}
-		rl.DrawBillboardRec(playerWorld.camera, otherPlayerTexture, otherPlayerTextureRectangle, offsetOtherPlayerHeight(otherPlayer.position), rl.Vector2{X: float32(otherPlayerWidth), Y: float32(otherPlayerHeight)}, rl.White)
+		labelPosition := rl.Vector3Add(otherPlayer.position, rl.Vector3{Y: otherPlayer.height() + nameLabelGap})
+		if rl.Vector3DotProduct(forward, rl.Vector3Subtract(labelPosition, playerWorld.camera.Position)) <= 0 || !teammate && !playerWorld.canSee(labelPosition) {
+			continue
+		}
+		name := playerWorld.playerName(i)
+		screenPosition := rl.GetWorldToScreenEx(labelPosition, playerWorld.camera, internalWindowWidth, internalWindowHeight)
+		width := rl.MeasureTextEx(playerWorld.font, name, killFeedFontSize, 0).X
+		rl.DrawTextEx(playerWorld.font, name, rl.Vector2{X: screenPosition.X - width/2, Y: screenPosition.Y}, killFeedFontSize, 0, rl.Black)
+		if !teammate {
+			continue
+		}
+
+		// the server tells us our teammates' health, see sendTeammateHealth
+		health := protocol.MaxHealth - otherPlayer.healthLost
+		bar := rl.Rectangle{X: screenPosition.X - healthBarWidth/2, Y: screenPosition.Y + killFeedFontSize, Width: healthBarWidth, Height: healthBarHeight}
+		rl.DrawRectangleRec(bar, rl.DarkGray)
+		colour := rl.Green
+		if health <= lowHealth {
+			colour = rl.Red
+		}
+		bar.Width *= float32(health) / protocol.MaxHealth
+		rl.DrawRectangleRec(bar, colour)
 	}
 }
 
-func offsetOtherPlayerHeight(position rl.Vector3) rl.Vector3 {
-	return rl.Vector3{X: position.X, Y: position.Y + 1, Z: position.Z}
+// whether neither a block, a closed door nor smoke stands between the camera
+// and a point
+func (playerWorld *playerWorld) canSee(position rl.Vector3) bool {
+	if playerWorld.thrownGrenades.hides(playerWorld.camera.Position, position) {
+		return false
+	}
+
+	toPosition := rl.Vector3Subtract(position, playerWorld.camera.Position)
+	distance := rl.Vector3Length(toPosition)
+	ray := rl.Ray{Position: playerWorld.camera.Position, Direction: rl.Vector3Normalize(toPosition)}
+	for _, block := range playerWorld.blocks {
+		collision := rl.GetRayCollisionBox(ray, block.boundingBox)
+		if collision.Hit && collision.Distance < distance {
+			return false
+		}
+	}
+	for _, block := range playerWorld.closedDoors() {
+		collision := rl.GetRayCollisionBox(ray, block.boundingBox)
+		if collision.Hit && collision.Distance < distance {
+			return false
+		}
+	}
+	return true
+}
+
+// an enemy player a shot went through, and whether it was their head it hit
+// first
+type playerHit struct {
+	id       int
+	headshot bool
+	point    rl.Vector3 // where the shot landed
 }
 
-// handle shooting enemy players
-func (playerWorld *playerWorld) checkRayOtherPlayersCollision(ray rl.Ray) {
+// the enemy players a shot hits, short of any closed door
+func (playerWorld *playerWorld) checkRayOtherPlayersCollision(ray rl.Ray) []playerHit {
+	doorDistance := playerWorld.closedDoorDistance(ray)
 	var opponentTeam []otherPlayer
 	var teamDependantOffset int
-	switch playerWorld.team {
-	case a:
-		opponentTeam = playerWorld.otherPlayers[maxTeamPlayers:]
-		teamDependantOffset = maxTeamPlayers
-	case b:
-		opponentTeam = playerWorld.otherPlayers[:maxTeamPlayers]
+	switch playerWorld.Team {
+	case protocol.A:
+		opponentTeam = playerWorld.otherPlayers[playerWorld.teamSize:]
+		teamDependantOffset = playerWorld.teamSize
+	case protocol.B:
+		opponentTeam = playerWorld.otherPlayers[:playerWorld.teamSize]
 		teamDependantOffset = 0
 	}
+	var hits []playerHit
 	for otherPlayerId, otherPlayer := range opponentTeam {
 		if otherPlayer.otherPlayerState == dead || otherPlayer.otherPlayerState == nonExistent {
 			continue
 		}
-		rayCollision := rl.GetRayCollisionBox(ray, otherPlayer.boundingBox)
-		if rayCollision.Hit {
-			rl.PlaySound(playerWorld.hitMarkerSound)
-			playerWorld.sendHitMessage(otherPlayerId + teamDependantOffset)
+		head, body := otherPlayer.hitBoxes()
+		headCollision := rl.GetRayCollisionBox(ray, head)
+		bodyCollision := rl.GetRayCollisionBox(ray, body)
+		headCollision.Hit = headCollision.Hit && headCollision.Distance < doorDistance
+		bodyCollision.Hit = bodyCollision.Hit && bodyCollision.Distance < doorDistance
+		switch {
+		case headCollision.Hit && (!bodyCollision.Hit || headCollision.Distance <= bodyCollision.Distance):
+			hits = append(hits, playerHit{id: otherPlayerId + teamDependantOffset, headshot: true, point: headCollision.Point})
+		case bodyCollision.Hit:
+			hits = append(hits, playerHit{id: otherPlayerId + teamDependantOffset, point: bodyCollision.Point})
 		}
 	}
+	return hits
 }
 
 // let server know the client made a hit
-func (playerWorld *playerWorld) sendHitMessage(hitPlayerId int) {
+func (playerWorld *playerWorld) sendHitMessage(hitPlayerId int, gun protocol.Gun, pellets, headshots int) {
 	playerWorld.connMutex.Lock()
-	if err := playerWorld.conn.WriteMessage(websocket.BinaryMessage, []byte{byte(hitMessage), byte(hitPlayerId), byte(playerWorld.guns.guns[playerWorld.currentGun].damage)}); err != nil {
-		log.Println(err)
+	if err := writeMessage(playerWorld.conn, protocol.EncodeHit(hitPlayerId, gun, pellets, headshots, playerWorld.serverClock.at(time.Now().Add(-playerWorld.renderDelay())))); err != nil {
+		slog.Warn("Could not send message", "header", protocol.HitMessage, "error", err)
 	}
 	playerWorld.connMutex.Unlock()
 }
 
+// remember a location update to interpolate between
+func (otherPlayer *otherPlayer) addSnapshot(location rl.Vector3, sentAt time.Time) {
+	// jump straight to a respawn instead of sliding across the map, and start
+	// again if a better estimate of the server's clock puts this update before
+	// the last one
+	if otherPlayer.snapshotCount > 0 {
+		latest := otherPlayer.snapshots[otherPlayer.snapshotCount-1]
+		if rl.Vector3Distance(latest.location, location) > teleportDistance || !sentAt.After(latest.sentAt) {
+			otherPlayer.snapshotCount = 0
+		}
+	}
+	if otherPlayer.arrival != nil && rl.Vector3Distance(*otherPlayer.arrival, location) < arrivalDistance {
+		otherPlayer.snapshotCount, otherPlayer.arrival = 0, nil
+	}
+	otherPlayer.velocity = rl.Vector3Zero()
+	if otherPlayer.snapshotCount > 0 {
+		previous := otherPlayer.snapshots[otherPlayer.snapshotCount-1]
+		if elapsed := float32(sentAt.Sub(previous.sentAt).Seconds()); elapsed > 0 {
+			otherPlayer.velocity = rl.Vector3Scale(rl.Vector3Subtract(location, previous.location), 1/elapsed)
+		}
+	}
+	if otherPlayer.snapshotCount == snapshotBufferSize {
+		copy(otherPlayer.snapshots[:], otherPlayer.snapshots[1:])
+		otherPlayer.snapshotCount--
+	}
+	otherPlayer.snapshots[otherPlayer.snapshotCount] = locationSnapshot{location: location, sentAt: sentAt}
+	otherPlayer.snapshotCount++
+}
+
+// where the other player was at a point in time, guessed from their velocity
+// if no update has arrived for that time yet
+func (otherPlayer *otherPlayer) interpolatedLocation(renderTime time.Time) rl.Vector3 {
+	snapshots := otherPlayer.snapshots[:otherPlayer.snapshotCount]
+	if !renderTime.After(snapshots[0].sentAt) {
+		return snapshots[0].location
+	}
+
+	for i := 1; i < len(snapshots); i++ {
+		previous, next := snapshots[i-1], snapshots[i]
+		if renderTime.After(next.sentAt) {
+			continue
+		}
+		amount := float32(renderTime.Sub(previous.sentAt)) / float32(next.sentAt.Sub(previous.sentAt))
+		return rl.Vector3Lerp(previous.location, next.location, amount)
+	}
+
+	latest := snapshots[len(snapshots)-1]
+	if len(snapshots) == 1 {
+		return latest.location
+	}
+	previous := snapshots[len(snapshots)-2]
+	ahead := min(renderTime.Sub(latest.sentAt), maxExtrapolation)
+	interval := latest.sentAt.Sub(previous.sentAt)
+	if interval <= 0 {
+		return latest.location
+	}
+	velocity := rl.Vector3Scale(rl.Vector3Subtract(latest.location, previous.location), float32(ahead)/float32(interval))
+	return rl.Vector3Add(latest.location, velocity)
+}
+
 // sets the location of an other player as well as updating their bounding box accordingly
 func (otherPlayer *otherPlayer) setOtherPlayerLocation(location rl.Vector3) {
 	otherPlayer.position = location
-	updateBoundingbox(location, &otherPlayer.boundingBox, boundingBoxHalfWidth, float32(otherPlayerHeight))
+	updateBoundingbox(location, &otherPlayer.boundingBox, boundingBoxHalfWidth, otherPlayer.height())
 }
 
 //////// networking
 
-type team int
+type meta struct {
+	id int
+	protocol.Team
+	conn                     *websocket.Conn
+	url                      string // what we joined, to join again if the connection drops
+	reconnecting             atomic.Bool
+	token                    []byte
+	spectating               bool // joined to play, but watching as the match was underway
+	mapName                  string
+	tickRate                 int // locations exchanged per second, as the server told us
+	teamSize                 int // players on each team, as the server told us
+	name                     string
+	password                 string
+	messages                 messageReader // the connection, unless playing back a demo
+	playback                 bool
+	connMutex                sync.Mutex
+	round                    int
+	warmup                   bool // playing before the match starts, where nothing counts
+	teamAPoints, teamBPoints int
+	ping                     time.Duration
+	pingNumber               uint16
+	pingSentAt               time.Time
+	serverClock              serverClock
+	pingMutex                sync.Mutex
+	roster                   protocol.Roster
+	rosterMutex              sync.Mutex
+	roundEnds                time.Time // zero unless the round in play has a time limit
+	roundEndsMutex           sync.Mutex
+	netStats                 netStats
+}
 
-const (
-	a team = iota
-	b
-)
+// the id may be protocol.AnyId, in which case the server picks our slot, and
+// the name may be empty, in which case the server names us after it
+func newMeta(id int, name, password string) *meta {
+	return &meta{id: id, name: name, password: password}
+}
 
-type successResponse int
+// watch a demo as the player who recorded it, without a connection
+func newPlaybackMeta(header demoHeader, demo *demoPlayer) *meta {
+	return &meta{
+		id:       header.id,
+		Team:     header.Team,
+		mapName:  header.mapName,
+		tickRate: header.tickRate,
+		teamSize: header.teamSize,
+		messages: demo,
+		playback: true,
+	}
+}
 
-const (
-	success successResponse = iota
-	failure
-)
+func (meta *meta) connectToServer(url string) error {
+	meta.url = url
 
-type messageHeaders byte
+	// observers have no slot to take back
+	if meta.observing() {
+		return meta.dialServer(url, protocol.EncodeJoin(meta.id, meta.name, meta.password))
+	}
 
-const (
-	nextRoundHeader messageHeaders = iota
-	playHeader
-	locationHeader
-	shotHeader
-	killedHeader
-	teamPointHeader
-	loseHealthHeader
-	playerDisconnectHeader
-)
+	// try to take back our slot if we dropped out of a match on this server
+	if id, token := loadSession(url, meta.id); token != nil {
+		if err := meta.dialServer(url, protocol.EncodeRejoin(id, token, meta.name, meta.password)); err == nil {
+			return nil
+		}
+		clearSession()
+	}
 
-type clientMessage byte
+	if err := meta.dialServer(url, protocol.EncodeJoin(meta.id, meta.name, meta.password)); err != nil {
+		return err
+	}
+	if !meta.spectating {
+		saveSession(url, meta.id, meta.token)
+	}
+	return nil
+}
 
-const (
-	hitMessage clientMessage = iota
-	shotMessage
-	locationMessage
-)
+func (meta *meta) setRoster(roster protocol.Roster) {
+	meta.rosterMutex.Lock()
+	defer meta.rosterMutex.Unlock()
+	meta.roster = roster
+}
 
-const (
-	maxPlayers     = 6
-	maxTeamPlayers = 6 >> 1
-)
+// the server says how long is left of the round, zero stops the clock
+func (meta *meta) setRoundTime(left time.Duration) {
+	meta.roundEndsMutex.Lock()
+	defer meta.roundEndsMutex.Unlock()
+	if left == 0 {
+		meta.roundEnds = time.Time{}
+		return
+	}
+	meta.roundEnds = time.Now().Add(left)
+}
 
-type meta struct {
-	id int
-	team
-	conn                     *websocket.Conn
-	connMutex                sync.Mutex
-	round                    int
-	teamAPoints, teamBPoints int
+// how long is left of the round, false if the clock is not running
+func (meta *meta) roundTimeLeft() (time.Duration, bool) {
+	meta.roundEndsMutex.Lock()
+	defer meta.roundEndsMutex.Unlock()
+	if meta.roundEnds.IsZero() {
+		return 0, false
+	}
+	return max(time.Until(meta.roundEnds), 0), true
 }
 
-func newMeta(id int) *meta {
-	var team team
-	if id < maxTeamPlayers {
-		team = a
-	} else {
-		team = b
+// what a player goes by, their slot until the server tells us their name
+func (meta *meta) playerName(id int) string {
+	meta.rosterMutex.Lock()
+	defer meta.rosterMutex.Unlock()
+	if meta.roster.Name(id) == "" {
+		return fmt.Sprintf("Player %d", id)
 	}
-	return &meta{id: id, team: team}
+	return meta.roster.Name(id)
 }
 
-func (meta *meta) connectToServer(url string) error {
+// how many player slots the lobby has, team A's first
+func (meta *meta) slots() int {
+	return 2 * meta.teamSize
+}
+
+// whether every id from a message is one of the lobby's player slots
+func (meta *meta) hasSlots(ids []int) bool {
+	for _, id := range ids {
+		if id < 0 || meta.slots() <= id {
+			return false
+		}
+	}
+	return true
+}
+
+// the team a player slot belongs to
+func (meta *meta) teamOf(id int) protocol.Team {
+	return protocol.TeamOf(id, meta.teamSize)
+}
+
+// whether the server has told us someone is in a slot
+func (meta *meta) hasPlayer(id int) bool {
+	meta.rosterMutex.Lock()
+	defer meta.rosterMutex.Unlock()
+	return meta.roster.Name(id) != ""
+}
+
+// how messages are sent once the handshake is over, set by -protocol
+var encoding = protocol.BinaryEncoding
+
+// send a message to the server in the encoding we speak
+func writeMessage(conn *websocket.Conn, message []byte) error {
+	err := connection.Write(conn, encoding, message)
+	if err == nil {
+		sentBytes.Add(int64(len(message)))
+	}
+	return err
+}
+
+// connect to the server and ask for our player slot
+func (meta *meta) dialServer(url string, joinMessage []byte) error {
 	// connect to server
 	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
 	if err != nil {
 		return err
 	}
-
-	// send ID to the server
-	idMessage := []byte{byte(meta.id)}
-	if err = conn.WriteMessage(websocket.BinaryMessage, idMessage); err != nil {
-		conn.Close()
+	admission, err := join(conn, joinMessage)
+	if err != nil {
 		return err
 	}
+	meta.adopt(conn, admission)
+	meta.messages = connection.NewReader(conn)
+	return nil
+}
 
-	// get message and check if our connection succeeded
-	_, responseMessage, err := conn.ReadMessage()
-	if err != nil {
-		conn.Close()
+// ask for our player slot over a new connection, closing it if refused
+func join(conn *websocket.Conn, joinMessage []byte) (protocol.Admission, error) {
+	// the server pings us regularly, if it goes quiet it is gone
+	conn.SetReadDeadline(time.Now().Add(protocol.KeepaliveTimeout))
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(protocol.KeepaliveTimeout))
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(protocol.KeepaliveInterval))
+		if errors.Is(err, websocket.ErrCloseSent) {
+			return nil
+		}
 		return err
-	}
+	})
 
-	if len(responseMessage) != 1 || responseMessage[0] != byte(success) {
+	// send ID to the server and check if our connection succeeded, a server
+	// on another version of the protocol closes the connection saying so
+	admission, err := connection.Join(conn, joinMessage)
+	var closeError *websocket.CloseError
+	if errors.As(err, &closeError) && closeError.Code == websocket.CloseProtocolError {
 		conn.Close()
-		return err
+		return protocol.Admission{}, fmt.Errorf("Update required, %s, this client speaks %d", closeError.Text, protocol.Version)
 	}
+	if err != nil {
+		conn.Close()
+		return protocol.Admission{}, err
+	}
+	return admission, nil
+}
 
+// adopt whichever slot the server gave us
+func (meta *meta) adopt(conn *websocket.Conn, admission protocol.Admission) {
 	meta.conn = conn
-	return nil
+	meta.spectating = !meta.observing() && admission.Id == protocol.ObserverId
+	meta.id = admission.Id
+	meta.Team = admission.Team
+	meta.token = admission.Token
+	meta.mapName = admission.Map
+	meta.tickRate = admission.TickRate
+	meta.teamSize = admission.TeamSize
+}
+
+// how long there is between one exchange of locations and the next
+func (meta *meta) tickInterval() time.Duration {
+	return time.Second / time.Duration(meta.tickRate)
 }
 
-// blocks until game has started
-func (playerWorld *playerWorld) waitUntilGameStarts() {
+// time the round trip to the server every so often, telling it the last one
+func (meta *meta) measurePing(context context.Context) {
+	ticker := time.NewTicker(time.Second / protocol.PingFrequency)
+	defer ticker.Stop()
+
 	for {
-		if playerWorld.round > 0 {
-			break
+		select {
+		case <-context.Done():
+			return
+		case <-ticker.C:
+			meta.pingMutex.Lock()
+			meta.pingNumber++
+			meta.pingSentAt = time.Now()
+			message := protocol.EncodePing(meta.pingNumber, int(meta.ping.Milliseconds()))
+			meta.pingMutex.Unlock()
+
+			meta.connMutex.Lock()
+			if err := writeMessage(meta.conn, message); err != nil {
+				slog.Warn("Could not send message", "header", protocol.PingMessage, "error", err)
+			}
+			meta.connMutex.Unlock()
 		}
-		time.Sleep(time.Second)
 	}
 }
 
-const lastRound = 10 // TODO put in common internal shared file
+// only the answer to the latest ping counts, older ones arrived too late
+func (meta *meta) handlePong(number uint16, serverTime time.Duration) {
+	meta.pingMutex.Lock()
+	defer meta.pingMutex.Unlock()
+
+	if number == meta.pingNumber {
+		now := time.Now()
+		meta.ping = now.Sub(meta.pingSentAt)
+		meta.serverClock.sample(meta.pingSentAt, now, serverTime)
+	}
+}
+
+func (meta *meta) currentPing() time.Duration {
+	meta.pingMutex.Lock()
+	defer meta.pingMutex.Unlock()
+
+	return meta.ping
+}
 
 // prepare the start of the round
 func (playerWorld *playerWorld) handleNextRound() {
+	playerWorld.warmup = false
+
 	// handle ending condition
-	if playerWorld.round == lastRound {
+	if playerWorld.round == protocol.LastRound {
 		playerWorld.exitRequested = true
 		return
 	}
+	playerWorld.killcam.reset()
 
 	// set player position to the calculated spawn locations
-	var location rl.Vector3
-	switch playerWorld.team {
-	case a:
-		location = aSpawnLocations[(playerWorld.round+playerWorld.id)%len(aSpawnLocations)]
-	case b:
-		location = bSpawnLocations[(playerWorld.round+playerWorld.id)%len(bSpawnLocations)]
+	// the server puts us at the same spawn, the free camera of an observer or
+	// a demo stays where it is
+	if !playerWorld.watching() {
+		spawnLocations := playerWorld.spawnLocations[playerWorld.Team]
+		spawnLocation := spawnLocations[(playerWorld.round+playerWorld.id)%len(spawnLocations)]
+		playerWorld.setPlayerLocation(spawnLocation)
+		playerWorld.prediction.reset(spawnLocation)
 	}
-	playerWorld.setPlayerLocation(location)
 
 	// reset player attributes
 	playerWorld.reset()
+	playerWorld.setRoundTime(0)
+
+	// items can be bought until the round starts
+	playerWorld.buyPhase = !playerWorld.watching()
 
 	playerWorld.round++
 
 	// wait for play message before the player may continue
 }
 
-// how much the int8s are scaled from their float32 counterpart in location
-// data to save packet space
-const scalingFactor = 8
+// pick the match back up after rejoining it
+func (playerWorld *playerWorld) handleResume(state protocol.ResumeState) {
+	playerWorld.reset()
+	if !playerWorld.observing() {
+		location := rl.Vector3{X: protocol.Int8ScaleToFloat32(state.X), Y: protocol.Int8ScaleToFloat32(state.Y), Z: protocol.Int8ScaleToFloat32(state.Z)}
+		playerWorld.setPlayerLocation(location)
+		playerWorld.prediction.reset(location)
+	}
+	playerWorld.health = state.Health
+	playerWorld.teamAPoints = state.TeamAPoints
+	playerWorld.teamBPoints = state.TeamBPoints
+
+	for _, score := range state.Players {
+		if score.Id == playerWorld.id {
+			playerWorld.killAmount = score.Kills
+			playerWorld.deathAmount = score.Deaths
+			playerWorld.assistAmount = score.Assists
+			continue
+		}
+		otherPlayer := &playerWorld.otherPlayers[score.Id]
+		otherPlayer.killAmount = score.Kills
+		otherPlayer.deathAmount = score.Deaths
+		otherPlayer.assistAmount = score.Assists
+		if score.IsAlive {
+			otherPlayer.otherPlayerState = alive
+		} else {
+			otherPlayer.otherPlayerState = dead
+		}
+	}
+
+	if state.IsAlive && state.InPlay && !playerWorld.watching() {
+		playerWorld.playerState = normal
+	}
+
+	// set last, as this lets the game start
+	playerWorld.round = state.Round
+}
+
+// a player killed while warming up, or who has just joined the warmup, is
+// back at their spawn
+func (playerWorld *playerWorld) handleRespawn(event protocol.RespawnEvent) {
+	if event.PlayerId != playerWorld.id || playerWorld.playback {
+		playerWorld.otherPlayers[event.PlayerId].otherPlayerState = alive
+		playerWorld.otherPlayers[event.PlayerId].healthLost = 0
+	}
+	if event.PlayerId != playerWorld.id || playerWorld.watching() {
+		return
+	}
+	location := rl.Vector3{X: protocol.Int8ScaleToFloat32(event.X), Y: protocol.Int8ScaleToFloat32(event.Y), Z: protocol.Int8ScaleToFloat32(event.Z)}
+	playerWorld.setPlayerLocation(location)
+	playerWorld.prediction.reset(location)
+	playerWorld.gunState = idle
+	playerWorld.guns.guns[0].ammo = playerWorld.guns.guns[0].capacity
+	playerWorld.guns.guns[1].ammo = playerWorld.guns.guns[1].capacity
+	playerWorld.health = protocol.MaxHealth
+	playerWorld.playerState = normal
+}
+
+// someone new in the roster mid-match has taken a slot in the middle of a
+// round, which they sit out until the next one; before the match, and while
+// warming up, everyone is brought into being by their first location instead
+func (playerWorld *playerWorld) handleRoster(roster protocol.Roster) {
+	if playerWorld.round == 0 || playerWorld.warmup {
+		return
+	}
+	for id, name := range roster {
+		if name == "" || id == playerWorld.id && !playerWorld.playback {
+			continue
+		}
+		if playerWorld.otherPlayers[id].otherPlayerState == nonExistent {
+			playerWorld.otherPlayers[id].otherPlayerState = dead
+		}
+	}
+}
 
 // receive messages from server and respond accordingly
 func (playerWorld *playerWorld) receiveMessages(context context.Context) {
@@ -1261,66 +2097,130 @@ func (playerWorld *playerWorld) receiveMessages(context context.Context) {
 		case <-context.Done():
 			return
 		default:
-			_, message, err := playerWorld.conn.ReadMessage()
+			_, message, err := playerWorld.messages.ReadMessage()
 			if err != nil {
-				log.Println(err)
-				continue
+				// the connection cannot be read from again after an error,
+				// and a demo simply runs out
+				if !playerWorld.playback || !errors.Is(err, io.EOF) {
+					slog.Error("Connection lost", "error", err)
+				}
+				playerWorld.connectionLost = true
+				return
 			}
 
 			// in case of gaps in messages
 			if len(message) == 0 {
 				continue
 			}
+			playerWorld.netStats.receive(len(message), time.Now())
 
-			switch message[0] {
-			case byte(nextRoundHeader):
+			event, err := protocol.ParseServerMessage(message)
+			if err == nil && !playerWorld.hasSlots(protocol.PlayerIds(event)) {
+				err = errors.New("Player id is not a slot in the lobby")
+			}
+			if err != nil {
+				slog.Warn("Bad message", "error", err)
+				continue
+			}
+			switch event := event.(type) {
+			case protocol.NextRoundEvent:
 				playerWorld.handleNextRound()
 
-			case byte(playHeader):
-				playerWorld.playerState = normal
+			case protocol.WarmupEvent:
+				playerWorld.warmup = true
+
+			case protocol.RespawnEvent:
+				playerWorld.handleRespawn(event)
 
-			case byte(locationHeader):
-				// update other players accordingly
-				for i := 1; i < len(message); i += 4 { // 4 is the size of each location parcel
-					id := int(message[i+0])
-					if id == playerWorld.id {
+			case protocol.PlayEvent:
+				// observers and demos only watch, so the HUD of a living player is not shown
+				if !playerWorld.watching() {
+					playerWorld.playerState = normal
+				}
+				playerWorld.buyPhase = false
+				playerWorld.countdown.live()
+				playerWorld.playRoundStartStinger()
+
+			case protocol.LocationsEvent:
+				// update other players accordingly, they are moved each frame
+				received := time.Now()
+				playerWorld.jitterBuffer.arrived(received)
+				sentAt := playerWorld.serverClock.local(event.SentAt, received)
+				playerWorld.netStats.update(sentAt)
+				for _, parcel := range event.Players {
+					id := int(parcel.Id)
+					location := rl.Vector3{X: protocol.Int8ScaleToFloat32(parcel.X), Y: protocol.Int8ScaleToFloat32(parcel.Y), Z: protocol.Int8ScaleToFloat32(parcel.Z)}
+					yaw, pitch := protocol.ByteToYaw(parcel.Yaw), protocol.Int8ToPitch(parcel.Pitch)
+					// we are kept too, to be seen in the killcam
+					playerWorld.killcam.record(id, view{location: location, yaw: yaw, pitch: pitch, crouching: parcel.Crouching, sentAt: sentAt})
+					// a demo shows the player who recorded it as well
+					if id == playerWorld.id && !playerWorld.playback {
 						continue
 					}
-					location := rl.Vector3{X: float32(int8(message[i+1])) / scalingFactor, Y: float32(int8(message[i+2])) / scalingFactor, Z: float32(int8(message[i+3])) / scalingFactor}
-					playerWorld.otherPlayers[id].setOtherPlayerLocation(location)
+					playerWorld.otherPlayers[id].addSnapshot(location, sentAt)
+					playerWorld.otherPlayers[id].crouching = parcel.Crouching
+					playerWorld.otherPlayers[id].yaw = yaw
+					playerWorld.otherPlayers[id].pitch = pitch
 					if playerWorld.otherPlayers[id].otherPlayerState == nonExistent {
 						playerWorld.otherPlayers[id].otherPlayerState = otherPlayerState(normal)
 					}
 				}
 
-			case byte(shotHeader):
-				if len(message) != 2 {
-					log.Println("Erroneous server message")
+			case protocol.ShotEvent:
+				shooterId := event.ShooterId
+				// do not play sound if we get the same ID; i.e. we made the shot
+				if playerWorld.id == shooterId && !playerWorld.playback {
 					break
 				}
-				// do not play sound if we get the same ID; i.e. we made the shot
-				if playerWorld.id == int(message[1]) {
+				playerWorld.otherPlayers[shooterId].shotAt = time.Now()
+				shooterLocation := rl.Vector3{X: protocol.Int8ScaleToFloat32(event.X), Y: protocol.Int8ScaleToFloat32(event.Y) + cameraHeight, Z: protocol.Int8ScaleToFloat32(event.Z)}
+				genericShootSound := playerWorld.genericShootSounds[shooterId]
+				distance := rl.Vector3Distance(playerWorld.camera.Position, shooterLocation)
+				playerWorld.settings.setEffectVolume(genericShootSound, min(1, gunshotFullVolumeDistance/distance))
+				rl.SetSoundPan(genericShootSound, playerWorld.panTowards(shooterLocation))
+				rl.PlaySound(genericShootSound)
+				playerWorld.soundIndicators.add(gunshotSound, shooterLocation, min(1, gunshotFullVolumeDistance/distance))
+				playerWorld.addOtherPlayerTracer(shooterId, shooterLocation)
+
+			case protocol.ActionEvent:
+				// we already saw and heard our own
+				if playerWorld.id == event.PlayerId && !playerWorld.playback {
 					break
 				}
-				rl.PlaySound(playerWorld.genericShootSound)
+				playerWorld.otherPlayerAction(event.PlayerId, event.Action, event.Gun)
+
+			case protocol.KilledEvent:
+				killerId, killedId := event.KillerId, event.KilledId
 
-			case byte(killedHeader):
-				if len(message) != 3 {
-					log.Println("Erroneous server message")
+				// kills while warming up are only shown in the kill feed,
+				// and the killed respawn shortly
+				if playerWorld.warmup {
+					if playerWorld.id == killedId {
+						playerWorld.playerState = limbo
+					}
+					if playerWorld.id != killedId || playerWorld.playback {
+						playerWorld.otherPlayers[killedId].otherPlayerState = dead
+					}
+					playerWorld.killFeed.add(playerWorld.playerName(killerId), playerWorld.playerName(killedId), event.Weapon, event.Headshot)
 					break
 				}
 
-				killerId := int(message[1])
-				killedId := int(message[2])
-
 				// if it is us who is killed, set ourself to limbo
 				if playerWorld.id == killedId {
 					// TODO make a function/method that does this i.e. player.die()
 					playerWorld.deathAmount++
 					playerWorld.playerState = limbo
+					if playerWorld.playback {
+						playerWorld.otherPlayers[killedId].otherPlayerState = dead
+					}
+					// see how it happened before watching the rest of the round
+					if !playerWorld.watching() && killerId != killedId {
+						playerWorld.killcam.start(killerId)
+					}
 				} else {
 					playerWorld.otherPlayers[killedId].deathAmount++
 					playerWorld.otherPlayers[killedId].otherPlayerState = dead
+					playerWorld.otherPlayers[killedId].diedAt = time.Now()
 				}
 
 				if playerWorld.id == killerId {
@@ -1328,85 +2228,234 @@ func (playerWorld *playerWorld) receiveMessages(context context.Context) {
 				} else {
 					playerWorld.otherPlayers[killerId].killAmount++
 				}
-
-			case byte(teamPointHeader):
-				if len(message) != 2 {
-					log.Println("Erroneous server message")
-					break
+				for _, id := range event.AssisterIds {
+					if playerWorld.id == id {
+						playerWorld.assistAmount++
+					} else {
+						playerWorld.otherPlayers[id].assistAmount++
+					}
 				}
+				playerWorld.killFeed.add(playerWorld.playerName(killerId), playerWorld.playerName(killedId), event.Weapon, event.Headshot)
+
+			case protocol.VoiceEvent:
+				playerWorld.voice.receive(event.SpeakerId, event.Samples)
 
-				teamThatWonPoint := team(message[1])
-				switch teamThatWonPoint {
-				case a:
+			case protocol.GrenadeThrowEvent:
+				playerWorld.thrownGrenades.throw(event.Kind, event.State)
+
+			case protocol.GrenadeBounceEvent:
+				playerWorld.thrownGrenades.bounce(event.State)
+
+			case protocol.ExplosionEvent:
+				location := rl.Vector3{X: protocol.Int8ScaleToFloat32(event.X), Y: protocol.Int8ScaleToFloat32(event.Y), Z: protocol.Int8ScaleToFloat32(event.Z)}
+				playerWorld.thrownGrenades.explode(event.GrenadeId, location)
+				playerWorld.explosionParticles(location)
+				distance := rl.Vector3Distance(playerWorld.camera.Position, location)
+				playerWorld.settings.setEffectVolume(playerWorld.explosionSound, min(1, gunshotFullVolumeDistance/distance))
+				rl.SetSoundPan(playerWorld.explosionSound, playerWorld.panTowards(location))
+				rl.PlaySound(playerWorld.explosionSound)
+
+			case protocol.SmokeEvent:
+				playerWorld.thrownGrenades.smoke(event.GrenadeId, rl.Vector3{X: protocol.Int8ScaleToFloat32(event.X), Y: protocol.Int8ScaleToFloat32(event.Y), Z: protocol.Int8ScaleToFloat32(event.Z)})
+
+			case protocol.FlashEvent:
+				location := rl.Vector3{X: protocol.Int8ScaleToFloat32(event.X), Y: protocol.Int8ScaleToFloat32(event.Y), Z: protocol.Int8ScaleToFloat32(event.Z)}
+				playerWorld.thrownGrenades.blind(event.GrenadeId, playerWorld.flashIntensity(location))
+
+			case protocol.Roster:
+				playerWorld.setRoster(event)
+				playerWorld.handleRoster(event)
+
+			case protocol.TeamPointEvent:
+				switch event.Team {
+				case protocol.A:
 					playerWorld.teamAPoints++
-				case b:
+				case protocol.B:
 					playerWorld.teamBPoints++
-				default:
-					log.Println("Deformed team point message")
 				}
+				playerWorld.roundBanner.set(event.Team)
+				playerWorld.setRoundTime(0)
 
-			case byte(loseHealthHeader):
-				if len(message) != 2 {
-					log.Println("Erroneous server message")
-					break
+			case protocol.RoundTimeEvent:
+				playerWorld.setRoundTime(event.Left)
+
+			case protocol.GraceEvent:
+				playerWorld.countdown.set(event.Left)
+
+			case protocol.LoseHealthEvent:
+				if event.Headshot {
+					playerWorld.settings.setEffectVolume(playerWorld.headshotSound, 1)
+					rl.SetSoundPan(playerWorld.headshotSound, 0.5)
+					rl.PlaySound(playerWorld.headshotSound)
 				}
 
 				// handle taking damage
-				damage := int(message[1])
-				playerWorld.health -= damage
+				playerWorld.health -= event.Damage
 				if playerWorld.health < 0 {
 					playerWorld.health = 0
 				}
 				playerWorld.isDamaged = true
-				time.AfterFunc(100 * time.Millisecond, func() {
+				playerWorld.takeDamage()
+				time.AfterFunc(100*time.Millisecond, func() {
 					playerWorld.isDamaged = false
 				})
 
-			case byte(playerDisconnectHeader):
-				if len(message) != 2 {
-					log.Println("Erroneous server message")
-					break
+			case protocol.HealthPackTakenEvent:
+				pack, healed := event.Pack, event.Healed
+				playerWorld.healthPacks.take(pack)
+
+				// we hear our own pick up up close, and anyone else's from
+				// where the health pack was
+				if event.PlayerId == playerWorld.id {
+					playerWorld.health += healed
+					playerWorld.healed = healed
+					time.AfterFunc(healedDisplayTime, func() {
+						playerWorld.healed = 0
+					})
+					playerWorld.settings.setEffectVolume(playerWorld.healthPackSound, 1)
+					rl.SetSoundPan(playerWorld.healthPackSound, 0.5)
+					rl.PlaySound(playerWorld.healthPackSound)
+				} else if pack < len(playerWorld.healthPackLocations) {
+					location := playerWorld.healthPackLocations[pack]
+					distance := rl.Vector3Distance(playerWorld.camera.Position, location)
+					playerWorld.settings.setEffectVolume(playerWorld.healthPackSound, min(1, gunshotFullVolumeDistance/distance))
+					rl.SetSoundPan(playerWorld.healthPackSound, playerWorld.panTowards(location))
+					rl.PlaySound(playerWorld.healthPackSound)
+				}
+
+			case protocol.HealthPacksEvent:
+				playerWorld.healthPacks.setTaken(event.Taken)
+
+			case protocol.DoorEvent:
+				playerWorld.doors.set(event.Door, event.Open)
+
+			case protocol.DoorsEvent:
+				playerWorld.doors.setOpen(event.Open)
+
+			case protocol.LaunchEvent:
+				if event.PlayerId != playerWorld.id {
+					playerWorld.otherPlayerLaunched(event.PlayerId, event.Pad)
+				}
+
+			case protocol.TeleportEvent:
+				if event.PlayerId != playerWorld.id {
+					playerWorld.otherPlayerTeleported(event.PlayerId, event.Teleporter)
 				}
 
+			case protocol.StreakEvent:
+				playerWorld.announceStreak(event)
+
+			case protocol.TeammateHealthEvent:
+				playerWorld.otherPlayers[event.PlayerId].healthLost = protocol.MaxHealth - event.Health
+
+			case protocol.MarkerEvent:
+				playerWorld.markers.set(event.PlayerId, rl.Vector3{X: protocol.Int8ScaleToFloat32(event.X), Y: protocol.Int8ScaleToFloat32(event.Y), Z: protocol.Int8ScaleToFloat32(event.Z)})
+
+			case protocol.StatisticsEvent:
+				playerWorld.statistics = event
+
+			case protocol.Inventory:
+				playerWorld.applyInventory(event)
+
+			case protocol.PlayerDisconnectEvent:
 				// handle player disconnection
-				disconnectedPlayerId := int(message[1])
-				playerWorld.otherPlayers[disconnectedPlayerId].otherPlayerState = nonExistent
+				playerWorld.otherPlayers[event.Id].otherPlayerState = nonExistent
+				playerWorld.otherPlayers[event.Id].snapshotCount = 0
+
+			case protocol.HitConfirmation:
+				if !event.Accepted {
+					break
+				}
+				playerWorld.hitFeedback.confirm(event)
+				hitSound, volume := playerWorld.hitMarkerSound, float32(hitMarkerVolume)
+				if event.Headshot {
+					hitSound, volume = playerWorld.headshotSound, 1
+				}
+				playerWorld.settings.setEffectVolume(hitSound, volume)
+				rl.SetSoundPan(hitSound, playerWorld.panTowards(playerWorld.otherPlayers[event.PlayerId].position))
+				rl.PlaySound(hitSound)
+
+			case protocol.PongEvent:
+				playerWorld.handlePong(event.Number, event.ServerTime)
+
+			case protocol.PingsEvent:
+				for _, parcel := range event {
+					playerWorld.otherPlayers[parcel.Id].ping = parcel.Ping
+				}
+
+			case protocol.CorrectionEvent:
+				playerWorld.prediction.correct(event.Sequence, event.X, event.Y, event.Z)
 
-			default:
-				log.Println("Erroneous message from server")
+			case protocol.MapChangeEvent:
+				mapName := event.Name
+				gameMap, err := playerWorld.resourceFiles.loadMap(playerWorld.mapDirectory, mapName)
+				if err != nil {
+					slog.Error("Could not load map", "map", mapName, "error", err)
+					break
+				}
+
+				// the world can only be rebuilt on the main thread, and has
+				// to be in place before the next round puts us at a spawn
+				change := worldChange{gameMap: gameMap, done: make(chan struct{})}
+				select {
+				case playerWorld.worldChanges <- change:
+				case <-context.Done():
+					return
+				}
+				select {
+				case <-change.done:
+				case <-context.Done():
+					return
+				}
+				playerWorld.mapName = mapName
+
+			case protocol.ResumeState:
+				playerWorld.handleResume(event)
+
+			case protocol.VoteState:
+				playerWorld.votes.update(event, playerWorld.id)
+
+			case protocol.SayEvent:
+				playerWorld.said.set(event.Text)
+
+			case protocol.PromotedEvent:
+				playerWorld.handlePromoted(event)
 			}
 		}
 	}
 }
 
-const locationUpdateFrequency = 12
+// which way the camera is looking, scaled to be sent
+func (playerWorld *playerWorld) look() (byte, int8) {
+	forward := rl.Vector3Normalize(rl.Vector3Subtract(playerWorld.camera.Target, playerWorld.camera.Position))
+	yaw := math.Atan2(float64(forward.Z), float64(forward.X))
+	pitch := math.Asin(float64(forward.Y))
+	return protocol.YawToByte(float32(yaw)), protocol.PitchToInt8(float32(pitch))
+}
 
-// constantly update the server on our location
+// constantly tell the server how far we moved, it has the final say on where we are
 func (playerWorld *playerWorld) sendServerLocation() {
-	for playerWorld.round == 0 {
+	for playerWorld.round == 0 && !playerWorld.warmup {
 		time.Sleep(time.Second)
 	}
 
-	ticker := time.NewTicker(time.Second / locationUpdateFrequency)
+	ticker := time.NewTicker(playerWorld.tickInterval())
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
 			playerWorld.connMutex.Lock()
-			playerWorld.conn.WriteMessage(websocket.BinaryMessage, []byte{byte(locationMessage), byte(float32ScaleToInt8(playerWorld.camera.Position.X)), byte(float32ScaleToInt8(playerWorld.camera.Position.Y - cameraHeight)), byte(float32ScaleToInt8(playerWorld.camera.Position.Z))})
+			yaw, pitch := playerWorld.look()
+			writeMessage(playerWorld.conn, playerWorld.prediction.nextMove(positionOffsetHeight(playerWorld.camera.Position, playerWorld.eyeHeight()), yaw, pitch, playerWorld.crouching))
 			playerWorld.connMutex.Unlock()
 		}
 	}
 }
 
-func float32ScaleToInt8(number float32) int8 {
-	return int8(number * scalingFactor)
-}
-
 func disconnect(conn *websocket.Conn) {
 	if err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")); err != nil {
-		log.Println(err)
+		slog.Warn("Could not close connection", "error", err)
 	}
 	time.Sleep(500 * time.Millisecond)
 	conn.Close()
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"sync"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// prediction
+//////// the player moves straight away, and is put back in line whenever the
+//////// server refuses one of their moves
+
+// how many sent moves are remembered, enough for a few seconds of lag
+const moveHistorySize = 64
+
+// a location in scaled units, wide enough to not overflow while adding
+type scaledLocation [3]int
+
+func scaleLocation(location rl.Vector3) scaledLocation {
+	return scaledLocation{
+		int(protocol.Float32ScaleToInt8(location.X)),
+		int(protocol.Float32ScaleToInt8(location.Y)),
+		int(protocol.Float32ScaleToInt8(location.Z)),
+	}
+}
+
+// where the server will have the player once it has applied a move
+type sentMove struct {
+	sequence protocol.Sequence
+	location scaledLocation
+	valid    bool
+}
+
+type prediction struct {
+	sequence   protocol.Sequence
+	sent       scaledLocation // where the server will have the player after every sent move
+	history    [moveHistorySize]sentMove
+	correction rl.Vector3 // waiting to be applied to the player
+	mutex      sync.Mutex
+}
+
+// start predicting afresh from a location the server agrees with
+func (prediction *prediction) reset(location rl.Vector3) {
+	prediction.mutex.Lock()
+	defer prediction.mutex.Unlock()
+
+	prediction.sent = scaleLocation(location)
+	prediction.history = [moveHistorySize]sentMove{}
+	prediction.correction = rl.Vector3Zero()
+}
+
+// the move message taking the server from the last sent location to this one,
+// the yaw and pitch are already scaled
+func (prediction *prediction) nextMove(location rl.Vector3, yaw byte, pitch int8, crouching bool) []byte {
+	prediction.mutex.Lock()
+	defer prediction.mutex.Unlock()
+
+	target := scaleLocation(location)
+	var delta [3]int8
+	for axis := range delta {
+		delta[axis] = int8(min(max(target[axis]-prediction.sent[axis], -128), 127))
+		prediction.sent[axis] += int(delta[axis])
+	}
+
+	prediction.sequence++
+	prediction.history[int(prediction.sequence)%moveHistorySize] = sentMove{
+		sequence: prediction.sequence,
+		location: prediction.sent,
+		valid:    true,
+	}
+	return protocol.EncodeMove(protocol.Move{
+		Sequence:  prediction.sequence,
+		Dx:        delta[0],
+		Dy:        delta[1],
+		Dz:        delta[2],
+		Yaw:       yaw,
+		Pitch:     pitch,
+		Crouching: crouching,
+	})
+}
+
+// the server had the player somewhere else after a move, so shift the player
+// and every move since by the difference
+func (prediction *prediction) correct(sequence protocol.Sequence, x, y, z int8) {
+	prediction.mutex.Lock()
+	defer prediction.mutex.Unlock()
+
+	// a move too old to remember is treated as the latest one
+	expected := prediction.sent
+	if move := prediction.history[int(sequence)%moveHistorySize]; move.valid && move.sequence == sequence {
+		expected = move.location
+	}
+	offset := scaledLocation{int(x) - expected[0], int(y) - expected[1], int(z) - expected[2]}
+	if offset == (scaledLocation{}) {
+		return
+	}
+
+	for axis := range offset {
+		prediction.sent[axis] += offset[axis]
+	}
+	for i := range prediction.history {
+		move := &prediction.history[i]
+		if move.valid && move.sequence.After(sequence) {
+			for axis := range offset {
+				move.location[axis] += offset[axis]
+			}
+		}
+	}
+	prediction.correction = rl.Vector3Add(prediction.correction, rl.Vector3{
+		X: float32(offset[0]) / protocol.ScalingFactor,
+		Y: float32(offset[1]) / protocol.ScalingFactor,
+		Z: float32(offset[2]) / protocol.ScalingFactor,
+	})
+}
+
+// take the correction that still has to be applied to the player
+func (prediction *prediction) takeCorrection() rl.Vector3 {
+	prediction.mutex.Lock()
+	defer prediction.mutex.Unlock()
+
+	correction := prediction.correction
+	prediction.correction = rl.Vector3Zero()
+	return correction
+}
+
+// put the player where the server says they are
+func (playerWorld *playerWorld) applyCorrection() {
+	correction := playerWorld.prediction.takeCorrection()
+	if correction == rl.Vector3Zero() {
+		return
+	}
+	playerWorld.camera.Position = rl.Vector3Add(playerWorld.camera.Position, correction)
+	playerWorld.camera.Target = rl.Vector3Add(playerWorld.camera.Target, correction)
+	playerWorld.boundingBox.Min = rl.Vector3Add(playerWorld.boundingBox.Min, correction)
+	playerWorld.boundingBox.Max = rl.Vector3Add(playerWorld.boundingBox.Max, correction)
+}
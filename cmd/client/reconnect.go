@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/gorilla/websocket"
+	"github.com/lezhou8/shooter/internal/connection"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// reconnecting
+//////// a connection that drops in the middle of a match, rather than being
+//////// closed by the server, is dialled again with our session token, backing
+//////// off between tries, for as long as the server holds our slot; the server
+//////// catches us up as it does anyone who rejoins, so everything reading
+//////// messages carries on as though the connection never went away
+
+const (
+	firstReconnectWait = 500 * time.Millisecond
+	maxReconnectWait   = 4 * time.Second
+)
+
+// reads the connection, and the one that replaces it if it drops
+type reconnectingReader struct {
+	meta      *meta
+	messages  messageReader // the current connection
+	pending   [][]byte      // to be read before anything else, as if the server had sent them
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newReconnectingReader(meta *meta) *reconnectingReader {
+	return &reconnectingReader{meta: meta, messages: meta.messages, done: make(chan struct{})}
+}
+
+func (reader *reconnectingReader) ReadMessage() (int, []byte, error) {
+	for {
+		if len(reader.pending) > 0 {
+			message := reader.pending[0]
+			reader.pending = reader.pending[1:]
+			return websocket.BinaryMessage, message, nil
+		}
+
+		messageType, message, err := reader.messages.ReadMessage()
+		if err == nil || !reader.droppedOut(err) {
+			return messageType, message, err
+		}
+		slog.Warn("Connection lost, reconnecting", "error", err)
+		if reconnectErr := reader.reconnect(); reconnectErr != nil {
+			slog.Error("Could not reconnect", "error", reconnectErr)
+			return messageType, message, err
+		}
+		slog.Info("Reconnected")
+	}
+}
+
+// stop trying to reconnect, as we are leaving
+func (reader *reconnectingReader) Close() {
+	reader.closeOnce.Do(func() {
+		close(reader.done)
+	})
+}
+
+// whether the connection went away on its own, rather than being closed by
+// the server at the end of the match or by us on the way out; observers have
+// no slot held for them to come back to
+func (reader *reconnectingReader) droppedOut(err error) bool {
+	select {
+	case <-reader.done:
+		return false
+	default:
+	}
+	if reader.meta.token == nil {
+		return false
+	}
+	var closeError *websocket.CloseError
+	if errors.As(err, &closeError) {
+		return closeError.Code == websocket.CloseAbnormalClosure
+	}
+	return true
+}
+
+// dial the server until it takes us back, or our slot is gone
+func (reader *reconnectingReader) reconnect() error {
+	meta := reader.meta
+	meta.reconnecting.Store(true)
+	defer meta.reconnecting.Store(false)
+
+	giveUp := time.Now().Add(protocol.ReconnectGraceTime)
+	wait := firstReconnectWait
+	for {
+		select {
+		case <-reader.done:
+			return errors.New("Stopped reconnecting")
+		case <-time.After(wait):
+		}
+
+		// the server turns us away until it notices the old connection is
+		// gone too, so that is tried again like a server that cannot be
+		// reached
+		conn, _, err := websocket.DefaultDialer.Dial(meta.url, nil)
+		var admission protocol.Admission
+		if err == nil {
+			admission, err = join(conn, protocol.EncodeRejoin(meta.id, meta.token, meta.name, meta.password))
+		}
+		if err != nil {
+			if time.Now().After(giveUp) {
+				return err
+			}
+			slog.Debug("Could not rejoin", "error", err)
+			wait = min(wait*2, maxReconnectWait)
+			continue
+		}
+
+		// the map may have moved on while we were gone
+		if admission.Map != meta.mapName {
+			reader.pending = append(reader.pending, protocol.EncodeMapChange(admission.Map))
+		}
+		meta.connMutex.Lock()
+		meta.adopt(conn, admission)
+		meta.connMutex.Unlock()
+		reader.messages = connection.NewReader(conn)
+		return nil
+	}
+}
+
+// dim the screen while the connection is being made again
+func (playerWorld *playerWorld) drawReconnecting() {
+	if !playerWorld.reconnecting.Load() {
+		return
+	}
+	rl.DrawRectangle(0, 0, internalWindowWidth, internalWindowHeight, rl.Fade(rl.Black, 0.5))
+	playerWorld.drawScaled(rl.Vector2{X: centerX, Y: centerY}, func() {
+		rl.DrawTextEx(playerWorld.font, "RECONNECTING...", rl.Vector2{X: textXLocation, Y: textYLocation}, fontSize, 0, rl.White)
+	})
+}
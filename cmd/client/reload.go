@@ -0,0 +1,145 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+//////// reloading resources
+//////// in developer mode the resources directory is checked for changed
+//////// files twice a second, and the textures and shaders read from them are
+//////// loaded again where they are, without restarting; a texture keeps the
+//////// size it was first loaded at, so a new size needs a restart
+
+const reloadInterval = 500 * time.Millisecond
+
+const developerResourceDirectory = "resources" // watched when -dev is given without -resources
+
+type watchedShader struct {
+	shader                   *rl.Shader
+	vertexName, fragmentName string
+}
+
+// everything loaded from the resources directory, only touched from the main
+// thread, where the textures and shaders are loaded
+type resourceWatcher struct {
+	textures map[string][]rl.Texture2D // by the path they were read from
+	shaders  []watchedShader
+	modified map[string]time.Time // zero for a file the directory does not have
+	checked  time.Time
+}
+
+func newResourceFiles(directory string, developer bool) resourceFiles {
+	if !developer {
+		return resourceFiles{directory: directory}
+	}
+	if directory == "" {
+		directory = developerResourceDirectory
+	}
+	return resourceFiles{
+		directory: directory,
+		watcher:   &resourceWatcher{textures: map[string][]rl.Texture2D{}, modified: map[string]time.Time{}},
+	}
+}
+
+func (files resourceFiles) modifiedAt(name string) time.Time {
+	info, err := os.Stat(filepath.Join(files.directory, filepath.FromSlash(name)))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func (files resourceFiles) watch(name string) {
+	if _, ok := files.watcher.modified[name]; !ok {
+		files.watcher.modified[name] = files.modifiedAt(name)
+	}
+}
+
+func (files resourceFiles) watchTexture(name string, texture rl.Texture2D) {
+	if files.watcher == nil {
+		return
+	}
+	files.watch(name)
+	files.watcher.textures[name] = append(files.watcher.textures[name], texture)
+}
+
+func (files resourceFiles) watchShader(shader *rl.Shader, vertexName, fragmentName string) {
+	if files.watcher == nil {
+		return
+	}
+	for _, name := range []string{vertexName, fragmentName} {
+		if name != "" {
+			files.watch(name)
+		}
+	}
+	files.watcher.shaders = append(files.watcher.shaders, watchedShader{shader, vertexName, fragmentName})
+}
+
+// stop reloading a texture and unload it, for the textures of a map being
+// left
+func (files resourceFiles) unloadTexture(texture rl.Texture2D) {
+	if files.watcher != nil {
+		for name, textures := range files.watcher.textures {
+			files.watcher.textures[name] = slices.DeleteFunc(textures, func(watched rl.Texture2D) bool {
+				return watched.ID == texture.ID
+			})
+		}
+	}
+	rl.UnloadTexture(texture)
+}
+
+// load again whatever has changed since it was last checked, called each
+// frame, the main thread only
+func (files resourceFiles) reloadChanged() {
+	watcher := files.watcher
+	if watcher == nil || time.Since(watcher.checked) < reloadInterval {
+		return
+	}
+	watcher.checked = time.Now()
+
+	changed := map[string]bool{}
+	for name, modified := range watcher.modified {
+		if now := files.modifiedAt(name); !now.Equal(modified) {
+			watcher.modified[name] = now
+			changed[name] = true
+		}
+	}
+	for name := range changed {
+		for _, texture := range watcher.textures[name] {
+			files.reloadTexture(name, texture)
+		}
+	}
+	for _, watched := range watcher.shaders {
+		if changed[watched.vertexName] || changed[watched.fragmentName] {
+			rl.UnloadShader(*watched.shader)
+			*watched.shader = files.shader(watched.vertexName, watched.fragmentName)
+			slog.Info("Reloaded shader", "vertex", watched.vertexName, "fragment", watched.fragmentName)
+		}
+	}
+}
+
+// the texture's pixels are replaced, so everything drawing it sees the
+// change
+func (files resourceFiles) reloadTexture(name string, texture rl.Texture2D) {
+	data, err := files.read(name)
+	if err != nil || len(data) == 0 {
+		slog.Warn("Could not reload texture", "path", name, "error", err)
+		return
+	}
+	image := rl.LoadImageFromMemory(fileType(name), data, int32(len(data)))
+	defer rl.UnloadImage(image)
+	if image.Width != texture.Width || image.Height != texture.Height {
+		slog.Warn("Texture changed size, restart to see it", "path", name)
+		return
+	}
+	colours := rl.LoadImageColors(image)
+	rl.UpdateTexture(texture, colours)
+	rl.UnloadImageColors(colours)
+	slog.Info("Reloaded texture", "path", name)
+}
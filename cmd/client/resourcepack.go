@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/png"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/lezhou8/shooter/internal/maps"
+	embedded "github.com/lezhou8/shooter/resources"
+)
+
+//////// resource packs
+//////// a resource pack is a directory laid out like resources, reskinning the
+//////// guns, sounds and the rest by having files of the same names; the files
+//////// built into the client are the manifest a pack is checked against before
+//////// the client starts, so a file the game would fail to load, or would draw
+//////// wrongly, is caught up front, and anything the pack leaves out stays
+//////// built in
+
+// make sure each file in a pack can take the place of the built in one
+func checkResourcePack(directory string) error {
+	info, err := os.Stat(directory)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", directory)
+	}
+
+	var problems []error
+	err = filepath.WalkDir(directory, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relative, err := filepath.Rel(directory, file)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relative)
+		builtIn, err := fs.ReadFile(embedded.Files, name)
+		if err != nil {
+			// most likely a misspelt name, which would be ignored
+			slog.Warn("Resource pack has a file the game does not use", "path", name)
+			return nil
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := checkResource(name, data, builtIn); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", name, err))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Join(problems...)
+}
+
+// whether a file can stand in for the built in one of the same name
+func checkResource(name string, data, builtIn []byte) error {
+	if len(data) == 0 {
+		return errors.New("File is empty")
+	}
+	switch path.Dir(name) {
+	case "textures":
+		// sprites are cut into frames by their size
+		packed, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		original, _, err := image.DecodeConfig(bytes.NewReader(builtIn))
+		if err != nil {
+			return err
+		}
+		if packed.Width != original.Width || packed.Height != original.Height {
+			return fmt.Errorf("Image is %dx%d but has to be %dx%d", packed.Width, packed.Height, original.Width, original.Height)
+		}
+	case "sounds", "music":
+		if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+			return errors.New("Not a WAV file")
+		}
+	case "fonts":
+		if magic := string(data[:min(4, len(data))]); magic != "\x00\x01\x00\x00" && magic != "true" && magic != "OTTO" {
+			return errors.New("Not a TrueType or OpenType font")
+		}
+	case "maps":
+		if _, err := maps.Parse(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
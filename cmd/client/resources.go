@@ -1,6 +1,19 @@
 package main
 
-import rl "github.com/gen2brain/raylib-go/raylib"
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/protocol"
+	embedded "github.com/lezhou8/shooter/resources"
+)
 
 const (
 	internalWindowWidth  = 426
@@ -8,25 +21,31 @@ const (
 )
 
 type resources struct {
+	files resourceFiles
 	textures
+	models
 	fonts
 	sound
+	music
 	shaders
 }
 
 type textures struct {
-	renderTexture    rl.RenderTexture2D
-	floorTexture     rl.Texture2D
-	outerWallTexture rl.Texture2D
-	innerWallTexture rl.Texture2D
+	renderTexture rl.RenderTexture2D
 
 	handgunShoot rl.Texture2D
 	sniperShoot  rl.Texture2D
 	sniperScope  rl.Texture2D
+	shotgunShoot rl.Texture2D
+	smgShoot     rl.Texture2D
+	rifleShoot   rl.Texture2D
+
+	smokeTexture       rl.Texture2D
+	muzzleFlashTexture rl.Texture2D
+}
 
-	otherPlayerA      rl.Texture2D
-	otherPlayerB      rl.Texture2D
-	deadPlayerTexture rl.Texture2D
+type models struct {
+	characterModel rl.Model // a unit cube, scaled into each part of a character
 }
 
 type fonts struct {
@@ -38,53 +57,98 @@ type sound struct {
 	handgunReloadSound rl.Sound
 	sniperShootSound   rl.Sound
 	sniperReloadSound  rl.Sound
-	genericShootSound  rl.Sound
+	shotgunShootSound  rl.Sound
+	smgShootSound      rl.Sound
+	rifleShootSound    rl.Sound
+	genericShootSounds [protocol.MaxPlayers]rl.Sound // one for each player, so shots from different places can overlap
 	swapSound          rl.Sound
 	hitMarkerSound     rl.Sound
+	headshotSound      rl.Sound
+	explosionSound     rl.Sound
+	healthPackSound    rl.Sound
+	painSound          rl.Sound
+	heartbeatSound     rl.Sound
+	streakSounds       [streakKinds]rl.Sound         // announcer lines, see streaks.go
+	footstepSounds     [protocol.MaxPlayers]rl.Sound // one for each player, so each can have its own volume
+	reloadSounds       [protocol.MaxPlayers]rl.Sound // other players reloading, one for each like footsteps
+	swapSounds         [protocol.MaxPlayers]rl.Sound
 }
 
 type shaders struct {
 	chromaticAberration rl.Shader
+	lighting            rl.Shader // the sun on the world, see lighting.go
 }
 
 func (resources *resources) loadResources() {
 	resources.renderTexture = rl.LoadRenderTexture(internalWindowWidth, internalWindowHeight)
-	resources.floorTexture = rl.LoadTexture("resources/textures/floor_texture.png")
-	resources.outerWallTexture = rl.LoadTexture("resources/textures/outer_wall_texture.png")
-	resources.innerWallTexture = rl.LoadTexture("resources/textures/inner_wall_texture.png")
-	resources.handgunShoot = rl.LoadTexture("resources/textures/handgun_shoot.png")
-	resources.sniperShoot = rl.LoadTexture("resources/textures/sniper_shoot.png")
-	resources.sniperScope = rl.LoadTexture("resources/textures/sniper_scope.png")
-	resources.otherPlayerA = rl.LoadTexture("resources/textures/other_player_a.png")
-	resources.otherPlayerB = rl.LoadTexture("resources/textures/other_player_b.png")
-	resources.deadPlayerTexture = rl.LoadTexture("resources/textures/dead.png")
-
-	resources.mainFont = rl.LoadFont("resources/fonts/FSEX300.ttf")
+	resources.handgunShoot = resources.files.texture("textures/handgun_shoot.png")
+	resources.sniperShoot = resources.files.texture("textures/sniper_shoot.png")
+	resources.sniperScope = resources.files.texture("textures/sniper_scope.png")
+	resources.shotgunShoot = resources.files.texture("textures/shotgun_shoot.png")
+	resources.smgShoot = resources.files.texture("textures/smg_shoot.png")
+	resources.rifleShoot = resources.files.texture("textures/rifle_shoot.png")
+	smokeImage := rl.GenImageGradientRadial(64, 64, 0.4, rl.Gray, rl.Blank)
+	resources.smokeTexture = rl.LoadTextureFromImage(smokeImage)
+	rl.UnloadImage(smokeImage)
+	muzzleFlashImage := rl.GenImageGradientRadial(32, 32, 0.2, rl.NewColor(255, 240, 180, 255), rl.Blank)
+	resources.muzzleFlashTexture = rl.LoadTextureFromImage(muzzleFlashImage)
+	rl.UnloadImage(muzzleFlashImage)
+
+	resources.characterModel = rl.LoadModelFromMesh(rl.GenMeshCube(1, 1, 1))
+
+	resources.mainFont = resources.files.font("fonts/FSEX300.ttf")
 
 	rl.InitAudioDevice()
-	resources.handgunShootSound = rl.LoadSound("resources/sounds/handgun_shoot.wav")
-	resources.handgunReloadSound = rl.LoadSound("resources/sounds/handgun_reload.wav")
-	resources.sniperShootSound = rl.LoadSound("resources/sounds/sniper_shoot.wav")
-	resources.sniperReloadSound = rl.LoadSound("resources/sounds/sniper_reload.wav")
-	resources.genericShootSound = rl.LoadSound("resources/sounds/generic_gunshot.wav")
-	resources.swapSound = rl.LoadSound("resources/sounds/swap_sound.wav")
-	resources.hitMarkerSound = rl.LoadSound("resources/sounds/hit_marker.wav")
-	rl.SetSoundVolume(resources.hitMarkerSound, 5)
+	resources.handgunShootSound = resources.files.sound("sounds/handgun_shoot.wav")
+	resources.handgunReloadSound = resources.files.sound("sounds/handgun_reload.wav")
+	resources.sniperShootSound = resources.files.sound("sounds/sniper_shoot.wav")
+	resources.sniperReloadSound = resources.files.sound("sounds/sniper_reload.wav")
+	resources.shotgunShootSound = resources.files.sound("sounds/shotgun_shoot.wav")
+	resources.smgShootSound = resources.files.sound("sounds/smg_shoot.wav")
+	resources.rifleShootSound = resources.files.sound("sounds/rifle_shoot.wav")
+	for i := range resources.genericShootSounds {
+		resources.genericShootSounds[i] = resources.files.sound("sounds/generic_gunshot.wav")
+	}
+	resources.swapSound = resources.files.sound("sounds/swap_sound.wav")
+	resources.hitMarkerSound = resources.files.sound("sounds/hit_marker.wav")
+	resources.headshotSound = resources.files.sound("sounds/headshot.wav")
+	resources.explosionSound = resources.files.sound("sounds/explosion.wav")
+	resources.healthPackSound = resources.files.sound("sounds/health_pickup.wav")
+	resources.painSound = resources.files.sound("sounds/pain.wav")
+	resources.heartbeatSound = resources.files.sound("sounds/heartbeat.wav")
+	for kind, file := range streakSoundFiles {
+		resources.streakSounds[kind] = resources.files.sound(file)
+	}
+	for i := range resources.footstepSounds {
+		resources.footstepSounds[i] = resources.files.sound("sounds/footstep.wav")
+	}
+	for i := range resources.reloadSounds {
+		resources.reloadSounds[i] = resources.files.sound("sounds/handgun_reload.wav")
+		resources.swapSounds[i] = resources.files.sound("sounds/swap_sound.wav")
+	}
 
-	resources.chromaticAberration = rl.LoadShader("", "resources/shaders/chromatic_aberration.fs")
+	resources.lobbyMusic = resources.loadMusic("music/lobby.wav")
+	resources.lastRoundMusic = resources.loadMusic("music/last_round.wav")
+	resources.roundStartStinger = resources.files.sound("music/round_start.wav")
+
+	resources.chromaticAberration = resources.files.shader("", "shaders/chromatic_aberration.fs")
+	resources.lighting = resources.files.shader("shaders/lighting.vs", "shaders/lighting.fs")
+	resources.files.watchShader(&resources.chromaticAberration, "", "shaders/chromatic_aberration.fs")
+	resources.files.watchShader(&resources.lighting, "shaders/lighting.vs", "shaders/lighting.fs")
 }
 
 func (resources *resources) unloadResources() {
 	rl.UnloadRenderTexture(resources.renderTexture)
-	rl.UnloadTexture(resources.floorTexture)
-	rl.UnloadTexture(resources.outerWallTexture)
-	rl.UnloadTexture(resources.innerWallTexture)
 	rl.UnloadTexture(resources.handgunShoot)
 	rl.UnloadTexture(resources.sniperShoot)
 	rl.UnloadTexture(resources.sniperScope)
-	rl.UnloadTexture(resources.otherPlayerA)
-	rl.UnloadTexture(resources.otherPlayerB)
-	rl.UnloadTexture(resources.deadPlayerTexture)
+	rl.UnloadTexture(resources.shotgunShoot)
+	rl.UnloadTexture(resources.smgShoot)
+	rl.UnloadTexture(resources.rifleShoot)
+	rl.UnloadTexture(resources.smokeTexture)
+	rl.UnloadTexture(resources.muzzleFlashTexture)
+
+	rl.UnloadModel(resources.characterModel)
 
 	rl.UnloadFont(resources.mainFont)
 
@@ -93,9 +157,148 @@ func (resources *resources) unloadResources() {
 	rl.UnloadSound(resources.handgunReloadSound)
 	rl.UnloadSound(resources.sniperShootSound)
 	rl.UnloadSound(resources.sniperReloadSound)
-	rl.UnloadSound(resources.genericShootSound)
+	rl.UnloadSound(resources.shotgunShootSound)
+	rl.UnloadSound(resources.smgShootSound)
+	rl.UnloadSound(resources.rifleShootSound)
+	for _, genericShootSound := range resources.genericShootSounds {
+		rl.UnloadSound(genericShootSound)
+	}
 	rl.UnloadSound(resources.swapSound)
 	rl.UnloadSound(resources.hitMarkerSound)
+	rl.UnloadSound(resources.headshotSound)
+	rl.UnloadSound(resources.explosionSound)
+	rl.UnloadSound(resources.healthPackSound)
+	rl.UnloadSound(resources.painSound)
+	rl.UnloadSound(resources.heartbeatSound)
+	for _, streakSound := range resources.streakSounds {
+		rl.UnloadSound(streakSound)
+	}
+	for _, footstepSound := range resources.footstepSounds {
+		rl.UnloadSound(footstepSound)
+	}
+	for i := range resources.reloadSounds {
+		rl.UnloadSound(resources.reloadSounds[i])
+		rl.UnloadSound(resources.swapSounds[i])
+	}
+
+	rl.UnloadMusicStream(resources.lobbyMusic)
+	rl.UnloadMusicStream(resources.lastRoundMusic)
+	rl.UnloadSound(resources.roundStartStinger)
 
 	rl.UnloadShader(resources.chromaticAberration)
+	rl.UnloadShader(resources.lighting)
+}
+
+// where resource files are read from, by their path in the resources
+// directory such as textures/floor_texture.png; a file in the directory given
+// with -resources takes the place of the one built in, and anything it leaves
+// out is still built in
+type resourceFiles struct {
+	directory string
+	watcher   *resourceWatcher // only in developer mode, see reload.go
+}
+
+func (files resourceFiles) read(name string) ([]byte, error) {
+	if files.directory != "" {
+		data, err := os.ReadFile(filepath.Join(files.directory, filepath.FromSlash(name)))
+		if !errors.Is(err, fs.ErrNotExist) {
+			return data, err
+		}
+	}
+	return fs.ReadFile(embedded.Files, name)
+}
+
+// raylib tells what a file holds from its extension
+func fileType(name string) string {
+	return strings.ToLower(path.Ext(name))
+}
+
+// a texture that cannot be read is left empty, as raylib does with a missing
+// file
+func (files resourceFiles) texture(name string) rl.Texture2D {
+	data, err := files.read(name)
+	if err != nil || len(data) == 0 {
+		slog.Error("Could not read texture", "path", name, "error", err)
+		return rl.Texture2D{}
+	}
+	texture := textureFromMemory(name, data)
+	files.watchTexture(name, texture)
+	return texture
+}
+
+// always RGBA, so a texture can be reloaded in place from any image
+func textureFromMemory(name string, data []byte) rl.Texture2D {
+	image := rl.LoadImageFromMemory(fileType(name), data, int32(len(data)))
+	rl.ImageFormat(image, rl.UncompressedR8g8b8a8)
+	texture := rl.LoadTextureFromImage(image)
+	rl.UnloadImage(image)
+	return texture
+}
+
+func (files resourceFiles) sound(name string) rl.Sound {
+	data, err := files.read(name)
+	if err != nil || len(data) == 0 {
+		slog.Error("Could not read sound", "path", name, "error", err)
+		return rl.Sound{}
+	}
+	wave := rl.LoadWaveFromMemory(fileType(name), data, int32(len(data)))
+	sound := rl.LoadSoundFromWave(wave)
+	rl.UnloadWave(wave)
+	return sound
+}
+
+// loaded at the size raylib loads fonts at by default
+func (files resourceFiles) font(name string) rl.Font {
+	data, err := files.read(name)
+	if err != nil || len(data) == 0 {
+		slog.Error("Could not read font", "path", name, "error", err)
+		return rl.GetFontDefault()
+	}
+	return rl.LoadFontFromMemory(fileType(name), data, 32, nil)
+}
+
+// an empty name uses raylib's default shader for that stage, as does one
+// that cannot be read
+func (files resourceFiles) shader(vertexName, fragmentName string) rl.Shader {
+	var code [2]string
+	for i, name := range []string{vertexName, fragmentName} {
+		if name == "" {
+			continue
+		}
+		data, err := files.read(name)
+		if err != nil {
+			slog.Error("Could not read shader", "path", name, "error", err)
+			continue
+		}
+		code[i] = string(data)
+	}
+	return rl.LoadShaderFromMemory(code[0], code[1])
+}
+
+// a texture a map names by its path, those under resources/ are the ones
+// that come with the game and are read like the rest of the resources, others
+// are read from disk
+func (files resourceFiles) mapTexture(texturePath string) rl.Texture2D {
+	if name, ok := strings.CutPrefix(filepath.ToSlash(texturePath), "resources/"); ok {
+		if data, err := files.read(name); err == nil && len(data) > 0 {
+			texture := textureFromMemory(name, data)
+			files.watchTexture(name, texture)
+			return texture
+		}
+	}
+	return rl.LoadTexture(texturePath)
+}
+
+// load a map from the maps directory, or the one built in with that name if
+// the directory does not have it
+func (files resourceFiles) loadMap(directory, name string) (*maps.Map, error) {
+	gameMap, err := maps.LoadNamed(directory, name)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return gameMap, err
+	}
+	data, readErr := files.read(path.Join("maps", name+".json"))
+	if readErr != nil {
+		return nil, err
+	}
+	return maps.Parse(data)
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// round results
+//////// whoever takes a round is announced with a banner across the screen
+//////// that pops in, holds with the new score and fades, and the score and
+//////// round are always shown small under the round timer
+
+const (
+	roundBannerTime     = 3 * time.Second
+	roundBannerPopTime  = 200 * time.Millisecond // growing to full size
+	roundBannerFadeTime = 500 * time.Millisecond // at the end of its time
+	roundBannerFontSize = 30
+	roundBannerHeight   = 44
+)
+
+var roundBannerBackground = rl.NewColor(230, 230, 230, 200)
+
+// written by the message receiver, read when drawing
+type roundBanner struct {
+	team  protocol.Team // that took the round
+	at    time.Time
+	mutex sync.Mutex
+}
+
+func (banner *roundBanner) set(team protocol.Team) {
+	banner.mutex.Lock()
+	defer banner.mutex.Unlock()
+
+	banner.team, banner.at = team, time.Now()
+}
+
+func (banner *roundBanner) get() (protocol.Team, time.Time) {
+	banner.mutex.Lock()
+	defer banner.mutex.Unlock()
+
+	return banner.team, banner.at
+}
+
+// what the banner says about a round, from our side unless we are only
+// watching
+func (playerWorld *playerWorld) roundResultText(team protocol.Team) string {
+	score := fmt.Sprintf("TEAM A %d : %d TEAM B", playerWorld.teamAPoints, playerWorld.teamBPoints)
+	switch {
+	case playerWorld.watching():
+		return fmt.Sprintf("TEAM %s TAKES THE ROUND - %s", scoreboardTeamNames[team], score)
+	case team == playerWorld.Team:
+		return "ROUND WON - " + score
+	}
+	return "ROUND LOST - " + score
+}
+
+func (playerWorld *playerWorld) drawRoundBanner() {
+	team, at := playerWorld.roundBanner.get()
+	since := time.Since(at)
+	if at.IsZero() || since >= roundBannerTime {
+		return
+	}
+
+	scale := min(1, 0.5+0.5*float32(since)/float32(roundBannerPopTime))
+	fade := min(1, float32(roundBannerTime-since)/float32(roundBannerFadeTime))
+	text := playerWorld.roundResultText(team)
+	size := roundBannerFontSize * scale
+	width := rl.MeasureTextEx(playerWorld.font, text, size, 0).X
+	height := roundBannerHeight * scale
+	top := float32(centerY) - lineSpace*4 - height/2
+	rl.DrawRectangleRec(rl.Rectangle{X: 0, Y: top, Width: internalWindowWidth, Height: height}, rl.Fade(roundBannerBackground, fade))
+	rl.DrawTextEx(playerWorld.font, text, rl.Vector2{X: centerX - width/2, Y: top + (height-size)/2}, size, 0, rl.Fade(characterColours[team], fade))
+}
+
+// the score and round, small, under the round timer
+func (playerWorld *playerWorld) drawScoreTicker() {
+	if playerWorld.round == 0 || playerWorld.warmup {
+		return
+	}
+	parts := []struct {
+		text   string
+		colour rl.Color
+	}{
+		{fmt.Sprintf("A %d", playerWorld.teamAPoints), characterColours[protocol.A]},
+		{" : ", rl.Black},
+		{fmt.Sprintf("%d B", playerWorld.teamBPoints), characterColours[protocol.B]},
+		{fmt.Sprintf("  ()::%d/%d", min(playerWorld.round, protocol.LastRound), protocol.LastRound), rl.Black},
+	}
+	width := float32(0)
+	for _, part := range parts {
+		width += rl.MeasureTextEx(playerWorld.font, part.text, scoreboardFontSize, 0).X
+	}
+	x := centerX - width/2
+	for _, part := range parts {
+		rl.DrawTextEx(playerWorld.font, part.text, rl.Vector2{X: x, Y: topMargin + lineSpace}, scoreboardFontSize, 0, part.colour)
+		x += rl.MeasureTextEx(playerWorld.font, part.text, scoreboardFontSize, 0).X
+	}
+}
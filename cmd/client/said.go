@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+//////// host messages
+//////// whatever the host says to the lobby, from the server console or the
+//////// admin API, is shown at the top of the screen for a while
+
+const saidDuration = 6 * time.Second
+
+// written by the message receiver, read when drawing
+type said struct {
+	text  string
+	at    time.Time
+	mutex sync.Mutex
+}
+
+func (said *said) set(text string) {
+	said.mutex.Lock()
+	defer said.mutex.Unlock()
+	said.text, said.at = text, time.Now()
+}
+
+func (playerWorld *playerWorld) drawSaid() {
+	playerWorld.said.mutex.Lock()
+	text, at := playerWorld.said.text, playerWorld.said.at
+	playerWorld.said.mutex.Unlock()
+	if text == "" || time.Since(at) > saidDuration {
+		return
+	}
+
+	line := "HOST: " + text
+	playerWorld.drawScaled(rl.Vector2{X: centerX, Y: 0}, func() {
+		width := rl.MeasureTextEx(playerWorld.font, line, fontSize, 0).X
+		rl.DrawTextEx(playerWorld.font, line, rl.Vector2{X: centerX - width/2, Y: topMargin + lineSpace*5}, fontSize, 0, rl.Maroon)
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// scoreboard
+//////// held open with Tab, each team in its own column with its best players
+//////// at the top, players who are dead this round are greyed out
+
+const (
+	scoreboardFontSize   = 12
+	scoreboardLineSpace  = 11
+	scoreboardKillPoints = 2 // an assist is worth one point
+	scoreboardNameLength = 12
+	summaryNameLength    = 8 // leaving room for accuracy and damage
+)
+
+var (
+	scoreboardBackground = rl.NewColor(230, 230, 230, 200)
+	scoreboardTeamNames  = [2]string{protocol.A: "A", protocol.B: "B"}
+)
+
+type scoreboardRow struct {
+	id, kills, deaths, assists, ping int
+	name                             string
+	alive                            bool
+}
+
+func (row scoreboardRow) score() int {
+	return row.kills*scoreboardKillPoints + row.assists
+}
+
+// the players of a team, best first
+func (playerWorld *playerWorld) scoreboardRows(team protocol.Team) []scoreboardRow {
+	var rows []scoreboardRow
+	for i := range playerWorld.otherPlayers {
+		otherPlayer := &playerWorld.otherPlayers[i]
+		if playerWorld.teamOf(i) != team {
+			continue
+		}
+		row := scoreboardRow{
+			id:      i,
+			kills:   otherPlayer.killAmount,
+			deaths:  otherPlayer.deathAmount,
+			assists: otherPlayer.assistAmount,
+			ping:    otherPlayer.ping,
+			name:    playerWorld.playerName(i),
+			alive:   otherPlayer.otherPlayerState == alive,
+		}
+		if i == playerWorld.id && !playerWorld.playback {
+			row.kills, row.deaths, row.assists = playerWorld.killAmount, playerWorld.deathAmount, playerWorld.assistAmount
+			row.ping = int(playerWorld.currentPing().Milliseconds())
+			row.alive = playerWorld.playerState != limbo || playerWorld.buyPhase
+		} else if otherPlayer.otherPlayerState == nonExistent {
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		switch {
+		case a.score() != b.score():
+			return a.score() > b.score()
+		case a.deaths != b.deaths:
+			return a.deaths < b.deaths
+		}
+		return a.id < b.id
+	})
+	return rows
+}
+
+func (playerWorld *playerWorld) drawScoreboard() {
+	// round
+	rl.DrawTextEx(playerWorld.font, fmt.Sprintf("()::%02d", playerWorld.round), rl.Vector2{X: leftMargin, Y: topMargin + (lineSpace * 2)}, fontSize, 0, rl.Black)
+	playerWorld.drawScoreboardTeams(topMargin+(lineSpace*3), false)
+}
+
+// both teams side by side from the top down, with the dead greyed out and
+// everyone's ping during the match, or their accuracy and damage once it is
+// over
+func (playerWorld *playerWorld) drawScoreboardTeams(top float32, matchOver bool) {
+	statistics := make([]protocol.PlayerStatistics, playerWorld.slots())
+	for _, player := range playerWorld.statistics {
+		statistics[player.Id] = player
+	}
+
+	columnWidth := float32(internalWindowWidth-3*leftMargin) / 2
+	height := float32(scoreboardLineSpace*(playerWorld.teamSize+1)) + 2*leftMargin
+	rl.DrawRectangleV(rl.Vector2{X: leftMargin, Y: top}, rl.Vector2{X: internalWindowWidth - 2*leftMargin, Y: height}, scoreboardBackground)
+
+	points := [2]int{protocol.A: playerWorld.teamAPoints, protocol.B: playerWorld.teamBPoints}
+	for _, team := range [2]protocol.Team{protocol.A, protocol.B} {
+		x := leftMargin*2 + float32(team)*(columnWidth+leftMargin)
+		y := top + leftMargin
+
+		title := fmt.Sprintf("~%s::%02d", scoreboardTeamNames[team], points[team])
+		header := fmt.Sprintf(" %-*s %2s %2s %2s %4s", scoreboardNameLength, title, "K", "D", "A", "MS")
+		if matchOver {
+			header = fmt.Sprintf(" %-*s %2s %2s %2s %4s %3s", summaryNameLength, title, "K", "D", "A", "ACC", "DMG")
+		}
+		rl.DrawTextEx(playerWorld.font, header, rl.Vector2{X: x, Y: y}, scoreboardFontSize, 0, characterColours[team])
+
+		for _, row := range playerWorld.scoreboardRows(team) {
+			y += scoreboardLineSpace
+			marker := " "
+			if row.id == playerWorld.id && !playerWorld.playback {
+				marker = ">"
+			}
+			colour := rl.Black
+			if !matchOver && !row.alive {
+				colour = rl.Gray
+			}
+			line := fmt.Sprintf("%s%-*.*s %2d %2d %2d %4d", marker, scoreboardNameLength, scoreboardNameLength, row.name, row.kills, row.deaths, row.assists, row.ping)
+			if matchOver {
+				line = fmt.Sprintf("%s%-*.*s %2d %2d %2d %3d%% %3d", marker, summaryNameLength, summaryNameLength, row.name, row.kills, row.deaths, row.assists, statistics[row.id].Accuracy(), statistics[row.id].Damage)
+			}
+			rl.DrawTextEx(playerWorld.font, line, rl.Vector2{X: x, Y: y}, scoreboardFontSize, 0, colour)
+		}
+	}
+}
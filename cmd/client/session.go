@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// session
+//////// remembers the session token of the match we are in, so that the
+//////// client can take back its slot if it drops out and is started again
+
+func sessionPath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "shooter", "session"), nil
+}
+
+// store the session as three lines: server url, player id, token
+func saveSession(url string, id int, token []byte) {
+	path, err := sessionPath()
+	if err != nil {
+		slog.Warn("Could not save session", "error", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		slog.Warn("Could not save session", "error", err)
+		return
+	}
+	contents := url + "\n" + strconv.Itoa(id) + "\n" + hex.EncodeToString(token) + "\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		slog.Warn("Could not save session", "error", err)
+	}
+}
+
+// the player slot and token of the stored session, if it belongs to this
+// server and the requested slot; any slot matches protocol.AnyId
+func loadSession(url string, id int) (int, []byte) {
+	path, err := sessionPath()
+	if err != nil {
+		return 0, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, nil
+	}
+	defer file.Close()
+
+	lines := make([]string, 0, 3)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 3 || lines[0] != url {
+		return 0, nil
+	}
+
+	sessionId, err := strconv.Atoi(lines[1])
+	if err != nil || (id != protocol.AnyId && id != sessionId) {
+		return 0, nil
+	}
+
+	token, err := hex.DecodeString(lines[2])
+	if err != nil {
+		return 0, nil
+	}
+	return sessionId, token
+}
+
+func clearSession() {
+	path, err := sessionPath()
+	if err != nil {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Could not clear session", "error", err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+//////// settings
+//////// how looking around, sound, the window and the HUD feel, from the config and
+//////// command line and changed from the settings menu, in game or on the main
+//////// menu, where up and down pick a setting and left and right change it,
+//////// every change is saved
+
+const (
+	defaultLookSensitivity   = 0.005
+	defaultScopedSensitivity = 0.2 // of the look sensitivity
+
+	settingsSliderX     = 155 // to the right of the text
+	settingsSliderWidth = 60
+	settingsLength      = 10 // settings shown at once
+)
+
+var settingsMenuKey int32 = rl.KeyO
+
+// a setting changed in steps between two values
+type slider struct {
+	name, format   string
+	min, max, step float32
+	value          func(*config) *float32
+}
+
+var sliders = [...]slider{
+	{"Sensitivity", "LOOK   %.4f", 0.0005, 0.02, 0.0005, func(config *config) *float32 { return &config.Sensitivity }},
+	{"Scoped sensitivity", "SCOPED x%.2f", 0.05, 1, 0.05, func(config *config) *float32 { return &config.ScopedSensitivity }},
+	{"FOV", "FOV    %.0f", 60, 110, 5, func(config *config) *float32 { return &config.Fov }},
+	{"Master volume", "MASTER %.1f", 0, 1, 0.1, func(config *config) *float32 { return &config.Volume }},
+	{"SFX volume", "SFX    %.1f", 0, 1, 0.1, func(config *config) *float32 { return &config.SfxVolume }},
+	{"Music volume", "MUSIC  %.1f", 0, 1, 0.1, func(config *config) *float32 { return &config.MusicVolume }},
+	{"Voice volume", "VOICE  %.1f", 0, 1, 0.1, func(config *config) *float32 { return &config.VoiceVolume }},
+	{"UI scale", "UI     x%.2f", 0.5, 2, 0.25, func(config *config) *float32 { return &config.UiScale }},
+}
+
+// a setting picked from a few, left and right go through them
+type choice struct {
+	format string
+	text   func(*config) string
+	change func(config *config, direction int)
+	apply  func(config) // makes the change take effect, if it does not by itself
+}
+
+var choices = [...]choice{
+	{"INVERT Y::%s", func(config *config) string { return onOff(config.InvertY) }, func(config *config, _ int) { config.InvertY = !config.InvertY }, nil},
+	{"DISPLAY::%s", func(config *config) string { return strings.ToUpper(config.Display) }, func(config *config, direction int) {
+		config.Display = displayModes[(slices.Index(displayModes, config.Display)+len(displayModes)+direction)%len(displayModes)]
+	}, applyDisplay},
+	{"MONITOR::%s", func(config *config) string { return strconv.Itoa(config.Monitor + 1) }, func(config *config, direction int) {
+		count := max(rl.GetMonitorCount(), 1)
+		config.Monitor = (config.Monitor + count + direction) % count
+	}, applyDisplay},
+	{"WHOLE PIXELS::%s", func(config *config) string { return onOff(config.IntegerScaling) }, func(config *config, _ int) { config.IntegerScaling = !config.IntegerScaling }, nil},
+	{"FPS::%s", func(config *config) string {
+		if config.FpsCap == 0 {
+			return "UNCAPPED"
+		}
+		return strconv.Itoa(int(config.FpsCap))
+	}, func(config *config, direction int) {
+		config.FpsCap = fpsCaps[(slices.Index(fpsCaps, config.FpsCap)+len(fpsCaps)+direction)%len(fpsCaps)]
+	}, applyFrameRate},
+	{"VSYNC::%s", func(config *config) string { return onOff(config.Vsync) }, func(config *config, _ int) { config.Vsync = !config.Vsync }, applyFrameRate},
+	{"EFFECTS::%s", func(config *config) string { return onOff(config.PostProcessing) }, func(config *config, _ int) { config.PostProcessing = !config.PostProcessing }, nil},
+	{"LIGHTING::%s", func(config *config) string { return onOff(config.Lighting) }, func(config *config, _ int) { config.Lighting = !config.Lighting }, nil},
+	{"IMPACTS::%s", func(config *config) string {
+		if config.Impacts == 0 {
+			return "OFF"
+		}
+		return strconv.Itoa(config.Impacts)
+	}, func(config *config, direction int) {
+		config.Impacts = impactPools[(slices.Index(impactPools, config.Impacts)+len(impactPools)+direction)%len(impactPools)]
+	}, nil},
+	{"SOUND ICONS::%s", func(config *config) string { return onOff(config.SoundIndicators) }, func(config *config, _ int) { config.SoundIndicators = !config.SoundIndicators }, nil},
+}
+
+// the sliders, then the choices
+const settingCount = len(sliders) + len(choices)
+
+func onOff(on bool) string {
+	if on {
+		return "ON"
+	}
+	return "OFF"
+}
+
+type settings struct {
+	config
+	menuOpen bool
+	selected int
+}
+
+func newSettings(config config) (*settings, error) {
+	for _, slider := range sliders {
+		if value := *slider.value(&config); value < slider.min || slider.max < value {
+			return nil, fmt.Errorf("%s must be between %g and %g", slider.name, slider.min, slider.max)
+		}
+	}
+	if !slices.Contains(displayModes, config.Display) {
+		return nil, fmt.Errorf("Display must be one of %s", strings.Join(displayModes, ", "))
+	}
+	if !slices.Contains(fpsCaps, config.FpsCap) {
+		return nil, fmt.Errorf("FPS cap must be 30, 60, 120 or 0 for no cap")
+	}
+	if !slices.Contains(impactPools, config.Impacts) {
+		return nil, fmt.Errorf("Impacts must be 0, 32, 128 or 512")
+	}
+	if config.Monitor < 0 {
+		return nil, fmt.Errorf("Monitor must not be negative")
+	}
+	return &settings{config: config}, nil
+}
+
+// how far the camera turns for each pixel the mouse moves, sideways and up
+func (settings *settings) sensitivity(scoped bool) (float32, float32) {
+	sensitivity := settings.Sensitivity
+	if scoped {
+		sensitivity *= settings.ScopedSensitivity
+	}
+	if settings.InvertY {
+		return sensitivity, -sensitivity
+	}
+	return sensitivity, sensitivity
+}
+
+// set how loud a sound effect plays, scaled by the effects volume, before
+// playing it
+func (settings *settings) setEffectVolume(sound rl.Sound, volume float32) {
+	rl.SetSoundVolume(sound, volume*settings.SfxVolume)
+}
+
+// open or close the settings menu, and change whichever setting is picked
+func (settings *settings) update() {
+	if rl.IsKeyPressed(settingsMenuKey) {
+		settings.menuOpen = !settings.menuOpen
+	}
+	if !settings.menuOpen {
+		return
+	}
+
+	switch {
+	case rl.IsKeyPressed(rl.KeyUp):
+		settings.selected = (settings.selected + settingCount - 1) % settingCount
+	case rl.IsKeyPressed(rl.KeyDown):
+		settings.selected = (settings.selected + 1) % settingCount
+	}
+
+	var change int
+	switch {
+	case rl.IsKeyPressed(rl.KeyLeft):
+		change = -1
+	case rl.IsKeyPressed(rl.KeyRight):
+		change = 1
+	default:
+		return
+	}
+	if settings.selected < len(sliders) {
+		slider := sliders[settings.selected]
+		value := slider.value(&settings.config)
+		*value = min(max(*value+float32(change)*slider.step, slider.min), slider.max)
+	} else {
+		choice := choices[settings.selected-len(sliders)]
+		choice.change(&settings.config, change)
+		if choice.apply != nil {
+			choice.apply(settings.config)
+		}
+	}
+	rl.SetMasterVolume(settings.Volume)
+	saveConfig(settings.config)
+}
+
+func (settings *settings) draw(font rl.Font) {
+	if !settings.menuOpen {
+		return
+	}
+
+	// scroll so the selected setting is always shown
+	first := max(0, settings.selected-settingsLength+1)
+	for i := first; i < min(settingCount, first+settingsLength); i++ {
+		y := float32(topMargin + lineSpace*(4+i-first))
+		marker := " "
+		if i == settings.selected {
+			marker = ">"
+		}
+
+		if i >= len(sliders) {
+			choice := choices[i-len(sliders)]
+			rl.DrawTextEx(font, marker+fmt.Sprintf(choice.format, choice.text(&settings.config)), rl.Vector2{X: leftMargin, Y: y}, fontSize, 0, rl.Black)
+			continue
+		}
+
+		slider := sliders[i]
+		value := *slider.value(&settings.config)
+		rl.DrawTextEx(font, marker+fmt.Sprintf(slider.format, value), rl.Vector2{X: leftMargin, Y: y}, fontSize, 0, rl.Black)
+		bar := rl.Rectangle{X: settingsSliderX, Y: y + lineSpace/3, Width: settingsSliderWidth, Height: lineSpace / 3}
+		rl.DrawRectangleRec(rl.Rectangle{X: bar.X, Y: bar.Y, Width: bar.Width * (value - slider.min) / (slider.max - slider.min), Height: bar.Height}, rl.Black)
+		rl.DrawRectangleLinesEx(bar, 1, rl.Black)
+	}
+}
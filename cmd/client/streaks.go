@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// kill streaks
+//////// the server announces every kill of a streak from a double kill on, and
+//////// an ace, one player killing the whole other team by themselves in a
+//////// round; each is shown as a banner above the crosshair, gold when it is
+//////// ours, with its own announcer line
+
+const (
+	streakBannerTime = 2 * time.Second
+	streakFontSize   = 30
+)
+
+type streakKind int
+
+const (
+	doubleKill streakKind = iota
+	tripleKill
+	multiKill // four kills or more
+	aceKill
+	streakKinds
+)
+
+var streakSoundFiles = [streakKinds]string{
+	doubleKill: "sounds/streak_double.wav",
+	tripleKill: "sounds/streak_triple.wav",
+	multiKill:  "sounds/streak_multi.wav",
+	aceKill:    "sounds/streak_ace.wav",
+}
+
+func newStreakKind(kills int, ace bool) streakKind {
+	switch {
+	case ace:
+		return aceKill
+	case kills <= 2:
+		return doubleKill
+	case kills == 3:
+		return tripleKill
+	}
+	return multiKill
+}
+
+func (kind streakKind) text(kills int) string {
+	switch kind {
+	case doubleKill:
+		return "DOUBLE KILL"
+	case tripleKill:
+		return "TRIPLE KILL"
+	case aceKill:
+		return "ACE"
+	}
+	return fmt.Sprintf("%d KILL STREAK", kills)
+}
+
+// written by the message receiver, read when drawing
+type streakBanner struct {
+	text  string
+	own   bool
+	at    time.Time
+	mutex sync.Mutex
+}
+
+func (playerWorld *playerWorld) announceStreak(event protocol.StreakEvent) {
+	kind := newStreakKind(event.Kills, event.Ace)
+	text := kind.text(event.Kills)
+	own := event.PlayerId == playerWorld.id && !playerWorld.watching()
+	if !own {
+		text = playerWorld.playerName(event.PlayerId) + ": " + text
+	}
+
+	banner := &playerWorld.streakBanner
+	banner.mutex.Lock()
+	banner.text, banner.own, banner.at = text, own, time.Now()
+	banner.mutex.Unlock()
+
+	sound := playerWorld.streakSounds[kind]
+	playerWorld.settings.setEffectVolume(sound, 1)
+	rl.PlaySound(sound)
+}
+
+// the latest streak, fading out over its time
+func (playerWorld *playerWorld) drawStreak() {
+	banner := &playerWorld.streakBanner
+	banner.mutex.Lock()
+	text, own, at := banner.text, banner.own, banner.at
+	banner.mutex.Unlock()
+	since := time.Since(at)
+	if text == "" || since >= streakBannerTime {
+		return
+	}
+
+	colour := rl.Black
+	if own {
+		colour = headshotColour
+	}
+	playerWorld.drawScaled(rl.Vector2{X: centerX, Y: centerY}, func() {
+		width := rl.MeasureTextEx(playerWorld.font, text, streakFontSize, 0).X
+		rl.DrawTextEx(playerWorld.font, text, rl.Vector2{X: centerX - width/2, Y: centerY - lineSpace*5}, streakFontSize, 0, rl.Fade(colour, 1-float32(since)/float32(streakBannerTime)))
+	})
+}
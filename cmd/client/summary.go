@@ -0,0 +1,125 @@
+package main
+
+import (
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// summary
+//////// once the match is over the winner and everyone's score are shown
+//////// until the player quits, or asks for a rematch, which joins the same
+//////// server and lobby again; left and right or the mouse pick a button
+
+const (
+	summaryButtonWidth  = 80
+	summaryButtonHeight = 20
+	summaryButtonsY     = 150
+)
+
+type summaryButton int
+
+const (
+	rematchButton summaryButton = iota
+	quitButton
+	summaryButtons // how many buttons there are
+)
+
+var summaryButtonNames = [summaryButtons]string{rematchButton: "REMATCH", quitButton: "QUIT"}
+
+// who won, as seen by us
+func (playerWorld *playerWorld) resultText() string {
+	switch {
+	case playerWorld.teamAPoints == playerWorld.teamBPoints:
+		return "DRAW"
+	case playerWorld.observing() && playerWorld.teamAPoints > playerWorld.teamBPoints:
+		return "TEAM A WON"
+	case playerWorld.observing():
+		return "TEAM B WON"
+	case playerWorld.Team == protocol.A && playerWorld.teamAPoints > playerWorld.teamBPoints:
+		return "CONGRATULATIONS::TEAM A WON"
+	case playerWorld.Team == protocol.A:
+		return "DEFEAT::TEAM B WON"
+	case playerWorld.teamBPoints > playerWorld.teamAPoints:
+		return "CONGRATULATIONS::TEAM B WON"
+	}
+	return "DEFEAT::TEAM A WON"
+}
+
+// the button in the middle of the screen, the rematch button is left out if
+// there cannot be one
+func summaryButtonRectangle(button summaryButton, canRematch bool) rl.Rectangle {
+	x := float32(centerX - summaryButtonWidth/2)
+	if canRematch {
+		// side by side with a gap between them
+		x = centerX + float32(button)*(summaryButtonWidth+leftMargin) - summaryButtonWidth - leftMargin/2
+	}
+	return rl.Rectangle{X: x, Y: summaryButtonsY, Width: summaryButtonWidth, Height: summaryButtonHeight}
+}
+
+// show the result of the match, true if a rematch was picked
+func (playerWorld *playerWorld) runSummary(resources *resources, canRematch bool) bool {
+	rl.EnableCursor()
+	resources.playMusic(&resources.lobbyMusic)
+	selected := quitButton
+	if canRematch {
+		selected = rematchButton
+	}
+
+	for !rl.WindowShouldClose() {
+		if canRematch && (rl.IsKeyPressed(rl.KeyLeft) || rl.IsKeyPressed(rl.KeyRight)) {
+			selected = summaryButtons - 1 - selected
+		}
+		if rl.IsKeyPressed(rl.KeyEnter) {
+			return selected == rematchButton
+		}
+		mouse := internalMousePosition(playerWorld.settings.IntegerScaling)
+		for button := range summaryButtons {
+			if (canRematch || button == quitButton) && rl.CheckCollisionPointRec(mouse, summaryButtonRectangle(button, canRematch)) {
+				selected = button
+				if rl.IsMouseButtonPressed(rl.MouseButtonLeft) {
+					return button == rematchButton
+				}
+			}
+		}
+
+		drawFrame(resources, playerWorld.settings, func() {
+			playerWorld.drawSummary(selected, canRematch)
+		})
+	}
+	return false
+}
+
+func (playerWorld *playerWorld) drawSummary(selected summaryButton, canRematch bool) {
+	rl.ClearBackground(rl.RayWhite)
+
+	// the winner's colour, or black for a draw
+	colour := rl.Black
+	switch {
+	case playerWorld.teamAPoints > playerWorld.teamBPoints:
+		colour = characterColours[protocol.A]
+	case playerWorld.teamBPoints > playerWorld.teamAPoints:
+		colour = characterColours[protocol.B]
+	}
+	banner := playerWorld.resultText()
+	width := rl.MeasureTextEx(playerWorld.font, banner, fontSize, 0).X
+	rl.DrawTextEx(playerWorld.font, banner, rl.Vector2{X: centerX - width/2, Y: topMargin + lineSpace}, fontSize, 0, colour)
+	playerWorld.drawScoreboardTeams(topMargin+(lineSpace*4), true)
+
+	for button := range summaryButtons {
+		if button == rematchButton && !canRematch {
+			continue
+		}
+		rectangle := summaryButtonRectangle(button, canRematch)
+		if button == selected {
+			rl.DrawRectangleRec(rectangle, rl.Black)
+		}
+		rl.DrawRectangleLinesEx(rectangle, 1, rl.Black)
+		textColour := rl.Black
+		if button == selected {
+			textColour = rl.RayWhite
+		}
+		name := summaryButtonNames[button]
+		textWidth := rl.MeasureTextEx(playerWorld.font, name, fontSize, 0).X
+		rl.DrawTextEx(playerWorld.font, name, rl.Vector2{X: rectangle.X + (rectangle.Width-textWidth)/2, Y: rectangle.Y}, fontSize, 0, textColour)
+	}
+}
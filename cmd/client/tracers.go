@@ -0,0 +1,178 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+//////// tracers and muzzle flashes
+//////// every shot leaves a line along its path for a moment, ours from the gun
+//////// along each pellet's ray, and everyone else's from where the shot message
+//////// says they were along the way they were looking, each stopping at the
+//////// first block, closed door or player in the way, where it makes an
+//////// impact if it is not a player, see impacts.go, and blood if it is; our
+//////// gun flashes at its muzzle and throws out a shell casing as it fires
+
+const (
+	tracerTime      = 100 * time.Millisecond
+	tracerRange     = 60 // shots that hit nothing are drawn this far
+	maxTracers      = 64
+	muzzleFlashTime = 60 * time.Millisecond
+	muzzleFlashSize = 0.35 // of the gun rectangle's width
+)
+
+var (
+	tracerColour = rl.NewColor(255, 230, 150, 255)
+
+	bloodEmitter = emitter{
+		burst:    6,
+		lifetime: 400 * time.Millisecond,
+		speed:    2,
+		spread:   0.6,
+		gravity:  -9,
+		size:     0.04,
+		endSize:  0.02,
+		colour:   rl.NewColor(150, 0, 0, 255),
+	}
+	casingEmitter = emitter{
+		burst:    1,
+		lifetime: 600 * time.Millisecond,
+		speed:    2,
+		spread:   0.2,
+		gravity:  -9,
+		size:     0.03,
+		endSize:  0.03,
+		colour:   rl.NewColor(200, 160, 60, 255),
+	}
+)
+
+// where our tracers start, from the camera, under and to the right of where
+// we look, as the gun is drawn
+var tracerOffset = rl.Vector3{X: 0.15, Y: -0.12, Z: 0.3} // right, up and forward
+
+type tracer struct {
+	from, to rl.Vector3
+	at       time.Time
+}
+
+type tracers struct {
+	list  []tracer
+	mutex sync.Mutex
+}
+
+func (tracers *tracers) add(from, to rl.Vector3) {
+	tracers.mutex.Lock()
+	defer tracers.mutex.Unlock()
+
+	if len(tracers.list) == maxTracers {
+		tracers.list = tracers.list[1:]
+	}
+	tracers.list = append(tracers.list, tracer{from: from, to: to, at: time.Now()})
+}
+
+// fading out over their time, in 3D mode
+func (tracers *tracers) draw() {
+	tracers.mutex.Lock()
+	defer tracers.mutex.Unlock()
+
+	now := time.Now()
+	live := tracers.list[:0]
+	for _, tracer := range tracers.list {
+		age := now.Sub(tracer.at)
+		if age >= tracerTime {
+			continue
+		}
+		live = append(live, tracer)
+		rl.DrawLine3D(tracer.from, tracer.to, rl.Fade(tracerColour, 1-float32(age)/float32(tracerTime)))
+	}
+	tracers.list = live
+}
+
+// where the world stops a shot along a ray, tracerRange along it if nothing
+// does, and whether a hole can be left there, which it cannot on a ramp's
+// slope or a door that may open
+func (playerWorld *playerWorld) shotImpact(ray rl.Ray) (impact rl.RayCollision, hole bool) {
+	impact.Distance = tracerRange
+	for _, block := range playerWorld.blocks {
+		if collision := rl.GetRayCollisionBox(ray, block.boundingBox); collision.Hit && collision.Distance < impact.Distance {
+			impact, hole = collision, block.tiltAngle == 0
+		}
+	}
+	for _, block := range playerWorld.closedDoors() {
+		if collision := rl.GetRayCollisionBox(ray, block.boundingBox); collision.Hit && collision.Distance < impact.Distance {
+			impact, hole = collision, false
+		}
+	}
+	return impact, hole
+}
+
+// the tracer of a shot, blood from anyone it hit before the world stopped
+// it, and its impact if the world stopped it before anyone
+func (playerWorld *playerWorld) addShot(from rl.Vector3, ray rl.Ray, hits []playerHit) {
+	impact, hole := playerWorld.shotImpact(ray)
+	distance := impact.Distance
+	for _, hit := range hits {
+		hitDistance := rl.Vector3Distance(ray.Position, hit.point)
+		if hitDistance < impact.Distance {
+			playerWorld.particles.burst(&bloodEmitter, hit.point, ray.Direction)
+		}
+		distance = min(distance, hitDistance)
+	}
+	if impact.Hit && distance == impact.Distance {
+		playerWorld.impact(impact.Point, impact.Normal, hole)
+	}
+	playerWorld.tracers.add(from, rl.Vector3Add(ray.Position, rl.Vector3Scale(ray.Direction, distance)))
+}
+
+// a tracer for one of our pellets, stopping at the nearest player it hit if
+// that is closer than the world
+func (playerWorld *playerWorld) addOwnTracer(ray rl.Ray, hits []playerHit) {
+	playerWorld.addShot(playerWorld.gunPosition(), ray, hits)
+}
+
+// where the gun is drawn, in the world
+func (playerWorld *playerWorld) gunPosition() rl.Vector3 {
+	right := rl.GetCameraRight(&playerWorld.camera)
+	up := rl.GetCameraUp(&playerWorld.camera)
+	forward := rl.GetCameraForward(&playerWorld.camera)
+	return rl.Vector3Add(playerWorld.camera.Position, rl.Vector3Add(rl.Vector3Add(
+		rl.Vector3Scale(right, tracerOffset.X),
+		rl.Vector3Scale(up, tracerOffset.Y)),
+		rl.Vector3Scale(forward, tracerOffset.Z),
+	))
+}
+
+// a spent casing flicked out of the gun, up and to the right
+func (playerWorld *playerWorld) ejectCasing() {
+	direction := rl.Vector3Add(rl.GetCameraRight(&playerWorld.camera), rl.GetCameraUp(&playerWorld.camera))
+	playerWorld.particles.burst(&casingEmitter, playerWorld.gunPosition(), direction)
+}
+
+// a tracer for someone else's shot, from their eyes where the server says
+// they fired, the way they were last seen looking
+func (playerWorld *playerWorld) addOtherPlayerTracer(id int, eyes rl.Vector3) {
+	otherPlayer := &playerWorld.otherPlayers[id]
+	yaw, pitch := float64(otherPlayer.yaw), float64(otherPlayer.pitch)
+	look := rl.Vector3{
+		X: float32(math.Cos(yaw) * math.Cos(pitch)),
+		Y: float32(math.Sin(pitch)),
+		Z: float32(math.Sin(yaw) * math.Cos(pitch)),
+	}
+	playerWorld.addShot(eyes, rl.Ray{Position: eyes, Direction: look}, nil)
+}
+
+// a glow at the end of the barrel just after we fire, over the gun
+func (playerWorld *playerWorld) drawMuzzleFlash(gun *gun, gunRectangle rl.Rectangle) {
+	if time.Since(playerWorld.firedAt) >= muzzleFlashTime {
+		return
+	}
+	size := gunRectangle.Width * muzzleFlashSize
+	muzzle := rl.Vector2{X: gunRectangle.X + gunRectangle.Width*gun.muzzle.X, Y: gunRectangle.Y + gunRectangle.Height*gun.muzzle.Y}
+	texture := playerWorld.muzzleFlashTexture
+	rl.BeginBlendMode(rl.BlendAdditive)
+	rl.DrawTexturePro(texture, rl.Rectangle{Width: float32(texture.Width), Height: float32(texture.Height)}, rl.Rectangle{X: muzzle.X - size/2, Y: muzzle.Y - size/2, Width: size, Height: size}, rl.Vector2Zero(), 0, rl.White)
+	rl.EndBlendMode()
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// voice chat
+//////// raylib cannot record, so our voice is read from a command that writes
+//////// 16 bit little endian mono samples at protocol.VoiceSampleRate to its
+//////// output, and sent while the talk key is held
+
+var talkKey int32 = rl.KeyV
+
+const (
+	// most of a speaker's voice held back waiting to be played, anything
+	// more is dropped so the delay does not build up
+	maxVoiceBacklog = protocol.VoiceFrameSamples * 10
+)
+
+type voice struct {
+	talking  atomic.Bool
+	streams  []rl.AudioStream // by slot
+	backlogs [][]float32      // samples received but not yet played
+	mutex    sync.Mutex
+}
+
+// audio streams can only be made once the audio device is up, one for each
+// player slot
+func newVoice(slots int) *voice {
+	voice := &voice{streams: make([]rl.AudioStream, slots), backlogs: make([][]float32, slots)}
+	rl.SetAudioStreamBufferSizeDefault(protocol.VoiceFrameSamples)
+	for i := range voice.streams {
+		voice.streams[i] = rl.LoadAudioStream(protocol.VoiceSampleRate, 32, 1)
+		rl.PlayAudioStream(voice.streams[i])
+	}
+	return voice
+}
+
+func (voice *voice) unload() {
+	for _, stream := range voice.streams {
+		rl.UnloadAudioStream(stream)
+	}
+}
+
+// queue up a frame from a teammate, called by the message receiver
+func (voice *voice) receive(speakerId int, samples []byte) {
+	voice.mutex.Lock()
+	defer voice.mutex.Unlock()
+
+	backlog := voice.backlogs[speakerId]
+	for _, sample := range samples {
+		backlog = append(backlog, float32(decodeMuLaw(sample))/32768)
+	}
+	if len(backlog) > maxVoiceBacklog {
+		backlog = backlog[len(backlog)-maxVoiceBacklog:]
+	}
+	voice.backlogs[speakerId] = backlog
+}
+
+// keep each speaker's stream fed, quieter the further away they are, must be
+// called from the main thread
+func (playerWorld *playerWorld) playVoices() {
+	voice := playerWorld.voice
+	voice.mutex.Lock()
+	defer voice.mutex.Unlock()
+
+	for i, stream := range voice.streams {
+		distance := rl.Vector3Distance(playerWorld.camera.Position, playerWorld.otherPlayers[i].position)
+		rl.SetAudioStreamVolume(stream, max(0, 1-distance/protocol.VoiceRange)*playerWorld.settings.VoiceVolume)
+
+		if !rl.IsAudioStreamProcessed(stream) {
+			continue
+		}
+		frame := make([]float32, protocol.VoiceFrameSamples)
+		played := copy(frame, voice.backlogs[i])
+		voice.backlogs[i] = voice.backlogs[i][played:]
+		rl.UpdateAudioStream(stream, frame)
+	}
+}
+
+// run the capture command until the context is cancelled, sending what it
+// records while we are talking
+func (playerWorld *playerWorld) captureVoice(context context.Context, command string) {
+	arguments := strings.Fields(command)
+	if len(arguments) == 0 {
+		return
+	}
+	capture := exec.CommandContext(context, arguments[0], arguments[1:]...)
+	output, err := capture.StdoutPipe()
+	if err != nil {
+		slog.Error("Could not capture voice", "error", err)
+		return
+	}
+	if err := capture.Start(); err != nil {
+		slog.Error("Could not capture voice", "error", err)
+		return
+	}
+	defer capture.Wait()
+
+	reader := bufio.NewReader(output)
+	frame := make([]byte, protocol.VoiceFrameSamples*2)
+	samples := make([]byte, protocol.VoiceFrameSamples)
+	for {
+		// keep reading while not talking, so what is sent is never stale
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			if context.Err() == nil {
+				slog.Error("Voice capture stopped", "error", err)
+			}
+			return
+		}
+		if !playerWorld.voice.talking.Load() {
+			continue
+		}
+
+		for i := range samples {
+			samples[i] = encodeMuLaw(int16(binary.LittleEndian.Uint16(frame[i*2:])))
+		}
+		playerWorld.connMutex.Lock()
+		if err := writeMessage(playerWorld.conn, protocol.EncodeVoiceMessage(samples)); err != nil {
+			slog.Warn("Could not send message", "header", protocol.VoiceMessage, "error", err)
+		}
+		playerWorld.connMutex.Unlock()
+	}
+}
+
+//////// G.711 mu-law
+
+const (
+	muLawBias = 0x84
+	muLawClip = 32635
+)
+
+func encodeMuLaw(sample int16) byte {
+	linear := int(sample)
+	sign := 0
+	if linear < 0 {
+		linear = -linear
+		sign = 0x80
+	}
+	linear = min(linear, muLawClip) + muLawBias
+
+	exponent := 7
+	for mask := 0x4000; linear&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (linear >> (exponent + 3)) & 0x0F
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+func decodeMuLaw(encoded byte) int16 {
+	encoded = ^encoded
+	exponent := int(encoded>>4) & 0x07
+	mantissa := int(encoded) & 0x0F
+	linear := ((mantissa << 3) + muLawBias) << exponent
+	if encoded&0x80 != 0 {
+		return int16(muLawBias - linear)
+	}
+	return int16(linear - muLawBias)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// votes
+//////// the vote menu calls a vote to kick a player, change to the next map or
+//////// restart the match, the server decides whether it passes; while one is
+//////// being held it is shown at the top of the screen, where F1 and F2 vote
+//////// for and against it, and how it went stays up for a moment after
+
+var voteMenuKey int32 = rl.KeyK
+
+const (
+	voteYesKey = rl.KeyF1
+	voteNoKey  = rl.KeyF2
+
+	voteResultTime = 3 * time.Second // a decided vote is shown for
+)
+
+// how many players the kick menu lists at once, picked by the number keys
+// from 1, lobbies with more have more pages
+const kickPageSize = 9
+
+// keys calling each kind of vote from the menu, in the order of kinds
+var voteKindKeys = [protocol.VoteKinds]int32{rl.KeyOne, rl.KeyTwo, rl.KeyThree}
+
+// written by the message receiver, read when drawing
+type votes struct {
+	state      protocol.VoteState
+	receivedAt time.Time // zero until there is a vote to show
+	voted      bool      // we have had our say in the vote being held
+	mutex      sync.Mutex
+
+	// only touched when updating
+	menuOpen bool
+	kicking  bool // picking who to kick from the menu
+	kickPage int  // of kickPageSize players, 0 turns the page
+}
+
+// how a vote stands, as the server has just told us
+func (votes *votes) update(state protocol.VoteState, id int) {
+	votes.mutex.Lock()
+	defer votes.mutex.Unlock()
+
+	// a new vote, the caller is already counted as being for it
+	if votes.receivedAt.IsZero() || votes.state.Result != protocol.VoteOpen {
+		votes.voted = state.CallerId == id
+	}
+	votes.state = state
+	votes.receivedAt = time.Now()
+}
+
+// whether we can vote in the vote being held
+func (votes *votes) canVote(id int) bool {
+	votes.mutex.Lock()
+	defer votes.mutex.Unlock()
+	return !votes.receivedAt.IsZero() && votes.state.Result == protocol.VoteOpen && !votes.voted &&
+		!(votes.state.Kind == protocol.KickVote && votes.state.TargetId == id)
+}
+
+func (votes *votes) markVoted() {
+	votes.mutex.Lock()
+	defer votes.mutex.Unlock()
+	votes.voted = true
+}
+
+// open and close the vote menu, call whatever vote is picked from it, and vote
+// in the vote being held
+func (playerWorld *playerWorld) updateVotes() {
+	votes := &playerWorld.votes
+	if rl.IsKeyPressed(voteMenuKey) {
+		votes.menuOpen = !votes.menuOpen
+		votes.kicking = false
+		votes.kickPage = 0
+		playerWorld.buyMenuOpen = false
+	}
+	// only one menu takes the number keys at a time
+	if playerWorld.buyMenuOpen {
+		votes.menuOpen = false
+	}
+
+	if votes.canVote(playerWorld.id) {
+		switch {
+		case rl.IsKeyPressed(voteYesKey):
+			playerWorld.sendVoteMessage(protocol.EncodeBallot(true))
+			votes.markVoted()
+		case rl.IsKeyPressed(voteNoKey):
+			playerWorld.sendVoteMessage(protocol.EncodeBallot(false))
+			votes.markVoted()
+		}
+	}
+
+	if !votes.menuOpen {
+		return
+	}
+	if votes.kicking {
+		candidates := playerWorld.kickCandidates()
+		if rl.IsKeyPressed(rl.KeyZero) {
+			votes.kickPage++
+		}
+		if votes.kickPage*kickPageSize >= len(candidates) {
+			votes.kickPage = 0
+		}
+		for i, id := range playerWorld.kickPage(candidates) {
+			if rl.IsKeyPressed(int32(rl.KeyOne + i)) {
+				playerWorld.sendVoteMessage(protocol.EncodeCallVote(protocol.KickVote, id))
+				votes.menuOpen = false
+			}
+		}
+		return
+	}
+	for kind, key := range voteKindKeys {
+		if !rl.IsKeyPressed(key) {
+			continue
+		}
+		if protocol.VoteKind(kind) == protocol.KickVote {
+			votes.kicking = true
+			continue
+		}
+		playerWorld.sendVoteMessage(protocol.EncodeCallVote(protocol.VoteKind(kind), 0))
+		votes.menuOpen = false
+	}
+}
+
+// everyone else in the lobby, who could be voted to be kicked
+func (playerWorld *playerWorld) kickCandidates() []int {
+	var candidates []int
+	for id := range playerWorld.slots() {
+		if id != playerWorld.id && playerWorld.hasPlayer(id) {
+			candidates = append(candidates, id)
+		}
+	}
+	return candidates
+}
+
+// the candidates on the kick menu's page
+func (playerWorld *playerWorld) kickPage(candidates []int) []int {
+	start := min(playerWorld.votes.kickPage*kickPageSize, len(candidates))
+	return candidates[start:min(start+kickPageSize, len(candidates))]
+}
+
+func (playerWorld *playerWorld) sendVoteMessage(message []byte) {
+	playerWorld.connMutex.Lock()
+	defer playerWorld.connMutex.Unlock()
+	if err := writeMessage(playerWorld.conn, message); err != nil {
+		slog.Warn("Could not send message", "header", protocol.ClientMessage(message[0]), "error", err)
+	}
+}
+
+// what a vote is asking
+func (playerWorld *playerWorld) voteQuestion(state protocol.VoteState) string {
+	switch state.Kind {
+	case protocol.KickVote:
+		return "KICK " + strings.ToUpper(playerWorld.playerName(state.TargetId))
+	case protocol.MapVote:
+		return "CHANGE MAP"
+	}
+	return "RESTART MATCH"
+}
+
+func (playerWorld *playerWorld) drawVoteMenu() {
+	votes := &playerWorld.votes
+	if !votes.menuOpen {
+		return
+	}
+	line := 0
+	drawLine := func(text string) {
+		rl.DrawTextEx(playerWorld.font, text, rl.Vector2{X: textXLocation, Y: textYLocation + float32(lineSpace*line)}, fontSize, 0, rl.Black)
+		line++
+	}
+	if !votes.kicking {
+		drawLine("1::VOTE KICK")
+		drawLine("2::VOTE MAP")
+		drawLine("3::VOTE RESTART")
+		return
+	}
+	candidates := playerWorld.kickCandidates()
+	for i, id := range playerWorld.kickPage(candidates) {
+		drawLine(fmt.Sprintf("%d::KICK %s", i+1, playerWorld.playerName(id)))
+	}
+	if len(candidates) > kickPageSize {
+		drawLine("0::MORE")
+	}
+}
+
+// the vote being held, or how the last one went for a moment after
+func (playerWorld *playerWorld) drawVote() {
+	votes := &playerWorld.votes
+	votes.mutex.Lock()
+	state, receivedAt := votes.state, votes.receivedAt
+	votes.mutex.Unlock()
+	if receivedAt.IsZero() {
+		return
+	}
+
+	var lines []string
+	question := playerWorld.voteQuestion(state)
+	switch state.Result {
+	case protocol.VoteOpen:
+		left := max(state.Left-time.Since(receivedAt), 0)
+		lines = append(lines, fmt.Sprintf("%s VOTES %s? %d/%d %ds", strings.ToUpper(playerWorld.playerName(state.CallerId)), question, state.Yes, state.Needed, int(left.Seconds()+0.999)))
+		if playerWorld.votes.canVote(playerWorld.id) {
+			lines = append(lines, "F1::YES F2::NO")
+		}
+	case protocol.VotePassed:
+		if time.Since(receivedAt) > voteResultTime {
+			return
+		}
+		lines = append(lines, fmt.Sprintf("VOTE PASSED: %s", question))
+	default:
+		if time.Since(receivedAt) > voteResultTime {
+			return
+		}
+		lines = append(lines, fmt.Sprintf("VOTE FAILED: %s", question))
+	}
+
+	playerWorld.drawScaled(rl.Vector2{X: centerX, Y: 0}, func() {
+		for i, line := range lines {
+			width := rl.MeasureTextEx(playerWorld.font, line, fontSize, 0).X
+			rl.DrawTextEx(playerWorld.font, line, rl.Vector2{X: centerX - width/2, Y: topMargin + float32(lineSpace*(i+2))}, fontSize, 0, rl.Black)
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/navigation"
+)
+
+//////// mapcheck
+//////// loads map files and reports what would go wrong playing on them, so a
+//////// map can be checked before it is hosted: errors for spawn points off the
+//////// map or inside blocks, spawns one team cannot reach the other from, and
+//////// texture images that are missing, and warnings for blocks that overlap,
+//////// floor nobody can reach from a spawn, and textures nothing uses; it
+//////// exits with 1 if any map has an error
+
+// what was found wrong with one map
+type report struct {
+	path             string
+	errors, warnings int
+}
+
+func (report *report) errorf(format string, arguments ...any) {
+	report.errors++
+	fmt.Printf("%s: error: %s\n", report.path, fmt.Sprintf(format, arguments...))
+}
+
+func (report *report) warnf(format string, arguments ...any) {
+	report.warnings++
+	fmt.Printf("%s: warning: %s\n", report.path, fmt.Sprintf(format, arguments...))
+}
+
+func main() {
+	root := flag.String("root", ".", "directory the texture paths in maps are relative to")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: mapcheck [options] [map file...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		report := &report{path: path}
+		checkMap(report, *root)
+		if report.errors == 0 && report.warnings == 0 {
+			fmt.Printf("%s: OK\n", path)
+		} else {
+			fmt.Printf("%s: %d errors, %d warnings\n", path, report.errors, report.warnings)
+		}
+		failed = failed || report.errors > 0
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func checkMap(report *report, root string) {
+	data, err := os.ReadFile(report.path)
+	if err != nil {
+		report.errorf("%v", err)
+		return
+	}
+	// a map the game would not load at all has nothing more worth checking
+	gameMap, err := maps.Parse(data)
+	if err != nil {
+		report.errorf("%v", err)
+		return
+	}
+
+	checkTextures(report, gameMap, root)
+	checkBlocks(report, gameMap)
+	grid := navigation.New(gameMap, navigation.PlayerHalfWidth, navigation.PlayerHeight)
+	checkSpawns(report, gameMap, grid)
+	checkTeleporters(report, gameMap, grid)
+	checkReachability(report, gameMap, grid)
+}
+
+// every texture's image is there, and every texture is used
+func checkTextures(report *report, gameMap *maps.Map, root string) {
+	used := make(map[string]bool)
+	for _, block := range gameMap.Blocks {
+		used[block.Texture] = true
+	}
+	for _, door := range gameMap.Doors {
+		used[door.Texture] = true
+	}
+	names := make([]string, 0, len(gameMap.Textures))
+	for name := range gameMap.Textures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.Join(root, gameMap.Textures[name])
+		if _, err := os.Stat(path); err != nil {
+			report.errorf("Texture %q has no image at %s", name, path)
+		}
+		if !used[name] {
+			report.warnf("Texture %q is not used by any block or door", name)
+		}
+	}
+}
+
+// blocks that share some of their space, which is drawn flickering
+func checkBlocks(report *report, gameMap *maps.Map) {
+	for i, block := range gameMap.Blocks {
+		for j := i + 1; j < len(gameMap.Blocks); j++ {
+			other := gameMap.Blocks[j]
+			overlaps := true
+			for axis := range block.Min {
+				if max(block.Min[axis], other.Min[axis]) >= min(block.Max[axis], other.Max[axis]) {
+					overlaps = false
+					break
+				}
+			}
+			if overlaps {
+				report.warnf("Blocks %s and %s overlap", blockName(gameMap, i), blockName(gameMap, j))
+			}
+		}
+	}
+}
+
+func blockName(gameMap *maps.Map, i int) string {
+	if name := gameMap.Blocks[i].Name; name != "" {
+		return fmt.Sprintf("%d (%s)", i, name)
+	}
+	return fmt.Sprint(i)
+}
+
+// every spawn is on the map, with room for a player to stand
+func checkSpawns(report *report, gameMap *maps.Map, grid *navigation.Grid) {
+	teams := []struct {
+		name   string
+		spawns []maps.Vector3
+	}{{"A", gameMap.Spawns.A}, {"B", gameMap.Spawns.B}}
+	for _, team := range teams {
+		for i, spawn := range team.spawns {
+			if !inRegions(gameMap, spawn) {
+				report.errorf("Team %s spawn %d at %v is outside every region", team.name, i, spawn)
+			}
+			if !grid.Fits(spawn) {
+				report.errorf("Team %s spawn %d at %v is inside a block", team.name, i, spawn)
+			}
+		}
+	}
+}
+
+// every teleporter leads somewhere on the map with room for a player to stand
+func checkTeleporters(report *report, gameMap *maps.Map, grid *navigation.Grid) {
+	for i, teleporter := range gameMap.Teleporters {
+		if !inRegions(gameMap, teleporter.To) {
+			report.errorf("Teleporter %d leads to %v, outside every region", i, teleporter.To)
+		}
+		if !grid.Fits(teleporter.To) {
+			report.errorf("Teleporter %d leads to %v, inside a block", i, teleporter.To)
+		}
+	}
+}
+
+func inRegions(gameMap *maps.Map, point maps.Vector3) bool {
+	for _, region := range gameMap.Regions {
+		if region.BottomLeft[0] <= point[0] && point[0] <= region.TopRight[0] &&
+			region.BottomLeft[1] <= point[2] && point[2] <= region.TopRight[1] &&
+			(region.Heights == nil || region.Heights[0] <= point[1] && point[1] <= region.Heights[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// the teams can get to each other, and there is no floor nobody can get to
+func checkReachability(report *report, gameMap *maps.Map, grid *navigation.Grid) {
+	for i, spawn := range gameMap.Spawns.B {
+		if !grid.Connected(gameMap.Spawns.A[0], spawn) {
+			report.errorf("Team B spawn %d at %v cannot be reached from team A's spawns", i, spawn)
+		}
+	}
+
+	spawns := append(append([]maps.Vector3{}, gameMap.Spawns.A...), gameMap.Spawns.B...)
+	for _, area := range grid.UnreachableAreas(spawns) {
+		report.warnf("Floor from %v to %v, %d cells of %g units, cannot be reached from any spawn",
+			area.Min, area.Max, area.Cells, navigation.CellSize)
+	}
+}
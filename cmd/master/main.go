@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lezhou8/shooter/internal/listing"
+	"github.com/lezhou8/shooter/internal/logging"
+)
+
+//////// master server
+//////// game servers announce themselves here every so often, and clients
+//////// fetch the list of those heard from lately to pick one to join
+
+const (
+	maxServers          = 1000 // so announcements cannot use up all the memory
+	maxAnnouncementSize = 1 << 12
+)
+
+type entry struct {
+	listing.Server
+	lastSeen time.Time
+}
+
+type master struct {
+	servers map[string]*entry // by address
+	mutex   sync.Mutex
+}
+
+func newMaster() *master {
+	return &master{servers: make(map[string]*entry)}
+}
+
+// forget the servers not heard from in a while, the master's mutex must be
+// held
+func (master *master) prune(now time.Time) {
+	for address, entry := range master.servers {
+		if now.Sub(entry.lastSeen) > listing.Expiry {
+			delete(master.servers, address)
+		}
+	}
+}
+
+// a game server telling us it is still there, the host it is joined at is
+// wherever the announcement came from
+func (master *master) serveAnnounce(w http.ResponseWriter, r *http.Request) {
+	var announcement listing.Announcement
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAnnouncementSize)).Decode(&announcement); err != nil {
+		http.Error(w, "Bad announcement", http.StatusBadRequest)
+		return
+	}
+	if err := announcement.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Unknown address", http.StatusBadRequest)
+		return
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(announcement.Port))
+
+	master.mutex.Lock()
+	defer master.mutex.Unlock()
+
+	now := time.Now()
+	master.prune(now)
+	_, known := master.servers[address]
+	if !known && len(master.servers) >= maxServers {
+		http.Error(w, "Too many servers", http.StatusServiceUnavailable)
+		return
+	}
+	if !known {
+		slog.Info("Server announced", "address", address, "name", announcement.Name)
+	}
+	master.servers[address] = &entry{
+		Server:   listing.Server{Announcement: announcement, Address: address},
+		lastSeen: now,
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// every server heard from lately, by name, only those in a region or playing
+// a mode if asked for
+func (master *master) serveList(w http.ResponseWriter, r *http.Request) {
+	region := r.URL.Query().Get("region")
+	mode := r.URL.Query().Get("mode")
+
+	master.mutex.Lock()
+	master.prune(time.Now())
+	servers := make([]listing.Server, 0, len(master.servers))
+	for _, entry := range master.servers {
+		if region != "" && !strings.EqualFold(entry.Region, region) {
+			continue
+		}
+		if mode != "" && !strings.EqualFold(entry.Mode, mode) {
+			continue
+		}
+		servers = append(servers, entry.Server)
+	}
+	master.mutex.Unlock()
+
+	sort.Slice(servers, func(i, j int) bool {
+		if servers[i].Name != servers[j].Name {
+			return servers[i].Name < servers[j].Name
+		}
+		return servers[i].Address < servers[j].Address
+	})
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(servers); err != nil {
+		slog.Warn("Could not write server list", "error", err)
+	}
+}
+
+//////// program entry
+
+func main() {
+	logFlags := logging.RegisterFlags()
+	flag.Usage = func() {
+		fmt.Printf("Usage: %s [options] [port]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		return
+	}
+
+	if err := logFlags.Setup(); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	port, err := strconv.Atoi(flag.Arg(0))
+	if err != nil {
+		fmt.Println("Port needs to be a number:", err)
+		return
+	}
+
+	master := newMaster()
+	http.HandleFunc("POST /servers", master.serveAnnounce)
+	http.HandleFunc("GET /servers", master.serveList)
+	slog.Info("Master server listening", "port", port)
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil); err != nil {
+		slog.Error("Master server stopped", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// admin
+//////// lets the host look at and manage running matches over HTTP, every
+//////// request needs the admin token as a bearer token
+
+type lobbyStatus struct {
+	Name        string         `json:"name"`
+	Map         string         `json:"map"`
+	Round       int            `json:"round"`
+	InPlay      bool           `json:"in_play"`
+	MatchOver   bool           `json:"match_over"`
+	TeamAPoints int            `json:"team_a_points"`
+	TeamBPoints int            `json:"team_b_points"`
+	Players     []playerStatus `json:"players"`
+}
+
+type playerStatus struct {
+	Id         int    `json:"id"`
+	Name       string `json:"name"`
+	Team       string `json:"team"`
+	Health     int    `json:"health"`
+	Kills      int    `json:"kills"`
+	Deaths     int    `json:"deaths"`
+	Assists    int    `json:"assists"`
+	IsAlive    bool   `json:"is_alive"`
+	Connected  bool   `json:"connected"` // false while the slot is held for a disconnected player
+	Ping       int    `json:"ping"`
+	Bot        bool   `json:"bot"`
+	Difficulty string `json:"difficulty,omitempty"` // only for bots
+}
+
+func (server *server) registerAdmin(mux *http.ServeMux, token string) {
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.HandleFunc(pattern, requireToken(token, handler))
+	}
+	handle("GET /admin/lobbies", server.adminLobbies)
+	handle("GET /admin/lobbies/{lobby}", server.adminLobby)
+	handle("GET /admin/lobbies/{lobby}/players", server.adminPlayers)
+	handle("POST /admin/lobbies/{lobby}/players/{id}/kick", server.adminKick)
+	handle("POST /admin/lobbies/{lobby}/next-round", server.adminNextRound)
+	handle("POST /admin/lobbies/{lobby}/end", server.adminEndMatch)
+	handle("POST /admin/lobbies/{lobby}/say", server.adminSay)
+}
+
+func requireToken(token string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			slog.Warn("Unauthorised admin request", "path", r.URL.Path, "address", r.RemoteAddr)
+			http.Error(w, "Unauthorised", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (server *server) adminLobbies(w http.ResponseWriter, r *http.Request) {
+	server.mutex.Lock()
+	lobbies := make([]*lobby, 0, len(server.lobbies))
+	for _, lobby := range server.lobbies {
+		lobbies = append(lobbies, lobby)
+	}
+	server.mutex.Unlock()
+
+	statuses := make([]lobbyStatus, 0, len(lobbies))
+	for _, lobby := range lobbies {
+		statuses = append(statuses, lobby.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	writeJSON(w, statuses)
+}
+
+func (server *server) adminLobby(w http.ResponseWriter, r *http.Request) {
+	if lobby := server.requestedLobby(w, r); lobby != nil {
+		writeJSON(w, lobby.status())
+	}
+}
+
+func (server *server) adminPlayers(w http.ResponseWriter, r *http.Request) {
+	if lobby := server.requestedLobby(w, r); lobby != nil {
+		writeJSON(w, lobby.status().Players)
+	}
+}
+
+func (server *server) adminKick(w http.ResponseWriter, r *http.Request) {
+	lobby := server.requestedLobby(w, r)
+	if lobby == nil {
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || !protocol.ValidId(id) {
+		http.Error(w, "Invalid player id", http.StatusBadRequest)
+		return
+	}
+	respond(w, lobby.kick(id))
+}
+
+func (server *server) adminNextRound(w http.ResponseWriter, r *http.Request) {
+	if lobby := server.requestedLobby(w, r); lobby != nil {
+		respond(w, lobby.forceNextRound())
+	}
+}
+
+func (server *server) adminEndMatch(w http.ResponseWriter, r *http.Request) {
+	if lobby := server.requestedLobby(w, r); lobby != nil {
+		respond(w, lobby.endMatch())
+	}
+}
+
+// the request body is what is said, as plain text
+func (server *server) adminSay(w http.ResponseWriter, r *http.Request) {
+	lobby := server.requestedLobby(w, r)
+	if lobby == nil {
+		return
+	}
+	text, err := io.ReadAll(io.LimitReader(r.Body, protocol.MaxSayLength+1))
+	if err != nil {
+		http.Error(w, "Could not read message", http.StatusBadRequest)
+		return
+	}
+	if err := lobby.say(strings.TrimSpace(string(text))); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// the lobby named in the request, nil if it does not exist
+func (server *server) requestedLobby(w http.ResponseWriter, r *http.Request) *lobby {
+	server.mutex.Lock()
+	lobby, ok := server.lobbies[r.PathValue("lobby")]
+	server.mutex.Unlock()
+
+	if !ok {
+		http.Error(w, "No such lobby", http.StatusNotFound)
+		return nil
+	}
+	return lobby
+}
+
+// actions either succeed with no content, or could not be done in the
+// lobby's current state
+func respond(w http.ResponseWriter, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Warn("Could not write JSON response", "error", err)
+	}
+}
+
+//////// lobby management
+
+func (lobby *lobby) status() lobbyStatus {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	status := lobbyStatus{
+		Name:        lobby.name,
+		Map:         lobby.currentMap(),
+		Round:       lobby.round,
+		InPlay:      lobby.inPlay,
+		MatchOver:   lobby.matchOver,
+		TeamAPoints: lobby.teamAPoints,
+		TeamBPoints: lobby.teamBPoints,
+		Players:     make([]playerStatus, 0, len(lobby.players)),
+	}
+	for _, player := range lobby.players {
+		if player.isEmpty() {
+			continue
+		}
+		team := "a"
+		if player.Team == protocol.B {
+			team = "b"
+		}
+		status.Players = append(status.Players, playerStatus{
+			Id:         player.id,
+			Name:       player.name,
+			Team:       team,
+			Health:     max(player.health, 0),
+			Kills:      player.killAmount,
+			Deaths:     player.deathAmount,
+			Assists:    player.assistAmount,
+			IsAlive:    player.isAlive,
+			Connected:  player.isConnected(),
+			Ping:       player.ping,
+			Bot:        player.bot,
+			Difficulty: player.difficulty.name,
+		})
+	}
+	return status
+}
+
+// remove a player from the lobby for good, they cannot resume their slot
+func (lobby *lobby) kick(id int) error {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	if !lobby.hasSlots([]int{id}) {
+		return errors.New("No such player slot")
+	}
+	player := &lobby.players[id]
+	if player.isEmpty() {
+		return errors.New("Player slot is empty")
+	}
+	return lobby.kickPlayer(player)
+}
+
+// the lobby's mutex must be held
+func (lobby *lobby) kickPlayer(player *player) error {
+	player.kicked = true
+	lobby.logger.Info("Player kicked", "player", player.id)
+	lobby.note(matchEvent{Kind: kickedEvent, Player: player.name})
+
+	// bots notice on their own and leave
+	if player.bot {
+		return nil
+	}
+
+	// a held slot is given up straight away, a connected player has their
+	// connection closed, which frees their slot as they leave
+	if player.resumed != nil {
+		close(player.resumed)
+		player.resumed = nil
+		return nil
+	}
+	if err := player.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Kicked")); err != nil {
+		lobby.logger.Warn("Could not close connection", "player", player.id, "error", err)
+	}
+	return player.conn.Close()
+}
+
+// tell everyone in the lobby something from the host
+func (lobby *lobby) say(text string) error {
+	if !protocol.ValidSay(text) {
+		return fmt.Errorf("Message must be 1 to %d bytes of text", protocol.MaxSayLength)
+	}
+	lobby.logger.Info("Host said", "text", text)
+	lobby.broadcastByteMessage(protocol.EncodeSay(text))
+	return nil
+}
+
+// end the current round without awarding a point to either team
+func (lobby *lobby) forceNextRound() error {
+	lobby.mutex.Lock()
+	switch {
+	case lobby.round == 0 || lobby.matchOver:
+		lobby.mutex.Unlock()
+		return errors.New("Match is not in progress")
+	case !lobby.inPlay || lobby.roundOver:
+		lobby.mutex.Unlock()
+		return errors.New("Round is not being played")
+	}
+	// stops the round from being won while it is being replaced
+	lobby.roundOver = true
+	lobby.note(matchEvent{Kind: roundEndedEvent})
+	lobby.mutex.Unlock()
+
+	lobby.logger.Info("Round ended by admin")
+	lobby.nextRound()
+	return nil
+}
+
+// stop the match where it is and send everyone away
+func (lobby *lobby) endMatch() error {
+	lobby.mutex.Lock()
+	if lobby.round == 0 || lobby.matchOver {
+		lobby.mutex.Unlock()
+		return errors.New("Match is not in progress")
+	}
+	lobby.matchOver = true
+	lobby.postFinalScore(false)
+	lobby.mutex.Unlock()
+
+	lobby.logger.Info("Match ended by admin")
+	lobby.disconnectAll()
+	lobby.writeReport(false)
+	return nil
+}
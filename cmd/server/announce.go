@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/lezhou8/shooter/internal/listing"
+)
+
+//////// announce
+//////// a public server tells a master server about itself every so often, so
+//////// clients can find it without being given its address
+
+// how many players are playing across every lobby, bots are not counted
+func (server *server) players() int {
+	server.mutex.Lock()
+	lobbies := make([]*lobby, 0, len(server.lobbies))
+	for _, lobby := range server.lobbies {
+		lobbies = append(lobbies, lobby)
+	}
+	server.mutex.Unlock()
+
+	players := 0
+	for _, lobby := range lobbies {
+		lobby.mutex.Lock()
+		for _, player := range lobby.players {
+			if player.isConnected() && !player.bot {
+				players++
+			}
+		}
+		lobby.mutex.Unlock()
+	}
+	return players
+}
+
+// announce the server until it stops, the player count is filled in each time
+func (server *server) announce(masterURL string, announcement listing.Announcement) {
+	client := http.Client{Timeout: 5 * time.Second}
+	ticker := time.NewTicker(listing.AnnounceInterval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		announcement.Players = server.players()
+		body, err := json.Marshal(announcement)
+		if err != nil {
+			slog.Error("Could not announce server", "error", err)
+			return
+		}
+		response, err := client.Post(masterURL+"/servers", "application/json", bytes.NewReader(body))
+		if err != nil {
+			slog.Warn("Could not announce server", "master", masterURL, "error", err)
+			continue
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusNoContent {
+			slog.Warn("Could not announce server", "master", masterURL, "error", fmt.Errorf("Master server responded with %s", response.Status))
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/navigation"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// bots
+//////// fill the slots nobody joined in time, so a match can start anyway
+
+const (
+	// how long a lobby waits for more people after someone joins, before
+	// filling the empty slots with bots
+	botFillDelay = 10 * time.Second
+
+	botSpeed           = 4   // units per second
+	botArrivalDistance = 0.5 // close enough to a waypoint to pick the next one
+	botStuckTime       = 2 * time.Second
+	botReplanDistance  = 1 // how far an enemy being pushed towards moves before the way to them is found again
+	botSightRange      = 20
+	botShootInterval   = 1200 * time.Millisecond
+	botEyeHeight       = 1.5
+)
+
+// state only the bot's own goroutine touches
+type bot struct {
+	id           int
+	round        int
+	position     maps.Vector3
+	waypoint     maps.Vector3   // the next point on the way to the goal
+	path         []maps.Vector3 // the points after the waypoint
+	goal         maps.Vector3
+	bestDistance float32 // closest the bot has got to its waypoint
+	stuckTicks   int
+	nextShot     time.Time
+	targetId     int          // the enemy being shot at, -1 for none
+	spottedAt    time.Time    // when the target came into sight
+	lastSeen     maps.Vector3 // where the target was last seen
+	pushing      bool         // moving towards the target while shooting at it
+}
+
+func newBotPlayer(id int, team protocol.Team, difficulty botDifficulty) *player {
+	return &player{
+		id:         id,
+		name:       fmt.Sprintf("Bot %d", id),
+		Team:       team,
+		bot:        true,
+		difficulty: difficulty,
+		token:      newSessionToken(), // tells the bot apart from whoever has the slot next
+		primary:    protocol.NoPrimary,
+	}
+}
+
+// wait a while for people to join, then fill up the lobby with bots
+func (lobby *lobby) scheduleBotFill() {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	if lobby.botFill != nil {
+		lobby.botFill.Stop()
+	}
+	lobby.botFill = lobby.clock.afterFunc(botFillDelay, lobby.fillWithBots)
+}
+
+func (lobby *lobby) fillWithBots() {
+	lobby.mutex.Lock()
+	if lobby.started || lobby.currentNumPlayers == 0 {
+		lobby.mutex.Unlock()
+		return
+	}
+	bots := make([]*bot, 0, lobby.config.numPlayers-lobby.currentNumPlayers)
+	for lobby.currentNumPlayers < lobby.config.numPlayers {
+		id := lobby.freeSlotId()
+		lobby.players[id] = *newBotPlayer(id, lobby.teamOf(id), lobby.config.botDifficulty)
+		lobby.currentNumPlayers++
+		lobby.note(matchEvent{Kind: joinedEvent, Player: lobby.players[id].name})
+		bots = append(bots, &bot{id: id, targetId: -1})
+	}
+	lobby.mutex.Unlock()
+
+	for _, bot := range bots {
+		lobby.logger.Info("Bot added", "player", bot.id)
+		lobby.runBot(bot)
+	}
+	lobby.broadcastRoster()
+	lobby.startIfFull()
+}
+
+func (lobby *lobby) runBot(bot *bot) {
+	lobby.every(lobby.tickInterval(), func() bool {
+		if !lobby.stepBot(bot) {
+			lobby.freeSlot(bot.id)
+			lobby.logger.Info("Bot removed", "player", bot.id)
+			return false
+		}
+		return true
+	})
+}
+
+// move the bot along, or shoot at an enemy it can see, as well as its
+// difficulty lets it; reports false once the bot has been kicked
+func (lobby *lobby) stepBot(bot *bot) bool {
+	lobby.mutex.Lock()
+	player := &lobby.players[bot.id]
+	if player.kicked {
+		lobby.mutex.Unlock()
+		return false
+	}
+	if !lobby.inPlay || !player.isAlive {
+		lobby.mutex.Unlock()
+		return true
+	}
+
+	difficulty := player.difficulty
+	now := lobby.clock.now()
+
+	// every round starts the bot afresh from its spawn
+	if bot.round != lobby.round {
+		bot.round = lobby.round
+		bot.position = unscaleLocation(player.x, player.y, player.z)
+		bot.targetId = -1
+		lobby.pickWaypoint(bot, difficulty)
+	}
+
+	target := lobby.visibleEnemy(bot)
+	switch {
+	case target == -1 && bot.targetId != -1:
+		// an enemy that got out of sight may be chased to where it was last seen
+		if lobby.random.Float32() < difficulty.aggression {
+			lobby.headFor(bot, bot.lastSeen)
+		}
+	case target != -1 && target != bot.targetId:
+		bot.spottedAt = now
+		bot.pushing = lobby.random.Float32() < difficulty.aggression
+	}
+	bot.targetId = target
+	if target != -1 {
+		bot.lastSeen = unscaleLocation(lobby.players[target].x, lobby.players[target].y, lobby.players[target].z)
+		if bot.pushing && horizontalDistance(bot.goal, bot.lastSeen) > botReplanDistance {
+			lobby.headFor(bot, bot.lastSeen)
+		}
+	}
+
+	var doorMessage []byte
+	if target == -1 || bot.pushing {
+		doorMessage = lobby.moveBot(bot, player)
+	}
+	if target != -1 {
+		player.yaw, player.pitch = bot.lookAt(lobby.players[target].chest())
+	}
+	headVisible := target != -1 && lobby.canSee(bot.eye(), lobby.players[target].head())
+	healthPackMessage := lobby.pickUpHealthPack(player)
+	x, y, z := player.x, player.y, player.z
+	lobby.mutex.Unlock()
+
+	if healthPackMessage != nil {
+		lobby.broadcastByteMessage(healthPackMessage)
+	}
+	if doorMessage != nil {
+		lobby.broadcastByteMessage(doorMessage)
+	}
+
+	if target == -1 || now.Before(bot.nextShot) || now.Before(bot.spottedAt.Add(difficulty.reactionTime)) {
+		return true
+	}
+	bot.nextShot = now.Add(botShootInterval)
+	lobby.countShot(bot.id)
+	lobby.broadcastByteMessage(protocol.EncodeShot(bot.id, x, y, z))
+	if lobby.random.Float32() < difficulty.accuracy {
+		headshots := 0
+		if headVisible && lobby.random.Float32() < difficulty.headshotChance {
+			headshots = 1
+		}
+		lobby.shoot(bot.id, target, protocol.Handgun, 1, headshots)
+	}
+	return true
+}
+
+func (bot *bot) eye() maps.Vector3 {
+	return maps.Vector3{bot.position[0], bot.position[1] + botEyeHeight, bot.position[2]}
+}
+
+// the yaw and pitch of the bot looking from its eye to a point, scaled like in
+// location parcels
+func (bot *bot) lookAt(point maps.Vector3) (byte, int8) {
+	eye := bot.eye()
+	dx, dy, dz := float64(point[0]-eye[0]), float64(point[1]-eye[1]), float64(point[2]-eye[2])
+	yaw := math.Atan2(dz, dx)
+	pitch := math.Atan2(dy, math.Hypot(dx, dz))
+	return protocol.YawToByte(float32(yaw)), protocol.PitchToInt8(float32(pitch))
+}
+
+// head somewhere new, bots wander between the spawns of both teams unless
+// they know where an enemy is, the lobby's mutex must be held
+func (lobby *lobby) pickWaypoint(bot *bot, difficulty botDifficulty) {
+	if lobby.random.Float32() < difficulty.mapKnowledge {
+		var enemies []maps.Vector3
+		for _, player := range lobby.players {
+			if !player.isEmpty() && player.isAlive && player.Team != lobby.players[bot.id].Team {
+				enemies = append(enemies, unscaleLocation(player.x, player.y, player.z))
+			}
+		}
+		if len(enemies) > 0 {
+			lobby.headFor(bot, enemies[lobby.random.IntN(len(enemies))])
+			return
+		}
+	}
+	gameMap := lobby.config.maps[lobby.mapIndex]
+	waypoints := append(append([]maps.Vector3{}, gameMap.Spawns.A...), gameMap.Spawns.B...)
+	lobby.headFor(bot, waypoints[lobby.random.IntN(len(waypoints))])
+}
+
+// find the way to a point, at the height the bot is at, the lobby's mutex must
+// be held
+func (lobby *lobby) headFor(bot *bot, goal maps.Vector3) {
+	goal[1] = bot.position[1]
+	bot.goal = goal
+	bot.path = lobby.config.navGrids[lobby.mapIndex].Path(bot.position, goal)
+	if len(bot.path) == 0 {
+		// walk straight at it, sliding along whatever is in the way
+		bot.path = []maps.Vector3{goal}
+	}
+	bot.nextWaypoint()
+}
+
+// move on to the next point of the path
+func (bot *bot) nextWaypoint() {
+	bot.waypoint = bot.path[0]
+	bot.waypoint[1] = bot.position[1]
+	bot.path = bot.path[1:]
+	bot.bestDistance = horizontalDistance(bot.position, bot.waypoint)
+	bot.stuckTicks = 0
+}
+
+// take a step towards the waypoint, sliding along walls in the way, and pick
+// a new goal once there or stuck, returning the message to broadcast if it
+// opened a door in its way, the lobby's mutex must be held
+func (lobby *lobby) moveBot(bot *bot, player *player) []byte {
+	distance := horizontalDistance(bot.position, bot.waypoint)
+	if distance < botArrivalDistance {
+		if len(bot.path) > 0 {
+			bot.nextWaypoint()
+		} else {
+			lobby.pickWaypoint(bot, player.difficulty)
+		}
+		return nil
+	}
+
+	player.yaw, player.pitch = bot.lookAt(maps.Vector3{bot.waypoint[0], bot.position[1] + botEyeHeight, bot.waypoint[2]})
+	step := min(float32(botSpeed*lobby.tickInterval().Seconds()), distance) / distance
+	next := maps.Vector3{
+		bot.position[0] + (bot.waypoint[0]-bot.position[0])*step,
+		bot.position[1],
+		bot.position[2] + (bot.waypoint[2]-bot.position[2])*step,
+	}
+	candidates := []maps.Vector3{
+		next,
+		{next[0], bot.position[1], bot.position[2]},
+		{bot.position[0], bot.position[1], next[2]},
+	}
+	moved := false
+	for _, candidate := range candidates {
+		if !lobby.collidesAt(candidate, navigation.PlayerHeight) {
+			bot.position, moved = candidate, true
+			break
+		}
+	}
+	// the way was planned as though every door were open
+	var doorMessage []byte
+	if !moved {
+		doorMessage = lobby.openDoorInWay(player)
+	}
+
+	// give up on waypoints the bot cannot get any closer to
+	if distance = horizontalDistance(bot.position, bot.waypoint); distance < bot.bestDistance {
+		bot.bestDistance = distance
+		bot.stuckTicks = 0
+	} else if bot.stuckTicks++; bot.stuckTicks > int(botStuckTime/lobby.tickInterval()) {
+		lobby.pickWaypoint(bot, player.difficulty)
+	}
+
+	player.x = protocol.Float32ScaleToInt8(bot.position[0])
+	player.y = protocol.Float32ScaleToInt8(bot.position[1])
+	player.z = protocol.Float32ScaleToInt8(bot.position[2])
+	return doorMessage
+}
+
+// the closest living enemy the bot has a clear shot at, or -1, the lobby's
+// mutex must be held
+func (lobby *lobby) visibleEnemy(bot *bot) int {
+	eye := bot.eye()
+	target, targetDistance := -1, float32(botSightRange)
+	for id, player := range lobby.players {
+		if player.isEmpty() || !player.isAlive || player.Team == lobby.players[bot.id].Team {
+			continue
+		}
+		chest := player.chest()
+		enemyDistance := distance(eye, chest)
+		if enemyDistance < targetDistance && lobby.canSee(eye, chest) {
+			target, targetDistance = id, enemyDistance
+		}
+	}
+	return target
+}
+
+// whether nothing in the current map stands between two points, the lobby's
+// mutex must be held
+func (lobby *lobby) lineOfSight(from, to maps.Vector3) bool {
+	for _, block := range lobby.solidBlocks() {
+		if segmentHitsBox(from, to, block.Min, block.Max) {
+			return false
+		}
+	}
+	return true
+}
+
+// slab test of the segment between two points against a box
+func segmentHitsBox(from, to, boxMin, boxMax maps.Vector3) bool {
+	enter, exit := float32(0), float32(1)
+	for axis := range from {
+		direction := to[axis] - from[axis]
+		if direction == 0 {
+			if from[axis] < boxMin[axis] || boxMax[axis] < from[axis] {
+				return false
+			}
+			continue
+		}
+		near := (boxMin[axis] - from[axis]) / direction
+		far := (boxMax[axis] - from[axis]) / direction
+		if near > far {
+			near, far = far, near
+		}
+		enter, exit = max(enter, near), min(exit, far)
+		if enter > exit {
+			return false
+		}
+	}
+	return true
+}
+
+func horizontalDistance(a, b maps.Vector3) float32 {
+	return float32(math.Hypot(float64(a[0]-b[0]), float64(a[2]-b[2])))
+}
+
+func distance(a, b maps.Vector3) float32 {
+	dx, dy, dz := float64(a[0]-b[0]), float64(a[1]-b[1]), float64(a[2]-b[2])
+	return float32(math.Sqrt(dx*dx + dy*dy + dz*dz))
+}
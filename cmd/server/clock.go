@@ -0,0 +1,262 @@
+package main
+
+import (
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//////// clock
+//////// game logic tells the time, waits and steps through the lobby's clock,
+//////// which is the wall clock unless the server is started with -simulate;
+//////// then it is a count of fixed ticks, every timer going off on a tick in
+//////// the order it was set, so that with a seed the same things happen at
+//////// the same ticks every time; keepalives, read deadlines and how fast a
+//////// client sends moves are about the network, so stay on the wall clock
+
+type clock interface {
+	now() time.Time
+	// calls f once d has passed, on a goroutine of the clock's own
+	afterFunc(d time.Duration, f func()) timer
+	newTicker(d time.Duration) ticker
+}
+
+type timer interface {
+	// reports whether the timer was stopped before it went off
+	Stop() bool
+}
+
+type ticker interface {
+	channel() <-chan time.Time
+	Stop()
+}
+
+// a channel that is sent the time once d has passed, like time.After
+func after(clock clock, d time.Duration) (<-chan time.Time, timer) {
+	fired := make(chan time.Time, 1)
+	return fired, clock.afterFunc(d, func() {
+		fired <- clock.now()
+	})
+}
+
+// call step every d on the lobby's clock, until it reports false or the lobby
+// is torn down
+func (lobby *lobby) every(d time.Duration, step func() bool) {
+	var next func()
+	next = func() {
+		select {
+		case <-lobby.done:
+			return
+		default:
+		}
+		if step() {
+			lobby.clock.afterFunc(d, next)
+		}
+	}
+	lobby.clock.afterFunc(d, next)
+}
+
+// how long the lobby has been around on its clock, which every server time
+// sent to clients counts from
+func (lobby *lobby) serverTime() time.Duration {
+	return lobby.clock.now().Sub(lobby.epoch)
+}
+
+// how far ahead of the server's clock a client's estimate of it may be
+const maxClockSkew = 500 * time.Millisecond
+
+//////// wall clock
+
+type wallClock struct{}
+
+type wallTicker struct {
+	*time.Ticker
+}
+
+func (wallClock) now() time.Time {
+	return time.Now()
+}
+
+func (wallClock) afterFunc(d time.Duration, f func()) timer {
+	return time.AfterFunc(d, f)
+}
+
+func (wallClock) newTicker(d time.Duration) ticker {
+	return wallTicker{time.NewTicker(d)}
+}
+
+func (ticker wallTicker) channel() <-chan time.Time {
+	return ticker.C
+}
+
+//////// tick clock
+
+// ticks per second, a multiple of the rates locations are sent, grenades are
+// stepped and pings are passed on at, so each of them is a whole number of
+// ticks
+const simulationRate = 60
+
+// when the first tick of a simulation is, so times in logs are the same from
+// one run to the next
+var simulationEpoch = time.Unix(0, 0).UTC()
+
+type tickClock struct {
+	tickLength time.Duration
+	ticks      int64
+	pending    []*tickTimer // in the order they go off
+	timersSet  int64
+	mutex      sync.Mutex
+}
+
+type tickTimer struct {
+	clock *tickClock
+	at    int64 // the tick it goes off on
+	order int64 // timers on the same tick go off in the order they were set
+	f     func()
+}
+
+type tickTicker struct {
+	fired   chan time.Time
+	timer   atomic.Pointer[tickTimer]
+	stopped atomic.Bool
+}
+
+func newTickClock(rate int) *tickClock {
+	return &tickClock{tickLength: time.Second / time.Duration(rate)}
+}
+
+// go off tick by tick at the rate of the wall clock, until told to stop
+func (clock *tickClock) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(clock.tickLength)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			clock.advance()
+		}
+	}
+}
+
+// move on a tick, setting off every timer due on it
+func (clock *tickClock) advance() {
+	clock.mutex.Lock()
+	clock.ticks++
+	due := 0
+	for due < len(clock.pending) && clock.pending[due].at <= clock.ticks {
+		due++
+	}
+	fired := slices.Clone(clock.pending[:due])
+	clock.pending = slices.Delete(clock.pending, 0, due)
+	clock.mutex.Unlock()
+
+	for _, timer := range fired {
+		timer.f()
+	}
+}
+
+func (clock *tickClock) now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return simulationEpoch.Add(time.Duration(clock.ticks) * clock.tickLength)
+}
+
+// how many ticks a duration is, to the nearest tick, but at least one
+func (clock *tickClock) ticksIn(d time.Duration) int64 {
+	return max(int64((d+clock.tickLength/2)/clock.tickLength), 1)
+}
+
+func (clock *tickClock) afterFunc(d time.Duration, f func()) timer {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	timer := &tickTimer{clock: clock, at: clock.ticks + clock.ticksIn(d), order: clock.timersSet, f: f}
+	clock.timersSet++
+	index, _ := slices.BinarySearchFunc(clock.pending, timer, func(pending, timer *tickTimer) int {
+		if pending.at != timer.at {
+			return int(pending.at - timer.at)
+		}
+		return int(pending.order - timer.order)
+	})
+	clock.pending = slices.Insert(clock.pending, index, timer)
+	return timer
+}
+
+func (timer *tickTimer) Stop() bool {
+	clock := timer.clock
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	index := slices.Index(clock.pending, timer)
+	if index == -1 {
+		return false
+	}
+	clock.pending = slices.Delete(clock.pending, index, index+1)
+	return true
+}
+
+// a ticker is a timer that sets itself again each time it goes off, a tick
+// that finds the last one not yet received is dropped, as with time.Ticker
+func (clock *tickClock) newTicker(d time.Duration) ticker {
+	ticker := &tickTicker{fired: make(chan time.Time, 1)}
+	var tick func()
+	tick = func() {
+		select {
+		case ticker.fired <- clock.now():
+		default:
+		}
+		if !ticker.stopped.Load() {
+			ticker.timer.Store(clock.afterFunc(d, tick).(*tickTimer))
+		}
+	}
+	ticker.timer.Store(clock.afterFunc(d, tick).(*tickTimer))
+	return ticker
+}
+
+func (ticker *tickTicker) channel() <-chan time.Time {
+	return ticker.fired
+}
+
+func (ticker *tickTicker) Stop() {
+	ticker.stopped.Store(true)
+	ticker.timer.Load().Stop()
+}
+
+//////// random
+
+// the lobby's random numbers, from its seed so that a simulation can be run
+// again; safe to use from any goroutine
+type random struct {
+	source *rand.Rand
+	mutex  sync.Mutex
+}
+
+// a seed of 0 picks one at random
+func newRandom(seed uint64) *random {
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return &random{source: rand.New(rand.NewPCG(seed, seed))}
+}
+
+func (random *random) Float32() float32 {
+	random.mutex.Lock()
+	defer random.mutex.Unlock()
+	return random.source.Float32()
+}
+
+func (random *random) Float64() float64 {
+	random.mutex.Lock()
+	defer random.mutex.Unlock()
+	return random.source.Float64()
+}
+
+func (random *random) IntN(n int) int {
+	random.mutex.Lock()
+	defer random.mutex.Unlock()
+	return random.source.IntN(n)
+}
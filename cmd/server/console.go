@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// console
+//////// with -console the server reads commands from its standard input, one
+//////// to a line, so that a match can be managed from the terminal the server
+//////// was started in; they act on a lobby through the same lobby management
+//////// as the admin API, on the default lobby unless another is picked, and
+//////// RCON takes the same commands, see rcon.go
+
+const consoleHelp = `Commands:
+  status                   every lobby and who is in it
+  lobby [name]             manage another lobby, or show which one is being managed
+  kick [id]                remove a player for good
+  difficulty [id] [level]  change how well a bot plays: beginner, normal, hard or punishing
+  say [message]            tell everyone in the lobby something
+  nextround                end the round without a point
+  shutdown                 end every match and stop the server
+  help                     show this`
+
+// someone giving commands, who manages one lobby at a time
+type consoleSession struct {
+	server    *server
+	lobbyName string
+	shutdown  func()
+}
+
+func (server *server) newConsoleSession(shutdown func()) *consoleSession {
+	return &consoleSession{server: server, lobbyName: defaultLobbyName, shutdown: shutdown}
+}
+
+// read commands until the input runs out, or the server is shut down
+func (server *server) runConsole(input io.Reader, output io.Writer, shutdown func()) {
+	session := server.newConsoleSession(shutdown)
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		if session.execute(scanner.Text(), output) {
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		slog.Warn("Could not read console", "error", err)
+	}
+}
+
+// carry out a command, writing what comes of it, reports whether the server
+// is being shut down
+func (session *consoleSession) execute(line string, output io.Writer) bool {
+	command, argument, _ := strings.Cut(strings.TrimSpace(line), " ")
+	argument = strings.TrimSpace(argument)
+
+	var err error
+	switch command {
+	case "":
+	case "help":
+		fmt.Fprintln(output, consoleHelp)
+	case "status":
+		session.server.printStatus(output)
+	case "lobby":
+		if argument != "" {
+			session.lobbyName = argument
+		}
+		fmt.Fprintf(output, "Managing lobby %q\n", session.lobbyName)
+	case "kick":
+		id, parseErr := strconv.Atoi(argument)
+		if parseErr != nil || !protocol.ValidId(id) {
+			err = fmt.Errorf("Invalid player id %q", argument)
+			break
+		}
+		err = session.onLobby(func(lobby *lobby) error { return lobby.kick(id) })
+	case "difficulty":
+		idText, name, _ := strings.Cut(argument, " ")
+		id, parseErr := strconv.Atoi(idText)
+		if parseErr != nil || !protocol.ValidId(id) {
+			err = fmt.Errorf("Invalid player id %q", idText)
+			break
+		}
+		difficulty, parseErr := parseBotDifficulty(strings.TrimSpace(name))
+		if parseErr != nil {
+			err = parseErr
+			break
+		}
+		err = session.onLobby(func(lobby *lobby) error { return lobby.setBotDifficulty(id, difficulty) })
+	case "say":
+		err = session.onLobby(func(lobby *lobby) error { return lobby.say(argument) })
+	case "nextround":
+		err = session.onLobby((*lobby).forceNextRound)
+	case "shutdown":
+		fmt.Fprintln(output, "Shutting down")
+		session.shutdown()
+		return true
+	default:
+		err = fmt.Errorf("Unknown command %q, try help", command)
+	}
+	if err != nil {
+		fmt.Fprintln(output, err)
+	}
+	return false
+}
+
+// do something to the lobby being managed, if it exists
+func (session *consoleSession) onLobby(action func(*lobby) error) error {
+	server := session.server
+	server.mutex.Lock()
+	lobby, ok := server.lobbies[session.lobbyName]
+	server.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("No such lobby %q", session.lobbyName)
+	}
+	return action(lobby)
+}
+
+// every lobby, with the score and each player's
+func (server *server) printStatus(output io.Writer) {
+	server.mutex.Lock()
+	lobbies := make([]*lobby, 0, len(server.lobbies))
+	for _, lobby := range server.lobbies {
+		lobbies = append(lobbies, lobby)
+	}
+	server.mutex.Unlock()
+
+	statuses := make([]lobbyStatus, 0, len(lobbies))
+	for _, lobby := range lobbies {
+		statuses = append(statuses, lobby.status())
+	}
+
+	if len(statuses) == 0 {
+		fmt.Fprintln(output, "No lobbies")
+		return
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	for _, status := range statuses {
+		state := "waiting for players"
+		switch {
+		case status.MatchOver:
+			state = "match over"
+		case status.InPlay:
+			state = fmt.Sprintf("round %d being played", status.Round)
+		case status.Round > 0:
+			state = fmt.Sprintf("round %d", status.Round)
+		}
+		fmt.Fprintf(output, "%s: %s on %s, %d-%d\n", status.Name, state, status.Map, status.TeamAPoints, status.TeamBPoints)
+		for _, player := range status.Players {
+			line := fmt.Sprintf("  %d %s, team %s, %d/%d/%d, %dms", player.Id, player.Name, strings.ToUpper(player.Team),
+				player.Kills, player.Deaths, player.Assists, player.Ping)
+			if player.Bot {
+				line += ", bot, " + player.Difficulty
+			} else if !player.Connected {
+				line += ", disconnected"
+			}
+			if !player.IsAlive {
+				line += ", dead"
+			}
+			fmt.Fprintln(output, line)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// datagrams
+//////// with -udp, locations go over UDP on the same port to each client that
+//////// asks for them, where one that is lost or late does not hold up those
+//////// behind it; a client says hello with its session token every so often,
+//////// and goes back to getting locations over the websocket, which carries
+//////// everything else either way, once its hellos stop
+
+// note down where each hello came from, until the connection is closed
+func (server *server) listenDatagrams(conn *net.UDPConn) {
+	buffer := make([]byte, protocol.MaxDatagramSize)
+	for {
+		size, address, err := conn.ReadFromUDP(buffer)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			slog.Warn("Could not read datagram", "error", err)
+			continue
+		}
+		token, err := protocol.DecodeHello(buffer[:size])
+		if err != nil {
+			slog.Debug("Bad datagram", "address", address, "error", err)
+			continue
+		}
+		server.helloFrom(token, address)
+	}
+}
+
+// the player the token belongs to is sent locations at the address from now
+// on, whichever lobby they are in
+func (server *server) helloFrom(token []byte, address *net.UDPAddr) {
+	server.mutex.Lock()
+	lobbies := make([]*lobby, 0, len(server.lobbies))
+	for _, lobby := range server.lobbies {
+		lobbies = append(lobbies, lobby)
+	}
+	server.mutex.Unlock()
+
+	for _, lobby := range lobbies {
+		lobby.mutex.Lock()
+		for id := range lobby.players {
+			player := &lobby.players[id]
+			if player.isConnected() && subtle.ConstantTimeCompare(player.token, token) == 1 {
+				player.datagramAddress = address
+				player.lastHello = time.Now()
+			}
+		}
+		lobby.mutex.Unlock()
+	}
+}
+
+// whether the player still wants locations over UDP
+func (player *player) wantsDatagrams() bool {
+	return player.datagramAddress != nil && time.Since(player.lastHello) < protocol.DatagramTimeout
+}
+
+// send everyone's locations to every player and observer, over UDP to the
+// players who asked for it, the lobby's mutex must be held
+func (lobby *lobby) sendLocations(locations []byte) {
+	lobby.record(locations)
+	lobby.locationSequence++
+	datagram := protocol.EncodeLocationsDatagram(lobby.locationSequence, locations)
+	for _, player := range lobby.players {
+		if !player.isConnected() {
+			continue
+		}
+		var err error
+		if player.wantsDatagrams() {
+			_, err = lobby.config.datagrams.WriteToUDP(datagram, player.datagramAddress)
+		} else {
+			err = writeMessage(player.conn, locations)
+		}
+		if err != nil {
+			lobby.logger.Warn("Could not send message", "player", player.id, "header", protocol.LocationsHeader, "error", err)
+		}
+	}
+	for conn := range lobby.observers {
+		if err := writeMessage(conn, locations); err != nil {
+			lobby.logger.Warn("Could not send message", "observer", conn.RemoteAddr(), "header", protocol.LocationsHeader, "error", err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//////// bot difficulty
+//////// how well a bot plays comes from one of a few presets, from beginner to
+//////// punishing: how quickly it shoots at an enemy it has just spotted, how
+//////// often its shots land, how readily it pushes towards and chases
+//////// enemies, and how often it knows where they are without seeing them;
+//////// bots start at the server's -bot-difficulty, and each one can be given
+//////// another from the console
+
+type botDifficulty struct {
+	name           string
+	reactionTime   time.Duration // from spotting an enemy to the first shot at them
+	accuracy       float32       // chance of each shot landing
+	headshotChance float32       // chance of a shot that lands being to the head, if it can be seen
+	aggression     float32       // chance of pushing towards an enemy while shooting, and of chasing one out of sight
+	mapKnowledge   float32       // chance of heading for where an enemy is, instead of wandering
+}
+
+// easiest first
+var botDifficulties = []botDifficulty{
+	{name: "beginner", reactionTime: 900 * time.Millisecond, accuracy: 0.15, headshotChance: 0.05, aggression: 0.1, mapKnowledge: 0},
+	{name: "normal", reactionTime: 400 * time.Millisecond, accuracy: 0.35, headshotChance: 0.15, aggression: 0.3, mapKnowledge: 0.2},
+	{name: "hard", reactionTime: 250 * time.Millisecond, accuracy: 0.55, headshotChance: 0.3, aggression: 0.6, mapKnowledge: 0.5},
+	{name: "punishing", reactionTime: 150 * time.Millisecond, accuracy: 0.75, headshotChance: 0.5, aggression: 0.9, mapKnowledge: 0.9},
+}
+
+func parseBotDifficulty(name string) (botDifficulty, error) {
+	for _, difficulty := range botDifficulties {
+		if difficulty.name == name {
+			return difficulty, nil
+		}
+	}
+	return botDifficulty{}, fmt.Errorf("Unknown bot difficulty %q, one of %s", name, botDifficultyNames())
+}
+
+func botDifficultyNames() string {
+	names := make([]string, 0, len(botDifficulties))
+	for _, difficulty := range botDifficulties {
+		names = append(names, difficulty.name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// change how well a bot plays, from its next step on
+func (lobby *lobby) setBotDifficulty(id int, difficulty botDifficulty) error {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	if !lobby.hasSlots([]int{id}) {
+		return errors.New("No such player slot")
+	}
+	player := &lobby.players[id]
+	if player.isEmpty() {
+		return errors.New("Player slot is empty")
+	}
+	if !player.bot {
+		return errors.New("Player is not a bot")
+	}
+	player.difficulty = difficulty
+	lobby.logger.Info("Bot difficulty changed", "player", id, "difficulty", difficulty.name)
+	return nil
+}
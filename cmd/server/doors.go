@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/navigation"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// doors
+//////// every door starts the round the way the map has it, and using one
+//////// within reach opens or closes it for everyone; a closed door is as
+//////// solid as any block, stopping players, grenades and what bots can see,
+//////// though bots plan their way as though every door were open, and open
+//////// the ones they walk into
+
+const doorReach = 1.5 // how close a player's chest has to get to a door's box
+
+// put every door back the way the map has it, the lobby's mutex must be held
+func (lobby *lobby) resetDoors() {
+	doors := lobby.config.maps[lobby.mapIndex].Doors
+	lobby.openDoors = make([]bool, len(doors))
+	for door, mapDoor := range doors {
+		lobby.openDoors[door] = mapDoor.Open
+	}
+}
+
+// open or close the nearest door within the player's reach, returning the
+// message to broadcast, or nil if there is none, or it would close on someone
+// standing in the doorway, the lobby's mutex must be held
+func (lobby *lobby) useDoor(player *player) []byte {
+	if !lobby.playing() || !player.isAlive || player.limbo {
+		return nil
+	}
+
+	chest := player.chest()
+	nearest, nearestDistance := -1, float32(doorReach)
+	for door, mapDoor := range lobby.config.maps[lobby.mapIndex].Doors {
+		if doorDistance := distanceToBox(chest, mapDoor.Min, mapDoor.Max); doorDistance <= nearestDistance {
+			nearest, nearestDistance = door, doorDistance
+		}
+	}
+	if nearest < 0 {
+		return nil
+	}
+	open := !lobby.openDoors[nearest]
+	if !open && lobby.inDoorway(nearest) {
+		return nil
+	}
+	lobby.openDoors[nearest] = open
+	lobby.logger.Debug("Door used", "player", player.id, "door", nearest, "open", open)
+	return protocol.EncodeDoor(nearest, open)
+}
+
+// open a closed door within reach, for a bot that walked into one,
+// returning the message to broadcast, or nil if there is none, the lobby's
+// mutex must be held
+func (lobby *lobby) openDoorInWay(player *player) []byte {
+	chest := player.chest()
+	for door, mapDoor := range lobby.config.maps[lobby.mapIndex].Doors {
+		if !lobby.openDoors[door] && distanceToBox(chest, mapDoor.Min, mapDoor.Max) <= doorReach {
+			lobby.openDoors[door] = true
+			lobby.logger.Debug("Door opened by bot", "player", player.id, "door", door)
+			return protocol.EncodeDoor(door, true)
+		}
+	}
+	return nil
+}
+
+// whether anyone alive is standing where a door closes, the lobby's mutex
+// must be held
+func (lobby *lobby) inDoorway(door int) bool {
+	mapDoor := lobby.config.maps[lobby.mapIndex].Doors[door]
+	for _, player := range lobby.players {
+		if player.isEmpty() || !player.isAlive {
+			continue
+		}
+		feet := unscaleLocation(player.x, player.y, player.z)
+		playerMin := maps.Vector3{feet[0] - navigation.PlayerHalfWidth, feet[1], feet[2] - navigation.PlayerHalfWidth}
+		playerMax := maps.Vector3{feet[0] + navigation.PlayerHalfWidth, feet[1] + player.height(), feet[2] + navigation.PlayerHalfWidth}
+		if mapDoor.Overlaps(playerMin, playerMax) {
+			return true
+		}
+	}
+	return false
+}
+
+// what is solid in the current map, its blocks and whichever doors are
+// closed, the lobby's mutex must be held
+func (lobby *lobby) solidBlocks() []maps.Block {
+	gameMap := lobby.config.maps[lobby.mapIndex]
+	if len(gameMap.Doors) == 0 {
+		return gameMap.Blocks
+	}
+	blocks := append(make([]maps.Block, 0, len(gameMap.Blocks)+len(gameMap.Doors)), gameMap.Blocks...)
+	for door, mapDoor := range gameMap.Doors {
+		if !lobby.openDoors[door] {
+			blocks = append(blocks, mapDoor.Block)
+		}
+	}
+	return blocks
+}
+
+// the lobby's mutex must be held
+func (lobby *lobby) openDoorList() []int {
+	var open []int
+	for door, isOpen := range lobby.openDoors {
+		if isOpen {
+			open = append(open, door)
+		}
+	}
+	return open
+}
+
+// how far a point is from the nearest part of a box, 0 inside it
+func distanceToBox(point, boxMin, boxMax maps.Vector3) float32 {
+	var nearest maps.Vector3
+	for axis := range point {
+		nearest[axis] = min(max(point[axis], boxMin[axis]), boxMax[axis])
+	}
+	return distance(point, nearest)
+}
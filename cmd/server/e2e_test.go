@@ -0,0 +1,322 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lezhou8/shooter/internal/connection"
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/navigation"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// end to end
+//////// plays scripted rounds against a server started in the test on a free
+//////// port, with clients that join, shoot, kill, drop out and leave, and
+//////// checks the messages everyone is sent along the way; stops at the
+//////// first step that goes wrong
+
+const (
+	expectTimeout  = 15 * time.Second // longer than the grace time between rounds
+	fireInterval   = 100 * time.Millisecond
+	rejoinInterval = 50 * time.Millisecond
+	maxShots       = 100 // a handgun headshot does at least 1 damage from anywhere
+)
+
+// messages that come regardless of what the script does, which are skipped
+// over when waiting for what is expected
+var backgroundHeaders = map[protocol.MessageHeader]bool{
+	protocol.LocationsHeader:  true,
+	protocol.PingsHeader:      true,
+	protocol.PongHeader:       true,
+	protocol.RosterHeader:     true,
+	protocol.InventoryHeader:  true,
+	protocol.RoundTimeHeader:  true,
+	protocol.GraceHeader:      true,
+	protocol.CorrectionHeader: true,
+	protocol.ShotHeader:       true,
+	protocol.LoseHealthHeader: true,
+	protocol.HitConfirmHeader: true,
+}
+
+// serve lobbies for a number of players on a free port, until the test ends
+func startTestServer(t *testing.T, numPlayers int) string {
+	t.Helper()
+	gameMap, err := maps.LoadNamed(filepath.Join("..", "..", maps.DefaultDirectory), maps.DefaultName)
+	if err != nil {
+		t.Fatal("Could not load map:", err)
+	}
+	leaderboard, err := loadLeaderboard("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newServer(&config{
+		numPlayers:      numPlayers,
+		teamSize:        protocol.DefaultTeamSize,
+		mapNames:        []string{maps.DefaultName},
+		maps:            []*maps.Map{gameMap},
+		navGrids:        []*navigation.Grid{navigation.New(gameMap, navigation.PlayerHalfWidth, navigation.PlayerHeight)},
+		mapRounds:       2,
+		roundTime:       120 * time.Second,
+		tickRate:        protocol.DefaultTickRate,
+		roundStartGrace: time.Second,
+		roundEndGrace:   time.Second,
+	}, leaderboard)
+	httpServer := httptest.NewServer(http.HandlerFunc(server.serveWs))
+	t.Cleanup(func() {
+		server.shutdown()
+		httpServer.Close()
+		server.cleanUp()
+	})
+	return strings.TrimPrefix(httpServer.URL, "http://")
+}
+
+type testClient struct {
+	name      string
+	conn      *websocket.Conn
+	messages  *connection.Reader
+	admission protocol.Admission
+	seenAt    atomic.Int64 // the server time of the latest locations, as a time.Duration
+}
+
+// join a lobby in a slot, or as protocol.AnyId or protocol.ObserverId
+func join(address, lobby string, id int, name string) (*testClient, error) {
+	return dial(address, lobby, name, protocol.EncodeJoin(id, name, ""))
+}
+
+// take back a slot after dropping out, trying again until the server has
+// noticed the connection dropped and is holding the slot
+func rejoin(address, lobby string, id int, token []byte, name string) (*testClient, error) {
+	deadline := time.Now().Add(expectTimeout)
+	for {
+		client, err := dial(address, lobby, name, protocol.EncodeRejoin(id, token, name, ""))
+		if err == nil || time.Now().After(deadline) {
+			return client, err
+		}
+		time.Sleep(rejoinInterval)
+	}
+}
+
+func dial(address, lobby, name string, joinMessage []byte) (*testClient, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s/ws?lobby=%s", address, url.QueryEscape(lobby)), nil)
+	if err != nil {
+		return nil, err
+	}
+	admission, err := connection.Join(conn, joinMessage)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s could not join: %w", name, err)
+	}
+	return &testClient{name: name, conn: conn, messages: connection.NewReader(conn), admission: admission}, nil
+}
+
+func (client *testClient) send(message []byte) error {
+	return connection.Write(client.conn, protocol.BinaryEncoding, message)
+}
+
+// leave the match the way the client does
+func (client *testClient) leave() {
+	client.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	client.conn.Close()
+}
+
+// wait for each of the headers in order, failing on any other message that
+// is not background, and returning the messages that came
+func (client *testClient) expect(headers ...protocol.MessageHeader) ([][]byte, error) {
+	client.conn.SetReadDeadline(time.Now().Add(expectTimeout))
+	defer client.conn.SetReadDeadline(time.Time{})
+
+	var received [][]byte
+	for _, expected := range headers {
+		for {
+			_, message, err := client.messages.ReadMessage()
+			if err != nil {
+				return nil, fmt.Errorf("%s waiting for %s: %w", client.name, expected, err)
+			}
+			if len(message) == 0 {
+				continue
+			}
+			header := protocol.MessageHeader(message[0])
+			if header == protocol.LocationsHeader {
+				if sentAt, _, err := protocol.DecodeLocations(message); err == nil {
+					client.seenAt.Store(int64(sentAt))
+				}
+			}
+			if header == expected {
+				received = append(received, message)
+				break
+			}
+			if !backgroundHeaders[header] {
+				return nil, fmt.Errorf("%s waiting for %s got %s", client.name, expected, header)
+			}
+		}
+	}
+	return received, nil
+}
+
+// keep shooting the target in the head until told to stop, returning why it
+// could not if it had to give up first
+func fire(shooter *testClient, targetId int, stop <-chan struct{}) error {
+	ticker := time.NewTicker(fireInterval)
+	defer ticker.Stop()
+
+	for range maxShots {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+		err := errors.Join(
+			shooter.send(protocol.EncodeShotMessage()),
+			shooter.send(protocol.EncodeHit(targetId, protocol.Handgun, 1, 1, time.Duration(shooter.seenAt.Load()))),
+		)
+		if err != nil {
+			return fmt.Errorf("%s could not shoot: %w", shooter.name, err)
+		}
+	}
+	return nil
+}
+
+func TestEndToEnd(t *testing.T) {
+	if testing.Short() {
+		t.Skip("plays whole rounds")
+	}
+	address := startTestServer(t, 2)
+
+	var alpha, bravo *testClient
+	defer func() {
+		for _, player := range []*testClient{alpha, bravo} {
+			if player != nil {
+				player.leave()
+			}
+		}
+	}()
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"players join the slots they ask for", func() (err error) {
+			if alpha, err = join(address, "match", 0, "alpha"); err != nil {
+				return err
+			}
+			if bravo, err = join(address, "match", 3, "bravo"); err != nil {
+				return err
+			}
+			if alpha.admission.Id != 0 || alpha.admission.Team != protocol.A || bravo.admission.Id != 3 || bravo.admission.Team != protocol.B {
+				return fmt.Errorf("Admitted as %+v and %+v", alpha.admission, bravo.admission)
+			}
+			return nil
+		}},
+
+		{"the match starts once the lobby is full", func() error {
+			for _, player := range []*testClient{alpha, bravo} {
+				if _, err := player.expect(protocol.NextRoundHeader, protocol.PlayHeader); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+
+		{"killing the last enemy wins the round", func() (err error) {
+			// the shooting is over before the step is, so nothing is sent
+			// on a connection a later step closes
+			stop, fired := make(chan struct{}), make(chan error, 1)
+			go func() {
+				fired <- fire(alpha, bravo.admission.Id, stop)
+			}()
+			defer func() {
+				close(stop)
+				if fireErr := <-fired; err == nil {
+					err = fireErr
+				}
+			}()
+
+			// the shooter is told each hit landed
+			messages, err := alpha.expect(protocol.HitConfirmHeader)
+			if err != nil {
+				return err
+			}
+			confirmation, err := protocol.DecodeHitConfirm(messages[0])
+			if err != nil {
+				return err
+			}
+			if !confirmation.Accepted || confirmation.PlayerId != bravo.admission.Id || !confirmation.Headshot || confirmation.Damage < 1 {
+				return fmt.Errorf("%s's hit was confirmed as %+v", alpha.name, confirmation)
+			}
+
+			for _, player := range []*testClient{alpha, bravo} {
+				messages, err := player.expect(protocol.KilledHeader, protocol.TeamPointHeader, protocol.NextRoundHeader)
+				if err != nil {
+					return err
+				}
+				killerId, killedId, weapon, headshot, _, err := protocol.DecodeKilled(messages[0])
+				if err != nil {
+					return err
+				}
+				if killerId != alpha.admission.Id || killedId != bravo.admission.Id || weapon != protocol.Handgun.Weapon() || !headshot {
+					return fmt.Errorf("%s was told %d killed %d with %s", player.name, killerId, killedId, weapon)
+				}
+				if team, err := protocol.DecodeTeamPoint(messages[1]); err != nil || team != protocol.A {
+					return fmt.Errorf("%s was told the point went to team %d, %v", player.name, team, err)
+				}
+			}
+			return nil
+		}},
+
+		{"a player who drops out can resume the match", func() (err error) {
+			token := bravo.admission.Token
+			bravo.leave()
+			if bravo, err = rejoin(address, "match", 3, token, "bravo"); err != nil {
+				return err
+			}
+			messages, err := bravo.expect(protocol.ResumeHeader)
+			if err != nil {
+				return err
+			}
+			state, err := protocol.DecodeResume(messages[0])
+			if err != nil {
+				return err
+			}
+			if state.Round != 2 || state.TeamAPoints != 1 || state.TeamBPoints != 0 {
+				return fmt.Errorf("Resumed in round %d at %d:%d", state.Round, state.TeamAPoints, state.TeamBPoints)
+			}
+			return nil
+		}},
+
+		{"a player leaving before the match is broadcast", func() error {
+			observer, err := join(address, "waiting", protocol.ObserverId, "observer")
+			if err != nil {
+				return err
+			}
+			defer observer.leave()
+			charlie, err := join(address, "waiting", protocol.AnyId, "charlie")
+			if err != nil {
+				return err
+			}
+			charlie.leave()
+			messages, err := observer.expect(protocol.PlayerDisconnectHeader)
+			if err != nil {
+				return err
+			}
+			if id, err := protocol.DecodePlayerDisconnect(messages[0]); err != nil || id != charlie.admission.Id {
+				return fmt.Errorf("Told %d left instead of %d, %v", id, charlie.admission.Id, err)
+			}
+			return nil
+		}},
+	}
+
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// economy
+//////// players earn money from kills and rounds, and spend it on items while
+//////// waiting for a round to start
+
+func (player *player) inventory() protocol.Inventory {
+	return protocol.Inventory{
+		Money:    player.money,
+		Primary:  player.primary,
+		Armor:    player.armor,
+		Grenades: player.grenades,
+	}
+}
+
+func (player *player) earn(amount int) {
+	player.money = min(player.money+amount, protocol.MaxMoney)
+}
+
+// a player who dies loses everything they bought, but not their money
+func (player *player) loseInventory() {
+	player.primary = protocol.NoPrimary
+	player.armor = 0
+	player.grenades = [protocol.GrenadeKinds]int{}
+}
+
+// tell a player what they have, the lobby's mutex must be held
+func (lobby *lobby) sendInventory(player *player) {
+	if !player.isConnected() {
+		return
+	}
+	if err := writeMessage(player.conn, protocol.EncodeInventory(player.inventory())); err != nil {
+		lobby.logger.Warn("Could not send message", "player", player.id, "header", protocol.InventoryHeader, "error", err)
+	}
+}
+
+// pay every player for the round that just ended, the winners more than the
+// losers, the lobby's mutex must be held
+func (lobby *lobby) payRound(winningTeam protocol.Team, won bool) {
+	for i := range lobby.players {
+		player := &lobby.players[i]
+		if player.isEmpty() {
+			continue
+		}
+		if won && player.Team == winningTeam {
+			player.earn(protocol.RoundWinReward)
+		} else {
+			player.earn(protocol.RoundLossReward)
+		}
+		lobby.sendInventory(player)
+	}
+}
+
+// spend a player's money on an item, which can only be done between rounds
+func (lobby *lobby) buy(id int, item protocol.Item) error {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	player := &lobby.players[id]
+	if !lobby.started || lobby.inPlay || lobby.matchOver {
+		return errors.New("Items can only be bought before a round starts")
+	}
+	if player.money < protocol.Prices[item] {
+		return errors.New("Not enough money")
+	}
+
+	if kind, ok := item.GrenadeKind(); ok {
+		if protocol.MaxGrenades[kind] <= player.grenades[kind] {
+			return errors.New("Cannot carry any more grenades of that kind")
+		}
+		player.grenades[kind]++
+	} else if item == protocol.Armor {
+		if protocol.MaxArmor <= player.armor {
+			return errors.New("Armor is already full")
+		}
+		player.armor = protocol.MaxArmor
+	} else {
+		if player.primary == item {
+			return errors.New("Already has that gun")
+		}
+		player.primary = item
+	}
+	player.money -= protocol.Prices[item]
+	lobby.sendInventory(player)
+	return nil
+}
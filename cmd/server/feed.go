@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+//////// overlay feed
+//////// /api/feed is a stream of server-sent events for a lobby's match, so a
+//////// browser source can keep a live overlay without polling: a "state"
+//////// event, the same JSON as /api/state, whenever the score, health or
+//////// anything else in it changes, and every event of the match timeline
+//////// as it happens, named by its kind, such as "kill" for the kill feed
+
+// how often the state is checked for changes
+const feedStateInterval = 250 * time.Millisecond
+
+// events an overlay has not been sent yet, any more are dropped for it
+const feedQueueSize = 32
+
+func (server *server) serveFeed(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("lobby")
+	if name == "" {
+		name = defaultLobbyName
+	}
+
+	server.mutex.Lock()
+	lobby, ok := server.lobbies[name]
+	server.mutex.Unlock()
+	if !ok {
+		http.Error(w, "No match is being played in that lobby", http.StatusNotFound)
+		return
+	}
+
+	events := make(chan matchEvent, feedQueueSize)
+	lobby.mutex.Lock()
+	lobby.feeds[events] = struct{}{}
+	lobby.mutex.Unlock()
+	defer func() {
+		lobby.mutex.Lock()
+		delete(lobby.feeds, events)
+		lobby.mutex.Unlock()
+	}()
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	controller := http.NewResponseController(w)
+	send := func(kind string, value any) error {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", kind, data); err != nil {
+			return err
+		}
+		return controller.Flush()
+	}
+
+	ticker := time.NewTicker(feedStateInterval)
+	defer ticker.Stop()
+
+	var lastState []byte
+	for {
+		state, err := json.Marshal(lobby.status())
+		if err == nil && !bytes.Equal(state, lastState) {
+			err = send("state", json.RawMessage(state))
+			lastState = state
+		}
+		if err != nil {
+			lobby.logger.Debug("Overlay feed closed", "error", err)
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-lobby.done:
+			return
+		case event := <-events:
+			err = send(event.Kind, event)
+		case <-ticker.C:
+		}
+		if err != nil {
+			lobby.logger.Debug("Overlay feed closed", "error", err)
+			return
+		}
+	}
+}
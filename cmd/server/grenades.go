@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"time"
+
+	"github.com/lezhou8/shooter/internal/grenade"
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// grenades
+//////// the server follows every grenade until it goes off, letting clients
+//////// know each time it bounces so they stay in step
+
+type thrownGrenade struct {
+	grenade.Grenade
+	kind         protocol.GrenadeKind
+	throwerId    int
+	throwerToken []byte // of whoever had the thrower's slot, see thrownBy
+	protocol.Team
+	round   int  // the grenade is a dud if the round ends before it goes off
+	wentOff bool // guarded by the lobby's mutex
+}
+
+// a smoke cloud that hides whatever is behind it until it clears
+type smokeCloud struct {
+	position maps.Vector3
+	at       time.Time
+}
+
+// throw a grenade from the player's hand in the direction they sent
+func (lobby *lobby) throwGrenade(throwerId int, kind protocol.GrenadeKind, dx, dy, dz int8) {
+	lobby.mutex.Lock()
+	thrower := &lobby.players[throwerId]
+	length := math.Sqrt(float64(dx)*float64(dx) + float64(dy)*float64(dy) + float64(dz)*float64(dz))
+	if !lobby.inPlay || !thrower.isAlive || thrower.grenades[kind] < 1 || length == 0 {
+		lobby.mutex.Unlock()
+		return
+	}
+	thrower.grenades[kind]--
+
+	speed := grenade.ThrowSpeed / float32(length)
+	feet := unscaleLocation(thrower.x, thrower.y, thrower.z)
+	thrown := &thrownGrenade{
+		Grenade: grenade.Grenade{
+			Id:       lobby.nextGrenadeId,
+			Position: maps.Vector3{feet[0], feet[1] + grenade.ThrowHeight, feet[2]},
+			Velocity: maps.Vector3{float32(dx) * speed, float32(dy) * speed, float32(dz) * speed},
+		},
+		kind:         kind,
+		throwerId:    throwerId,
+		throwerToken: thrower.token,
+		Team:         thrower.Team,
+		round:        lobby.round,
+	}
+	lobby.nextGrenadeId++
+	message := protocol.EncodeGrenadeThrow(throwerId, kind, thrown.State())
+	lobby.mutex.Unlock()
+
+	lobby.broadcastByteMessage(message)
+	lobby.runGrenade(thrown)
+}
+
+// step the grenade through the air until its fuse runs out
+func (lobby *lobby) runGrenade(thrown *thrownGrenade) {
+	lobby.clock.afterFunc(grenade.Fuse, func() {
+		select {
+		case <-lobby.done:
+			return
+		default:
+		}
+		lobby.mutex.Lock()
+		thrown.wentOff = true
+		lobby.mutex.Unlock()
+
+		switch thrown.kind {
+		case protocol.Frag:
+			lobby.explode(thrown)
+		case protocol.Smoke:
+			lobby.smoke(thrown)
+		case protocol.Flash:
+			lobby.flash(thrown)
+		}
+	})
+
+	lobby.every(time.Second/grenade.TickRate, func() bool {
+		lobby.mutex.Lock()
+		if thrown.wentOff || lobby.round != thrown.round || !lobby.inPlay {
+			lobby.mutex.Unlock()
+			return false
+		}
+		bounced := thrown.Step(lobby.solidBlocks())
+		state := thrown.State()
+		lobby.mutex.Unlock()
+
+		if bounced {
+			lobby.broadcastByteMessage(protocol.EncodeGrenadeBounce(state))
+		}
+		return true
+	})
+}
+
+// set the grenade off, hurting every enemy in range that is not behind cover
+func (lobby *lobby) explode(thrown *thrownGrenade) {
+	lobby.mutex.Lock()
+	if lobby.round != thrown.round || !lobby.inPlay {
+		lobby.mutex.Unlock()
+		return
+	}
+	// a grenade whose thrower has left still goes off, but hurts nobody, as
+	// there is nobody left to credit
+	damages := make(map[int]int)
+	for _, player := range lobby.players {
+		if !lobby.thrownBy(thrown) || player.isEmpty() || !player.isAlive || player.Team == thrown.Team {
+			continue
+		}
+		chest := player.chest()
+		damage := grenade.Damage(distance(thrown.Position, chest))
+		if damage > 0 && lobby.lineOfSight(thrown.Position, chest) {
+			damages[player.id] = damage
+		}
+	}
+	state := thrown.State()
+	lobby.mutex.Unlock()
+
+	lobby.broadcastByteMessage(protocol.EncodeExplosion(state.Id, state.X, state.Y, state.Z))
+	for id, damage := range damages {
+		lobby.hit(thrown.throwerId, id, damage, protocol.FragWeapon, false)
+	}
+}
+
+// whether the grenade's thrower still has the slot it was thrown from, rather
+// than someone who has taken it since, the lobby's mutex must be held
+func (lobby *lobby) thrownBy(thrown *thrownGrenade) bool {
+	thrower := lobby.players[thrown.throwerId]
+	return !thrower.isEmpty() && bytes.Equal(thrower.token, thrown.throwerToken)
+}
+
+// start a smoke cloud where the grenade came to rest
+func (lobby *lobby) smoke(thrown *thrownGrenade) {
+	lobby.mutex.Lock()
+	if lobby.round != thrown.round || !lobby.inPlay {
+		lobby.mutex.Unlock()
+		return
+	}
+	lobby.smokes = append(lobby.smokes, smokeCloud{position: thrown.Position, at: lobby.clock.now()})
+	state := thrown.State()
+	lobby.mutex.Unlock()
+
+	lobby.broadcastByteMessage(protocol.EncodeSmoke(state.Id, state.X, state.Y, state.Z))
+}
+
+// a flashbang hurts nobody, clients blind themselves if they were looking
+func (lobby *lobby) flash(thrown *thrownGrenade) {
+	lobby.mutex.Lock()
+	if lobby.round != thrown.round || !lobby.inPlay {
+		lobby.mutex.Unlock()
+		return
+	}
+	state := thrown.State()
+	lobby.mutex.Unlock()
+
+	lobby.broadcastByteMessage(protocol.EncodeFlash(state.Id, state.X, state.Y, state.Z))
+}
+
+// whether one point can be seen from another, with neither a block nor a
+// smoke cloud in the way, the lobby's mutex must be held
+func (lobby *lobby) canSee(from, to maps.Vector3) bool {
+	// clouds that have cleared are forgotten
+	for len(lobby.smokes) > 0 && lobby.clock.now().Sub(lobby.smokes[0].at) >= grenade.SmokeDuration {
+		lobby.smokes = lobby.smokes[1:]
+	}
+	for _, smoke := range lobby.smokes {
+		if grenade.SmokeBlocks(smoke.position, grenade.SmokeCloudRadius(lobby.clock.now().Sub(smoke.at)), from, to) {
+			return false
+		}
+	}
+	return lobby.lineOfSight(from, to)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// guns
+//////// clients only say who they hit, the server decides how much it hurt,
+//////// which falls off with the distance the shot travelled
+
+type gunStats struct {
+	damage      float32 // of each pellet, up close
+	falloffFrom float32 // the distance damage starts to fall off from
+	falloffTo   float32 // the distance from which damage stops falling off
+	leastDamage float32 // fraction of the damage left from falloffTo on
+	headshot    float32 // how many times the damage a pellet to the head does
+	pellets     int     // the most pellets one shot can land
+}
+
+var guns = [protocol.Guns]gunStats{
+	protocol.Handgun:               {damage: 1, falloffFrom: 8, falloffTo: 25, leastDamage: 0.5, headshot: 2, pellets: 1},
+	protocol.Gun(protocol.Sniper):  {damage: 3, falloffFrom: 30, falloffTo: 40, leastDamage: 0.9, headshot: 2, pellets: 1},
+	protocol.Gun(protocol.Shotgun): {damage: 1, falloffFrom: 3, falloffTo: 12, leastDamage: 0.15, headshot: 1.5, pellets: 8},
+	protocol.Gun(protocol.SMG):     {damage: 1, falloffFrom: 6, falloffTo: 20, leastDamage: 0.4, headshot: 1.5, pellets: 1},
+	protocol.Gun(protocol.Rifle):   {damage: 2, falloffFrom: 12, falloffTo: 30, leastDamage: 0.6, headshot: 1.75, pellets: 1},
+}
+
+// damage of each pellet after travelling some distance, falling in a straight
+// line between the two falloff distances
+func (stats gunStats) damageAt(distance float32) float32 {
+	fraction := (distance - stats.falloffFrom) / (stats.falloffTo - stats.falloffFrom)
+	fraction = min(max(fraction, 0), 1)
+	return stats.damage * (1 - fraction*(1-stats.leastDamage))
+}
+
+// how much the hit player is hurt by some pellets of a shot, some of them to
+// the head, health only comes in whole points so any fraction left over is
+// dealt by chance, which keeps weak hits adding up to the right damage on
+// average
+func (lobby *lobby) shotDamage(shooterId, hitPlayerId int, gun protocol.Gun, pellets, headshots int) int {
+	lobby.mutex.Lock()
+	shooter := lobby.players[shooterId]
+	hitPlayer := lobby.players[hitPlayerId]
+	lobby.mutex.Unlock()
+
+	// nobody can shoot a primary gun they do not have
+	if gun != protocol.Handgun && shooter.primary.Gun() != gun {
+		return 0
+	}
+
+	stats := guns[gun]
+	distance := distance(unscaleLocation(shooter.x, shooter.y, shooter.z), unscaleLocation(hitPlayer.x, hitPlayer.y, hitPlayer.z))
+	pellets = min(pellets, stats.pellets)
+	headshots = min(headshots, pellets)
+	damage := (float32(pellets-headshots) + float32(headshots)*stats.headshot) * stats.damageAt(distance)
+	whole, fraction := math.Modf(float64(damage))
+	if lobby.random.Float64() < fraction {
+		whole++
+	}
+	return int(whole)
+}
+
+// a shot was fired, for the shooter's accuracy
+func (lobby *lobby) countShot(shooterId int) {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+	if !lobby.warmup {
+		lobby.players[shooterId].shotsFired++
+	}
+}
+
+// a shot landed, hurting the hit player by however much it does from there,
+// reporting what came of it for the shooter
+func (lobby *lobby) shoot(shooterId, hitPlayerId int, gun protocol.Gun, pellets, headshots int) protocol.HitConfirmation {
+	lobby.mutex.Lock()
+	hitPlayer := lobby.players[hitPlayerId]
+	if !lobby.warmup && !hitPlayer.isEmpty() && hitPlayer.isAlive && hitPlayer.Team != lobby.players[shooterId].Team {
+		lobby.players[shooterId].shotsHit++
+	}
+	lobby.mutex.Unlock()
+
+	confirmation := protocol.HitConfirmation{PlayerId: hitPlayerId, Headshot: headshots > 0}
+	if confirmation.Damage = lobby.shotDamage(shooterId, hitPlayerId, gun, pellets, headshots); confirmation.Damage > 0 {
+		confirmation.Health, confirmation.Accepted = lobby.hit(shooterId, hitPlayerId, confirmation.Damage, gun.Weapon(), headshots > 0)
+	}
+	return confirmation
+}
+
+// tell the shooter what came of a hit they sent, a hit that did not land
+// still says how much health the player has left
+func (lobby *lobby) confirmHit(shooterId int, confirmation protocol.HitConfirmation) {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	if !confirmation.Accepted {
+		confirmation.Damage = 0
+		if hitPlayer := lobby.players[confirmation.PlayerId]; hitPlayer.isAlive {
+			confirmation.Health = hitPlayer.health
+		}
+	}
+	shooter := lobby.players[shooterId]
+	if !shooter.isConnected() {
+		return
+	}
+	if err := writeMessage(shooter.conn, protocol.EncodeHitConfirm(confirmation)); err != nil {
+		lobby.logger.Warn("Could not send message", "player", shooterId, "header", protocol.HitConfirmHeader, "error", err)
+	}
+}
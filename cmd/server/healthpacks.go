@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// health packs
+//////// the first player to touch a health pack gets it, and it comes back a
+//////// while later
+
+const (
+	healthPackHeal        = 1
+	healthPackRespawnTime = 20 * time.Second
+	healthPackReach       = 1 // how close a player's feet have to get
+)
+
+// let the player have a health pack they are touching, returning the message
+// to broadcast, or nil if they did not get one, the lobby's mutex must be held
+func (lobby *lobby) pickUpHealthPack(player *player) []byte {
+	// a player on full health leaves it for someone who needs it
+	if !lobby.inPlay || !player.isAlive || protocol.MaxHealth <= player.health {
+		return nil
+	}
+
+	feet := unscaleLocation(player.x, player.y, player.z)
+	for pack, position := range lobby.config.maps[lobby.mapIndex].HealthPacks {
+		if lobby.takenHealthPacks[pack] || horizontalDistance(feet, position) > healthPackReach || math.Abs(float64(feet[1]-position[1])) > healthPackReach {
+			continue
+		}
+
+		lobby.takenHealthPacks[pack] = true
+		healed := min(healthPackHeal, protocol.MaxHealth-player.health)
+		player.health += healed
+		lobby.sendTeammateHealth(player)
+		round := lobby.round
+		lobby.clock.afterFunc(healthPackRespawnTime, func() {
+			lobby.respawnHealthPack(pack, round)
+		})
+		lobby.logger.Debug("Health pack taken", "player", player.id, "pack", pack)
+		return protocol.EncodeHealthPackTaken(pack, player.id, healed)
+	}
+	return nil
+}
+
+// put a health pack back, unless the round it was taken in is over, as every
+// health pack is put back for the next round anyway
+func (lobby *lobby) respawnHealthPack(pack, round int) {
+	lobby.mutex.Lock()
+	if lobby.round != round || len(lobby.takenHealthPacks) <= pack {
+		lobby.mutex.Unlock()
+		return
+	}
+	lobby.takenHealthPacks[pack] = false
+	message := protocol.EncodeHealthPacks(lobby.takenHealthPackList())
+	lobby.mutex.Unlock()
+
+	lobby.broadcastByteMessage(message)
+}
+
+// the lobby's mutex must be held
+func (lobby *lobby) takenHealthPackList() []int {
+	var taken []int
+	for pack, isTaken := range lobby.takenHealthPacks {
+		if isTaken {
+			taken = append(taken, pack)
+		}
+	}
+	return taken
+}
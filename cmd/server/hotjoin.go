@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// hot joining
+//////// with -hot-join, someone joining a match that is underway takes a free
+//////// slot straight away instead of spectating it; they sit out the round
+//////// being played in limbo, dead and left out of everyone's locations, and
+//////// are spawned with everyone else at the start of the next one
+
+// whether someone joining now can take a slot mid-match, the lobby's mutex
+// must be held
+func (lobby *lobby) canHotJoin() bool {
+	return lobby.config.hotJoin && !lobby.matchOver && lobby.currentNumPlayers < lobby.config.numPlayers
+}
+
+// put the player who has just taken a slot mid-match in limbo, and catch
+// them up on the match, the lobby's mutex must be held
+func (lobby *lobby) hotJoin(id int) error {
+	player := &lobby.players[id]
+	player.limbo = true
+	lobby.spawn(id)
+
+	// sent under the lock so no broadcast can sneak in before the match state
+	err := player.conn.WriteMessage(websocket.BinaryMessage, protocol.EncodeResponse(protocol.Success, lobby.admission(player)))
+	if err == nil {
+		err = lobby.catchUp(id)
+	}
+	return err
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+// a player who hot-joined sits out the round in limbo, so nothing they shoot
+// can land until the next one
+func TestLimboHitRefused(t *testing.T) {
+	lobby := newLobby("test", &config{numPlayers: 2, teamSize: 1}, nil)
+	defer lobby.cleanUp()
+	lobby.round, lobby.inPlay = 1, true
+	lobby.players[0] = *newBotPlayer(0, protocol.A, lobby.config.botDifficulty)
+	lobby.players[0].limbo = true
+	lobby.players[1] = *newBotPlayer(1, protocol.B, lobby.config.botDifficulty)
+	lobby.players[1].health, lobby.players[1].isAlive = protocol.MaxHealth, true
+
+	hit := protocol.HitRequest{PlayerId: 1, Gun: protocol.Handgun, Pellets: 1, SeenAt: lobby.serverTime()}
+	lobby.handleRequest(0, hit, lobby.logger)
+	if health := lobby.players[1].health; health != protocol.MaxHealth {
+		t.Fatalf("Hit from limbo landed, leaving %d health", health)
+	}
+
+	// once spawned for the next round the same hit lands
+	lobby.players[0].limbo, lobby.players[0].isAlive = false, true
+	lobby.handleRequest(0, hit, lobby.logger)
+	if health := lobby.players[1].health; health != protocol.MaxHealth-1 {
+		t.Fatalf("Hit from a living player left %d health", health)
+	}
+}
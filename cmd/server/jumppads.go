@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// jump pads and teleporters
+//////// clients launch themselves off jump pads, and the server lets them
+//////// move as fast as the pad throws them for a while; teleporters are only
+//////// ever used by the server, which moves the player and corrects their
+//////// client like it would after a refused move
+
+const launchTime = 3 * time.Second // longer than any jump pad keeps a player in the air
+
+// launch a player who has just stepped onto a jump pad, or move one who has
+// just stepped into a teleporter to where it leads, returning the message to
+// broadcast, or nil if neither happened, and whether the player was moved,
+// the lobby's mutex must be held
+func (lobby *lobby) stepInto(player *player, from maps.Vector3) ([]byte, bool) {
+	if !lobby.playing() || !player.isAlive || player.limbo {
+		return nil, false
+	}
+
+	gameMap := lobby.config.maps[lobby.mapIndex]
+	feet := unscaleLocation(player.x, player.y, player.z)
+	for pad, jumpPad := range gameMap.JumpPads {
+		if jumpPad.Contains(feet) && !jumpPad.Contains(from) {
+			player.launchedUntil = time.Now().Add(launchTime)
+			player.launchSpeed = float32(math.Hypot(float64(jumpPad.Launch[0]), float64(jumpPad.Launch[2])))
+			return protocol.EncodeLaunch(player.id, pad), false
+		}
+	}
+	for i, teleporter := range gameMap.Teleporters {
+		if teleporter.Contains(feet) && !teleporter.Contains(from) {
+			player.x = protocol.Float32ScaleToInt8(teleporter.To[0])
+			player.y = protocol.Float32ScaleToInt8(teleporter.To[1])
+			player.z = protocol.Float32ScaleToInt8(teleporter.To[2])
+			player.ground(time.Now())
+			lobby.logger.Debug("Player teleported", "player", player.id, "teleporter", i)
+			return protocol.EncodeTeleport(player.id, i), true
+		}
+	}
+	return nil, false
+}
+
+// how fast a player can move across, faster for a while after a jump pad
+// throws them
+func (player *player) runSpeed(now time.Time) float32 {
+	if now.Before(player.launchedUntil) {
+		return max(maxRunSpeed, player.launchSpeed)
+	}
+	return maxRunSpeed
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// leaderboard
+//////// results of finished matches are appended to a file, one JSON object
+//////// per line, and added up per player name across every match
+
+type matchResult struct {
+	Time        time.Time      `json:"time"`
+	Lobby       string         `json:"lobby"`
+	TeamAPoints int            `json:"team_a_points"`
+	TeamBPoints int            `json:"team_b_points"`
+	Players     []playerResult `json:"players"`
+}
+
+type playerResult struct {
+	Name        string         `json:"name"`
+	Team        string         `json:"team"`
+	Kills       int            `json:"kills"`
+	WeaponKills map[string]int `json:"weapon_kills,omitempty"` // by the name of the weapon
+	Deaths      int            `json:"deaths"`
+	Won         bool           `json:"won"`
+}
+
+type leaderboardEntry struct {
+	Name    string  `json:"name"`
+	Matches int     `json:"matches"`
+	Wins    int     `json:"wins"`
+	WinRate float64 `json:"win_rate"`
+	Kills   int     `json:"kills"`
+	Deaths  int     `json:"deaths"`
+}
+
+type leaderboard struct {
+	path    string // empty to keep results only while the server runs
+	entries map[string]*leaderboardEntry
+	mutex   sync.Mutex
+}
+
+// read back every result recorded so far, a missing file is an empty leaderboard
+func loadLeaderboard(path string) (*leaderboard, error) {
+	leaderboard := &leaderboard{path: path, entries: make(map[string]*leaderboardEntry)}
+	if path == "" {
+		return leaderboard, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return leaderboard, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var result matchResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		leaderboard.add(&result)
+	}
+	return leaderboard, scanner.Err()
+}
+
+// keep a finished match's result, counting it towards the leaderboard
+func (leaderboard *leaderboard) record(result *matchResult) error {
+	leaderboard.mutex.Lock()
+	defer leaderboard.mutex.Unlock()
+
+	leaderboard.add(result)
+	if leaderboard.path == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(leaderboard.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (leaderboard *leaderboard) add(result *matchResult) {
+	for _, player := range result.Players {
+		entry, ok := leaderboard.entries[player.Name]
+		if !ok {
+			entry = &leaderboardEntry{Name: player.Name}
+			leaderboard.entries[player.Name] = entry
+		}
+		entry.Matches++
+		if player.Won {
+			entry.Wins++
+		}
+		entry.WinRate = float64(entry.Wins) / float64(entry.Matches)
+		entry.Kills += player.Kills
+		entry.Deaths += player.Deaths
+	}
+}
+
+// best players first: most wins, then best win rate, then most kills
+func (leaderboard *leaderboard) ranking() []leaderboardEntry {
+	leaderboard.mutex.Lock()
+	defer leaderboard.mutex.Unlock()
+
+	ranking := make([]leaderboardEntry, 0, len(leaderboard.entries))
+	for _, entry := range leaderboard.entries {
+		ranking = append(ranking, *entry)
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		a, b := ranking[i], ranking[j]
+		switch {
+		case a.Wins != b.Wins:
+			return a.Wins > b.Wins
+		case a.WinRate != b.WinRate:
+			return a.WinRate > b.WinRate
+		case a.Kills != b.Kills:
+			return a.Kills > b.Kills
+		}
+		return a.Name < b.Name
+	})
+	return ranking
+}
+
+func (leaderboard *leaderboard) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, leaderboard.ranking())
+}
+
+// the lobby's match as it stands, bots are left out as they have no standing
+// to keep, the lobby's mutex must be held
+func (lobby *lobby) result() *matchResult {
+	result := &matchResult{
+		Time:        time.Now().UTC(),
+		Lobby:       lobby.name,
+		TeamAPoints: lobby.teamAPoints,
+		TeamBPoints: lobby.teamBPoints,
+	}
+	for _, player := range lobby.players {
+		if player.isEmpty() || player.bot {
+			continue
+		}
+		team, won := "a", lobby.teamAPoints > lobby.teamBPoints
+		if player.Team == protocol.B {
+			team, won = "b", lobby.teamBPoints > lobby.teamAPoints
+		}
+		weaponKills := make(map[string]int)
+		for weapon, kills := range player.weaponKills {
+			if kills > 0 {
+				weaponKills[protocol.Weapon(weapon).String()] = kills
+			}
+		}
+		result.Players = append(result.Players, playerResult{
+			Name:        player.name,
+			Team:        team,
+			Kills:       player.killAmount,
+			WeaponKills: weaponKills,
+			Deaths:      player.deathAmount,
+			Won:         won,
+		})
+	}
+	return result
+}
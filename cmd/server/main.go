@@ -2,277 +2,1015 @@ package main
 
 import (
 	"bytes"
-	"encoding/binary"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/lezhou8/shooter/internal/listing"
+	"github.com/lezhou8/shooter/internal/logging"
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/navigation"
+	"github.com/lezhou8/shooter/internal/protocol"
 )
 
 var upgrader = websocket.Upgrader{}
 
+// how messages are sent once the handshake is over, set by -protocol
+var encoding = protocol.BinaryEncoding
+
+// send a message to a client in the encoding the server speaks
+func writeMessage(conn *websocket.Conn, message []byte) error {
+	data, text, err := encoding.Encode(message, true)
+	if err != nil {
+		return err
+	}
+	if text {
+		return conn.WriteMessage(websocket.TextMessage, data)
+	}
+	return conn.WriteMessage(websocket.BinaryMessage, data)
+}
+
 //////// server
+//////// hosts many lobbies at once, each one an independent match
 
 const (
-	maxPlayers     = 6
-	maxTeamPlayers = maxPlayers >> 1
+	defaultLobbyName   = "default"
+	maxLobbyNameLength = 32
 )
 
-type messageHeaders byte // TODO move this to an internal module, shared between the client and server
+// settings shared by every lobby
+type config struct {
+	numPlayers int // needed to start a match
+	teamSize   int // players on each team, a lobby has a slot for each of them
+	mapNames   []string
+	maps       []*maps.Map        // loaded maps, in the same order as their names
+	navGrids   []*navigation.Grid // laid out from each map for bots
+	mapRounds  int                // rounds played on each map, 0 never changes map
+	password   string             // empty if anyone may join
+	fillBots   bool
+	roundTime  time.Duration // 0 lets a round go on until a team is wiped out
+	timeoutWinner
+	tickRate        int           // locations exchanged per second
+	roundStartGrace time.Duration // from a round starting to it being played
+	roundEndGrace   time.Duration // from a round being won to the next one starting
+	datagrams       *net.UDPConn  // nil unless locations can be sent over UDP
+	simulate        bool          // lobbies run on a tick clock, see clock.go
+	seed            uint64        // of every lobby's random numbers, 0 for a random one
+	tvDelay         time.Duration // how far behind shooterTV is, 0 if matches are not relayed
+	reportDirectory string        // where match reports are written, empty to not write them
+	webhook         *webhook      // nil unless matches are posted to Discord
+	warmup          bool          // players can play while a lobby fills up, see warmup.go
+	promotion       bool          // those who join mid-match play once a slot is free, see spectators.go
+	hotJoin         bool          // those who join mid-match take a free slot straight away, see hotjoin.go
+	botDifficulty   botDifficulty // how well bots play when they are added, see difficulty.go
+}
+
+// who gets the point when a round runs out of time
+type timeoutWinner int
 
 const (
-	nextRoundHeader messageHeaders = iota
-	playerHeader
-	locationsHeader
-	shotHeader
-	killedHeader
-	teamPointHeader
-	loseHealthHeader
-	playerDisconnectHeader
+	majorityWins timeoutWinner = iota // the team with more players alive, nobody if it is level
+	teamAWins
+	teamBWins
 )
 
+func parseTimeoutWinner(name string) (timeoutWinner, error) {
+	switch name {
+	case "majority":
+		return majorityWins, nil
+	case "a":
+		return teamAWins, nil
+	case "b":
+		return teamBWins, nil
+	}
+	return 0, fmt.Errorf("Unknown timeout winner %q", name)
+}
+
 type server struct {
-	players           [maxPlayers]player
+	lobbies     map[string]*lobby
+	config      *config
+	leaderboard *leaderboard
+	mutex       sync.Mutex
+}
+
+func newServer(config *config, leaderboard *leaderboard) *server {
+	return &server{
+		lobbies:     make(map[string]*lobby),
+		config:      config,
+		leaderboard: leaderboard,
+	}
+}
+
+// find the requested lobby, creating it if it does not exist yet
+func (server *server) enterLobby(name string) *lobby {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	lobby, ok := server.lobbies[name]
+	if !ok {
+		lobby = newLobby(name, server.config, server.leaderboard)
+		server.lobbies[name] = lobby
+		go lobby.run()
+		lobby.logger.Info("Lobby created")
+	}
+	lobby.connections++
+	return lobby
+}
+
+// tear down the lobby once its last connection has left
+func (server *server) leaveLobby(lobby *lobby) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	lobby.connections--
+	if lobby.connections > 0 {
+		return
+	}
+
+	// a lobby whose match is over may already have been replaced
+	if server.lobbies[lobby.name] == lobby {
+		delete(server.lobbies, lobby.name)
+	}
+	lobby.cleanUp()
+	lobby.logger.Info("Lobby removed")
+}
+
+func (server *server) serveWs(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("lobby")
+	if name == "" {
+		name = defaultLobbyName
+	}
+	if len(name) > maxLobbyNameLength {
+		http.Error(w, "Lobby name is too long", http.StatusBadRequest)
+		return
+	}
+
+	// serving only returns once the player has left the lobby
+	lobby := server.enterLobby(name)
+	defer server.leaveLobby(lobby)
+	lobby.serveWs(w, r)
+}
+
+func (server *server) cleanUp() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	for name, lobby := range server.lobbies {
+		lobby.cleanUp()
+		delete(server.lobbies, name)
+	}
+}
+
+// end every match being played and send everyone away, for the server to stop
+func (server *server) shutdown() {
+	server.mutex.Lock()
+	lobbies := make([]*lobby, 0, len(server.lobbies))
+	for _, lobby := range server.lobbies {
+		lobbies = append(lobbies, lobby)
+	}
+	server.mutex.Unlock()
+
+	for _, lobby := range lobbies {
+		// players still waiting for a match have nothing to end
+		if err := lobby.endMatch(); err != nil {
+			lobby.disconnectAll()
+		}
+	}
+	server.cleanUp()
+}
+
+//////// lobby
+
+type lobby struct {
+	name              string
+	players           []player // a slot for each player on either team, team A's first
 	teamAPoints       int
 	teamBPoints       int
 	round             int
-	numPlayers        int
+	inPlay            bool
+	warmup            bool // players are warming up until the match starts
+	roundOver         bool
+	matchOver         bool
+	mapIndex          int
+	config            *config
 	currentNumPlayers int
 	mutex             sync.Mutex
 	broadcast         chan []byte
+	done              chan struct{}
+	closeOnce         sync.Once
+	connections       int // guarded by the server's mutex
+	logger            *slog.Logger
+	leaderboard       *leaderboard
+	started           bool // the first round has been set off
+	nextGrenadeId     byte
+	smokes            []smokeCloud // oldest first
+	takenHealthPacks  []bool       // indexed like the current map's health packs
+	openDoors         []bool       // indexed like the current map's doors
+	roundEnds         time.Time    // zero unless the round in play has a time limit
+	playsAt           time.Time    // zero unless the round started is waiting to be played
+	roundTimer        timer        // times out the round in play, nil if it has no time limit
+	botFill           timer        // nil unless bots are waiting to fill the lobby
+	observers         map[*websocket.Conn]struct{}
+	spectators        []spectator       // observers waiting to play, longest waiting first
+	locationSequence  protocol.Sequence // of the last locations sent over UDP
+	clock             clock
+	epoch             time.Time // on the clock, when the lobby was created
+	random            *random
+	relay             *relay                       // nil unless matches are relayed to shooterTV
+	events            []matchEvent                 // the match's timeline, only kept for match reports
+	feeds             map[chan matchEvent]struct{} // overlays following the match, see feed.go
+	vote              *vote                        // nil unless a vote is being held, see votes.go
+	mapVoted          bool                         // the map changes at the start of the next round
+	restartVoted      bool                         // the match starts over at the start of the next round
 }
 
-func newServer(numPlayers int) *server {
-	return &server{
-		numPlayers: numPlayers,
-		broadcast:  make(chan []byte),
+// broadcasts that can wait to be sent, those queued up together are batched
+const broadcastQueueSize = 16
+
+func newLobby(name string, config *config, leaderboard *leaderboard) *lobby {
+	lobby := &lobby{
+		name:        name,
+		config:      config,
+		leaderboard: leaderboard,
+		broadcast:   make(chan []byte, broadcastQueueSize),
+		done:        make(chan struct{}),
+		logger:      slog.With("lobby", name),
+		players:     make([]player, 2*config.teamSize),
+		observers:   make(map[*websocket.Conn]struct{}),
+		feeds:       make(map[chan matchEvent]struct{}),
+		clock:       wallClock{},
+		random:      newRandom(config.seed),
+		warmup:      config.warmup,
+	}
+	if config.simulate {
+		clock := newTickClock(simulationRate)
+		go clock.run(lobby.done)
+		lobby.clock = clock
+	}
+	lobby.epoch = lobby.clock.now()
+	if len(config.maps) > 0 {
+		lobby.resetDoors() // doors can be used in warmup, before the first round
 	}
+	if config.tvDelay > 0 {
+		lobby.relay = newRelay(config.tvDelay, lobby.clock.now(), lobby.currentMap())
+	}
+	return lobby
 }
 
-const locationUpdateFrequency = 12
-
 // broadcasting
-func (server *server) run() {
-	ticker := time.NewTicker(time.Second / locationUpdateFrequency)
+func (lobby *lobby) run() {
+	ticker := lobby.clock.newTicker(lobby.tickInterval())
 	defer ticker.Stop()
+	pingTicker := lobby.clock.newTicker(time.Second / protocol.PingFrequency)
+	defer pingTicker.Stop()
 
 	for {
 		select {
-		case broadcastMessage := <-server.broadcast:
-			server.mutex.Lock()
-			for _, player := range server.players {
-				if !player.isEmpty() {
-					if err := player.conn.WriteMessage(websocket.BinaryMessage, broadcastMessage); err != nil {
-						log.Println(err)
-					}
+		case <-lobby.done:
+			return
+
+		case broadcastMessage := <-lobby.broadcast:
+			// anything else already waiting, such as the team point after
+			// a kill, goes out in the same frame
+			messages := [][]byte{broadcastMessage}
+			for waiting := true; waiting; {
+				select {
+				case message := <-lobby.broadcast:
+					messages = append(messages, message)
+				default:
+					waiting = false
 				}
 			}
-			server.mutex.Unlock()
+			lobby.mutex.Lock()
+			for _, frame := range protocol.Batch(messages) {
+				lobby.sendToAll(frame)
+			}
+			lobby.mutex.Unlock()
 
-		case <-ticker.C:
-			// don't worry about locations before the game starts
-			if server.round == 0 {
+		case <-ticker.channel():
+			// don't worry about locations before the game starts, unless
+			// players are warming up
+			if lobby.round == 0 && !lobby.warmup {
 				break
 			}
 
 			// broadcast player locations
-			locationsMessage := server.serialiseLocations()
-			server.mutex.Lock()
-			for _, player := range server.players {
-				if !player.isEmpty() {
-					if err := player.conn.WriteMessage(websocket.BinaryMessage, locationsMessage); err != nil {
-						log.Println(err)
-					}
-				}
-			}
-			server.mutex.Unlock()
+			locationsMessage := lobby.serialiseLocations()
+			lobby.mutex.Lock()
+			lobby.sendLocations(locationsMessage)
+			lobby.mutex.Unlock()
+
+		case <-pingTicker.channel():
+			// pass on everyone's ping for the statistics board
+			lobby.mutex.Lock()
+			lobby.sendToAll(lobby.serialisePings())
+			lobby.mutex.Unlock()
 		}
 	}
 }
 
-type clientMessage byte
-
-const (
-	hitMessage clientMessage = iota
-	shotMessage
-	locationMessage
-)
-
-func (server *server) serveWs(w http.ResponseWriter, r *http.Request) {
-	// do not allow new connections if the lobby is full
-	if server.numPlayers <= server.currentNumPlayers {
-		http.Error(w, "Lobby is full", http.StatusForbidden)
-		return
-	}
-
-	// do not allow new connections during active game
-	if server.round > 0 {
-		http.Error(w, "Game is in progress", http.StatusForbidden)
-		return
-	}
-
+func (lobby *lobby) serveWs(w http.ResponseWriter, r *http.Request) {
 	// make websocket connection
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("server:", err)
+		lobby.logger.Warn("Could not upgrade connection", "error", err)
 		return
 	}
 
+	// a client that vanished without closing the connection times out
+	conn.SetReadDeadline(time.Now().Add(protocol.KeepaliveTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(protocol.KeepaliveTimeout))
+	})
+	stopKeepalive := make(chan struct{})
+	defer close(stopKeepalive)
+	go keepalive(conn, stopKeepalive)
+
 	// properly induct the player into the game
-	newPlayer, err := server.initialisePlayer(conn)
+	newPlayer, resumed, err := lobby.initialisePlayer(conn)
 	if err != nil {
-		log.Println(err)
+		lobby.logger.Info("Join refused", "error", err)
+		conn.Close()
+		return
+	}
+	if newPlayer.id == protocol.ObserverId {
+		lobby.logger.Info("Observer joined", "name", newPlayer.name)
+		lobby.observe(conn)
+		lobby.logger.Info("Observer left", "name", newPlayer.name)
 		return
 	}
+	logger := lobby.logger.With("player", newPlayer.id)
+	if resumed {
+		logger.Info("Player resumed")
+	} else {
+		logger.Info("Player joined", "name", newPlayer.name)
+	}
+	lobby.broadcastRoster()
+	if !resumed {
+		lobby.joinWarmup(newPlayer.id)
+	}
 
-	// go to next round if player quota reached
-	if server.currentNumPlayers == server.numPlayers {
-		server.nextRound()
+	// go to next round if player quota reached, otherwise bots may make up
+	// the numbers if nobody else turns up
+	if !resumed && !lobby.startIfFull() && lobby.config.fillBots {
+		lobby.scheduleBotFill()
 	}
 
 	// communication loop
 	for {
-		_, message, err := conn.ReadMessage()
+		messageType, message, err := conn.ReadMessage()
 		if err != nil {
-			// graceful disconnect
-			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-				break
+			// anything other than a graceful disconnect is worth logging, but
+			// the connection is unusable either way
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.Warn("Connection lost", "error", err)
 			}
-			log.Println(err)
-			continue
+			break
 		}
 
 		// messaging errors
-		if len(message) == 0 {
-			log.Println("Empty message")
+		message, err = protocol.Decode(message, messageType == websocket.TextMessage, false)
+		if err != nil {
+			logger.Warn("Bad message", "error", err)
 			continue
 		}
+		request, err := protocol.ParseClientMessage(message)
+		if err == nil && !lobby.hasSlots(protocol.PlayerIds(request)) {
+			err = errors.New("Player id is not a slot in the lobby")
+		}
+		if err != nil {
+			logger.Warn("Bad message", "error", err)
+			continue
+		}
+		lobby.handleRequest(newPlayer.id, request, logger)
+	}
 
-		switch message[0] {
-		case byte(hitMessage):
-			if len(message) != 3 {
-				log.Println("Incorrect message size for hit message")
-				break
+	// handle disconnect of player, holding on to their slot for a while if
+	// the match is underway so that they can come back to it
+	if lobby.isInProgress() {
+		logger.Info("Holding slot for disconnected player")
+		if lobby.holdSlot(newPlayer.id) {
+			return
+		}
+	}
+	lobby.freeSlot(newPlayer.id)
+	logger.Info("Player left")
+}
+
+// act on a message from the player in a slot, parsed so that every id and
+// kind in it is in range
+func (lobby *lobby) handleRequest(id int, request any, logger *slog.Logger) {
+	switch request := request.(type) {
+	case protocol.HitRequest:
+		// only a living player can land a hit, and only while playing, not
+		// from limbo or before the round is played; the client only estimates
+		// the server's clock, but no estimate puts what it saw this far ahead
+		// of now
+		confirmation := protocol.HitConfirmation{PlayerId: request.PlayerId}
+		lobby.mutex.Lock()
+		shooter := lobby.players[id]
+		canShoot := lobby.playing() && shooter.isAlive && !shooter.limbo
+		lobby.mutex.Unlock()
+		switch lag := lobby.serverTime() - request.SeenAt; {
+		case !canShoot:
+			logger.Debug("Hit from a player who cannot shoot refused", "target", request.PlayerId)
+		case lag < -maxClockSkew:
+			logger.Debug("Hit from the future refused", "lag", lag)
+		default:
+			logger.Debug("Hit", "target", request.PlayerId, "lag", lag)
+			confirmation = lobby.shoot(id, request.PlayerId, request.Gun, request.Pellets, request.Headshots)
+		}
+		lobby.confirmHit(id, confirmation)
+
+	case protocol.ShotRequest:
+		// just broadcast shot, so each client can play a gunshot from
+		// where it was fired
+		lobby.countShot(id)
+		lobby.mutex.Lock()
+		shooter := lobby.players[id]
+		lobby.mutex.Unlock()
+		lobby.broadcastByteMessage(protocol.EncodeShot(id, shooter.x, shooter.y, shooter.z))
+
+	case protocol.ActionRequest:
+		// pass it on so everyone else can see it, as long as the player
+		// could be doing it
+		lobby.mutex.Lock()
+		canAct := lobby.playing() && lobby.players[id].isAlive
+		lobby.mutex.Unlock()
+		if canAct {
+			lobby.broadcastByteMessage(protocol.EncodeAction(id, request.Action, request.Gun))
+		}
+
+	case protocol.Move:
+		// tell the client where it really is if the move was refused
+		lobby.mutex.Lock()
+		player := &lobby.players[id]
+		player.crouching = request.Crouching
+		player.yaw, player.pitch = request.Yaw, request.Pitch
+		from := unscaleLocation(player.x, player.y, player.z)
+		var healthPackMessage, stepMessage []byte
+		switch {
+		case lobby.movePlayer(player, request.Dx, request.Dy, request.Dz):
+			healthPackMessage = lobby.pickUpHealthPack(player)
+			var teleported bool
+			if stepMessage, teleported = lobby.stepInto(player, from); teleported {
+				if err := writeMessage(player.conn, protocol.EncodeCorrection(request.Sequence, player.x, player.y, player.z)); err != nil {
+					logger.Warn("Could not send message", "header", protocol.CorrectionHeader, "error", err)
+				}
 			}
-			hitPlayerId := int(message[1])
-			damage := int(message[2])
-
-			// send to the specific player, that they got hit, detract health from them
-			server.mutex.Lock() // TODO make a function specifically for this
-			server.players[hitPlayerId].health -= damage
-			if err := server.players[hitPlayerId].conn.WriteMessage(websocket.BinaryMessage, []byte{byte(loseHealthHeader), byte(damage)}); err != nil {
-				log.Println(err)
+		case player.refuseMove(time.Now()):
+			logger.Warn("Too many moves refused, kicking player", "moves", player.refusedMoves)
+			if err := lobby.kickPlayer(player); err != nil {
+				logger.Warn("Could not kick player", "error", err)
 			}
-			server.mutex.Unlock()
-
-			// check if the hit player is still alive, otherwise, broadcast to lobby
-			if server.players[hitPlayerId].health < 1 {
-				server.mutex.Lock()
-				server.players[hitPlayerId].isAlive = false
-				server.mutex.Unlock()
-
-				// broadcast the kill
-				server.broadcastByteMessage([]byte{byte(killedHeader), byte(newPlayer.id), byte(hitPlayerId)}) // TODO make a function specifically for this
-
-				// if the whole team is dead then the round is done, the winning team gets a point
-				if server.players[hitPlayerId].team == a && server.isTeamAAllDead() {
-					server.broadcastByteMessage([]byte{byte(teamPointHeader), byte(b)})
-					time.AfterFunc(roundEndGraceTime*time.Second, server.nextRound)
-				} else if server.players[hitPlayerId].team == b && server.isTeamBAllDead() {
-					server.broadcastByteMessage([]byte{byte(teamPointHeader), byte(a)})
-					time.AfterFunc(roundEndGraceTime*time.Second, server.nextRound)
-				}
+		default:
+			logger.Debug("Move refused", "sequence", request.Sequence)
+			if err := writeMessage(player.conn, protocol.EncodeCorrection(request.Sequence, player.x, player.y, player.z)); err != nil {
+				logger.Warn("Could not send message", "header", protocol.CorrectionHeader, "error", err)
 			}
+		}
+		lobby.mutex.Unlock()
 
-		case byte(shotMessage):
-			// just broadcast shot, so each client can play a gunshot
-			server.broadcastByteMessage([]byte{byte(shotHeader), byte(newPlayer.id)}) // TODO make a function specifically for this
+		if healthPackMessage != nil {
+			lobby.broadcastByteMessage(healthPackMessage)
+		}
+		if stepMessage != nil {
+			lobby.broadcastByteMessage(stepMessage)
+		}
 
-		case byte(locationMessage):
-			if len(message) != 4 {
-				log.Println("Incorrect message size for location message")
-				break
+	case protocol.PingRequest:
+		// answer straight away so the client can time the round trip
+		lobby.mutex.Lock()
+		player := &lobby.players[id]
+		player.ping = request.LastPing
+		if err := writeMessage(player.conn, protocol.EncodePong(request.Number, lobby.serverTime())); err != nil {
+			logger.Warn("Could not send message", "header", protocol.PongHeader, "error", err)
+		}
+		lobby.mutex.Unlock()
+
+	case protocol.ThrowRequest:
+		lobby.throwGrenade(id, request.Kind, request.Dx, request.Dy, request.Dz)
+
+	case protocol.BuyRequest:
+		if err := lobby.buy(id, request.Item); err != nil {
+			logger.Debug("Purchase refused", "item", request.Item, "error", err)
+		}
+
+	case protocol.VoiceRequest:
+		lobby.relayVoice(id, request.Samples)
+
+	case protocol.CallVoteRequest:
+		if err := lobby.callVote(id, request.Kind, request.TargetId); err != nil {
+			logger.Debug("Vote refused", "kind", request.Kind, "error", err)
+		}
+
+	case protocol.BallotRequest:
+		if err := lobby.castBallot(id, request.Yes); err != nil {
+			logger.Debug("Ballot refused", "error", err)
+		}
+
+	case protocol.UseRequest:
+		lobby.mutex.Lock()
+		doorMessage := lobby.useDoor(&lobby.players[id])
+		lobby.mutex.Unlock()
+		if doorMessage != nil {
+			lobby.broadcastByteMessage(doorMessage)
+		}
+
+	case protocol.MarkRequest:
+		if err := lobby.relayMark(id, request.X, request.Y, request.Z); err != nil {
+			logger.Debug("Mark refused", "error", err)
+		}
+	}
+}
+
+// start the match once every slot is taken, reporting whether it started
+func (lobby *lobby) startIfFull() bool {
+	lobby.mutex.Lock()
+	if lobby.started || lobby.currentNumPlayers < lobby.config.numPlayers {
+		lobby.mutex.Unlock()
+		return false
+	}
+	lobby.started = true
+	if lobby.botFill != nil {
+		lobby.botFill.Stop()
+	}
+	lobby.postFilled()
+	lobby.mutex.Unlock()
+
+	lobby.nextRound()
+	return true
+}
+
+// how recently someone must have hurt a killed player to be credited with an
+// assist
+const assistWindow = 5 * time.Second
+
+// a shot landed, killing the hit player if it took the last of their health,
+// reporting how much they have left and whether they could be hit at all
+func (lobby *lobby) hit(shooterId, hitPlayerId, damage int, weapon protocol.Weapon, headshot bool) (health int, landed bool) {
+	lobby.mutex.Lock()
+	hitPlayer := &lobby.players[hitPlayerId]
+
+	// a player that has already left or died cannot be hit
+	if hitPlayer.isEmpty() || !hitPlayer.isAlive {
+		lobby.mutex.Unlock()
+		return 0, false
+	}
+
+	// armor soaks up damage before health does
+	absorbed := min(hitPlayer.armor, damage)
+	hitPlayer.armor -= absorbed
+	damage -= absorbed
+
+	// let the specific player know they got hit, damage while warming up is
+	// not counted
+	warmup := lobby.warmup
+	if !warmup && shooterId != hitPlayerId && lobby.players[shooterId].Team != hitPlayer.Team {
+		if hitPlayer.damagedAt == nil {
+			hitPlayer.damagedAt = make([]time.Time, len(lobby.players))
+		}
+		hitPlayer.damagedAt[shooterId] = lobby.clock.now()
+		lobby.players[shooterId].damageDealt += absorbed + min(damage, hitPlayer.health)
+	}
+	hitPlayer.health -= damage
+	if hitPlayer.isConnected() {
+		if err := writeMessage(hitPlayer.conn, protocol.EncodeLoseHealth(damage, headshot)); err != nil {
+			lobby.logger.Warn("Could not send message", "player", hitPlayerId, "header", protocol.LoseHealthHeader, "error", err)
+		}
+	}
+
+	killed := hitPlayer.health < 1
+	if !killed {
+		lobby.sendTeammateHealth(hitPlayer)
+	}
+	var assisterIds []int
+	var streakMessage []byte
+	if killed && warmup {
+		hitPlayer.isAlive = false
+	}
+	if killed && !warmup {
+		hitPlayer.isAlive = false
+		hitPlayer.deathAmount++
+		hitPlayer.loseInventory()
+		shooter := &lobby.players[shooterId]
+		shooter.killAmount++
+		shooter.weaponKills[weapon]++
+		streakMessage = lobby.countStreak(shooter, hitPlayer)
+		if shooter.Team != hitPlayer.Team {
+			shooter.earn(protocol.KillReward)
+			lobby.sendInventory(shooter)
+		}
+
+		// everyone else who hurt the killed player shortly before helped
+		for id, damagedAt := range hitPlayer.damagedAt {
+			if damagedAt.IsZero() || lobby.clock.now().Sub(damagedAt) > assistWindow || id == shooterId || lobby.players[id].isEmpty() {
+				continue
 			}
+			lobby.players[id].assistAmount++
+			assisterIds = append(assisterIds, id)
+		}
+		hitPlayer.damagedAt = nil
 
-			// just update location
-			server.players[newPlayer.id].x = int8(message[1])
-			server.players[newPlayer.id].y = int8(message[2])
-			server.players[newPlayer.id].z = int8(message[3])
+		var assisters []string
+		for _, id := range assisterIds {
+			assisters = append(assisters, lobby.players[id].name)
+		}
+		lobby.note(matchEvent{Kind: killEvent, Player: shooter.name, Victim: hitPlayer.name, Weapon: weapon.String(), Headshot: headshot, Assists: assisters})
+	}
+	if absorbed > 0 || killed {
+		lobby.sendInventory(hitPlayer)
+	}
+	health = max(hitPlayer.health, 0)
+	lobby.mutex.Unlock()
+
+	if killed {
+		// broadcast the kill
+		lobby.broadcastByteMessage(protocol.EncodeKilled(shooterId, hitPlayerId, weapon, headshot, assisterIds))
+		if streakMessage != nil {
+			lobby.broadcastByteMessage(streakMessage)
+		}
 
-		default:
-			log.Println("Invalid client message")
+		// while warming up the killed come back, otherwise if the whole
+		// team is dead then the round is done
+		if warmup {
+			lobby.respawnLater(hitPlayerId)
+		} else {
+			lobby.checkRoundOver()
 		}
 	}
+	return health, true
+}
 
-	// handle disconnect of player
-	disconnectedPlayerId := newPlayer.id
-	server.mutex.Lock()
-	server.players[newPlayer.id] = player{}
-	server.currentNumPlayers--
-	server.mutex.Unlock()
+// ping the client until told to stop, its pongs keep the read deadline moving
+func keepalive(conn *websocket.Conn, stop <-chan struct{}) {
+	ticker := time.NewTicker(protocol.KeepaliveInterval)
+	defer ticker.Stop()
 
-	// inform lobby of player disconnection
-	server.broadcastByteMessage([]byte{byte(playerDisconnectHeader), byte(disconnectedPlayerId)})
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(protocol.KeepaliveInterval)); err != nil {
+				return
+			}
+		}
+	}
 }
 
-type successResponse int
+// keep the player's slot, health and score, blocking until they either
+// resume the match, or fail to in time; reports whether they resumed
+func (lobby *lobby) holdSlot(id int) bool {
+	resumed := make(chan struct{})
+	lobby.mutex.Lock()
+	// a kicked player has nothing to come back to
+	if lobby.players[id].kicked {
+		lobby.mutex.Unlock()
+		return false
+	}
+	lobby.players[id].conn = nil
+	lobby.players[id].datagramAddress = nil
+	lobby.players[id].resumed = resumed
+	lobby.mutex.Unlock()
+	return lobby.awaitResume(id, resumed)
+}
 
-const (
-	success successResponse = iota
-	failure
-)
+// wait for whoever a slot is held for to take it, reporting whether they did
+func (lobby *lobby) awaitResume(id int, resumed <-chan struct{}) bool {
+	gone, timer := after(lobby.clock, protocol.ReconnectGraceTime)
+	defer timer.Stop()
+
+	select {
+	case <-resumed:
+		// being kicked also ends the wait
+		lobby.mutex.Lock()
+		defer lobby.mutex.Unlock()
+		return !lobby.players[id].kicked
+	case <-gone:
+	case <-lobby.done:
+	}
+
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
 
-func (server *server) initialisePlayer(conn *websocket.Conn) (player, error) {
+	// the player may have come back just as time ran out
+	if lobby.players[id].isConnected() {
+		return true
+	}
+	lobby.players[id].resumed = nil
+	return false
+}
+
+// give up a player's slot and let everyone know they are gone
+func (lobby *lobby) freeSlot(id int) {
+	lobby.mutex.Lock()
+	lobby.note(matchEvent{Kind: leftEvent, Player: lobby.players[id].name})
+	lobby.players[id] = player{}
+	lobby.currentNumPlayers--
+	voteMessage := lobby.dropKickVote(id)
+	lobby.mutex.Unlock()
+
+	// inform lobby of player disconnection
+	lobby.broadcastByteMessage(protocol.EncodePlayerDisconnect(id))
+	if voteMessage != nil {
+		lobby.broadcastByteMessage(voteMessage)
+	}
+	lobby.broadcastRoster()
+
+	// the player leaving may have been the last one standing on their team
+	if lobby.isInProgress() {
+		lobby.checkRoundOver()
+	}
+}
+
+func (lobby *lobby) checkPassword(password string) bool {
+	if lobby.config.password == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(password), []byte(lobby.config.password)) == 1
+}
+
+// read the client's join message, telling it why if it cannot come in
+func (lobby *lobby) readJoin(conn *websocket.Conn) (id int, token []byte, name string, err error) {
 	// receive ID, team info
 	_, idMessage, err := conn.ReadMessage()
 	if err != nil {
-		return player{}, err
+		return 0, nil, "", err
 	}
 
 	// check for badly formed messages
-	if len(idMessage) != 1 || idMessage[0] < 0 || idMessage[0] > 5 {
+	id, token, name, password, err := protocol.DecodeJoin(idMessage)
+	var versionError protocol.VersionError
+	if errors.As(err, &versionError) {
+		// the client could not read a response, so it is told why in words
+		reason := fmt.Sprintf("Server speaks protocol version %d", protocol.Version)
+		_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseProtocolError, reason))
+		return 0, nil, "", err
+	}
+	if err != nil {
 		// send the failure code
-		_ = conn.WriteMessage(websocket.BinaryMessage, []byte{byte(failure)})
-		return player{}, errors.New("Badly formed ID team message")
+		_ = conn.WriteMessage(websocket.BinaryMessage, protocol.EncodeResponse(protocol.Failure, protocol.Admission{}))
+		return 0, nil, "", err
+	}
+
+	// nobody gets a slot, not even their old one, without the password
+	if !lobby.checkPassword(password) {
+		_ = conn.WriteMessage(websocket.BinaryMessage, protocol.EncodeResponse(protocol.WrongPassword, protocol.Admission{}))
+		return 0, nil, "", errors.New("Wrong password")
+	}
+	return id, token, name, nil
+}
+
+// reports whether the player is resuming a held slot
+func (lobby *lobby) initialisePlayer(conn *websocket.Conn) (player, bool, error) {
+	id, token, name, err := lobby.readJoin(conn)
+	if err != nil {
+		return player{}, false, err
 	}
 
-	id := int(idMessage[0])
+	if token != nil {
+		resumedPlayer, err := lobby.resumePlayer(id, token, conn)
+		return resumedPlayer, err == nil, err
+	}
+
+	// observers take no slot, and can come in whenever
+	if id == protocol.ObserverId {
+		return player{id: protocol.ObserverId, name: name, conn: conn}, false, lobby.admitObserver(conn)
+	}
+
+	lobby.mutex.Lock()
+	switch {
+	// anyone joining a match that is underway watches it unless they can
+	// take a slot, see spectators.go and hotjoin.go
+	case lobby.round > 0 && !lobby.canHotJoin():
+		lobby.mutex.Unlock()
+		return player{id: protocol.ObserverId, name: name, conn: conn}, false, lobby.admitSpectator(conn, name)
+
+	// do not allow new players if the lobby is full
+	case lobby.config.numPlayers <= lobby.currentNumPlayers:
+		err = errors.New("Lobby is full")
+
+	// pick a slot for the player if they left it to us
+	case id == protocol.AnyId:
+		id = lobby.freeSlotId()
+
+	// the teams may be too small for the slot asked for
+	case !lobby.hasSlots([]int{id}):
+		err = errors.New("No such player slot")
 
 	// check that the requested player slot is free
-	if !server.players[id].isEmpty() {
+	case !lobby.players[id].isEmpty():
+		err = errors.New("Player slot is taken")
+	}
+	if err != nil {
+		lobby.mutex.Unlock()
 		// send the failure code
-		_ = conn.WriteMessage(websocket.BinaryMessage, []byte{byte(failure)})
-		return player{}, errors.New("Player slot is taken")
+		_ = conn.WriteMessage(websocket.BinaryMessage, protocol.EncodeResponse(protocol.Failure, protocol.Admission{}))
+		return player{}, false, err
 	}
 
 	// player is okay to be inducted into game
-	newPlayer := newPlayer(id, conn)
-	server.mutex.Lock()
-	server.players[id] = *newPlayer
-	server.currentNumPlayers++
-	server.mutex.Unlock()
+	newPlayer := newPlayer(id, lobby.teamOf(id), name, conn)
+	lobby.players[id] = *newPlayer
+	lobby.currentNumPlayers++
+	lobby.note(matchEvent{Kind: joinedEvent, Player: name})
+	if lobby.round > 0 {
+		err = lobby.hotJoin(id)
+		lobby.mutex.Unlock()
+		return *newPlayer, false, err
+	}
+	admission := lobby.admission(newPlayer)
+	lobby.mutex.Unlock()
 
 	// send the success code
-	if err = conn.WriteMessage(websocket.BinaryMessage, []byte{byte(success)}); err != nil {
-		return *newPlayer, err
+	if err = conn.WriteMessage(websocket.BinaryMessage, protocol.EncodeResponse(protocol.Success, admission)); err != nil {
+		return *newPlayer, false, err
 	}
 
-	return *newPlayer, nil
+	return *newPlayer, false, nil
 }
 
-func (server *server) cleanUp() {
-	close(server.broadcast)
+// the first free slot on the team with fewer players, must hold the lock and
+// know that the lobby is not full
+func (lobby *lobby) freeSlotId() int {
+	teamAPlayers, teamBPlayers := 0, 0
+	for _, player := range lobby.players {
+		if player.isEmpty() {
+			continue
+		}
+		if player.Team == protocol.A {
+			teamAPlayers++
+		} else {
+			teamBPlayers++
+		}
+	}
+
+	// the smaller team first, then the other in case it is full
+	teamSize := lobby.config.teamSize
+	teamOffsets := [2]int{0, teamSize}
+	if teamBPlayers < teamAPlayers {
+		teamOffsets = [2]int{teamSize, 0}
+	}
+	for _, offset := range teamOffsets {
+		for id := offset; id < offset+teamSize; id++ {
+			if lobby.players[id].isEmpty() {
+				return id
+			}
+		}
+	}
+	return 0
+}
+
+// hand a held slot back to the player it belongs to, and catch them up on the match
+func (lobby *lobby) resumePlayer(id int, token []byte, conn *websocket.Conn) (player, error) {
+	lobby.mutex.Lock()
+	if !lobby.hasSlots([]int{id}) {
+		lobby.mutex.Unlock()
+		_ = conn.WriteMessage(websocket.BinaryMessage, protocol.EncodeResponse(protocol.Failure, protocol.Admission{}))
+		return player{}, errors.New("No such player slot")
+	}
+	resumingPlayer := &lobby.players[id]
+	if resumingPlayer.resumed == nil || !bytes.Equal(resumingPlayer.token, token) {
+		lobby.mutex.Unlock()
+		_ = conn.WriteMessage(websocket.BinaryMessage, protocol.EncodeResponse(protocol.Failure, protocol.Admission{}))
+		return player{}, errors.New("No session to resume")
+	}
+	resumingPlayer.conn = conn
+	close(resumingPlayer.resumed)
+	resumingPlayer.resumed = nil
+	lobby.note(matchEvent{Kind: resumedEvent, Player: resumingPlayer.name})
+	resumedPlayer := *resumingPlayer
+
+	// sent under the lock so no broadcast can sneak in before the resume state
+	err := conn.WriteMessage(websocket.BinaryMessage, protocol.EncodeResponse(protocol.Success, lobby.admission(resumingPlayer)))
+	if err == nil {
+		err = lobby.catchUp(id)
+	}
+	lobby.mutex.Unlock()
+
+	return resumedPlayer, err
+}
+
+// send a player who has just taken their slot mid-match everything they need
+// to pick the match up, the lobby's mutex must be held
+func (lobby *lobby) catchUp(id int) error {
+	player := &lobby.players[id]
+	err := writeMessage(player.conn, protocol.EncodeResume(lobby.resumeState(id)))
+	if err == nil {
+		err = writeMessage(player.conn, protocol.EncodeHealthPacks(lobby.takenHealthPackList()))
+	}
+	if err == nil && len(lobby.openDoors) > 0 {
+		err = writeMessage(player.conn, protocol.EncodeDoors(lobby.openDoorList()))
+	}
+	if err == nil {
+		err = writeMessage(player.conn, protocol.EncodeInventory(player.inventory()))
+	}
+	if err == nil && !lobby.roundEnds.IsZero() {
+		err = writeMessage(player.conn, protocol.EncodeRoundTime(lobby.roundEnds.Sub(lobby.clock.now())))
+	}
+	if err == nil && !lobby.playsAt.IsZero() {
+		err = writeMessage(player.conn, protocol.EncodeGrace(lobby.playsAt.Sub(lobby.clock.now())))
+	}
+	return err
+}
+
+// the state of the match from the point of view of a player, must hold the lock
+func (lobby *lobby) resumeState(id int) protocol.ResumeState {
+	player := lobby.players[id]
+	state := lobby.matchState()
+	state.Health = max(player.health, 0)
+	state.IsAlive = player.isAlive
+	state.X, state.Y, state.Z = player.x, player.y, player.z
+	return state
+}
+
+// the state of the match as anyone watching it sees it, must hold the lock
+func (lobby *lobby) matchState() protocol.ResumeState {
+	state := protocol.ResumeState{
+		Round:       lobby.round,
+		TeamAPoints: lobby.teamAPoints,
+		TeamBPoints: lobby.teamBPoints,
+		InPlay:      lobby.inPlay,
+	}
+	for _, otherPlayer := range lobby.players {
+		if otherPlayer.isEmpty() {
+			continue
+		}
+		state.Players = append(state.Players, protocol.PlayerScore{
+			Id:      otherPlayer.id,
+			Kills:   otherPlayer.killAmount,
+			Deaths:  otherPlayer.deathAmount,
+			Assists: otherPlayer.assistAmount,
+			IsAlive: otherPlayer.isAlive,
+		})
+	}
+	return state
+}
+
+// everyone's shooting over the match, the lobby's mutex must be held
+func (lobby *lobby) statistics() []protocol.PlayerStatistics {
+	var statistics []protocol.PlayerStatistics
+	for _, player := range lobby.players {
+		if player.isEmpty() {
+			continue
+		}
+		statistics = append(statistics, protocol.PlayerStatistics{
+			Id:         player.id,
+			ShotsFired: player.shotsFired,
+			ShotsHit:   player.shotsHit,
+			Damage:     player.damageDealt,
+		})
+	}
+	return statistics
+}
+
+// stop the lobby's broadcasting, safe to call more than once
+func (lobby *lobby) cleanUp() {
+	lobby.closeOnce.Do(func() {
+		close(lobby.done)
+	})
+}
+
+// close every player's connection, which ends their communication loops
+func (lobby *lobby) disconnectAll() {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	for _, player := range lobby.players {
+		if !player.isConnected() {
+			continue
+		}
+		if err := player.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Match is over")); err != nil {
+			lobby.logger.Warn("Could not close connection", "player", player.id, "error", err)
+		}
+		player.conn.Close()
+	}
+	for conn := range lobby.observers {
+		if err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Match is over")); err != nil {
+			lobby.logger.Warn("Could not close connection", "observer", conn.RemoteAddr(), "error", err)
+		}
+		conn.Close()
+	}
+	lobby.finishRecording()
 }
 
 // check if all of team A is dead
-func (server *server) isTeamAAllDead() bool {
-	for _, player := range server.players[:maxTeamPlayers] {
+func (lobby *lobby) isTeamAAllDead() bool {
+	for _, player := range lobby.players[:lobby.config.teamSize] {
 		if !player.isEmpty() && player.isAlive {
 			return false
 		}
@@ -281,8 +1019,8 @@ func (server *server) isTeamAAllDead() bool {
 }
 
 // check if all of team B is dead
-func (server *server) isTeamBAllDead() bool {
-	for _, player := range server.players[maxTeamPlayers:] {
+func (lobby *lobby) isTeamBAllDead() bool {
+	for _, player := range lobby.players[lobby.config.teamSize:] {
 		if !player.isEmpty() && player.isAlive {
 			return false
 		}
@@ -290,122 +1028,528 @@ func (server *server) isTeamBAllDead() bool {
 	return true
 }
 
-const (
-	roundStartGraceTime = 8
-	roundEndGraceTime   = 8
-	lastRound           = 10 // TODO put in common internal shared file
-	maxHealth           = 3
-	afterGameLingerTime = 2
-)
+// once a whole team is dead the round is done, the other team gets a point
+func (lobby *lobby) checkRoundOver() {
+	lobby.mutex.Lock()
+	if lobby.roundOver {
+		lobby.mutex.Unlock()
+		return
+	}
+	var winningTeam protocol.Team
+	switch {
+	case lobby.isTeamAAllDead():
+		winningTeam = protocol.B
+		lobby.teamBPoints++
+	case lobby.isTeamBAllDead():
+		winningTeam = protocol.A
+		lobby.teamAPoints++
+	default:
+		lobby.mutex.Unlock()
+		return
+	}
+	lobby.roundOver = true
+	lobby.roundEnds = time.Time{}
+	lobby.note(matchEvent{Kind: roundWonEvent, Team: teamName(winningTeam)})
+	lobby.payRound(winningTeam, true)
+	lobby.mutex.Unlock()
+
+	lobby.broadcastByteMessage(protocol.EncodeTeamPoint(winningTeam))
+	lobby.clock.afterFunc(lobby.config.roundEndGrace, lobby.nextRound)
+}
 
-func (server *server) nextRound() {
-	if server.round == lastRound {
-		time.AfterFunc(afterGameLingerTime*time.Second, func() {
-			server.cleanUp()
-			os.Exit(0)
-		})
+// the round ran out of time before either team was wiped out
+func (lobby *lobby) timeOut(round int) {
+	lobby.mutex.Lock()
+	if lobby.round != round || !lobby.inPlay || lobby.roundOver {
+		lobby.mutex.Unlock()
+		return
+	}
+	winningTeam, won := lobby.timeoutWinningTeam()
+	switch {
+	case !won:
+	case winningTeam == protocol.A:
+		lobby.teamAPoints++
+	case winningTeam == protocol.B:
+		lobby.teamBPoints++
 	}
+	lobby.roundOver = true
+	lobby.roundEnds = time.Time{}
+	event := matchEvent{Kind: timedOutEvent}
+	if won {
+		event.Team = teamName(winningTeam)
+	}
+	lobby.note(event)
+	lobby.payRound(winningTeam, won)
+	lobby.mutex.Unlock()
 
-	// reset player attributes TODO make a function/method for this i.e. server.resetPlayers()
-	server.mutex.Lock()
-	for i := range server.players {
-		player := &server.players[i]
-		player.health = maxHealth
-		player.isAlive = true
+	lobby.logger.Info("Round timed out", "round", round)
+	if won {
+		lobby.broadcastByteMessage(protocol.EncodeTeamPoint(winningTeam))
 	}
-	server.mutex.Unlock()
+	lobby.clock.afterFunc(lobby.config.roundEndGrace, lobby.nextRound)
+}
 
-	server.broadcastByteMessage([]byte{byte(nextRoundHeader)}) // TODO make a function specifically for this
+// the team a timed out round goes to, if any, the lobby's mutex must be held
+func (lobby *lobby) timeoutWinningTeam() (protocol.Team, bool) {
+	switch lobby.config.timeoutWinner {
+	case teamAWins:
+		return protocol.A, true
+	case teamBWins:
+		return protocol.B, true
+	}
 
-	server.mutex.Lock()
-	server.round++
-	server.mutex.Unlock()
+	teamAAlive, teamBAlive := 0, 0
+	for _, player := range lobby.players {
+		if player.isEmpty() || !player.isAlive {
+			continue
+		}
+		if player.Team == protocol.A {
+			teamAAlive++
+		} else {
+			teamBAlive++
+		}
+	}
+	switch {
+	case teamAAlive > teamBAlive:
+		return protocol.A, true
+	case teamBAlive > teamAAlive:
+		return protocol.B, true
+	}
+	return protocol.A, false
+}
 
-	// send play message after some time
-	time.AfterFunc(roundStartGraceTime*time.Second, func() {
-		server.broadcastByteMessage([]byte{byte(playerHeader)}) // TODO make a function specifically for this
-	})
+// a match is in progress from the first round until the last one ends
+func (lobby *lobby) isInProgress() bool {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+	return lobby.round > 0 && !lobby.matchOver
 }
 
-type locationParcel struct {
-	id      byte
-	x, y, z int8
+const afterGameLingerTime = 2
+
+// how long requests still being served are waited for when shutting down
+const shutdownTimeout = 5 * time.Second
+
+// go back to waiting for the lobby to fill, keeping everyone who stayed in
+// their slot with their scores wiped, and start straight away if nobody left
+func (lobby *lobby) awaitNextMatch() {
+	lobby.mutex.Lock()
+	lobby.restartMatch()
+	lobby.matchOver = false
+	lobby.started = false
+	lobby.warmup = lobby.config.warmup
+	lobby.events = nil
+	var warming []int
+	for i := range lobby.players {
+		player := &lobby.players[i]
+		player.health = protocol.MaxHealth
+		player.isAlive = true
+		player.crouching = false
+		player.damagedAt = nil
+		if player.isConnected() {
+			warming = append(warming, player.id)
+		}
+	}
+	lobby.mutex.Unlock()
+	lobby.logger.Info("Waiting for the next match")
+
+	for _, id := range warming {
+		lobby.joinWarmup(id)
+	}
+	if !lobby.startIfFull() && lobby.config.fillBots {
+		lobby.scheduleBotFill()
+	}
 }
 
-// turn location information into form that can be sent to clients
-func (server *server) serialiseLocations() []byte {
-	locationsBuffer := new(bytes.Buffer)
+func (lobby *lobby) nextRound() {
+	// a match voted to be restarted starts again from here, and a map voted
+	// for is changed to with the rest of the round
+	lobby.mutex.Lock()
+	changeMap := lobby.mapVoted
+	if lobby.restartVoted {
+		lobby.restartMatch()
+	}
+	lobby.mapVoted, lobby.restartVoted = false, false
+	lobby.mutex.Unlock()
+
+	// the match is over, the lobby waits for the next one once everyone has
+	// seen how it went
+	if lobby.round == protocol.LastRound {
+		lobby.mutex.Lock()
+		lobby.matchOver = true
+		result := lobby.result()
+		statistics := lobby.statistics()
+		lobby.postFinalScore(true)
+		lobby.mutex.Unlock()
+		lobby.broadcastByteMessage(protocol.EncodeStatistics(statistics))
+		if err := lobby.leaderboard.record(result); err != nil {
+			lobby.logger.Error("Could not record match result", "error", err)
+		}
+		lobby.writeReport(true)
 
-	// start with message type (location type message)
-	if err := binary.Write(locationsBuffer, binary.LittleEndian, locationsHeader); err != nil {
-		log.Println(err)
-		return nil
+		// clients take the round after the last as the end of the match and
+		// go to their end screen, but no more rounds are played
+		lobby.broadcastByteMessage(protocol.EncodeNextRound())
+		lobby.clock.afterFunc(afterGameLingerTime*time.Second, lobby.awaitNextMatch)
+		return
+	}
+
+	// move on to the next map every so many rounds
+	if changeMap || lobby.round > 0 && lobby.config.mapRounds > 0 && lobby.round%lobby.config.mapRounds == 0 {
+		lobby.rotateMap()
 	}
 
-	// write each player's location data
-	for _, player := range server.players {
+	// spectators waiting to play take any free slots, to be spawned with
+	// everyone else
+	lobby.mutex.Lock()
+	promoted := lobby.promoteSpectators()
+	lobby.mutex.Unlock()
+	if promoted {
+		lobby.broadcastRoster()
+	}
+
+	// reset player attributes TODO make a function/method for this i.e. lobby.resetPlayers()
+	lobby.mutex.Lock()
+	for i := range lobby.players {
+		player := &lobby.players[i]
+		player.health = protocol.MaxHealth
+		player.isAlive = true
+		player.crouching = false
+		player.limbo = false
+		player.damagedAt = nil
+		player.roundKills = 0
+		lobby.sendInventory(player)
+	}
+	lobby.warmup = false
+	lobby.smokes = nil
+	lobby.takenHealthPacks = make([]bool, len(lobby.config.maps[lobby.mapIndex].HealthPacks))
+	lobby.resetDoors()
+	lobby.roundEnds = time.Time{}
+	lobby.playsAt = lobby.clock.now().Add(lobby.config.roundStartGrace)
+	lobby.spawnPlayers()
+	lobby.inPlay = false
+	lobby.roundOver = false
+	lobby.mutex.Unlock()
+
+	lobby.broadcastByteMessage(protocol.EncodeNextRound())
+	lobby.broadcastByteMessage(protocol.EncodeGrace(lobby.config.roundStartGrace))
+
+	lobby.mutex.Lock()
+	lobby.round++
+	round := lobby.round
+	lobby.note(matchEvent{Kind: roundEvent, Map: lobby.currentMap()})
+	lobby.mutex.Unlock()
+	lobby.logger.Info("Round started", "round", round)
+
+	// send play message after some time, and start the clock if the round
+	// has a time limit
+	lobby.clock.afterFunc(lobby.config.roundStartGrace, func() {
+		roundTime := lobby.config.roundTime
+		lobby.mutex.Lock()
+		lobby.inPlay = true
+		lobby.playsAt = time.Time{}
+		if roundTime > 0 {
+			lobby.roundEnds = lobby.clock.now().Add(roundTime)
+		}
+		lobby.note(matchEvent{Kind: playEvent})
+		if round == 1 {
+			lobby.postStarted()
+		}
+		lobby.mutex.Unlock()
+		lobby.broadcastByteMessage(protocol.EncodePlay())
+
+		if roundTime > 0 {
+			lobby.broadcastByteMessage(protocol.EncodeRoundTime(roundTime))
+			timer := lobby.clock.afterFunc(roundTime, func() {
+				lobby.timeOut(round)
+			})
+			lobby.mutex.Lock()
+			lobby.roundTimer = timer
+			lobby.mutex.Unlock()
+		}
+
+		// a map change or restart voted for while waiting for the round
+		lobby.endRoundForVote()
+	})
+}
+
+// turn the ping of every player in the lobby into form that can be sent to
+// clients, the lobby's mutex must be held
+func (lobby *lobby) serialisePings() []byte {
+	parcels := make([]protocol.PingParcel, 0, len(lobby.players))
+	for _, player := range lobby.players {
 		if player.isEmpty() {
 			continue
 		}
-		if err := binary.Write(locationsBuffer, binary.LittleEndian, locationParcel{byte(player.id), player.x, player.y, player.z}); err != nil {
-			log.Println(err)
-			return nil
+		parcels = append(parcels, protocol.PingParcel{Id: player.id, Ping: player.ping})
+	}
+	return protocol.EncodePings(parcels)
+}
+
+// everyone's name, the lobby's mutex must be held
+func (lobby *lobby) roster() protocol.Roster {
+	roster := make(protocol.Roster, len(lobby.players))
+	for id, player := range lobby.players {
+		if !player.isEmpty() {
+			roster[id] = player.name
 		}
 	}
+	return roster
+}
+
+// let everyone know who is in the lobby after someone joins or leaves
+func (lobby *lobby) broadcastRoster() {
+	lobby.mutex.Lock()
+	message := protocol.EncodeRoster(lobby.roster())
+	lobby.mutex.Unlock()
 
-	return locationsBuffer.Bytes()
+	lobby.broadcastByteMessage(message)
 }
 
-func (server *server) broadcastByteMessage(message []byte) {
-	server.broadcast <- message
+func (lobby *lobby) currentMap() string {
+	return lobby.config.mapNames[lobby.mapIndex]
 }
 
-//////// player
+// how long there is between one exchange of locations and the next
+func (lobby *lobby) tickInterval() time.Duration {
+	return time.Second / time.Duration(lobby.config.tickRate)
+}
 
-type team int
+// change to the next map in the rotation, letting clients know if it differs
+func (lobby *lobby) rotateMap() {
+	lobby.mutex.Lock()
+	previousMap := lobby.currentMap()
+	lobby.mapIndex = (lobby.mapIndex + 1) % len(lobby.config.mapNames)
+	lobby.resetDoors()
+	nextMap := lobby.currentMap()
+	if nextMap != previousMap {
+		lobby.note(matchEvent{Kind: mapEvent, Map: nextMap})
+	}
+	lobby.mutex.Unlock()
 
-const (
-	a team = iota
-	b
-)
+	if nextMap != previousMap {
+		lobby.logger.Info("Map changed", "map", nextMap)
+		lobby.broadcastByteMessage(protocol.EncodeMapChange(nextMap))
+	}
+}
+
+// turn location information into form that can be sent to clients
+func (lobby *lobby) serialiseLocations() []byte {
+	parcels := make([]protocol.LocationParcel, 0, len(lobby.players))
+	for _, player := range lobby.players {
+		if player.isEmpty() || player.limbo {
+			continue
+		}
+		parcels = append(parcels, protocol.LocationParcel{Id: byte(player.id), X: player.x, Y: player.y, Z: player.z, Yaw: player.yaw, Pitch: player.pitch, Crouching: player.crouching})
+	}
+	return protocol.EncodeLocations(lobby.serverTime(), parcels)
+}
+
+// pass a frame of a player's voice on to their teammates within earshot
+func (lobby *lobby) relayVoice(speakerId int, samples []byte) {
+	message := protocol.EncodeVoice(speakerId, samples)
+
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	speaker := lobby.players[speakerId]
+	speakerLocation := unscaleLocation(speaker.x, speaker.y, speaker.z)
+	for _, player := range lobby.players {
+		if player.id == speakerId || player.Team != speaker.Team || !player.isConnected() {
+			continue
+		}
+		if distance(speakerLocation, unscaleLocation(player.x, player.y, player.z)) > protocol.VoiceRange {
+			continue
+		}
+		if err := writeMessage(player.conn, message); err != nil {
+			lobby.logger.Warn("Could not send message", "player", player.id, "header", protocol.VoiceHeader, "error", err)
+		}
+	}
+}
+
+// tell a player's teammates how much health they have left, for the bars
+// over their heads, the lobby's mutex must be held
+func (lobby *lobby) sendTeammateHealth(player *player) {
+	message := protocol.EncodeTeammateHealth(player.id, player.health)
+	for _, teammate := range lobby.players {
+		if teammate.id == player.id || teammate.Team != player.Team || !teammate.isConnected() {
+			continue
+		}
+		if err := writeMessage(teammate.conn, message); err != nil {
+			lobby.logger.Warn("Could not send message", "player", teammate.id, "header", protocol.TeammateHealthHeader, "error", err)
+		}
+	}
+}
+
+func (lobby *lobby) broadcastByteMessage(message []byte) {
+	select {
+	case lobby.broadcast <- message:
+	case <-lobby.done:
+	}
+}
+
+//////// player
 
 type player struct {
-	id, health int
-	team
+	id, health              int
+	killAmount, deathAmount int
+	assistAmount            int
+	shotsFired, shotsHit    int
+	weaponKills             [protocol.Weapons]int
+	damageDealt             int         // to enemies, over the whole match
+	damagedAt               []time.Time // when each enemy last hurt the player, for assists, by slot
+	streak                  int         // enemies killed since the player last died, see streaks.go
+	roundKills              int         // enemies killed this round
+	protocol.Team
 	conn    *websocket.Conn
 	isAlive bool
 	x, y, z int8
+	yaw     byte // scaled like in location parcels
+	pitch   int8
+	token   []byte
+	resumed chan struct{} // only set while the slot is held for a disconnected player
+	limbo   bool          // joined mid-round, sitting it out until the next, see hotjoin.go
+
+	moveAllowance  float32 // how far the player may still move, in units
+	climbAllowance float32 // how far the player may still rise, in units
+	lastMove       time.Time
+	groundedAt     time.Time // when the player was last standing on something
+	groundY        float32   // the height of their feet then
+	launchedUntil  time.Time // while a jump pad lets them move faster
+	launchSpeed    float32   // how fast across the jump pad threw them
+	refusedMoves   int       // since refusedSince
+	refusedSince   time.Time
+	ping           int // round trip time in milliseconds, as reported by the client
+	kicked         bool
+	bot            bool
+	difficulty     botDifficulty // how well a bot plays, see difficulty.go
+	name           string
+	grenades       [protocol.GrenadeKinds]int // left to throw, kept until death
+	crouching      bool
+	money          int
+	primary        protocol.Item // NoPrimary when only carrying the handgun
+	armor          int
+
+	datagramAddress *net.UDPAddr // nil unless the player asked for locations over UDP
+	lastHello       time.Time
+	voteFailedAt    time.Time // when a vote the player called last failed
+	markedAt        time.Time // when the player last marked a spot, see markers.go
 }
 
-func newPlayer(id int, conn *websocket.Conn) *player {
-	var team team
-	if id < maxTeamPlayers {
-		team = a
-	} else {
-		team = b
+// players who do not give a name are known by their slot
+func newPlayer(id int, team protocol.Team, name string, conn *websocket.Conn) *player {
+	if name == "" {
+		name = fmt.Sprintf("Player %d", id)
 	}
 	return &player{
-		id:   id,
-		team: team,
-		conn: conn,
+		id:      id,
+		name:    name,
+		Team:    team,
+		conn:    conn,
+		token:   newSessionToken(),
+		money:   protocol.StartingMoney,
+		primary: protocol.NoPrimary,
 	}
 }
 
+// the slot is neither occupied nor held for anyone
 func (player *player) isEmpty() bool {
-	return player.conn == nil
+	return player.conn == nil && player.resumed == nil && !player.bot
+}
+
+func (player *player) isConnected() bool {
+	return player.conn != nil
+}
+
+// what a player is told as they take their slot, the lobby's mutex must be held
+func (lobby *lobby) admission(player *player) protocol.Admission {
+	return protocol.Admission{
+		Id:       player.id,
+		Team:     player.Team,
+		TickRate: lobby.config.tickRate,
+		TeamSize: lobby.config.teamSize,
+		Token:    player.token,
+		Map:      lobby.currentMap(),
+	}
+}
+
+// the team a slot in the lobby belongs to
+func (lobby *lobby) teamOf(id int) protocol.Team {
+	return protocol.TeamOf(id, lobby.config.teamSize)
+}
+
+// whether an id from a message is one of the lobby's slots
+func (lobby *lobby) hasSlots(ids []int) bool {
+	for _, id := range ids {
+		if id < 0 || len(lobby.players) <= id {
+			return false
+		}
+	}
+	return true
+}
+
+func newSessionToken() []byte {
+	token := make([]byte, protocol.SessionTokenSize)
+	if _, err := rand.Read(token); err != nil {
+		slog.Error("Could not generate session token", "error", err)
+	}
+	return token
 }
 
 //////// program entry
 
 func main() {
 	// commandline arguments
-	if len(os.Args) != 3 {
-		fmt.Printf("Usage: %s [port] [num-players]\n", os.Args[0])
+	mapList := flag.String("maps", maps.DefaultName, "comma separated names of the maps to rotate through")
+	mapDirectory := flag.String("maps-dir", maps.DefaultDirectory, "directory the map files are in")
+	mapRounds := flag.Int("map-rounds", 2, "rounds played on each map before rotating, 0 to never rotate")
+	password := flag.String("password", "", "password players need to join, empty to let anyone join")
+	adminToken := flag.String("admin-token", "", "token needed to use the admin API, empty to turn it off")
+	fillBots := flag.Bool("fill-bots", false, "fill the slots nobody joins with bots")
+	botDifficultyName := flag.String("bot-difficulty", "normal", "how well bots play: "+botDifficultyNames())
+	resultsPath := flag.String("results", "", "file the results of finished matches are kept in, for the leaderboard")
+	roundTime := flag.Int("round-time", 120, "seconds each round lasts before it times out, 0 for no limit")
+	timeoutWinnerName := flag.String("timeout-winner", "majority", "who wins a round that times out: majority, a or b")
+	masterURL := flag.String("announce", "", "URL of a master server to list this server on, empty to keep it unlisted")
+	serverName := flag.String("server-name", "", "name the server is listed under, by default the host name")
+	region := flag.String("region", "", "region the server is listed in")
+	protocolName := flag.String("protocol", "binary", "how messages are sent: binary, or json for debugging")
+	udp := flag.Bool("udp", false, "send locations over UDP on the same port to clients that ask for it")
+	webDirectory := flag.String("web", "", "directory the browser client was built to, empty to not serve it")
+	simulate := flag.Bool("simulate", false, "run game logic on a fixed tick, counting every timer in ticks instead of wall clock time")
+	seed := flag.Uint64("seed", 0, "seed for each lobby's random numbers, 0 for a random one")
+	reportDirectory := flag.String("reports", "", "directory a report of each finished match is written to, empty to not write them")
+	warmup := flag.Bool("warmup", false, "let players play while a lobby fills up, without anything counting")
+	teamSize := flag.Int("team-size", protocol.DefaultTeamSize, "players on each team, so a lobby has twice as many slots")
+	hotJoin := flag.Bool("hot-join", false, "let those who join mid-match take a free slot straight away, sitting out the round being played")
+	promoteSpectators := flag.Bool("promote-spectators", false, "give those who join mid-match, and so spectate, any free slot at the start of the next round")
+	webhookURL := flag.String("webhook", "", "Discord webhook URL lobbies filling up, matches starting and final scores are posted to")
+	tvDelay := flag.Int("tv-delay", 0, "seconds matches are relayed behind to shooterTV viewers at /tv, 0 to not relay them")
+	tickRate := flag.Int("tick-rate", protocol.DefaultTickRate, "times a second locations are exchanged, higher is smoother but uses more bandwidth")
+	roundStartGrace := flag.Int("round-start-grace", 8, "seconds from a round starting to it being played, for buying and getting ready")
+	roundEndGrace := flag.Int("round-end-grace", 8, "seconds from a round being won to the next one starting")
+	console := flag.Bool("console", false, "read commands from standard input, type help for a list")
+	rconPort := flag.Int("rcon-port", 0, "TCP port the Source RCON protocol is spoken on, 0 to turn it off")
+	rconPassword := flag.String("rcon-password", "", "password RCON connections authenticate with")
+	logFlags := logging.RegisterFlags()
+	flag.Usage = func() {
+		fmt.Printf("Usage: %s [options] [port] [num-players]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
 		return
 	}
 
-	portString := os.Args[1]
-	numPlayersString := os.Args[2]
+	if err := logFlags.Setup(); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	portString := flag.Arg(0)
+	numPlayersString := flag.Arg(1)
 
 	port, err := strconv.Atoi(portString)
 	if err != nil {
@@ -419,15 +1563,213 @@ func main() {
 		return
 	}
 
-	if numPlayers < 1 || maxPlayers < numPlayers {
-		fmt.Println("num-players must be between 1 and 6, inclusive")
+	if !protocol.ValidTeamSize(*teamSize) {
+		fmt.Printf("team-size must be between 1 and %d, inclusive\n", protocol.MaxTeamSize)
+		return
+	}
+
+	if numPlayers < 1 || 2**teamSize < numPlayers {
+		fmt.Printf("num-players must be between 1 and %d, inclusive\n", 2**teamSize)
+		return
+	}
+
+	if *mapRounds < 0 {
+		fmt.Println("map-rounds cannot be negative")
+		return
+	}
+
+	if *tvDelay < 0 {
+		fmt.Println("tv-delay cannot be negative")
+		return
+	}
+
+	if *tickRate < 1 || protocol.MaxTickRate < *tickRate {
+		fmt.Printf("tick-rate must be between 1 and %d, inclusive\n", protocol.MaxTickRate)
+		return
+	}
+
+	// the tick clock cannot step a lobby at a rate it is not a multiple of
+	if *simulate && simulationRate%*tickRate != 0 {
+		fmt.Printf("tick-rate must divide %d when simulating\n", simulationRate)
+		return
+	}
+
+	if *roundStartGrace < 0 || *roundEndGrace < 0 {
+		fmt.Println("round-start-grace and round-end-grace cannot be negative")
+		return
+	}
+
+	if *rconPort != 0 && *rconPassword == "" {
+		fmt.Println("rcon-password is needed to turn on RCON")
+		return
+	}
+
+	if *roundTime < 0 || math.MaxUint16 < *roundTime {
+		fmt.Printf("round-time must be between 0 and %d, inclusive\n", math.MaxUint16)
 		return
 	}
 
+	timeoutWinner, err := parseTimeoutWinner(*timeoutWinnerName)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	botDifficulty, err := parseBotDifficulty(*botDifficultyName)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	encoding, err = protocol.ParseEncoding(*protocolName)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// make sure every map in the rotation can be played before anyone joins
+	mapNames := strings.Split(*mapList, ",")
+	gameMaps := make([]*maps.Map, 0, len(mapNames))
+	navGrids := make([]*navigation.Grid, 0, len(mapNames))
+	for _, mapName := range mapNames {
+		gameMap, err := maps.LoadNamed(*mapDirectory, mapName)
+		if err != nil {
+			fmt.Println("Could not load map:", err)
+			return
+		}
+		gameMaps = append(gameMaps, gameMap)
+		navGrids = append(navGrids, navigation.New(gameMap, navigation.PlayerHalfWidth, navigation.PlayerHeight))
+	}
+
+	// a listed server has to be reachable from elsewhere
+	listenHost := "localhost"
+	var announcement listing.Announcement
+	if *masterURL != "" {
+		listenHost = ""
+		if *serverName == "" {
+			*serverName, _ = os.Hostname()
+		}
+		announcement = listing.Announcement{
+			Name:       *serverName,
+			Region:     *region,
+			Mode:       fmt.Sprintf("%dv%d", (numPlayers+1)/2, numPlayers/2),
+			Port:       port,
+			MaxPlayers: numPlayers,
+			Password:   *password != "",
+		}
+		if err := announcement.Validate(); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	if *reportDirectory != "" {
+		if err := os.MkdirAll(*reportDirectory, 0o755); err != nil {
+			fmt.Println("Could not create report directory:", err)
+			return
+		}
+	}
+
+	leaderboard, err := loadLeaderboard(*resultsPath)
+	if err != nil {
+		fmt.Println("Could not load results:", err)
+		return
+	}
+
+	// locations can go over UDP on the same port
+	var datagrams *net.UDPConn
+	if *udp {
+		address, err := net.ResolveUDPAddr("udp", net.JoinHostPort(listenHost, strconv.Itoa(port)))
+		if err == nil {
+			datagrams, err = net.ListenUDP("udp", address)
+		}
+		if err != nil {
+			fmt.Println("Could not listen for UDP:", err)
+			return
+		}
+		defer datagrams.Close()
+	}
+
+	var matchWebhook *webhook
+	if *webhookURL != "" {
+		matchWebhook = newWebhook(*webhookURL)
+		go matchWebhook.run()
+	}
+
 	// start server
-	server := newServer(numPlayers)
+	server := newServer(&config{
+		numPlayers:      numPlayers,
+		teamSize:        *teamSize,
+		mapNames:        mapNames,
+		maps:            gameMaps,
+		navGrids:        navGrids,
+		mapRounds:       *mapRounds,
+		password:        *password,
+		fillBots:        *fillBots,
+		roundTime:       time.Duration(*roundTime) * time.Second,
+		timeoutWinner:   timeoutWinner,
+		tickRate:        *tickRate,
+		roundStartGrace: time.Duration(*roundStartGrace) * time.Second,
+		roundEndGrace:   time.Duration(*roundEndGrace) * time.Second,
+		datagrams:       datagrams,
+		simulate:        *simulate,
+		seed:            *seed,
+		tvDelay:         time.Duration(*tvDelay) * time.Second,
+		reportDirectory: *reportDirectory,
+		webhook:         matchWebhook,
+		warmup:          *warmup,
+		promotion:       *promoteSpectators,
+		hotJoin:         *hotJoin,
+		botDifficulty:   botDifficulty,
+	}, leaderboard)
 	defer server.cleanUp()
-	go server.run()
 	http.HandleFunc("/ws", server.serveWs)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf("localhost:%d", port), nil))
+	if *tvDelay > 0 {
+		http.HandleFunc("/tv", server.serveTV)
+	}
+	http.HandleFunc("GET /leaderboard", leaderboard.serveHTTP)
+	server.registerState(http.DefaultServeMux, *adminToken)
+	if *adminToken != "" {
+		server.registerAdmin(http.DefaultServeMux, *adminToken)
+	}
+	if *webDirectory != "" {
+		// the browser client fetches the maps it draws from here
+		http.Handle("/", http.FileServer(http.Dir(*webDirectory)))
+		http.Handle("GET /maps/", http.StripPrefix("/maps/", http.FileServer(http.Dir(*mapDirectory))))
+	}
+	if datagrams != nil {
+		go server.listenDatagrams(datagrams)
+	}
+	if *masterURL != "" {
+		go server.announce(strings.TrimSuffix(*masterURL, "/"), announcement)
+	}
+	httpServer := &http.Server{Addr: net.JoinHostPort(listenHost, strconv.Itoa(port))}
+	var shutdownOnce sync.Once
+	shutdown := func() {
+		shutdownOnce.Do(func() {
+			server.shutdown()
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := httpServer.Shutdown(ctx); err != nil {
+				slog.Warn("Could not shut down cleanly", "error", err)
+			}
+		})
+	}
+	if *console {
+		go server.runConsole(os.Stdin, os.Stdout, shutdown)
+	}
+	// RCON is for managing the server from elsewhere
+	if *rconPort != 0 {
+		listener, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(*rconPort)))
+		if err != nil {
+			fmt.Println("Could not listen for RCON:", err)
+			return
+		}
+		defer listener.Close()
+		go server.serveRcon(listener, *rconPassword, shutdown)
+	}
+	slog.Info("Server listening", "port", port)
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Server stopped", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Server shut down")
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// markers
+//////// a living player can mark a spot, which the server passes on to their
+//////// team, themselves included, and no one else; how often a player can
+//////// mark is limited so they cannot flood their teammates' screens
+
+const markCooldown = time.Second
+
+// pass a player's marker on to their team
+func (lobby *lobby) relayMark(markerId int, x, y, z int8) error {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	marker := &lobby.players[markerId]
+	if !marker.isAlive || marker.limbo {
+		return errors.New("Only the living can mark")
+	}
+	now := lobby.clock.now()
+	if now.Sub(marker.markedAt) < markCooldown {
+		return errors.New("Marking too often")
+	}
+	marker.markedAt = now
+
+	message := protocol.EncodeMarker(markerId, x, y, z)
+	for _, player := range lobby.players {
+		if player.Team != marker.Team || !player.isConnected() {
+			continue
+		}
+		if err := writeMessage(player.conn, message); err != nil {
+			lobby.logger.Warn("Could not send message", "player", player.id, "header", protocol.MarkerHeader, "error", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/navigation"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// movement
+//////// the server has the final say on where players are, clients only tell
+//////// it how far they moved; how far across and how far up a player can go
+//////// is each limited over time, and a player can only be off the ground
+//////// for as long and as high as a jump, or a jump pad, takes them
+
+const (
+	// fastest a player can run in units per second, with some leeway for the
+	// client's frame rate
+	maxRunSpeed = 9
+	// unused movement that can be saved up, so that moves bunched together by
+	// the network are not refused
+	maxMoveAllowance = maxRunSpeed / 2.0
+	// furthest a player can rise or fall in one move
+	maxVerticalMove = 4
+	// fastest a player can rise in units per second, running up a ramp or
+	// jumping again as soon as they land
+	maxClimbSpeed = maxRunSpeed
+	// a jump takes the feet this high above where they left the ground, with
+	// some leeway, and keeps them in the air for less than this long, with
+	// some for moves bunched together by the network
+	maxJumpHeight = 4
+	maxAirTime    = 1500 * time.Millisecond
+	// rising that can be saved up, a jump straight after stepping up a ledge
+	maxClimbAllowance = maxJumpHeight + 1
+	// how far feet can be from the top of a block and still stand on it,
+	// positions being rounded and ramp tops sloping under them
+	supportTolerance = 2 * collisionTolerance
+	// positions are rounded to the scaling factor, so walls get that much slack
+	collisionTolerance = 1.0 / protocol.ScalingFactor
+	crouchHeight       = 1.3
+	// a move is checked for collisions this often along the way, closer than a
+	// player is wide, so that no block can be skipped over
+	sweepStep = navigation.PlayerHalfWidth
+	// lag gets the odd move refused, but this many in a short while means the
+	// client is cheating, and it is kicked
+	maxRefusedMoves   = 20
+	refusedMoveWindow = 5 * time.Second
+)
+
+// move a player by what their client proposed, returning false if the move
+// was refused and the client needs correcting, the lobby's mutex must be held
+func (lobby *lobby) movePlayer(player *player, dx, dy, dz int8) bool {
+	now := time.Now()
+	runSpeed := player.runSpeed(now)
+	elapsed := float32(now.Sub(player.lastMove).Seconds())
+	player.moveAllowance = min(player.moveAllowance+elapsed*runSpeed, maxMoveAllowance*runSpeed/maxRunSpeed)
+	player.climbAllowance = min(player.climbAllowance+elapsed*maxClimbSpeed, maxClimbAllowance)
+	player.lastMove = now
+
+	// nobody moves outside of play, so these are moves left over from
+	// before the round was reset
+	if !lobby.playing() || !player.isAlive {
+		return true
+	}
+
+	from := unscaleLocation(player.x, player.y, player.z)
+	if lobby.supported(from) {
+		player.groundedAt, player.groundY = now, from[1]
+	}
+	// a jump pad throws players up as far as it likes
+	launched := now.Before(player.launchedUntil)
+
+	distance := float32(math.Hypot(float64(dx), float64(dz))) / protocol.ScalingFactor
+	if distance > player.moveAllowance {
+		return false
+	}
+	if math.Abs(float64(dy))/protocol.ScalingFactor > maxVerticalMove {
+		return false
+	}
+	rise := float32(max(dy, 0)) / protocol.ScalingFactor
+	if rise > player.climbAllowance && !launched {
+		return false
+	}
+
+	x, y, z := int(player.x)+int(dx), int(player.y)+int(dy), int(player.z)+int(dz)
+	if x != int(int8(x)) || y != int(int8(y)) || z != int(int8(z)) {
+		return false
+	}
+	to := unscaleLocation(int8(x), int8(y), int8(z))
+	if lobby.collidesAlong(from, to, player.height()) {
+		return false
+	}
+	// anyone can fall, however long it takes
+	if !launched && dy >= 0 && !player.inJumpArc(now, to[1]) && !lobby.supported(to) {
+		return false
+	}
+
+	player.x, player.y, player.z = int8(x), int8(y), int8(z)
+	player.moveAllowance -= distance
+	player.climbAllowance = max(player.climbAllowance-rise, 0)
+	return true
+}
+
+// whether a player whose feet are at some height could have jumped there
+// from where they last stood
+func (player *player) inJumpArc(now time.Time, feetY float32) bool {
+	return now.Sub(player.groundedAt) < maxAirTime && feetY <= player.groundY+maxJumpHeight
+}
+
+// put a player on the ground where they are, as if they had just landed there
+func (player *player) ground(now time.Time) {
+	player.groundedAt, player.groundY = now, protocol.Int8ScaleToFloat32(player.y)
+}
+
+// whether a player standing at a location has the top of a block of the
+// current map, or a closed door, under their feet
+func (lobby *lobby) supported(feet maps.Vector3) bool {
+	footprintMin := maps.Vector3{feet[0] - navigation.PlayerHalfWidth - collisionTolerance, feet[1], feet[2] - navigation.PlayerHalfWidth - collisionTolerance}
+	footprintMax := maps.Vector3{feet[0] + navigation.PlayerHalfWidth + collisionTolerance, feet[1], feet[2] + navigation.PlayerHalfWidth + collisionTolerance}
+
+	for _, block := range lobby.solidBlocks() {
+		if footprintMax[0] < block.Min[0] || block.Max[0] < footprintMin[0] || footprintMax[2] < block.Min[2] || block.Max[2] < footprintMin[2] {
+			continue
+		}
+		if top := block.TopUnder(footprintMin, footprintMax); math.Abs(float64(feet[1]-top)) <= supportTolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// whether a player moving between two locations would pass through a block on
+// the way, where they started from is not checked; a player going up steps up
+// before moving across, and one going down moves across before dropping, so
+// stepping onto a ledge or walking up or down a ramp is not caught on its edge
+func (lobby *lobby) collidesAlong(from, to maps.Vector3, height float32) bool {
+	corner := maps.Vector3{from[0], to[1], from[2]}
+	if to[1] < from[1] {
+		corner = maps.Vector3{to[0], from[1], to[2]}
+	}
+	if corner == from || corner == to {
+		return lobby.collidesStraight(from, to, height)
+	}
+	return lobby.collidesStraight(from, corner, height) || lobby.collidesStraight(corner, to, height)
+}
+
+// whether a player moving in a straight line between two locations would pass
+// through a block on the way, where they started from is not checked
+func (lobby *lobby) collidesStraight(from, to maps.Vector3, height float32) bool {
+	steps := max(int(math.Ceil(float64(distance(from, to)/sweepStep))), 1)
+	for step := 1; step <= steps; step++ {
+		fraction := float32(step) / float32(steps)
+		feet := maps.Vector3{
+			from[0] + (to[0]-from[0])*fraction,
+			from[1] + (to[1]-from[1])*fraction,
+			from[2] + (to[2]-from[2])*fraction,
+		}
+		if lobby.collidesAt(feet, height) {
+			return true
+		}
+	}
+	return false
+}
+
+// whether a player of some height standing at a location would be inside a
+// block of the current map, or a closed door
+func (lobby *lobby) collidesAt(feet maps.Vector3, height float32) bool {
+	playerMin := maps.Vector3{feet[0] - navigation.PlayerHalfWidth + collisionTolerance, feet[1] + collisionTolerance, feet[2] - navigation.PlayerHalfWidth + collisionTolerance}
+	playerMax := maps.Vector3{feet[0] + navigation.PlayerHalfWidth - collisionTolerance, feet[1] + height - collisionTolerance, feet[2] + navigation.PlayerHalfWidth - collisionTolerance}
+
+	for _, block := range lobby.solidBlocks() {
+		if block.Overlaps(playerMin, playerMax) {
+			return true
+		}
+	}
+	return false
+}
+
+// put every player at their team's spawn for the coming round, clients work
+// out the same spawn themselves, the lobby's mutex must be held
+func (lobby *lobby) spawnPlayers() {
+	for id := range lobby.players {
+		lobby.spawn(id)
+	}
+}
+
+// put the player in a slot at its spawn for the round, the lobby's mutex
+// must be held
+func (lobby *lobby) spawn(id int) {
+	spawns := lobby.config.maps[lobby.mapIndex].Spawns
+	player := &lobby.players[id]
+	teamSpawns := spawns.A
+	if lobby.teamOf(id) == protocol.B {
+		teamSpawns = spawns.B
+	}
+	spawn := teamSpawns[(lobby.round+id)%len(teamSpawns)]
+	player.x = protocol.Float32ScaleToInt8(spawn[0])
+	player.y = protocol.Float32ScaleToInt8(spawn[1])
+	player.z = protocol.Float32ScaleToInt8(spawn[2])
+	player.ground(time.Now())
+}
+
+// count a refused move, reporting whether the player has had so many refused
+// lately that they must be cheating rather than lagging
+func (player *player) refuseMove(now time.Time) bool {
+	if now.Sub(player.refusedSince) > refusedMoveWindow {
+		player.refusedMoves, player.refusedSince = 0, now
+	}
+	player.refusedMoves++
+	return player.refusedMoves > maxRefusedMoves
+}
+
+// crouching players are shorter, so can fit under lower blocks and are
+// harder to hit
+func (player *player) height() float32 {
+	if player.crouching {
+		return crouchHeight
+	}
+	return navigation.PlayerHeight
+}
+
+// the middle of the player's body, below their head
+func (player *player) chest() maps.Vector3 {
+	feet := unscaleLocation(player.x, player.y, player.z)
+	return maps.Vector3{feet[0], feet[1] + (player.height()-protocol.HeadHeight)/2, feet[2]}
+}
+
+// the middle of the player's head, the top of their box
+func (player *player) head() maps.Vector3 {
+	feet := unscaleLocation(player.x, player.y, player.z)
+	return maps.Vector3{feet[0], feet[1] + player.height() - protocol.HeadHeight/2, feet[2]}
+}
+
+func unscaleLocation(x, y, z int8) maps.Vector3 {
+	return maps.Vector3{protocol.Int8ScaleToFloat32(x), protocol.Int8ScaleToFloat32(y), protocol.Int8ScaleToFloat32(z)}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+// a lobby in play on a floor with a wall too high to jump onto, and a player
+// standing on the floor with their allowances saved up
+func newMovementLobby(t *testing.T) (*lobby, *player) {
+	t.Helper()
+	gameMap := &maps.Map{Blocks: []maps.Block{
+		{Name: "floor", Min: maps.Vector3{-10, 0, -10}, Max: maps.Vector3{10, 0, 10}},
+		{Name: "wall", Min: maps.Vector3{2, 0, -10}, Max: maps.Vector3{4, 6, 10}},
+	}}
+	lobby := newLobby("test", &config{numPlayers: 2, teamSize: 1, maps: []*maps.Map{gameMap}}, nil)
+	t.Cleanup(lobby.cleanUp)
+	lobby.round, lobby.inPlay = 1, true
+	player := &lobby.players[0]
+	*player = *newBotPlayer(0, protocol.A, lobby.config.botDifficulty)
+	player.isAlive = true
+	player.lastMove = time.Now().Add(-time.Second)
+	return lobby, player
+}
+
+// a jump goes up as high as a jump does and comes back down, but no higher
+func TestJump(t *testing.T) {
+	lobby, player := newMovementLobby(t)
+
+	for _, dy := range []int8{3 * protocol.ScalingFactor, protocol.ScalingFactor} {
+		if !lobby.movePlayer(player, 0, dy, 0) {
+			t.Fatalf("Jump refused at %d", player.y)
+		}
+	}
+	if lobby.movePlayer(player, 0, protocol.ScalingFactor, 0) {
+		t.Fatalf("Rose to %d in the air", player.y)
+	}
+	if !lobby.movePlayer(player, 0, -4*protocol.ScalingFactor, 0) || player.y != 0 {
+		t.Fatalf("Landing left the player at %d", player.y)
+	}
+}
+
+// rising is limited over time, a little at a time still runs out, and once a
+// jump is over a player in the air can only fall
+func TestClimbRefused(t *testing.T) {
+	lobby, player := newMovementLobby(t)
+
+	player.climbAllowance, player.lastMove = 0, time.Now()
+	if lobby.movePlayer(player, 0, protocol.ScalingFactor, 0) {
+		t.Fatalf("Rose with nothing left to climb")
+	}
+
+	player.lastMove = time.Now().Add(-time.Second)
+	stopped := false
+	for range 4 * maxClimbAllowance {
+		if !lobby.movePlayer(player, 0, protocol.ScalingFactor/2, 0) {
+			stopped = true
+			break
+		}
+	}
+	if !stopped {
+		t.Fatalf("Climbed to %d off the ground", player.y)
+	}
+
+	player.groundedAt = time.Now().Add(-2 * maxAirTime)
+	if lobby.movePlayer(player, protocol.ScalingFactor/2, 0, 0) {
+		t.Fatalf("Walked across the air at %d", player.y)
+	}
+	if !lobby.movePlayer(player, 0, -protocol.ScalingFactor, 0) {
+		t.Fatalf("Fall refused at %d", player.y)
+	}
+}
+
+// the top of a block is as good as the floor to stand on, but only a jump
+// pad can get a player onto one too high to jump onto
+func TestStandOnBlock(t *testing.T) {
+	lobby, player := newMovementLobby(t)
+	player.x, player.y = 3*protocol.ScalingFactor, 6*protocol.ScalingFactor
+	player.groundedAt = time.Now().Add(-2 * maxAirTime)
+	if !lobby.movePlayer(player, 0, 0, protocol.ScalingFactor) {
+		t.Fatalf("Walking along the top of the wall refused")
+	}
+
+	player.x, player.y, player.z = protocol.ScalingFactor*3/2, 0, 0
+	for lobby.movePlayer(player, 0, protocol.ScalingFactor, 0) {
+	}
+	if player.y >= 6*protocol.ScalingFactor {
+		t.Fatalf("Jumped up to %d beside the wall", player.y)
+	}
+}
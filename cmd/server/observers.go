@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/gorilla/websocket"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// observers
+//////// an observer watches the match without a slot, for casting or
+//////// refereeing; they are sent what every player is, and can join at any
+//////// time, being caught up on the match if it is underway
+
+// let an observer in if there is room, the lobby's mutex must not be held
+func (lobby *lobby) admitObserver(conn *websocket.Conn) error {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	if len(lobby.observers) >= protocol.MaxObservers {
+		_ = conn.WriteMessage(websocket.BinaryMessage, protocol.EncodeResponse(protocol.Failure, protocol.Admission{}))
+		return errors.New("Too many observers")
+	}
+
+	// sent under the lock so no broadcast can sneak in before the match state
+	admission := protocol.Admission{Id: protocol.ObserverId, TickRate: lobby.config.tickRate, TeamSize: lobby.config.teamSize, Map: lobby.currentMap()}
+	err := conn.WriteMessage(websocket.BinaryMessage, protocol.EncodeResponse(protocol.Success, admission))
+	if err == nil && lobby.warmup {
+		err = writeMessage(conn, protocol.EncodeWarmup())
+	}
+	if err == nil && lobby.round > 0 {
+		err = writeMessage(conn, protocol.EncodeResume(lobby.matchState()))
+	}
+	if err == nil && lobby.round > 0 {
+		err = writeMessage(conn, protocol.EncodeHealthPacks(lobby.takenHealthPackList()))
+	}
+	if err == nil && len(lobby.openDoors) > 0 {
+		err = writeMessage(conn, protocol.EncodeDoors(lobby.openDoorList()))
+	}
+	if err == nil && !lobby.roundEnds.IsZero() {
+		err = writeMessage(conn, protocol.EncodeRoundTime(lobby.roundEnds.Sub(lobby.clock.now())))
+	}
+	if err == nil && !lobby.playsAt.IsZero() {
+		err = writeMessage(conn, protocol.EncodeGrace(lobby.playsAt.Sub(lobby.clock.now())))
+	}
+	if err != nil {
+		return err
+	}
+	lobby.observers[conn] = struct{}{}
+	return nil
+}
+
+// wait for the observer to leave, anything they send is ignored
+func (lobby *lobby) observe(conn *websocket.Conn) {
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	lobby.mutex.Lock()
+	delete(lobby.observers, conn)
+	lobby.dropSpectator(conn)
+	lobby.mutex.Unlock()
+}
+
+// send a message to every connected player and observer, the lobby's mutex
+// must be held
+func (lobby *lobby) sendToAll(message []byte) {
+	lobby.record(message)
+	for _, player := range lobby.players {
+		if player.isConnected() {
+			if err := writeMessage(player.conn, message); err != nil {
+				lobby.logger.Warn("Could not send message", "player", player.id, "header", protocol.MessageHeader(message[0]), "error", err)
+			}
+		}
+	}
+	for conn := range lobby.observers {
+		if err := writeMessage(conn, message); err != nil {
+			lobby.logger.Warn("Could not send message", "observer", conn.RemoteAddr(), "header", protocol.MessageHeader(message[0]), "error", err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+)
+
+//////// RCON
+//////// with -rcon-port the server speaks the Source RCON protocol on its own
+//////// TCP port, so hosting panels and RCON tools can manage it remotely: a
+//////// connection authenticates with the RCON password, and then runs the
+//////// same commands as the console, each connection managing its own lobby
+
+// the kinds of packet, the auth response and a command share a number, and
+// are told apart by which way they go
+const (
+	rconAuth          int32 = 3
+	rconAuthResponse  int32 = 2
+	rconExecCommand   int32 = 2
+	rconResponseValue int32 = 0
+)
+
+const (
+	rconMaxPacketSize = 4096 // counting the id, kind and body, but not the size itself
+	rconHeaderSize    = 10   // the id, kind and the two nulls ending the body
+	rconIdleTimeout   = 10 * time.Minute
+)
+
+// answer RCON connections until the listener is closed
+func (server *server) serveRcon(listener net.Listener, password string, shutdown func()) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Warn("Stopped accepting RCON connections", "error", err)
+			}
+			return
+		}
+		go server.rconSession(conn, password, shutdown)
+	}
+}
+
+func (server *server) rconSession(conn net.Conn, password string, shutdown func()) {
+	defer conn.Close()
+	logger := slog.With("rcon", conn.RemoteAddr())
+	reader := bufio.NewReader(conn)
+	// the reply to the shutdown command goes out before the server stops
+	session := server.newConsoleSession(func() { go shutdown() })
+	authenticated := false
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(rconIdleTimeout))
+		id, kind, body, err := readRconPacket(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				logger.Debug("RCON connection closed", "error", err)
+			}
+			return
+		}
+
+		switch {
+		case kind == rconAuth:
+			// an empty response comes before the auth response, as tools
+			// written against Source servers expect
+			err = writeRconPacket(conn, id, rconResponseValue, "")
+			if subtle.ConstantTimeCompare([]byte(body), []byte(password)) != 1 {
+				logger.Warn("Wrong RCON password")
+				_ = writeRconPacket(conn, -1, rconAuthResponse, "")
+				return
+			}
+			authenticated = true
+			logger.Info("RCON authenticated")
+			if err == nil {
+				err = writeRconPacket(conn, id, rconAuthResponse, "")
+			}
+
+		case !authenticated:
+			logger.Warn("RCON command before authenticating")
+			return
+
+		case kind == rconExecCommand:
+			logger.Info("RCON command", "command", body)
+			var output bytes.Buffer
+			session.execute(body, &output)
+			err = writeRconResponse(conn, id, output.Bytes())
+
+		case kind == rconResponseValue:
+			// tools send an empty response after a command to find where a
+			// reply split over several packets ends, which is mirrored
+			// back followed by a packet Source servers send only then
+			err = writeRconPacket(conn, id, rconResponseValue, "")
+			if err == nil {
+				err = writeRconPacket(conn, id, rconResponseValue, "\x00\x01\x00\x00")
+			}
+		}
+		if err != nil {
+			logger.Debug("RCON connection closed", "error", err)
+			return
+		}
+	}
+}
+
+// a reply too long for one packet is split over as many as it needs
+func writeRconResponse(w io.Writer, id int32, output []byte) error {
+	const most = rconMaxPacketSize - rconHeaderSize
+	for first := true; first || len(output) > 0; first = false {
+		body := output[:min(len(output), most)]
+		output = output[len(body):]
+		if err := writeRconPacket(w, id, rconResponseValue, string(body)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packets are their size, id and kind as little endian int32s, then the body
+// and two nulls
+func readRconPacket(reader *bufio.Reader) (id, kind int32, body string, err error) {
+	var size int32
+	if err = binary.Read(reader, binary.LittleEndian, &size); err != nil {
+		return 0, 0, "", err
+	}
+	if size < rconHeaderSize || rconMaxPacketSize < size {
+		return 0, 0, "", fmt.Errorf("Bad RCON packet size %d", size)
+	}
+	packet := make([]byte, size)
+	if _, err = io.ReadFull(reader, packet); err != nil {
+		return 0, 0, "", err
+	}
+	if packet[size-2] != 0 || packet[size-1] != 0 {
+		return 0, 0, "", errors.New("RCON packet body is not terminated")
+	}
+	id = int32(binary.LittleEndian.Uint32(packet[0:4]))
+	kind = int32(binary.LittleEndian.Uint32(packet[4:8]))
+	return id, kind, string(packet[8 : size-2]), nil
+}
+
+func writeRconPacket(w io.Writer, id, kind int32, body string) error {
+	packet := make([]byte, 0, 4+rconHeaderSize+len(body))
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(rconHeaderSize+len(body)))
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(id))
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(kind))
+	packet = append(append(packet, body...), 0, 0)
+	_, err := w.Write(packet)
+	return err
+}
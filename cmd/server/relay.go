@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// shooterTV
+//////// with -tv-delay every broadcast of a lobby is recorded along with when
+//////// it went out on the lobby's clock, and anyone can watch the match at
+//////// /tv that far behind, so spectators of a tournament cannot tell the
+//////// players anything they would not already know; a viewer joins like an
+//////// observer, and however late they come they are sent the recording up
+//////// to the delay straight away, then the rest of it as it comes due
+
+// a frame sent to everyone, and how long after the recording started
+type relayedFrame struct {
+	at      time.Duration
+	message []byte
+}
+
+// the lobby's recording, guarded by the lobby's mutex
+type relay struct {
+	delay    time.Duration
+	start    time.Time // on the lobby's clock
+	startMap string
+	frames   []relayedFrame
+	finished bool // nothing more will be recorded
+}
+
+func newRelay(delay time.Duration, start time.Time, startMap string) *relay {
+	return &relay{delay: delay, start: start, startMap: startMap}
+}
+
+// keep a frame sent to everyone, the lobby's mutex must be held
+func (lobby *lobby) record(message []byte) {
+	if lobby.relay == nil || lobby.relay.finished {
+		return
+	}
+	lobby.relay.frames = append(lobby.relay.frames, relayedFrame{at: lobby.clock.now().Sub(lobby.relay.start), message: message})
+}
+
+// the match is over and everyone has been sent off, the lobby's mutex must be
+// held
+func (lobby *lobby) finishRecording() {
+	if lobby.relay != nil {
+		lobby.relay.finished = true
+	}
+}
+
+// a viewer of the lobby's relay, which stays around until the last one has
+// seen the end of the match
+func (server *server) serveTV(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("lobby")
+	if name == "" {
+		name = defaultLobbyName
+	}
+
+	server.mutex.Lock()
+	lobby, ok := server.lobbies[name]
+	if ok {
+		lobby.connections++
+	}
+	server.mutex.Unlock()
+	if !ok {
+		http.Error(w, "No match is being played in that lobby", http.StatusNotFound)
+		return
+	}
+	defer server.leaveLobby(lobby)
+	lobby.serveTV(w, r)
+}
+
+func (lobby *lobby) serveTV(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		lobby.logger.Warn("Could not upgrade connection", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(protocol.KeepaliveTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(protocol.KeepaliveTimeout))
+	})
+	stopKeepalive := make(chan struct{})
+	defer close(stopKeepalive)
+	go keepalive(conn, stopKeepalive)
+
+	// viewers have no slot to take, or take back
+	id, token, name, err := lobby.readJoin(conn)
+	if err == nil && (id != protocol.ObserverId || token != nil) {
+		_ = conn.WriteMessage(websocket.BinaryMessage, protocol.EncodeResponse(protocol.Failure, protocol.Admission{}))
+		err = errors.New("Only observers can watch the relay")
+	}
+	if err != nil {
+		lobby.logger.Info("Viewer refused", "error", err)
+		return
+	}
+	admission := protocol.Admission{Id: protocol.ObserverId, TickRate: lobby.config.tickRate, TeamSize: lobby.config.teamSize, Map: lobby.relay.startMap}
+	if err := conn.WriteMessage(websocket.BinaryMessage, protocol.EncodeResponse(protocol.Success, admission)); err != nil {
+		return
+	}
+
+	lobby.logger.Info("Viewer joined", "name", name)
+	if err := lobby.stream(conn); err != nil {
+		lobby.logger.Info("Viewer left", "name", name, "error", err)
+		return
+	}
+	lobby.logger.Info("Viewer saw the match out", "name", name)
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Match is over"))
+}
+
+// send the recording as it comes due, until the viewer leaves or has been
+// sent all of it
+func (lobby *lobby) stream(conn *websocket.Conn) error {
+	// anything the viewer sends is ignored, but reading notices them leaving
+	left := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				left <- err
+				return
+			}
+		}
+	}()
+
+	ticker := lobby.clock.newTicker(lobby.tickInterval())
+	defer ticker.Stop()
+
+	sent := 0
+	for {
+		select {
+		case err := <-left:
+			return err
+		case <-lobby.done:
+			return errors.New("Lobby closed")
+		case <-ticker.channel():
+		}
+
+		lobby.mutex.Lock()
+		shown := lobby.clock.now().Sub(lobby.relay.start) - lobby.relay.delay
+		due := sent
+		for due < len(lobby.relay.frames) && lobby.relay.frames[due].at <= shown {
+			due++
+		}
+		frames := lobby.relay.frames[sent:due]
+		over := lobby.relay.finished && due == len(lobby.relay.frames)
+		lobby.mutex.Unlock()
+
+		// recorded frames are never changed, so can be sent without the lock
+		for _, frame := range frames {
+			if err := writeMessage(conn, frame.message); err != nil {
+				return err
+			}
+		}
+		sent = due
+		if over {
+			return nil
+		}
+	}
+}
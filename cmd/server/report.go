@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// match reports
+//////// with -reports every lobby keeps a timeline of what happened in its
+//////// match, and once the match is over it is written out to its own file
+//////// in that directory along with the final score and everyone's stats,
+//////// so that a match can be gone back over after the server has moved on
+
+type matchReport struct {
+	Time        time.Time      `json:"time"` // when the match ended
+	Lobby       string         `json:"lobby"`
+	Finished    bool           `json:"finished"` // false if an admin ended it early
+	Rounds      int            `json:"rounds"`
+	TeamAPoints int            `json:"team_a_points"`
+	TeamBPoints int            `json:"team_b_points"`
+	Winner      string         `json:"winner"` // a, b or draw
+	Players     []reportPlayer `json:"players"`
+	Events      []matchEvent   `json:"events"` // oldest first
+}
+
+type reportPlayer struct {
+	Id          int            `json:"id"`
+	Name        string         `json:"name"`
+	Team        string         `json:"team"`
+	Bot         bool           `json:"bot"`
+	Kills       int            `json:"kills"`
+	WeaponKills map[string]int `json:"weapon_kills,omitempty"` // by the name of the weapon
+	Deaths      int            `json:"deaths"`
+	Assists     int            `json:"assists"`
+	ShotsFired  int            `json:"shots_fired"`
+	ShotsHit    int            `json:"shots_hit"`
+	Damage      int            `json:"damage"`
+}
+
+// something that happened in a match, players are named as they were then
+type matchEvent struct {
+	At       int64    `json:"at"` // milliseconds of server time, since the lobby was created
+	Round    int      `json:"round"`
+	Kind     string   `json:"kind"`
+	Player   string   `json:"player,omitempty"`
+	Victim   string   `json:"victim,omitempty"`
+	Weapon   string   `json:"weapon,omitempty"`
+	Headshot bool     `json:"headshot,omitempty"`
+	Assists  []string `json:"assists,omitempty"`
+	Team     string   `json:"team,omitempty"`
+	Map      string   `json:"map,omitempty"`
+}
+
+// the kinds of event in a timeline
+const (
+	joinedEvent     = "joined"
+	resumedEvent    = "resumed"
+	leftEvent       = "left"
+	kickedEvent     = "kicked"
+	roundEvent      = "round_started"
+	playEvent       = "play"
+	killEvent       = "kill"
+	roundWonEvent   = "round_won"
+	timedOutEvent   = "round_timed_out"
+	roundEndedEvent = "round_ended"
+	mapEvent        = "map_changed"
+	matchOverEvent  = "match_over"
+	restartEvent    = "match_restarted"
+)
+
+// add an event to the lobby's timeline, stamped with the time and round, and
+// pass it on to any overlay following the match, the lobby's mutex must be
+// held
+func (lobby *lobby) note(event matchEvent) {
+	event.At = lobby.serverTime().Milliseconds()
+	event.Round = lobby.round
+	if lobby.config.reportDirectory != "" {
+		lobby.events = append(lobby.events, event)
+	}
+	for feed := range lobby.feeds {
+		select {
+		case feed <- event:
+		default:
+		}
+	}
+}
+
+func teamName(team protocol.Team) string {
+	if team == protocol.B {
+		return "b"
+	}
+	return "a"
+}
+
+// the report of the lobby's match as it stands, the lobby's mutex must be held
+func (lobby *lobby) report(finished bool) *matchReport {
+	report := &matchReport{
+		Time:        time.Now().UTC(),
+		Lobby:       lobby.name,
+		Finished:    finished,
+		Rounds:      lobby.round,
+		TeamAPoints: lobby.teamAPoints,
+		TeamBPoints: lobby.teamBPoints,
+		Winner:      "draw",
+		Events:      lobby.events,
+	}
+	switch {
+	case lobby.teamAPoints > lobby.teamBPoints:
+		report.Winner = "a"
+	case lobby.teamBPoints > lobby.teamAPoints:
+		report.Winner = "b"
+	}
+	for _, player := range lobby.players {
+		if player.isEmpty() {
+			continue
+		}
+		weaponKills := make(map[string]int)
+		for weapon, kills := range player.weaponKills {
+			if kills > 0 {
+				weaponKills[protocol.Weapon(weapon).String()] = kills
+			}
+		}
+		report.Players = append(report.Players, reportPlayer{
+			Id:          player.id,
+			Name:        player.name,
+			Team:        teamName(player.Team),
+			Bot:         player.bot,
+			Kills:       player.killAmount,
+			WeaponKills: weaponKills,
+			Deaths:      player.deathAmount,
+			Assists:     player.assistAmount,
+			ShotsFired:  player.shotsFired,
+			ShotsHit:    player.shotsHit,
+			Damage:      player.damageDealt,
+		})
+	}
+	return report
+}
+
+// the lobby's match has just ended, which goes on its timeline, and the
+// report of it is written out to a file named after the lobby and when it
+// ended
+func (lobby *lobby) writeReport(finished bool) {
+	lobby.mutex.Lock()
+	lobby.note(matchEvent{Kind: matchOverEvent})
+	report := lobby.report(finished)
+	lobby.mutex.Unlock()
+	if lobby.config.reportDirectory == "" {
+		return
+	}
+
+	contents, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		lobby.logger.Error("Could not write match report", "error", err)
+		return
+	}
+	// lobby names can have anything in them, but the file has to stay in the
+	// directory
+	name := fmt.Sprintf("%s-%s.json", url.PathEscape(lobby.name), report.Time.Format("20060102-150405"))
+	path := filepath.Join(lobby.config.reportDirectory, name)
+	if err := os.WriteFile(path, append(contents, '\n'), 0o644); err != nil {
+		lobby.logger.Error("Could not write match report", "error", err)
+		return
+	}
+	lobby.logger.Info("Match report written", "path", path)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/gorilla/websocket"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// spectators
+//////// whoever joins a match that is underway watches it as an observer
+//////// instead of being turned away; with -promote-spectators they wait to
+//////// play, and at the start of each round every free slot is held for the
+//////// longest waiting of them, who is sent the token to rejoin into it with
+
+// someone watching who joined to play
+type spectator struct {
+	conn *websocket.Conn
+	name string
+}
+
+// let someone joining mid-match watch it, waiting for a slot if they can be
+// given one, the lobby's mutex must not be held
+func (lobby *lobby) admitSpectator(conn *websocket.Conn, name string) error {
+	if err := lobby.admitObserver(conn); err != nil {
+		return err
+	}
+	if lobby.config.promotion {
+		lobby.mutex.Lock()
+		lobby.spectators = append(lobby.spectators, spectator{conn: conn, name: name})
+		lobby.mutex.Unlock()
+	}
+	return nil
+}
+
+// someone watching has left, the lobby's mutex must be held
+func (lobby *lobby) dropSpectator(conn *websocket.Conn) {
+	lobby.spectators = slices.DeleteFunc(lobby.spectators, func(spectator spectator) bool {
+		return spectator.conn == conn
+	})
+}
+
+// hold every free slot for a spectator, in the order they joined, reporting
+// whether anyone was given one, the lobby's mutex must be held
+func (lobby *lobby) promoteSpectators() bool {
+	promoted := false
+	for len(lobby.spectators) > 0 && lobby.currentNumPlayers < lobby.config.numPlayers {
+		spectator := lobby.spectators[0]
+		lobby.spectators = lobby.spectators[1:]
+
+		id := lobby.freeSlotId()
+		newPlayer := newPlayer(id, lobby.teamOf(id), spectator.name, nil)
+		if err := writeMessage(spectator.conn, protocol.EncodePromoted(id, newPlayer.token)); err != nil {
+			lobby.logger.Warn("Could not send message", "observer", spectator.conn.RemoteAddr(), "header", protocol.PromotedHeader, "error", err)
+			continue
+		}
+
+		// the slot is held as it is for a player who dropped out, until the
+		// spectator rejoins into it
+		resumed := make(chan struct{})
+		newPlayer.resumed = resumed
+		lobby.players[id] = *newPlayer
+		lobby.currentNumPlayers++
+		lobby.note(matchEvent{Kind: joinedEvent, Player: newPlayer.name})
+		lobby.logger.Info("Spectator promoted", "player", id, "name", newPlayer.name)
+		promoted = true
+
+		go func() {
+			if !lobby.awaitResume(id, resumed) {
+				lobby.freeSlot(id)
+				lobby.logger.Info("Promoted spectator did not rejoin", "player", id)
+			}
+		}()
+	}
+	return promoted
+}
@@ -0,0 +1,40 @@
+package main
+
+import "net/http"
+
+//////// match state
+//////// the live state of a lobby's match, as the admin API reports it, is
+//////// served to anyone at /api/state for stream overlays and tournament
+//////// tools to poll, or followed at /api/feed, see feed.go; with -tv-delay
+//////// either would give away what shooterTV holds back, so then they need
+//////// the admin token
+
+func (server *server) registerState(mux *http.ServeMux, adminToken string) {
+	switch {
+	case server.config.tvDelay == 0:
+		mux.HandleFunc("GET /api/state", server.serveState)
+		mux.HandleFunc("GET /api/feed", server.serveFeed)
+	case adminToken != "":
+		mux.HandleFunc("GET /api/state", requireToken(adminToken, server.serveState))
+		mux.HandleFunc("GET /api/feed", requireToken(adminToken, server.serveFeed))
+	}
+}
+
+func (server *server) serveState(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("lobby")
+	if name == "" {
+		name = defaultLobbyName
+	}
+
+	server.mutex.Lock()
+	lobby, ok := server.lobbies[name]
+	server.mutex.Unlock()
+	if !ok {
+		http.Error(w, "No match is being played in that lobby", http.StatusNotFound)
+		return
+	}
+
+	// overlays are pages of their own, fetching from another origin
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	writeJSON(w, lobby.status())
+}
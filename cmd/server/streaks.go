@@ -0,0 +1,46 @@
+package main
+
+import "github.com/lezhou8/shooter/internal/protocol"
+
+//////// kill streaks
+//////// each enemy killed adds to the killer's streak and dying ends it; from a
+//////// double kill on, every kill of a streak is broadcast for clients to
+//////// announce, as is an ace, one player killing the whole other team by
+//////// themselves in a round
+
+const (
+	firstStreak = 2 // the fewest kills announced as a streak
+	smallestAce = 2 // the fewest players a team has to have for killing all of it to be an ace
+)
+
+// count a kill towards the killer's streak and end the killed player's,
+// returning the message to broadcast, or nil if there is nothing to
+// announce, the lobby's mutex must be held
+func (lobby *lobby) countStreak(killer, killed *player) []byte {
+	killed.streak = 0
+	if killer.id == killed.id || killer.Team == killed.Team {
+		return nil
+	}
+	killer.streak++
+	killer.roundKills++
+
+	ace := killer.roundKills >= smallestAce && killer.roundKills == lobby.teamSize(killed.Team)
+	if killer.streak < firstStreak && !ace {
+		return nil
+	}
+	lobby.logger.Debug("Kill streak", "player", killer.id, "kills", killer.streak, "ace", ace)
+	return protocol.EncodeStreak(killer.id, killer.streak, ace)
+}
+
+// how many players on a team are playing the round, the lobby's mutex must be
+// held
+func (lobby *lobby) teamSize(team protocol.Team) int {
+	size := 0
+	for i := range lobby.players {
+		player := &lobby.players[i]
+		if !player.isEmpty() && !player.limbo && player.Team == team {
+			size++
+		}
+	}
+	return size
+}
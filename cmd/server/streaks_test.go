@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+// a streak is announced from the second kill, killing the whole other team
+// alone is an ace, and dying ends it
+func TestStreak(t *testing.T) {
+	lobby := newLobby("test", &config{numPlayers: 4, teamSize: 2}, nil)
+	defer lobby.cleanUp()
+	for id, team := range []protocol.Team{protocol.A, protocol.A, protocol.B, protocol.B} {
+		lobby.players[id] = *newBotPlayer(id, team, lobby.config.botDifficulty)
+	}
+	killer := &lobby.players[0]
+
+	if message := lobby.countStreak(killer, &lobby.players[2]); message != nil {
+		t.Fatalf("First kill announced")
+	}
+	playerId, kills, ace, err := protocol.DecodeStreak(lobby.countStreak(killer, &lobby.players[3]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playerId != 0 || kills != 2 || !ace {
+		t.Fatalf("Second kill announced as player %d with %d kills, ace %t", playerId, kills, ace)
+	}
+
+	if message := lobby.countStreak(&lobby.players[1], &lobby.players[0]); message != nil || killer.streak != 0 {
+		t.Fatalf("Team kill announced, or left a streak of %d", killer.streak)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// votes
+//////// any player can call a vote to kick someone, to change to the next map
+//////// or to restart the match; everyone connected has a say, apart from bots
+//////// and whoever a kick vote is about, and the vote passes as soon as more
+//////// than half of them are for it, failing once that cannot happen or time
+//////// runs out; how it stands goes to everyone whenever it changes
+
+const (
+	voteTime     = 30 * time.Second
+	voteCooldown = time.Minute // before a player whose vote failed can call another
+)
+
+type vote struct {
+	protocol.VoteState
+	voters []bool // who has a say, by slot
+	voted  []bool
+	ends   time.Time
+}
+
+// start a vote, which the caller is taken to be for
+func (lobby *lobby) callVote(callerId int, kind protocol.VoteKind, targetId int) error {
+	lobby.mutex.Lock()
+	if err := lobby.checkVote(callerId, kind, targetId); err != nil {
+		lobby.mutex.Unlock()
+		return err
+	}
+
+	vote := &vote{
+		voters: make([]bool, len(lobby.players)),
+		voted:  make([]bool, len(lobby.players)),
+		ends:   lobby.clock.now().Add(voteTime),
+	}
+	vote.Kind, vote.CallerId = kind, callerId
+	if kind == protocol.KickVote {
+		vote.TargetId = targetId
+	}
+	voters := 0
+	for _, player := range lobby.players {
+		if player.isConnected() && !player.bot && !(kind == protocol.KickVote && player.id == targetId) {
+			vote.voters[player.id] = true
+			voters++
+		}
+	}
+	vote.Needed = voters/2 + 1
+	lobby.vote = vote
+	lobby.logger.Info("Vote called", "player", callerId, "kind", kind, "target", vote.TargetId)
+	message, passed := lobby.countBallot(callerId, true)
+	lobby.mutex.Unlock()
+
+	lobby.clock.afterFunc(voteTime, func() {
+		lobby.expireVote(vote)
+	})
+	lobby.broadcastByteMessage(message)
+	if passed {
+		lobby.carryOut(vote)
+	}
+	return nil
+}
+
+// whether a player can call a vote, the lobby's mutex must be held
+func (lobby *lobby) checkVote(callerId int, kind protocol.VoteKind, targetId int) error {
+	caller := lobby.players[callerId]
+	switch {
+	case lobby.vote != nil:
+		return errors.New("A vote is already being held")
+	case lobby.matchOver:
+		return errors.New("Match is over")
+	case lobby.clock.now().Before(caller.voteFailedAt.Add(voteCooldown)):
+		return errors.New("Player called a vote that failed too recently")
+	}
+
+	switch kind {
+	case protocol.KickVote:
+		if targetId == callerId {
+			return errors.New("Cannot vote to kick yourself")
+		}
+		if lobby.players[targetId].isEmpty() {
+			return errors.New("Player slot is empty")
+		}
+	case protocol.MapVote:
+		if len(lobby.config.mapNames) < 2 {
+			return errors.New("Only one map is played")
+		}
+		fallthrough
+	case protocol.RestartVote:
+		if lobby.round == 0 {
+			return errors.New("Match has not started")
+		}
+	}
+	return nil
+}
+
+// vote for or against the vote being held
+func (lobby *lobby) castBallot(id int, yes bool) error {
+	lobby.mutex.Lock()
+	vote := lobby.vote
+	switch {
+	case vote == nil:
+		lobby.mutex.Unlock()
+		return errors.New("No vote is being held")
+	case !vote.voters[id]:
+		lobby.mutex.Unlock()
+		return errors.New("Player has no say in this vote")
+	case vote.voted[id]:
+		lobby.mutex.Unlock()
+		return errors.New("Player has already voted")
+	}
+	message, passed := lobby.countBallot(id, yes)
+	lobby.mutex.Unlock()
+
+	lobby.broadcastByteMessage(message)
+	if passed {
+		lobby.carryOut(vote)
+	}
+	return nil
+}
+
+// count a player's vote and decide the vote if it can be, returning how it
+// now stands and whether it passed, the lobby's mutex must be held
+func (lobby *lobby) countBallot(id int, yes bool) ([]byte, bool) {
+	vote := lobby.vote
+	vote.voted[id] = true
+	if yes {
+		vote.Yes++
+	} else {
+		vote.No++
+	}
+
+	voters := 0
+	for _, voter := range vote.voters {
+		if voter {
+			voters++
+		}
+	}
+	switch {
+	case vote.Yes >= vote.Needed:
+		lobby.decideVote(protocol.VotePassed)
+	case vote.No > voters-vote.Needed:
+		lobby.decideVote(protocol.VoteFailed)
+	}
+	vote.Left = max(vote.ends.Sub(lobby.clock.now()), 0)
+	return protocol.EncodeVoteState(vote.VoteState), vote.Result == protocol.VotePassed
+}
+
+// the vote fails if it is still being held once its time is up
+func (lobby *lobby) expireVote(vote *vote) {
+	lobby.mutex.Lock()
+	if lobby.vote != vote {
+		lobby.mutex.Unlock()
+		return
+	}
+	lobby.decideVote(protocol.VoteFailed)
+	vote.Left = 0
+	message := protocol.EncodeVoteState(vote.VoteState)
+	lobby.mutex.Unlock()
+
+	lobby.broadcastByteMessage(message)
+}
+
+// the lobby's mutex must be held
+func (lobby *lobby) decideVote(result protocol.VoteResult) {
+	vote := lobby.vote
+	vote.Result = result
+	lobby.vote = nil
+	if result == protocol.VoteFailed {
+		lobby.players[vote.CallerId].voteFailedAt = lobby.clock.now()
+	}
+	lobby.logger.Info("Vote decided", "kind", vote.Kind, "passed", result == protocol.VotePassed, "yes", vote.Yes, "no", vote.No)
+}
+
+// a kick vote on a player who leaves before it is decided fails, so that it
+// cannot kick whoever takes their slot, returning how it ends up if there was
+// one, the lobby's mutex must be held
+func (lobby *lobby) dropKickVote(id int) []byte {
+	vote := lobby.vote
+	if vote == nil || vote.Kind != protocol.KickVote || vote.TargetId != id {
+		return nil
+	}
+	lobby.decideVote(protocol.VoteFailed)
+	vote.Left = max(vote.ends.Sub(lobby.clock.now()), 0)
+	return protocol.EncodeVoteState(vote.VoteState)
+}
+
+// do what a vote that passed was for; a map change or restart happens at the
+// start of the next round, which the round being played is ended early for
+func (lobby *lobby) carryOut(vote *vote) {
+	if vote.Kind == protocol.KickVote {
+		if err := lobby.kick(vote.TargetId); err != nil {
+			lobby.logger.Warn("Could not kick player", "player", vote.TargetId, "error", err)
+		}
+		return
+	}
+
+	lobby.mutex.Lock()
+	if vote.Kind == protocol.MapVote {
+		lobby.mapVoted = true
+	} else {
+		lobby.restartVoted = true
+	}
+	lobby.mutex.Unlock()
+	lobby.endRoundForVote()
+}
+
+// end the round being played without a point if a map change or restart is
+// waiting for the next one, which the round waiting to be played is only
+// ended for once it is
+func (lobby *lobby) endRoundForVote() {
+	lobby.mutex.Lock()
+	if !lobby.inPlay || lobby.roundOver || !(lobby.mapVoted || lobby.restartVoted) {
+		lobby.mutex.Unlock()
+		return
+	}
+	lobby.roundOver = true
+	lobby.roundEnds = time.Time{}
+	lobby.note(matchEvent{Kind: roundEndedEvent})
+	lobby.mutex.Unlock()
+
+	lobby.logger.Info("Round ended by vote")
+	lobby.nextRound()
+}
+
+// put the match back to how it was before the first round, with everyone's
+// score, statistics, money and items gone, and tell everyone, the lobby's
+// mutex must be held
+func (lobby *lobby) restartMatch() {
+	// the round being replaced would otherwise time out the first round
+	// played again
+	if lobby.roundTimer != nil {
+		lobby.roundTimer.Stop()
+		lobby.roundTimer = nil
+	}
+	lobby.round = 0
+	lobby.inPlay = false
+	lobby.teamAPoints, lobby.teamBPoints = 0, 0
+	for i := range lobby.players {
+		player := &lobby.players[i]
+		player.killAmount, player.deathAmount, player.assistAmount = 0, 0, 0
+		player.shotsFired, player.shotsHit = 0, 0
+		player.weaponKills = [protocol.Weapons]int{}
+		player.damageDealt = 0
+		player.streak, player.roundKills = 0, 0
+		player.money = protocol.StartingMoney
+		player.loseInventory()
+	}
+	lobby.note(matchEvent{Kind: restartEvent})
+	lobby.logger.Info("Match restarted")
+
+	// everyone is caught up as though they had just rejoined
+	for _, player := range lobby.players {
+		if !player.isConnected() {
+			continue
+		}
+		if err := writeMessage(player.conn, protocol.EncodeResume(lobby.resumeState(player.id))); err != nil {
+			lobby.logger.Warn("Could not send message", "player", player.id, "header", protocol.ResumeHeader, "error", err)
+		}
+	}
+	message := protocol.EncodeResume(lobby.matchState())
+	lobby.record(message)
+	for conn := range lobby.observers {
+		if err := writeMessage(conn, message); err != nil {
+			lobby.logger.Warn("Could not send message", "observer", conn.RemoteAddr(), "header", protocol.ResumeHeader, "error", err)
+		}
+	}
+}
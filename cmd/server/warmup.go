@@ -0,0 +1,67 @@
+package main
+
+import (
+	"time"
+
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// warmup
+//////// with -warmup, players who join a lobby that is still filling up are
+//////// spawned straight away and can run around and shoot each other until
+//////// the match starts, rather than waiting on the lobby screen; nothing
+//////// counts while warming up, no kills, deaths, money or points, and
+//////// anyone killed comes back a little later at their spawn
+
+// how long after being killed while warming up a player comes back
+const warmupRespawnTime = 2 * time.Second
+
+// whether players can move and act, in a round being played or while warming
+// up, the lobby's mutex must be held
+func (lobby *lobby) playing() bool {
+	return lobby.inPlay || lobby.warmup
+}
+
+// put someone who has just joined into the warmup, if the lobby is warming up
+func (lobby *lobby) joinWarmup(id int) {
+	lobby.mutex.Lock()
+	if !lobby.warmup {
+		lobby.mutex.Unlock()
+		return
+	}
+	player := &lobby.players[id]
+	if err := writeMessage(player.conn, protocol.EncodeWarmup()); err != nil {
+		lobby.logger.Warn("Could not send message", "player", id, "header", protocol.WarmupHeader, "error", err)
+	}
+	message := lobby.respawn(player)
+	lobby.mutex.Unlock()
+
+	lobby.broadcastByteMessage(message)
+}
+
+// bring a player killed while warming up back once they have been dead a while
+func (lobby *lobby) respawnLater(id int) {
+	lobby.clock.afterFunc(warmupRespawnTime, func() {
+		lobby.mutex.Lock()
+		player := &lobby.players[id]
+		// the match may have started, or they may have left, in the meantime
+		if !lobby.warmup || player.isEmpty() || player.isAlive {
+			lobby.mutex.Unlock()
+			return
+		}
+		message := lobby.respawn(player)
+		lobby.mutex.Unlock()
+
+		lobby.broadcastByteMessage(message)
+	})
+}
+
+// put a player back at their spawn with full health, returning the message
+// telling everyone, the lobby's mutex must be held
+func (lobby *lobby) respawn(player *player) []byte {
+	lobby.spawn(player.id)
+	player.health = protocol.MaxHealth
+	player.isAlive = true
+	player.crouching = false
+	return protocol.EncodeRespawn(player.id, player.x, player.y, player.z)
+}
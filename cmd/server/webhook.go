@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// webhook
+//////// with -webhook the server posts to a Discord channel when a lobby fills
+//////// up, when its match starts being played and with the final score, so a
+//////// community hosting pickup games hears about them without watching; the
+//////// posts go out one at a time, in order, away from the game so a slow or
+//////// unreachable Discord never holds up a lobby
+
+// posts waiting to be sent, any more than this are dropped
+const webhookQueueSize = 32
+
+// how long Discord is waited for when it asks for posts to slow down
+const maxWebhookRetryWait = 30 * time.Second
+
+type webhook struct {
+	url      string
+	messages chan string
+	client   http.Client
+}
+
+// the body Discord expects, mentions are turned off so that a player's name
+// cannot ping the channel
+type webhookPost struct {
+	Content         string `json:"content"`
+	AllowedMentions struct {
+		Parse []string `json:"parse"`
+	} `json:"allowed_mentions"`
+}
+
+func newWebhook(url string) *webhook {
+	return &webhook{url: url, messages: make(chan string, webhookQueueSize), client: http.Client{Timeout: 5 * time.Second}}
+}
+
+// queue a message to be posted
+func (webhook *webhook) post(message string) {
+	select {
+	case webhook.messages <- message:
+	default:
+		slog.Warn("Webhook post dropped, too many waiting")
+	}
+}
+
+// post queued messages until the server stops
+func (webhook *webhook) run() {
+	for message := range webhook.messages {
+		if err := webhook.send(message); err != nil {
+			slog.Warn("Could not post to webhook", "error", err)
+		}
+	}
+}
+
+func (webhook *webhook) send(message string) error {
+	post := webhookPost{Content: message}
+	post.AllowedMentions.Parse = []string{}
+	body, err := json.Marshal(post)
+	if err != nil {
+		return err
+	}
+
+	// a post Discord turned away for coming too fast is tried once more,
+	// after as long as it asked
+	for retried := false; ; retried = true {
+		response, err := webhook.client.Post(webhook.url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+		if response.StatusCode/100 == 2 {
+			return nil
+		}
+		if response.StatusCode != http.StatusTooManyRequests || retried {
+			return fmt.Errorf("Webhook responded with %s", response.Status)
+		}
+		wait, err := strconv.ParseFloat(response.Header.Get("Retry-After"), 64)
+		if err != nil {
+			wait = 1
+		}
+		time.Sleep(min(time.Duration(wait*float64(time.Second)), maxWebhookRetryWait))
+	}
+}
+
+// Discord formatting in a player's name is shown as it is typed
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`, ">", `\>`, "#", `\#`)
+
+// the names on a team, the lobby's mutex must be held
+func (lobby *lobby) teamNames(team protocol.Team) string {
+	var names []string
+	for _, player := range lobby.players {
+		if !player.isEmpty() && player.Team == team {
+			names = append(names, markdownEscaper.Replace(player.name))
+		}
+	}
+	if len(names) == 0 {
+		return "nobody"
+	}
+	return strings.Join(names, ", ")
+}
+
+// the lobby is full and its match is about to start, the lobby's mutex must
+// be held
+func (lobby *lobby) postFilled() {
+	if lobby.config.webhook == nil {
+		return
+	}
+	lobby.config.webhook.post(fmt.Sprintf("**%s** is full, the match starts soon\nTeam A: %s\nTeam B: %s",
+		markdownEscaper.Replace(lobby.name), lobby.teamNames(protocol.A), lobby.teamNames(protocol.B)))
+}
+
+// the first round is being played, the lobby's mutex must be held
+func (lobby *lobby) postStarted() {
+	if lobby.config.webhook == nil {
+		return
+	}
+	lobby.config.webhook.post(fmt.Sprintf("**%s**: the match has started on %s",
+		markdownEscaper.Replace(lobby.name), markdownEscaper.Replace(lobby.currentMap())))
+}
+
+// the match is over, with everyone's kills, deaths and assists, the lobby's
+// mutex must be held
+func (lobby *lobby) postFinalScore(finished bool) {
+	if lobby.config.webhook == nil {
+		return
+	}
+	var message strings.Builder
+	fmt.Fprintf(&message, "**%s**: ", markdownEscaper.Replace(lobby.name))
+	switch {
+	case lobby.teamAPoints > lobby.teamBPoints:
+		message.WriteString("Team A wins")
+	case lobby.teamBPoints > lobby.teamAPoints:
+		message.WriteString("Team B wins")
+	default:
+		message.WriteString("it is a draw")
+	}
+	fmt.Fprintf(&message, " %d-%d", lobby.teamAPoints, lobby.teamBPoints)
+	if !finished {
+		message.WriteString(", the match was ended early")
+	}
+	message.WriteString("\nKills/deaths/assists:")
+	for _, player := range lobby.players {
+		if !player.isEmpty() {
+			fmt.Fprintf(&message, "\n%s (%s) %d/%d/%d", markdownEscaper.Replace(player.name), strings.ToUpper(teamName(player.Team)),
+				player.killAmount, player.deathAmount, player.assistAmount)
+		}
+	}
+	lobby.config.webhook.post(message.String())
+}
@@ -0,0 +1,127 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"syscall/js"
+
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// draw
+//////// the map from above on the page's canvas, with X to the right and Z
+//////// downwards like the minimap, every player as a dot in their team's
+//////// colour pointing the way they look, and the score and kill feed on top
+
+const (
+	canvasMargin = 40 // pixels around the map, the score goes in the top one
+	wallHeight   = 0.5
+	dotRadius    = 6
+	fontSize     = 14
+)
+
+var (
+	backgroundColour = "rgb(245, 245, 245)"
+	wallColour       = "rgb(60, 60, 60)"
+	deadColour       = "rgb(120, 120, 120)"
+	textColour       = "rgb(0, 0, 0)"
+	teamColours      = [2]string{
+		protocol.A: "rgb(90, 170, 160)",
+		protocol.B: "rgb(200, 120, 80)",
+	}
+)
+
+type canvas struct {
+	element, context js.Value
+}
+
+func newCanvas(element js.Value) canvas {
+	return canvas{element: element, context: element.Call("getContext", "2d")}
+}
+
+func (canvas canvas) size() (float64, float64) {
+	return canvas.element.Get("width").Float(), canvas.element.Get("height").Float()
+}
+
+func (canvas canvas) fill(colour string) {
+	canvas.context.Set("fillStyle", colour)
+	canvas.context.Set("strokeStyle", colour)
+}
+
+func (canvas canvas) text(text string, x, y float64, colour string) {
+	canvas.fill(colour)
+	canvas.context.Set("font", fmt.Sprintf("%dpx monospace", fontSize))
+	canvas.context.Call("fillText", text, x, y)
+}
+
+// the corner of the map drawn top left, and how many pixels a unit takes up
+func mapScale(gameMap *maps.Map, width, height float64) (float64, float64, float64) {
+	lowX, lowZ := math.MaxFloat64, math.MaxFloat64
+	highX, highZ := -math.MaxFloat64, -math.MaxFloat64
+	for _, block := range gameMap.Blocks {
+		lowX, lowZ = min(lowX, float64(block.Min[0])), min(lowZ, float64(block.Min[2]))
+		highX, highZ = max(highX, float64(block.Max[0])), max(highZ, float64(block.Max[2]))
+	}
+	if highX <= lowX || highZ <= lowZ {
+		return 0, 0, 0
+	}
+	return lowX, lowZ, min((width-2*canvasMargin)/(highX-lowX), (height-2*canvasMargin)/(highZ-lowZ))
+}
+
+func (match *match) draw(canvas canvas) {
+	match.mutex.Lock()
+	defer match.mutex.Unlock()
+
+	width, height := canvas.size()
+	canvas.fill(backgroundColour)
+	canvas.context.Call("fillRect", 0, 0, width, height)
+
+	cornerX, cornerZ, scale := mapScale(match.gameMap, width, height)
+	toCanvas := func(x, z float64) (float64, float64) {
+		return canvasMargin + (x-cornerX)*scale, canvasMargin + (z-cornerZ)*scale
+	}
+	canvas.fill(wallColour)
+	for _, block := range match.gameMap.Blocks {
+		if block.Max[1]-block.Min[1] < wallHeight {
+			continue
+		}
+		left, top := toCanvas(float64(block.Min[0]), float64(block.Min[2]))
+		right, bottom := toCanvas(float64(block.Max[0]), float64(block.Max[2]))
+		canvas.context.Call("fillRect", left, top, right-left, bottom-top)
+	}
+
+	for id, player := range match.players {
+		if !player.located || match.roster.Name(id) == "" {
+			continue
+		}
+		colour := deadColour
+		if player.alive {
+			colour = teamColours[protocol.TeamOf(id, match.teamSize)]
+		}
+		x, y := toCanvas(float64(player.x), float64(player.z))
+		canvas.fill(colour)
+		canvas.context.Call("beginPath")
+		canvas.context.Call("arc", x, y, dotRadius, 0, 2*math.Pi)
+		canvas.context.Call("fill")
+		if player.alive {
+			yaw := float64(player.yaw)
+			canvas.context.Call("beginPath")
+			canvas.context.Call("moveTo", x, y)
+			canvas.context.Call("lineTo", x+math.Cos(yaw)*dotRadius*2, y+math.Sin(yaw)*dotRadius*2)
+			canvas.context.Call("stroke")
+		}
+		canvas.text(match.playerName(id), x+dotRadius, y-dotRadius, colour)
+	}
+
+	round := fmt.Sprintf("ROUND %d/%d", match.round, protocol.LastRound)
+	if match.over {
+		round = "MATCH OVER"
+	}
+	canvas.text(fmt.Sprintf("%s  A %d : %d B", round, match.teamAPoints, match.teamBPoints), canvasMargin, canvasMargin/2, textColour)
+	for i, line := range match.killFeed {
+		canvas.text(line, canvasMargin, height-canvasMargin/2-float64(len(match.killFeed)-1-i)*fontSize, textColour)
+	}
+}
@@ -0,0 +1,132 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"syscall/js"
+
+	"github.com/lezhou8/shooter/internal/connection"
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// browser client
+//////// built to WebAssembly for a page served by a server started with
+//////// -web, joins a lobby on that server as an observer over the browser's
+//////// websocket and watches the match from above; the page's query string
+//////// can give the lobby, name and password, such as ?lobby=default, and
+//////// tv=1 to watch through the server's shooterTV relay instead
+
+func main() {
+	location := js.Global().Get("location")
+	query := js.Global().Get("URLSearchParams").New(location.Get("search"))
+	param := func(name string) string {
+		if value := query.Call("get", name); !value.IsNull() {
+			return value.String()
+		}
+		return ""
+	}
+	lobby := param("lobby")
+	if lobby == "" {
+		lobby = "default"
+	}
+
+	path := "/ws"
+	if param("tv") != "" {
+		path = "/tv"
+	}
+
+	if err := watch(location.Get("host").String()+path, lobby, param("name"), param("password")); err != nil {
+		js.Global().Get("document").Call("getElementById", "status").Set("textContent", err.Error())
+	}
+	// the page keeps running the callbacks
+	select {}
+}
+
+// join the lobby at a server's path and draw the match every frame until it
+// is over
+func watch(endpoint, lobby, name, password string) error {
+	if !protocol.ValidName(name) {
+		return fmt.Errorf("Name must be at most %d bytes of printable characters", protocol.MaxNameLength)
+	}
+	socket, err := dialSocket(fmt.Sprintf("ws://%s?lobby=%s", endpoint, url.QueryEscape(lobby)))
+	if err != nil {
+		return err
+	}
+	admission, err := connection.Join(socket, protocol.EncodeJoin(protocol.ObserverId, name, password))
+	if err != nil {
+		socket.Close()
+		return err
+	}
+
+	gameMap, err := loadMap(admission.Map)
+	if err != nil {
+		socket.Close()
+		return err
+	}
+	match := newMatch(gameMap, admission.TeamSize)
+
+	canvas := newCanvas(js.Global().Get("document").Call("getElementById", "screen"))
+	var frame js.Func
+	frame = js.FuncOf(func(js.Value, []js.Value) any {
+		match.draw(canvas)
+		js.Global().Call("requestAnimationFrame", frame)
+		return nil
+	})
+	js.Global().Call("requestAnimationFrame", frame)
+
+	messages := connection.NewReader(socket)
+	for {
+		_, message, err := messages.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if len(message) == 0 {
+			continue
+		}
+		event, err := protocol.ParseServerMessage(message)
+		if err == nil && !match.hasSlots(protocol.PlayerIds(event)) {
+			err = errors.New("Player id is not a slot in the lobby")
+		}
+		if err != nil {
+			slog.Warn("Bad message", "error", err)
+			continue
+		}
+		match.handle(event)
+
+		// the next map is loaded ahead of the round it is played in
+		if mapChange, ok := event.(protocol.MapChangeEvent); ok {
+			if gameMap, err := loadMap(mapChange.Name); err == nil {
+				match.setMap(gameMap)
+			} else {
+				slog.Error("Could not load map", "error", err)
+			}
+		}
+	}
+}
+
+// maps are fetched from the server, which hands out the ones it plays
+func loadMap(name string) (*maps.Map, error) {
+	if !maps.ValidName(name) {
+		return nil, fmt.Errorf("Invalid map name %q", name)
+	}
+	response, err := http.Get(js.Global().Get("location").Get("origin").String() + "/maps/" + name + ".json")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Could not fetch map %s: %s", name, response.Status)
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	return maps.Parse(data)
+}
@@ -0,0 +1,133 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+//////// match
+//////// what an observer knows of the match, kept up to date from the
+//////// server's messages and read when drawing
+
+const killFeedLength = 5
+
+// where a player was last seen, on the floor plan
+type seenPlayer struct {
+	x, z    float32
+	yaw     float32
+	alive   bool
+	located bool // a location has come in since they joined
+}
+
+type match struct {
+	players                  []seenPlayer // by slot
+	teamSize                 int
+	roster                   protocol.Roster
+	round                    int
+	teamAPoints, teamBPoints int
+	gameMap                  *maps.Map
+	killFeed                 []string // newest last
+	over                     bool
+	mutex                    sync.Mutex
+}
+
+func newMatch(gameMap *maps.Map, teamSize int) *match {
+	return &match{players: make([]seenPlayer, 2*teamSize), teamSize: teamSize, gameMap: gameMap}
+}
+
+// whether every id from a message is one of the lobby's slots
+func (match *match) hasSlots(ids []int) bool {
+	for _, id := range ids {
+		if id < 0 || len(match.players) <= id {
+			return false
+		}
+	}
+	return true
+}
+
+func (match *match) setMap(gameMap *maps.Map) {
+	match.mutex.Lock()
+	defer match.mutex.Unlock()
+	match.gameMap = gameMap
+}
+
+func (match *match) playerName(id int) string {
+	if match.roster.Name(id) == "" {
+		return fmt.Sprintf("Player %d", id)
+	}
+	return match.roster.Name(id)
+}
+
+// the feed keeps the latest few lines, the match's mutex must be held
+func (match *match) addToFeed(line string) {
+	match.killFeed = append(match.killFeed, line)
+	if len(match.killFeed) > killFeedLength {
+		match.killFeed = match.killFeed[1:]
+	}
+}
+
+// keep up with one message from the server, as it was parsed
+func (match *match) handle(event any) {
+	match.mutex.Lock()
+	defer match.mutex.Unlock()
+
+	switch event := event.(type) {
+	case protocol.NextRoundEvent:
+		if match.round >= protocol.LastRound {
+			match.over = true
+			break
+		}
+		match.round++
+		for id := range match.players {
+			match.players[id].alive = match.roster.Name(id) != ""
+		}
+
+	case protocol.LocationsEvent:
+		for _, parcel := range event.Players {
+			player := &match.players[parcel.Id]
+			player.x = protocol.Int8ScaleToFloat32(parcel.X)
+			player.z = protocol.Int8ScaleToFloat32(parcel.Z)
+			player.yaw = protocol.ByteToYaw(parcel.Yaw)
+			player.located = true
+		}
+
+	case protocol.RespawnEvent:
+		match.players[event.PlayerId].alive = true
+
+	case protocol.KilledEvent:
+		match.players[event.KilledId].alive = false
+		line := fmt.Sprintf("%s [%s] %s", match.playerName(event.KillerId), event.Weapon, match.playerName(event.KilledId))
+		if event.Headshot {
+			line += " (HEADSHOT)"
+		}
+		match.addToFeed(line)
+
+	case protocol.SayEvent:
+		match.addToFeed("HOST: " + event.Text)
+
+	case protocol.TeamPointEvent:
+		if event.Team == protocol.A {
+			match.teamAPoints++
+		} else {
+			match.teamBPoints++
+		}
+
+	case protocol.PlayerDisconnectEvent:
+		match.players[event.Id] = seenPlayer{}
+
+	case protocol.Roster:
+		match.roster = event
+
+	case protocol.ResumeState:
+		match.round = event.Round
+		match.teamAPoints, match.teamBPoints = event.TeamAPoints, event.TeamBPoints
+		for _, score := range event.Players {
+			match.players[score.Id].alive = score.IsAlive
+		}
+	}
+}
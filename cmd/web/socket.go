@@ -0,0 +1,149 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"syscall/js"
+
+	"github.com/lezhou8/shooter/internal/connection"
+)
+
+//////// socket
+//////// the browser's own websocket, wrapped to read like gorilla's; its
+//////// callbacks cannot block, so messages are queued up until read
+
+type socketMessage struct {
+	messageType int
+	message     []byte
+}
+
+type socket struct {
+	websocket js.Value
+	queue     []socketMessage
+	err       error // set once the socket closes
+	ready     chan struct{}
+	mutex     sync.Mutex
+	callbacks []js.Func
+}
+
+// open a websocket, blocking until it is open
+func dialSocket(url string) (*socket, error) {
+	socket := &socket{
+		websocket: js.Global().Get("WebSocket").New(url),
+		ready:     make(chan struct{}, 1),
+	}
+	socket.websocket.Set("binaryType", "arraybuffer")
+
+	opened := make(chan struct{})
+	socket.on("open", func(js.Value) {
+		close(opened)
+	})
+	socket.on("message", func(event js.Value) {
+		data := event.Get("data")
+		if data.Type() == js.TypeString {
+			socket.push(socketMessage{connection.TextMessage, []byte(data.String())})
+			return
+		}
+		array := js.Global().Get("Uint8Array").New(data)
+		message := make([]byte, array.Length())
+		js.CopyBytesToGo(message, array)
+		socket.push(socketMessage{connection.BinaryMessage, message})
+	})
+	socket.on("close", func(event js.Value) {
+		socket.mutex.Lock()
+		socket.err = fmt.Errorf("Connection closed (%d) %s", event.Get("code").Int(), event.Get("reason").String())
+		socket.mutex.Unlock()
+		socket.signal()
+	})
+
+	// a socket that fails to open closes without opening
+	select {
+	case <-opened:
+		return socket, nil
+	case <-socket.ready:
+		socket.release()
+		return nil, socket.err
+	}
+}
+
+func (socket *socket) on(event string, handle func(event js.Value)) {
+	callback := js.FuncOf(func(this js.Value, arguments []js.Value) any {
+		handle(arguments[0])
+		return nil
+	})
+	socket.callbacks = append(socket.callbacks, callback)
+	socket.websocket.Set("on"+event, callback)
+}
+
+func (socket *socket) push(message socketMessage) {
+	socket.mutex.Lock()
+	socket.queue = append(socket.queue, message)
+	socket.mutex.Unlock()
+	socket.signal()
+}
+
+// wake up a reader waiting for messages
+func (socket *socket) signal() {
+	select {
+	case socket.ready <- struct{}{}:
+	default:
+	}
+}
+
+// the next message, blocking until there is one, messages that arrived
+// before the socket closed are still read
+func (socket *socket) ReadMessage() (int, []byte, error) {
+	for {
+		socket.mutex.Lock()
+		if len(socket.queue) > 0 {
+			message := socket.queue[0]
+			socket.queue = socket.queue[1:]
+			socket.mutex.Unlock()
+			return message.messageType, message.message, nil
+		}
+		err := socket.err
+		socket.mutex.Unlock()
+		if err != nil {
+			return 0, nil, err
+		}
+		<-socket.ready
+	}
+}
+
+func (socket *socket) WriteMessage(messageType int, message []byte) error {
+	socket.mutex.Lock()
+	err := socket.err
+	socket.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	switch messageType {
+	case connection.TextMessage:
+		socket.websocket.Call("send", string(message))
+	case connection.BinaryMessage:
+		array := js.Global().Get("Uint8Array").New(len(message))
+		js.CopyBytesToJS(array, message)
+		socket.websocket.Call("send", array)
+	default:
+		return errors.New("Unsupported message type")
+	}
+	return nil
+}
+
+// the callbacks are kept, as the close event still comes after closing
+func (socket *socket) Close() error {
+	socket.websocket.Call("close")
+	return nil
+}
+
+// only once the socket has closed
+func (socket *socket) release() {
+	for _, callback := range socket.callbacks {
+		callback.Release()
+	}
+	socket.callbacks = nil
+}
@@ -0,0 +1,102 @@
+// Package connection is the client's side of talking to the server once a
+// websocket is open, kept apart from any one front end so the desktop client
+// and the browser client join and read messages the same way.
+package connection
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+// websocket message types, as numbered by the websocket protocol
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+)
+
+// an open websocket, which gorilla's connections and the browser's can both
+// be
+type Conn interface {
+	ReadMessage() (messageType int, message []byte, err error)
+	WriteMessage(messageType int, message []byte) error
+	Close() error
+}
+
+// send the join message and wait for the server's answer, an error from
+// reading it is returned as it is, so a close frame can be told apart
+func Join(conn Conn, joinMessage []byte) (protocol.Admission, error) {
+	// the handshake is always binary
+	if err := conn.WriteMessage(BinaryMessage, joinMessage); err != nil {
+		return protocol.Admission{}, err
+	}
+	_, responseMessage, err := conn.ReadMessage()
+	if err != nil {
+		return protocol.Admission{}, err
+	}
+
+	response, admission, err := protocol.DecodeResponse(responseMessage)
+	if err != nil {
+		return protocol.Admission{}, err
+	}
+	switch response {
+	case protocol.Success:
+		return admission, nil
+	case protocol.WrongPassword:
+		return protocol.Admission{}, errors.New("Wrong password")
+	}
+	return protocol.Admission{}, errors.New("Server refused connection")
+}
+
+// send a message to the server in an encoding
+func Write(conn Conn, encoding protocol.Encoding, message []byte) error {
+	data, text, err := encoding.Encode(message, false)
+	if err != nil {
+		return err
+	}
+	if text {
+		return conn.WriteMessage(TextMessage, data)
+	}
+	return conn.WriteMessage(BinaryMessage, data)
+}
+
+// passes messages on from the server one at a time, turning any sent as JSON
+// back into binary and splitting up batches, so everything after, demos
+// included, sees each message on its own
+type Reader struct {
+	conn    Conn
+	batched [][]byte // left over from the last batch
+}
+
+func NewReader(conn Conn) *Reader {
+	return &Reader{conn: conn}
+}
+
+func (reader *Reader) ReadMessage() (int, []byte, error) {
+	if len(reader.batched) > 0 {
+		message := reader.batched[0]
+		reader.batched = reader.batched[1:]
+		return BinaryMessage, message, nil
+	}
+
+	messageType, message, err := reader.conn.ReadMessage()
+	if err != nil || (messageType != TextMessage && messageType != BinaryMessage) {
+		return messageType, message, err
+	}
+	// bad messages are skipped like empty ones
+	if message, err = protocol.Decode(message, messageType == TextMessage, true); err != nil {
+		slog.Warn("Bad message", "error", err)
+		return BinaryMessage, nil, nil
+	}
+	if len(message) == 0 || protocol.MessageHeader(message[0]) != protocol.BatchHeader {
+		return BinaryMessage, message, nil
+	}
+	batched, err := protocol.DecodeBatch(message)
+	if err != nil {
+		slog.Warn("Bad message", "header", protocol.BatchHeader, "error", err)
+		return BinaryMessage, nil, nil
+	}
+	reader.batched = batched[1:]
+	return BinaryMessage, batched[0], nil
+}
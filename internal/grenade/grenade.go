@@ -0,0 +1,160 @@
+// Package grenade simulates thrown grenades. The server and clients step them
+// in the same fixed ticks against the same map, so clients can follow a
+// grenade on their own between the server's updates.
+package grenade
+
+import (
+	"math"
+	"time"
+
+	"github.com/lezhou8/shooter/internal/maps"
+	"github.com/lezhou8/shooter/internal/protocol"
+)
+
+const (
+	ThrowSpeed  = 14  // units per second
+	ThrowHeight = 1.5 // above the thrower's feet
+	Fuse        = 2500 * time.Millisecond
+	TickRate    = 30 // steps per second
+
+	ExplosionRadius = 5                  // units, nobody further away is hurt
+	MaxDamage       = protocol.MaxHealth // at the centre of the explosion
+
+	SmokeRadius   = 3 // units, once the cloud has spread
+	SmokeSpread   = time.Second
+	SmokeDuration = 15 * time.Second
+
+	FlashRange    = 25 // units, nobody further away is blinded
+	FlashDuration = 3 * time.Second
+
+	Radius = 0.15 // half the width of the grenade's box
+
+	gravity        = -18  // units per second squared
+	restitution    = 0.45 // speed kept along an axis after bouncing off it
+	rollFriction   = 0.9  // horizontal speed kept each tick on the ground
+	minBounceSpeed = 1    // slower hits settle instead of bouncing
+)
+
+const tick = 1.0 / TickRate
+
+type Grenade struct {
+	Id       byte
+	Position maps.Vector3
+	Velocity maps.Vector3
+}
+
+// a grenade as it was last sent
+func FromState(state protocol.GrenadeState) Grenade {
+	return Grenade{
+		Id: state.Id,
+		Position: maps.Vector3{
+			protocol.Int8ScaleToFloat32(state.X),
+			protocol.Int8ScaleToFloat32(state.Y),
+			protocol.Int8ScaleToFloat32(state.Z),
+		},
+		Velocity: maps.Vector3{
+			protocol.VelocityScaleToFloat32(state.VX),
+			protocol.VelocityScaleToFloat32(state.VY),
+			protocol.VelocityScaleToFloat32(state.VZ),
+		},
+	}
+}
+
+func (grenade *Grenade) State() protocol.GrenadeState {
+	return protocol.GrenadeState{
+		Id: grenade.Id,
+		X:  protocol.Float32ScaleToInt8(grenade.Position[0]),
+		Y:  protocol.Float32ScaleToInt8(grenade.Position[1]),
+		Z:  protocol.Float32ScaleToInt8(grenade.Position[2]),
+		VX: protocol.Float32ScaleToVelocity(grenade.Velocity[0]),
+		VY: protocol.Float32ScaleToVelocity(grenade.Velocity[1]),
+		VZ: protocol.Float32ScaleToVelocity(grenade.Velocity[2]),
+	}
+}
+
+// move the grenade on by one tick, reporting whether it bounced off a block
+func (grenade *Grenade) Step(blocks []maps.Block) bool {
+	grenade.Velocity[1] += gravity * tick
+
+	// each axis is moved on its own, so the grenade bounces off whichever
+	// face of a block it ran into
+	bounced := false
+	for axis := range grenade.Position {
+		moved := grenade.Position
+		moved[axis] += grenade.Velocity[axis] * tick
+		if !collides(blocks, moved) {
+			grenade.Position = moved
+			continue
+		}
+
+		if math.Abs(float64(grenade.Velocity[axis])) > minBounceSpeed {
+			grenade.Velocity[axis] *= -restitution
+			bounced = true
+		} else {
+			grenade.Velocity[axis] = 0
+		}
+
+		// rolling along the floor slows it down
+		if axis == 1 {
+			grenade.Velocity[0] *= rollFriction
+			grenade.Velocity[2] *= rollFriction
+		}
+	}
+	return bounced
+}
+
+// how much an explosion hurts someone a distance away from it, nothing if
+// they are out of range
+func Damage(distance float32) int {
+	if distance >= ExplosionRadius {
+		return 0
+	}
+	return max(1, int(math.Ceil(MaxDamage*float64(1-distance/ExplosionRadius))))
+}
+
+// how far a smoke cloud has spread, a while after it went off
+func SmokeCloudRadius(age time.Duration) float32 {
+	if age >= SmokeDuration {
+		return 0
+	}
+	return SmokeRadius * float32(min(age, SmokeSpread)) / float32(SmokeSpread)
+}
+
+// whether a smoke cloud hides one point from another
+func SmokeBlocks(centre maps.Vector3, radius float32, from, to maps.Vector3) bool {
+	// find the point on the segment closest to the centre of the cloud
+	var segment, toCentre maps.Vector3
+	var lengthSquared, along float32
+	for axis := range segment {
+		segment[axis] = to[axis] - from[axis]
+		toCentre[axis] = centre[axis] - from[axis]
+		lengthSquared += segment[axis] * segment[axis]
+		along += segment[axis] * toCentre[axis]
+	}
+	if lengthSquared > 0 {
+		along = min(max(along/lengthSquared, 0), 1)
+	}
+
+	var distanceSquared float32
+	for axis := range segment {
+		offset := toCentre[axis] - segment[axis]*along
+		distanceSquared += offset * offset
+	}
+	return distanceSquared < radius*radius
+}
+
+func collides(blocks []maps.Block, position maps.Vector3) bool {
+	for _, block := range blocks {
+		overlaps := true
+		for axis := range position {
+			if position[axis]+Radius <= block.Min[axis] || block.Max[axis] <= position[axis]-Radius {
+				overlaps = false
+				break
+			}
+		}
+		if overlaps {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+// Package listing describes what game servers announce about themselves to
+// the master server, and what the master server lists for clients to pick
+// from.
+package listing
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	AnnounceInterval = 30 * time.Second
+	Expiry           = 3 * AnnounceInterval // servers not heard from for this long are dropped
+
+	MaxNameLength   = 32
+	MaxRegionLength = 16
+	MaxModeLength   = 16
+)
+
+// sent by a game server every AnnounceInterval
+type Announcement struct {
+	Name       string `json:"name"`
+	Region     string `json:"region"`
+	Mode       string `json:"mode"`
+	Port       int    `json:"port"`
+	Players    int    `json:"players"`
+	MaxPlayers int    `json:"max_players"` // in each lobby
+	Password   bool   `json:"password"`    // whether players need one to join
+}
+
+// a listed game server, joined at its address
+type Server struct {
+	Announcement
+	Address string `json:"address"` // host:port, the host being where the announcement came from
+}
+
+func (announcement Announcement) Validate() error {
+	switch {
+	case announcement.Name == "" || MaxNameLength < len(announcement.Name):
+		return errors.New("Name must be between 1 and 32 bytes")
+	case MaxRegionLength < len(announcement.Region):
+		return errors.New("Region must be at most 16 bytes")
+	case MaxModeLength < len(announcement.Mode):
+		return errors.New("Mode must be at most 16 bytes")
+	case announcement.Port < 1 || 65535 < announcement.Port:
+		return errors.New("Port must be between 1 and 65535")
+	case announcement.Players < 0 || announcement.MaxPlayers < 0:
+		return errors.New("Player counts cannot be negative")
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// Package logging sets up structured logging the same way for the client and
+// the server, so that their logs can be read by the same tools.
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+type Flags struct {
+	level  *string
+	format *string
+}
+
+// add the logging flags to the command line, to be read once it is parsed
+func RegisterFlags() *Flags {
+	return &Flags{
+		level:  flag.String("log-level", "info", "lowest level logged: debug, info, warn or error"),
+		format: flag.String("log-format", "text", "format of the logs: text or json"),
+	}
+}
+
+// make the logger described by the flags the default one, which the log
+// package writes through as well
+func (flags *Flags) Setup() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*flags.level)); err != nil {
+		return fmt.Errorf("Invalid log level %q", *flags.level)
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch *flags.format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, options)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	default:
+		return fmt.Errorf("Invalid log format %q", *flags.format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
@@ -0,0 +1,286 @@
+// Package maps describes the map file format, so that new maps can be made
+// without recompiling the game.
+package maps
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	DefaultDirectory = "resources/maps"
+	DefaultName      = "default"
+	maxNameLength    = 64
+	maxHealthPacks   = 256 // health packs are numbered with a byte
+	maxDoors         = 256 // so are doors
+	maxJumpPads      = 256 // and jump pads
+	maxTeleporters   = 256 // and teleporters
+)
+
+type Vector2 [2]float32
+
+type Vector3 [3]float32
+
+type Map struct {
+	Name        string            `json:"name"`
+	Textures    map[string]string `json:"textures"` // texture name to image path
+	Spawns      Spawns            `json:"spawns"`
+	Regions     []Region          `json:"regions"`
+	Blocks      []Block           `json:"blocks"`
+	HealthPacks []Vector3         `json:"health_packs"` // where each one sits on the floor
+	Doors       []Door            `json:"doors"`
+	JumpPads    []JumpPad         `json:"jump_pads"`
+	Teleporters []Teleporter      `json:"teleporters"`
+}
+
+// spawn locations of each team, at the player's feet
+type Spawns struct {
+	A []Vector3 `json:"a"`
+	B []Vector3 `json:"b"`
+}
+
+// a leaf of the region tree, on the horizontal plane, and between two
+// heights of the feet of those in it if it is stacked over or under another
+type Region struct {
+	BottomLeft Vector2  `json:"bottom_left"`
+	TopRight   Vector2  `json:"top_right"`
+	Heights    *Vector2 `json:"heights,omitempty"` // lowest and highest, any height if nil
+}
+
+// the ways a ramp's top can slope up, towards the larger or smaller X or Z
+const (
+	RisePositiveX = "+x"
+	RiseNegativeX = "-x"
+	RisePositiveZ = "+z"
+	RiseNegativeZ = "-z"
+)
+
+// a solid box in the world; the drawn mesh defaults to filling the bounding
+// box, a mesh with no height is drawn as a plane
+//
+// a block that rises is a ramp, solid up to a top that slopes from its
+// minimum height on one side to its maximum on the other
+type Block struct {
+	Name    string   `json:"name,omitempty"`
+	Min     Vector3  `json:"min"`
+	Max     Vector3  `json:"max"`
+	Centre  *Vector3 `json:"centre,omitempty"`
+	Size    *Vector3 `json:"size,omitempty"`
+	Texture string   `json:"texture"`
+	Rise    string   `json:"rise,omitempty"` // one of the Rise constants, flat if empty
+}
+
+// a block that players can open and close, solid only while closed, starting
+// each round the way the map has it
+type Door struct {
+	Block
+	Open bool `json:"open"`
+}
+
+// how high the block's top is at a point on the horizontal plane, held to
+// the block's edges
+func (block *Block) TopAt(x, z float32) float32 {
+	along := func(value, low, high float32) float32 {
+		if high <= low {
+			return 1
+		}
+		return (min(max(value, low), high) - low) / (high - low)
+	}
+	var fraction float32
+	switch block.Rise {
+	case RisePositiveX:
+		fraction = along(x, block.Min[0], block.Max[0])
+	case RiseNegativeX:
+		fraction = 1 - along(x, block.Min[0], block.Max[0])
+	case RisePositiveZ:
+		fraction = along(z, block.Min[2], block.Max[2])
+	case RiseNegativeZ:
+		fraction = 1 - along(z, block.Min[2], block.Max[2])
+	default:
+		return block.Max[1]
+	}
+	return block.Min[1] + fraction*(block.Max[1]-block.Min[1])
+}
+
+// the highest the block's top gets under a box's footprint, which is where
+// someone standing over it rests
+func (block *Block) TopUnder(boxMin, boxMax Vector3) float32 {
+	x, z := boxMax[0], boxMax[2]
+	switch block.Rise {
+	case RiseNegativeX:
+		x = boxMin[0]
+	case RiseNegativeZ:
+		z = boxMin[2]
+	}
+	return block.TopAt(x, z)
+}
+
+// whether a box shares some of the block's solid space, touching is not
+// overlapping
+func (block *Block) Overlaps(boxMin, boxMax Vector3) bool {
+	for axis := range boxMin {
+		if boxMax[axis] <= block.Min[axis] || block.Max[axis] <= boxMin[axis] {
+			return false
+		}
+	}
+	return boxMin[1] < block.TopUnder(boxMin, boxMax)
+}
+
+// a box that something happens to players in, by where their feet are
+type Volume struct {
+	Min Vector3 `json:"min"`
+	Max Vector3 `json:"max"`
+}
+
+func (volume *Volume) Contains(point Vector3) bool {
+	for axis := range point {
+		if point[axis] < volume.Min[axis] || volume.Max[axis] < point[axis] {
+			return false
+		}
+	}
+	return true
+}
+
+// a volume that throws anyone who steps into it
+type JumpPad struct {
+	Volume
+	Launch Vector3 `json:"launch"` // the velocity it gives, in units per second
+}
+
+// a volume that moves anyone who steps into it somewhere else on the map, two
+// leading into each other make a pair
+type Teleporter struct {
+	Volume
+	To Vector3 `json:"to"` // where they come out, at their feet
+}
+
+func (block *Block) MeshCentre() Vector3 {
+	if block.Centre != nil {
+		return *block.Centre
+	}
+	return Vector3{
+		(block.Min[0] + block.Max[0]) / 2,
+		(block.Min[1] + block.Max[1]) / 2,
+		(block.Min[2] + block.Max[2]) / 2,
+	}
+}
+
+func (block *Block) MeshSize() Vector3 {
+	if block.Size != nil {
+		return *block.Size
+	}
+	return Vector3{
+		block.Max[0] - block.Min[0],
+		block.Max[1] - block.Min[1],
+		block.Max[2] - block.Min[2],
+	}
+}
+
+// maps are referred to by name, which is their file name without the extension
+func ValidName(name string) bool {
+	return name != "" && len(name) <= maxNameLength && !strings.ContainsAny(name, `/\.`)
+}
+
+func Path(directory, name string) string {
+	return filepath.Join(directory, name+".json")
+}
+
+// load a map by name from a directory of maps
+func LoadNamed(directory, name string) (*Map, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("Invalid map name %q", name)
+	}
+	return Load(Path(directory, name))
+}
+
+func Load(path string) (*Map, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	gameMap, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return gameMap, nil
+}
+
+func Parse(data []byte) (*Map, error) {
+	gameMap := &Map{}
+	if err := json.Unmarshal(data, gameMap); err != nil {
+		return nil, err
+	}
+	if err := gameMap.check(); err != nil {
+		return nil, err
+	}
+	return gameMap, nil
+}
+
+// make sure the map has everything the game relies on
+func (gameMap *Map) check() error {
+	if gameMap.Name == "" {
+		return errors.New("Map has no name")
+	}
+	if len(gameMap.Spawns.A) == 0 || len(gameMap.Spawns.B) == 0 {
+		return errors.New("Map needs spawn locations for both teams")
+	}
+	if len(gameMap.Regions) == 0 {
+		return errors.New("Map has no regions")
+	}
+	for i, region := range gameMap.Regions {
+		if region.Heights != nil && region.Heights[0] > region.Heights[1] {
+			return fmt.Errorf("Region %d has its lowest height above its highest", i)
+		}
+	}
+	if len(gameMap.HealthPacks) > maxHealthPacks {
+		return fmt.Errorf("Map has more than %d health packs", maxHealthPacks)
+	}
+	if len(gameMap.Doors) > maxDoors {
+		return fmt.Errorf("Map has more than %d doors", maxDoors)
+	}
+	for i, block := range gameMap.Blocks {
+		if err := gameMap.checkBlock(block); err != nil {
+			return fmt.Errorf("Block %d %w", i, err)
+		}
+	}
+	for i, door := range gameMap.Doors {
+		if err := gameMap.checkBlock(door.Block); err != nil {
+			return fmt.Errorf("Door %d %w", i, err)
+		}
+	}
+	if len(gameMap.JumpPads) > maxJumpPads {
+		return fmt.Errorf("Map has more than %d jump pads", maxJumpPads)
+	}
+	if len(gameMap.Teleporters) > maxTeleporters {
+		return fmt.Errorf("Map has more than %d teleporters", maxTeleporters)
+	}
+	for i, teleporter := range gameMap.Teleporters {
+		// one that leads into itself goes nowhere
+		if teleporter.Contains(teleporter.To) {
+			return fmt.Errorf("Teleporter %d leads into itself", i)
+		}
+	}
+	return nil
+}
+
+// the error reads on from the block's number
+func (gameMap *Map) checkBlock(block Block) error {
+	if _, ok := gameMap.Textures[block.Texture]; !ok {
+		return fmt.Errorf("uses unknown texture %q", block.Texture)
+	}
+	for axis := range block.Min {
+		if block.Min[axis] > block.Max[axis] {
+			return errors.New("has its minimum corner above its maximum")
+		}
+	}
+	switch block.Rise {
+	case "", RisePositiveX, RiseNegativeX, RisePositiveZ, RiseNegativeZ:
+	default:
+		return fmt.Errorf("rises towards unknown direction %q", block.Rise)
+	}
+	return nil
+}
@@ -0,0 +1,338 @@
+// Package navigation lays a map out as a grid of cells on the floor its
+// spawns stand on, marking those a player fits in without touching a block.
+// Bots find their way between cells with A*, so they go round walls and
+// through the gaps between them instead of walking into them, and map tools
+// use it to find floor nobody can reach.
+package navigation
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/lezhou8/shooter/internal/maps"
+)
+
+// the player's box, half its width across and its height standing, as the
+// server collides it
+const (
+	PlayerHalfWidth = 0.35
+	PlayerHeight    = 2
+)
+
+const (
+	CellSize = 0.5 // units along each side of a cell
+	// how far from a point a free cell is looked for, when it is inside or too
+	// close to a block to stand at
+	snapCells = 4
+)
+
+type Grid struct {
+	originX, originZ  float32 // corner of the first cell
+	width, depth      int     // cells along X and Z
+	floor             float32 // height of the feet of anyone walking on it
+	walkable          []bool  // by cell, X first
+	blocks            []maps.Block
+	halfWidth, height float32 // of the player's box
+}
+
+// lay a map out for a player whose box is twice the half width across and
+// that high, the cells a player collides in are not walkable
+func New(gameMap *maps.Map, halfWidth, height float32) *Grid {
+	grid := &Grid{blocks: gameMap.Blocks, halfWidth: halfWidth, height: height}
+	if len(gameMap.Blocks) == 0 {
+		return grid
+	}
+	spawns := append(append([]maps.Vector3{}, gameMap.Spawns.A...), gameMap.Spawns.B...)
+	if len(spawns) > 0 {
+		grid.floor = spawns[0][1]
+	}
+
+	minX, minZ := float32(math.Inf(1)), float32(math.Inf(1))
+	maxX, maxZ := float32(math.Inf(-1)), float32(math.Inf(-1))
+	for _, block := range gameMap.Blocks {
+		minX, minZ = min(minX, block.Min[0]), min(minZ, block.Min[2])
+		maxX, maxZ = max(maxX, block.Max[0]), max(maxZ, block.Max[2])
+	}
+	grid.originX, grid.originZ = minX, minZ
+	grid.width = int(math.Ceil(float64((maxX - minX) / CellSize)))
+	grid.depth = int(math.Ceil(float64((maxZ - minZ) / CellSize)))
+	grid.walkable = make([]bool, grid.width*grid.depth)
+	for cell := range grid.walkable {
+		grid.walkable[cell] = grid.Fits(grid.centre(cell))
+	}
+	return grid
+}
+
+// whether a player standing with their feet at a point touches no block
+func (grid *Grid) Fits(feet maps.Vector3) bool {
+	playerMin := maps.Vector3{feet[0] - grid.halfWidth, feet[1], feet[2] - grid.halfWidth}
+	playerMax := maps.Vector3{feet[0] + grid.halfWidth, feet[1] + grid.height, feet[2] + grid.halfWidth}
+	for _, block := range grid.blocks {
+		if block.Overlaps(playerMin, playerMax) {
+			return false
+		}
+	}
+	return true
+}
+
+func (grid *Grid) centre(cell int) maps.Vector3 {
+	x, z := cell%grid.width, cell/grid.width
+	return maps.Vector3{
+		grid.originX + (float32(x)+0.5)*CellSize,
+		grid.floor,
+		grid.originZ + (float32(z)+0.5)*CellSize,
+	}
+}
+
+// the cell a point is over, false if it is off the grid
+func (grid *Grid) cellAt(point maps.Vector3) (int, bool) {
+	x := int(math.Floor(float64((point[0] - grid.originX) / CellSize)))
+	z := int(math.Floor(float64((point[2] - grid.originZ) / CellSize)))
+	if x < 0 || grid.width <= x || z < 0 || grid.depth <= z {
+		return 0, false
+	}
+	return z*grid.width + x, true
+}
+
+// the walkable cell closest to a point, false if there is none near it
+func (grid *Grid) nearestWalkable(point maps.Vector3) (int, bool) {
+	x := int(math.Floor(float64((point[0] - grid.originX) / CellSize)))
+	z := int(math.Floor(float64((point[2] - grid.originZ) / CellSize)))
+	best, bestDistance := 0, math.MaxInt
+	for dz := -snapCells; dz <= snapCells; dz++ {
+		for dx := -snapCells; dx <= snapCells; dx++ {
+			if distance := dx*dx + dz*dz; grid.walkableAt(x+dx, z+dz) && distance < bestDistance {
+				best, bestDistance = (z+dz)*grid.width+x+dx, distance
+			}
+		}
+	}
+	return best, bestDistance != math.MaxInt
+}
+
+func (grid *Grid) walkableAt(x, z int) bool {
+	return 0 <= x && x < grid.width && 0 <= z && z < grid.depth && grid.walkable[z*grid.width+x]
+}
+
+// the cells next to a cell that can be walked to from it, diagonally only
+// past corners that are clear, with how far away each is
+func (grid *Grid) neighbours(cell int, visit func(next int, step float32)) {
+	x, z := cell%grid.width, cell/grid.width
+	for dz := -1; dz <= 1; dz++ {
+		for dx := -1; dx <= 1; dx++ {
+			if dx == 0 && dz == 0 || !grid.walkableAt(x+dx, z+dz) {
+				continue
+			}
+			step := float32(CellSize)
+			if dx != 0 && dz != 0 {
+				if !grid.walkableAt(x+dx, z) || !grid.walkableAt(x, z+dz) {
+					continue
+				}
+				step *= math.Sqrt2
+			}
+			visit((z+dz)*grid.width+x+dx, step)
+		}
+	}
+}
+
+// the points to walk through to get from one place to another, ending at the
+// goal, or nil if there is no way there
+func (grid *Grid) Path(from, to maps.Vector3) []maps.Vector3 {
+	start, ok := grid.nearestWalkable(from)
+	if !ok {
+		return nil
+	}
+	goal, ok := grid.nearestWalkable(to)
+	if !ok {
+		return nil
+	}
+	cells := grid.search(start, goal)
+	if cells == nil {
+		return nil
+	}
+
+	// the goal itself is headed for if it can be stood at, rather than only
+	// somewhere near it
+	end := grid.centre(goal)
+	if cell, ok := grid.cellAt(to); ok && cell == goal {
+		end = to
+	}
+	points := make([]maps.Vector3, 0, len(cells))
+	for i := 1; i < len(cells)-1; i++ {
+		points = append(points, grid.centre(cells[i]))
+	}
+	return grid.straighten(from, append(points, end))
+}
+
+// A* from one cell to another, returning the cells on the way including both
+// ends
+func (grid *Grid) search(start, goal int) []int {
+	goalCentre := grid.centre(goal)
+	estimate := func(cell int) float32 {
+		return horizontalDistance(grid.centre(cell), goalCentre)
+	}
+
+	cameFrom := make(map[int]int)
+	cost := map[int]float32{start: 0}
+	open := &queue{{cell: start, priority: estimate(start)}}
+	closed := make(map[int]bool)
+	for open.Len() > 0 {
+		current := heap.Pop(open).(entry).cell
+		if current == goal {
+			cells := []int{goal}
+			for cell := goal; cell != start; {
+				cell = cameFrom[cell]
+				cells = append(cells, cell)
+			}
+			for i, j := 0, len(cells)-1; i < j; i, j = i+1, j-1 {
+				cells[i], cells[j] = cells[j], cells[i]
+			}
+			return cells
+		}
+		if closed[current] {
+			continue
+		}
+		closed[current] = true
+
+		grid.neighbours(current, func(next int, step float32) {
+			nextCost := cost[current] + step
+			if known, ok := cost[next]; ok && known <= nextCost {
+				return
+			}
+			cost[next] = nextCost
+			cameFrom[next] = current
+			heap.Push(open, entry{cell: next, priority: nextCost + estimate(next)})
+		})
+	}
+	return nil
+}
+
+// skip every point that can be walked past in a straight line, so the path
+// does not zigzag along the cells
+func (grid *Grid) straighten(from maps.Vector3, points []maps.Vector3) []maps.Vector3 {
+	var straight []maps.Vector3
+	for len(points) > 0 {
+		furthest := 0
+		for i := len(points) - 1; i > 0; i-- {
+			if grid.clearWalk(from, points[i]) {
+				furthest = i
+				break
+			}
+		}
+		from = points[furthest]
+		straight = append(straight, from)
+		points = points[furthest+1:]
+	}
+	return straight
+}
+
+// whether a player can walk in a straight line between two points without
+// touching a block, checked closer together than the player is wide so that
+// none is skipped
+func (grid *Grid) clearWalk(from, to maps.Vector3) bool {
+	steps := int(horizontalDistance(from, to)/grid.halfWidth) + 1
+	for step := 1; step <= steps; step++ {
+		amount := float32(step) / float32(steps)
+		point := maps.Vector3{
+			from[0] + (to[0]-from[0])*amount,
+			grid.floor,
+			from[2] + (to[2]-from[2])*amount,
+		}
+		if !grid.Fits(point) {
+			return false
+		}
+	}
+	return true
+}
+
+// a stretch of floor a player can walk around, but not get to from elsewhere
+type Area struct {
+	Min, Max maps.Vector2 // corners of the cells it covers, X and Z
+	Cells    int
+}
+
+// the stretches of floor no path from any of the points reaches
+func (grid *Grid) UnreachableAreas(from []maps.Vector3) []Area {
+	reached := make([]bool, len(grid.walkable))
+	for _, point := range from {
+		if cell, ok := grid.nearestWalkable(point); ok {
+			grid.flood(cell, reached, func(int) {})
+		}
+	}
+
+	var areas []Area
+	for cell, walkable := range grid.walkable {
+		if !walkable || reached[cell] {
+			continue
+		}
+		area := Area{
+			Min: maps.Vector2{float32(math.Inf(1)), float32(math.Inf(1))},
+			Max: maps.Vector2{float32(math.Inf(-1)), float32(math.Inf(-1))},
+		}
+		grid.flood(cell, reached, func(cell int) {
+			centre := grid.centre(cell)
+			area.Min = maps.Vector2{min(area.Min[0], centre[0]-CellSize/2), min(area.Min[1], centre[2]-CellSize/2)}
+			area.Max = maps.Vector2{max(area.Max[0], centre[0]+CellSize/2), max(area.Max[1], centre[2]+CellSize/2)}
+			area.Cells++
+		})
+		areas = append(areas, area)
+	}
+	return areas
+}
+
+// whether a path leads from one point to another
+func (grid *Grid) Connected(from, to maps.Vector3) bool {
+	start, ok := grid.nearestWalkable(from)
+	if !ok {
+		return false
+	}
+	goal, ok := grid.nearestWalkable(to)
+	if !ok {
+		return false
+	}
+	reached := make([]bool, len(grid.walkable))
+	grid.flood(start, reached, func(int) {})
+	return reached[goal]
+}
+
+// mark every cell that can be walked to from one, visiting each the first time
+func (grid *Grid) flood(start int, reached []bool, visit func(cell int)) {
+	if reached[start] {
+		return
+	}
+	reached[start] = true
+	frontier := []int{start}
+	for len(frontier) > 0 {
+		cell := frontier[len(frontier)-1]
+		frontier = frontier[:len(frontier)-1]
+		visit(cell)
+		grid.neighbours(cell, func(next int, _ float32) {
+			if !reached[next] {
+				reached[next] = true
+				frontier = append(frontier, next)
+			}
+		})
+	}
+}
+
+func horizontalDistance(a, b maps.Vector3) float32 {
+	return float32(math.Hypot(float64(a[0]-b[0]), float64(a[2]-b[2])))
+}
+
+// the open cells of an A* search, cheapest first
+type entry struct {
+	cell     int
+	priority float32 // cost so far and the estimate of what is left
+}
+
+type queue []entry
+
+func (queue queue) Len() int           { return len(queue) }
+func (queue queue) Less(i, j int) bool { return queue[i].priority < queue[j].priority }
+func (queue queue) Swap(i, j int)      { queue[i], queue[j] = queue[j], queue[i] }
+func (queue *queue) Push(item any)     { *queue = append(*queue, item.(entry)) }
+func (queue *queue) Pop() any {
+	old := *queue
+	item := old[len(old)-1]
+	*queue = old[:len(old)-1]
+	return item
+}
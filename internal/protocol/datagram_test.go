@@ -0,0 +1,31 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+)
+
+// locations with every player in them have to fit in the buffer datagrams are
+// read into, or they arrive cut short and are dropped
+func TestLocationsDatagramFits(t *testing.T) {
+	parcels := make([]LocationParcel, MaxPlayers)
+	for i := range parcels {
+		parcels[i] = LocationParcel{Id: byte(i), X: -100, Y: 20, Z: 100, Yaw: 255, Pitch: -60, Crouching: true}
+	}
+	datagram := EncodeLocationsDatagram(9, EncodeLocations(90*time.Second, parcels))
+	if len(datagram) > MaxDatagramSize {
+		t.Fatalf("Datagram of %d bytes is more than the %d read", len(datagram), MaxDatagramSize)
+	}
+
+	_, locations, err := DecodeLocationsDatagram(datagram[:min(len(datagram), MaxDatagramSize)])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, decoded, err := DecodeLocations(locations); err != nil || len(decoded) != MaxPlayers {
+		t.Fatalf("Decoded %d of %d players, error %v", len(decoded), MaxPlayers, err)
+	}
+	hello := EncodeHello(make([]byte, SessionTokenSize))
+	if len(hello) > MaxDatagramSize {
+		t.Fatalf("Hello of %d bytes is more than the %d read", len(hello), MaxDatagramSize)
+	}
+}
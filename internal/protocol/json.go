@@ -0,0 +1,387 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+//////// JSON
+//////// for debugging, messages can be sent as JSON text instead, naming the
+//////// message by its type and each of its fields, so they can be read and
+//////// typed by hand; every message is laid out as fields read in order,
+//////// which may end with a list of the same fields over again, and is
+//////// turned into JSON and back by following its layout
+
+// how messages after the handshake go on the wire, the handshake is always
+// binary
+type Encoding int
+
+const (
+	BinaryEncoding Encoding = iota
+	JSONEncoding
+)
+
+func ParseEncoding(name string) (Encoding, error) {
+	switch name {
+	case "binary":
+		return BinaryEncoding, nil
+	case "json":
+		return JSONEncoding, nil
+	}
+	return 0, fmt.Errorf("Unknown protocol %q", name)
+}
+
+// a message as it goes on the wire, and whether it goes as text
+func (encoding Encoding) Encode(message []byte, fromServer bool) ([]byte, bool, error) {
+	if encoding == BinaryEncoding {
+		return message, false, nil
+	}
+	text, err := MessageToJSON(message, fromServer)
+	return text, true, err
+}
+
+// a message as it came off the wire, either encoding is understood whichever
+// one we send in, a text message being JSON
+func Decode(message []byte, text, fromServer bool) ([]byte, error) {
+	if !text {
+		return message, nil
+	}
+	return MessageFromJSON(message, fromServer)
+}
+
+type fieldKind int
+
+const (
+	byteKind fieldKind = iota
+	int8Kind
+	uint16Kind
+	uint32Kind
+	boolKind
+	stringKind // with its length in the byte ahead of it
+	textKind   // the rest of the message
+	bytesKind  // the rest of the message, as base64 in JSON
+)
+
+type field struct {
+	name string
+	kind fieldKind
+	flag string // the name of the top bit of a byte sent as its own field, if it is one
+}
+
+type layout struct {
+	fields    []field
+	list      string  // the name of the list the message ends with, if it has one
+	listItems []field // the fields of each item in the list
+}
+
+func fields(kind fieldKind, names ...string) []field {
+	fields := make([]field, len(names))
+	for i, name := range names {
+		fields[i] = field{name: name, kind: kind}
+	}
+	return fields
+}
+
+func concat(groups ...[]field) []field {
+	var all []field
+	for _, group := range groups {
+		all = append(all, group...)
+	}
+	return all
+}
+
+var (
+	location     = fields(int8Kind, "x", "y", "z")
+	grenadeState = concat(fields(byteKind, "grenade"), location, fields(int8Kind, "vx", "vy", "vz"))
+	detonation   = layout{fields: concat(fields(byteKind, "grenade"), location)}
+)
+
+var serverLayouts = map[MessageHeader]layout{
+	NextRoundHeader: {},
+	PlayHeader:      {},
+	LocationsHeader: {fields: fields(uint32Kind, "time"), list: "players", listItems: concat(
+		[]field{{name: "id", kind: byteKind, flag: "crouching"}}, location, fields(byteKind, "yaw"), fields(int8Kind, "pitch"),
+	)},
+	ShotHeader: {fields: concat(fields(byteKind, "shooter"), location)},
+	KilledHeader: {
+		fields:    []field{{name: "killer", kind: byteKind}, {name: "killed", kind: byteKind, flag: "headshot"}, {name: "weapon", kind: byteKind}},
+		list:      "assisters",
+		listItems: fields(byteKind, "id"),
+	},
+	TeamPointHeader:        {fields: fields(byteKind, "team")},
+	LoseHealthHeader:       {fields: []field{{name: "damage", kind: byteKind, flag: "headshot"}}},
+	PlayerDisconnectHeader: {fields: fields(byteKind, "id")},
+	ResumeHeader: {
+		fields:    concat(fields(byteKind, "round", "team_a_points", "team_b_points", "health"), fields(boolKind, "alive", "in_play"), location),
+		list:      "players",
+		listItems: concat(fields(byteKind, "id", "kills", "deaths", "assists"), fields(boolKind, "alive")),
+	},
+	MapChangeHeader:       {fields: fields(textKind, "map")},
+	CorrectionHeader:      {fields: concat(fields(uint16Kind, "sequence"), location)},
+	PongHeader:            {fields: concat(fields(uint16Kind, "number"), fields(uint32Kind, "time"))},
+	PingsHeader:           {list: "players", listItems: concat(fields(byteKind, "id"), fields(uint16Kind, "ping"))},
+	RosterHeader:          {list: "players", listItems: concat(fields(byteKind, "id"), fields(stringKind, "name"))},
+	VoiceHeader:           {fields: concat(fields(byteKind, "speaker"), fields(bytesKind, "samples"))},
+	GrenadeThrowHeader:    {fields: concat(fields(byteKind, "thrower", "kind"), grenadeState)},
+	GrenadeBounceHeader:   {fields: grenadeState},
+	ExplosionHeader:       detonation,
+	SmokeHeader:           detonation,
+	FlashHeader:           detonation,
+	HealthPackTakenHeader: {fields: fields(byteKind, "pack", "player", "healed")},
+	HealthPacksHeader:     {list: "taken", listItems: fields(byteKind, "pack")},
+	RoundTimeHeader:       {fields: fields(uint16Kind, "seconds")},
+	InventoryHeader:       {fields: concat(fields(uint16Kind, "money"), fields(byteKind, "primary", "armor", "frags", "smokes", "flashes"))},
+	ActionHeader:          {fields: fields(byteKind, "player", "action", "gun")},
+	StatisticsHeader:      {list: "players", listItems: concat(fields(byteKind, "id"), fields(uint16Kind, "shots_fired", "shots_hit", "damage"))},
+	HitConfirmHeader: {fields: []field{
+		{name: "player", kind: byteKind, flag: "accepted"}, {name: "damage", kind: byteKind, flag: "headshot"}, {name: "health", kind: byteKind},
+	}},
+	WarmupHeader:         {},
+	RespawnHeader:        {fields: concat(fields(byteKind, "player"), location)},
+	VoteHeader:           {fields: fields(byteKind, "kind", "caller", "target", "yes", "no", "needed", "seconds", "result")},
+	SayHeader:            {fields: fields(textKind, "text")},
+	PromotedHeader:       {fields: concat(fields(byteKind, "player"), fields(bytesKind, "token"))},
+	DoorHeader:           {fields: concat(fields(byteKind, "door"), fields(boolKind, "open"))},
+	DoorsHeader:          {list: "open", listItems: fields(byteKind, "door")},
+	LaunchHeader:         {fields: fields(byteKind, "player", "pad")},
+	TeleportHeader:       {fields: fields(byteKind, "player", "teleporter")},
+	StreakHeader:         {fields: []field{{name: "player", kind: byteKind}, {name: "kills", kind: byteKind, flag: "ace"}}},
+	MarkerHeader:         {fields: concat(fields(byteKind, "player"), location)},
+	TeammateHealthHeader: {fields: fields(byteKind, "player", "health")},
+	GraceHeader:          {fields: fields(uint16Kind, "seconds")},
+}
+
+var clientLayouts = map[ClientMessage]layout{
+	HitMessage:      {fields: concat(fields(byteKind, "player", "gun", "pellets", "headshots"), fields(uint32Kind, "seen_at"))},
+	ShotMessage:     {},
+	MoveMessage:     {fields: concat(fields(uint16Kind, "sequence"), fields(int8Kind, "dx", "dy", "dz"), fields(byteKind, "yaw"), fields(int8Kind, "pitch"), fields(boolKind, "crouching"))},
+	PingMessage:     {fields: fields(uint16Kind, "number", "last_ping")},
+	VoiceMessage:    {fields: fields(bytesKind, "samples")},
+	ThrowMessage:    {fields: concat(fields(byteKind, "kind"), fields(int8Kind, "dx", "dy", "dz"))},
+	BuyMessage:      {fields: fields(byteKind, "item")},
+	ActionMessage:   {fields: fields(byteKind, "action", "gun")},
+	CallVoteMessage: {fields: fields(byteKind, "kind", "target")},
+	BallotMessage:   {fields: fields(boolKind, "yes")},
+	UseMessage:      {},
+	MarkMessage:     {fields: location},
+}
+
+// the layout of a message, from the server or from a client
+func layoutOf(header byte, fromServer bool) (layout, string, bool) {
+	if fromServer {
+		layout, ok := serverLayouts[MessageHeader(header)]
+		return layout, MessageHeader(header).String(), ok
+	}
+	layout, ok := clientLayouts[ClientMessage(header)]
+	return layout, ClientMessage(header).String(), ok
+}
+
+// a message as JSON, with its type and each of its fields
+func MessageToJSON(message []byte, fromServer bool) ([]byte, error) {
+	if len(message) == 0 {
+		return nil, ErrEmptyMessage
+	}
+	if fromServer && MessageHeader(message[0]) == BatchHeader {
+		return batchToJSON(message)
+	}
+	layout, name, ok := layoutOf(message[0], fromServer)
+	if !ok {
+		return nil, fmt.Errorf("No layout for message %s", name)
+	}
+
+	reader := newReader(message, name)
+	object := map[string]any{"type": name}
+	readFields(reader, layout.fields, object)
+	if layout.list != "" {
+		list := []map[string]any{}
+		for reader.more() {
+			item := map[string]any{}
+			readFields(reader, layout.listItems, item)
+			list = append(list, item)
+		}
+		object[layout.list] = list
+	}
+	if err := reader.end(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(object)
+}
+
+func readFields(reader *reader, fields []field, object map[string]any) {
+	for _, field := range fields {
+		switch field.kind {
+		case byteKind:
+			value := reader.byte()
+			if field.flag != "" {
+				object[field.flag] = value&0x80 != 0
+				value &^= 0x80
+			}
+			object[field.name] = value
+		case int8Kind:
+			object[field.name] = reader.int8()
+		case uint16Kind:
+			object[field.name] = reader.uint16()
+		case uint32Kind:
+			object[field.name] = reader.uint32()
+		case boolKind:
+			object[field.name] = reader.bool()
+		case stringKind:
+			object[field.name] = reader.string()
+		case textKind:
+			object[field.name] = string(reader.rest())
+		case bytesKind:
+			object[field.name] = reader.rest()
+		}
+	}
+}
+
+// a message from its JSON, as MessageToJSON writes it
+func MessageFromJSON(text []byte, fromServer bool) ([]byte, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(text, &object); err != nil {
+		return nil, err
+	}
+	var name string
+	if err := json.Unmarshal(object["type"], &name); err != nil {
+		return nil, errors.New("Message has no type")
+	}
+	if fromServer && name == BatchHeader.String() {
+		return batchFromJSON(object)
+	}
+
+	for header := range 256 {
+		layout, headerName, ok := layoutOf(byte(header), fromServer)
+		if !ok || headerName != name {
+			continue
+		}
+		message, err := writeFields([]byte{byte(header)}, layout.fields, object)
+		if err != nil || layout.list == "" {
+			return message, err
+		}
+		var list []map[string]json.RawMessage
+		if raw, ok := object[layout.list]; ok {
+			if err := json.Unmarshal(raw, &list); err != nil {
+				return nil, fmt.Errorf("Bad %s in %s message: %w", layout.list, name, err)
+			}
+		}
+		for _, item := range list {
+			if message, err = writeFields(message, layout.listItems, item); err != nil {
+				return nil, err
+			}
+		}
+		return message, nil
+	}
+	return nil, fmt.Errorf("Unknown message type %q", name)
+}
+
+// a batch is a list of the messages in it, each as JSON
+func batchToJSON(message []byte) ([]byte, error) {
+	messages, err := DecodeBatch(message)
+	if err != nil {
+		return nil, err
+	}
+	texts := make([]json.RawMessage, len(messages))
+	for i, batched := range messages {
+		if texts[i], err = MessageToJSON(batched, true); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(map[string]any{"type": BatchHeader.String(), "messages": texts})
+}
+
+func batchFromJSON(object map[string]json.RawMessage) ([]byte, error) {
+	var texts []json.RawMessage
+	if err := json.Unmarshal(object["messages"], &texts); err != nil {
+		return nil, fmt.Errorf("Bad messages in batch message: %w", err)
+	}
+	messages := make([][]byte, len(texts))
+	for i, text := range texts {
+		batched, err := MessageFromJSON(text, true)
+		if err != nil {
+			return nil, err
+		}
+		if len(batched) > MaxBatchedSize || MessageHeader(batched[0]) == BatchHeader {
+			return nil, errors.New("Message cannot be batched")
+		}
+		messages[i] = batched
+	}
+	return EncodeBatch(messages), nil
+}
+
+func writeFields(message []byte, fields []field, object map[string]json.RawMessage) ([]byte, error) {
+	for _, field := range fields {
+		raw, ok := object[field.name]
+		if !ok {
+			return nil, fmt.Errorf("Missing field %s", field.name)
+		}
+		switch field.kind {
+		case byteKind, int8Kind, uint16Kind, uint32Kind:
+			var value int64
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return nil, fmt.Errorf("Bad field %s: %w", field.name, err)
+			}
+			low, high := int64(0), int64(math.MaxUint8)
+			switch {
+			case field.kind == int8Kind:
+				low, high = math.MinInt8, math.MaxInt8
+			case field.kind == uint16Kind:
+				high = math.MaxUint16
+			case field.kind == uint32Kind:
+				high = math.MaxUint32
+			case field.flag != "":
+				high = 0x7F
+			}
+			if value < low || high < value {
+				return nil, fmt.Errorf("Field %s out of range", field.name)
+			}
+			if field.kind == uint16Kind {
+				message = appendUint16(message, uint16(value))
+				continue
+			}
+			if field.kind == uint32Kind {
+				message = appendUint32(message, uint32(value))
+				continue
+			}
+			number := byte(value)
+			if field.flag != "" {
+				var flag bool
+				if raw, ok := object[field.flag]; ok {
+					if err := json.Unmarshal(raw, &flag); err != nil {
+						return nil, fmt.Errorf("Bad field %s: %w", field.flag, err)
+					}
+				}
+				if flag {
+					number |= 0x80
+				}
+			}
+			message = append(message, number)
+		case boolKind:
+			var value bool
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return nil, fmt.Errorf("Bad field %s: %w", field.name, err)
+			}
+			message = append(message, boolToByte(value))
+		case stringKind, textKind:
+			var value string
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return nil, fmt.Errorf("Bad field %s: %w", field.name, err)
+			}
+			if field.kind == stringKind {
+				if len(value) > math.MaxUint8 {
+					return nil, fmt.Errorf("Field %s too long", field.name)
+				}
+				message = append(message, byte(len(value)))
+			}
+			message = append(message, value...)
+		case bytesKind:
+			var value []byte
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return nil, fmt.Errorf("Bad field %s: %w", field.name, err)
+			}
+			message = append(message, value...)
+		}
+	}
+	return message, nil
+}
@@ -0,0 +1,1340 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var ErrEmptyMessage = errors.New("Empty message")
+
+//////// handshake
+
+// client asks to join in a particular player slot, or AnyId, under a name,
+// giving the lobby's password if it has one
+func EncodeJoin(id int, name, password string) []byte {
+	return encodeJoin(encodeJoinId(id), nil, name, password)
+}
+
+// AnyId goes on the wire as 0xFF, and ObserverId as 0xFE
+func encodeJoinId(id int) byte {
+	switch id {
+	case AnyId:
+		return 0xFF
+	case ObserverId:
+		return 0xFE
+	}
+	return byte(id)
+}
+
+// client asks to take back its player slot after a disconnect
+func EncodeRejoin(id int, token []byte, name, password string) []byte {
+	return encodeJoin(byte(id), token, name, password)
+}
+
+// the protocol version goes first, the token and name each have their length
+// go ahead of them, and the password takes up the rest
+func encodeJoin(id byte, token []byte, name, password string) []byte {
+	message := appendUint16(nil, Version)
+	message = append(append(message, id, byte(len(token))), token...)
+	message = append(append(message, byte(len(name))), name...)
+	return append(message, password...)
+}
+
+// a client joined speaking a different version of the protocol than ours
+type VersionError struct {
+	Version int // the client's
+}
+
+func (err VersionError) Error() string {
+	return fmt.Sprintf("Client speaks protocol version %d, not %d", err.Version, Version)
+}
+
+// the token is nil unless the client is rejoining, and the name is empty if
+// the client did not give one, a client on another version gets a VersionError
+func DecodeJoin(message []byte) (id int, token []byte, name, password string, err error) {
+	reader := newHandshakeReader(message, "join")
+	if version := reader.uint16(); reader.err == nil && version != Version {
+		return 0, nil, "", "", VersionError{Version: int(version)}
+	}
+	wireId := reader.byte()
+	token = reader.take(int(reader.byte()))
+	name = reader.string()
+	password = string(reader.rest())
+	switch {
+	case len(token) != 0 && len(token) != SessionTokenSize:
+		reader.fail("Deformed join message")
+	case !ValidName(name):
+		reader.invalid("name")
+	}
+	if err = reader.end(); err != nil {
+		return 0, nil, "", "", err
+	}
+	if len(token) == 0 {
+		token = nil
+	}
+
+	if wireId == 0xFF && token == nil {
+		return AnyId, nil, name, password, nil
+	}
+	if wireId == 0xFE && token == nil {
+		return ObserverId, nil, name, password, nil
+	}
+	id = int(wireId)
+	if !ValidId(id) {
+		return 0, nil, "", "", errors.New("Invalid player id in join message")
+	}
+	return id, token, name, password, nil
+}
+
+// what a client is told once it has been let into the game, an observer is
+// given ObserverId and no token
+type Admission struct {
+	Id       int
+	Team     Team
+	TickRate int // how often locations are exchanged, per second
+	TeamSize int
+	Token    []byte
+	Map      string
+}
+
+// server replies whether the join succeeded, the admission is only sent on success
+func EncodeResponse(response SuccessResponse, admission Admission) []byte {
+	if response != Success {
+		return []byte{byte(response)}
+	}
+	token := admission.Token
+	if token == nil {
+		token = make([]byte, SessionTokenSize)
+	}
+	message := append([]byte{byte(response), encodeJoinId(admission.Id), byte(admission.Team), byte(admission.TickRate), byte(admission.TeamSize)}, token...)
+	return append(message, admission.Map...)
+}
+
+func DecodeResponse(message []byte) (response SuccessResponse, admission Admission, err error) {
+	if len(message) == 0 {
+		return Failure, Admission{}, ErrEmptyMessage
+	}
+	reader := newHandshakeReader(message, "response")
+	response = SuccessResponse(reader.byte())
+	if response != Success {
+		return response, Admission{}, nil
+	}
+	wireId := reader.byte()
+	admission = Admission{
+		Id:       int(wireId),
+		Team:     Team(reader.byte()),
+		TickRate: int(reader.byte()),
+		TeamSize: int(reader.byte()),
+		Token:    reader.take(SessionTokenSize),
+		Map:      string(reader.rest()),
+	}
+	switch {
+	case reader.err != nil:
+	case admission.TickRate < 1 || MaxTickRate < admission.TickRate:
+		reader.invalid("tick rate")
+	case !ValidTeamSize(admission.TeamSize):
+		reader.invalid("team size")
+	case wireId == 0xFE:
+		admission.Id = ObserverId
+		admission.Token = nil
+	case !ValidId(admission.Id) || 2*admission.TeamSize <= admission.Id:
+		reader.invalid("player id")
+	}
+	if err = reader.end(); err != nil {
+		return Failure, Admission{}, err
+	}
+	return response, admission, nil
+}
+
+//////// server messages
+
+func EncodeNextRound() []byte {
+	return []byte{byte(NextRoundHeader)}
+}
+
+func EncodePlay() []byte {
+	return []byte{byte(PlayHeader)}
+}
+
+// sent to anyone who joins while the lobby is warming up, until the match
+// starts with the first next round message; kills while warming up count for
+// nothing, and the killed respawn
+func EncodeWarmup() []byte {
+	return []byte{byte(WarmupHeader)}
+}
+
+// tells everyone a player killed while warming up, or who has just joined
+// the warmup, is alive again and where
+func EncodeRespawn(playerId int, x, y, z int8) []byte {
+	return []byte{byte(RespawnHeader), byte(playerId), byte(x), byte(y), byte(z)}
+}
+
+func DecodeRespawn(message []byte) (playerId int, x, y, z int8, err error) {
+	reader := newReader(message, "respawn")
+	playerId, x, y, z = reader.id(), reader.int8(), reader.int8(), reader.int8()
+	if err = reader.end(); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return playerId, x, y, z, nil
+}
+
+// size of each location parcel in a locations message
+const LocationParcelSize = 6
+
+// the top bit of a parcel's id is set for a crouching player
+const crouchingBit = 0x80
+
+type LocationParcel struct {
+	Id        byte
+	X, Y, Z   int8
+	Yaw       byte
+	Pitch     int8
+	Crouching bool
+}
+
+// everyone's location, stamped with the server time it was sent at
+func EncodeLocations(sentAt time.Duration, parcels []LocationParcel) []byte {
+	message := make([]byte, 0, 5+len(parcels)*LocationParcelSize)
+	message = appendServerTime(append(message, byte(LocationsHeader)), sentAt)
+	for _, parcel := range parcels {
+		id := parcel.Id
+		if parcel.Crouching {
+			id |= crouchingBit
+		}
+		message = append(message, id, byte(parcel.X), byte(parcel.Y), byte(parcel.Z), parcel.Yaw, byte(parcel.Pitch))
+	}
+	return message
+}
+
+func DecodeLocations(message []byte) (sentAt time.Duration, parcels []LocationParcel, err error) {
+	reader := newReader(message, "locations")
+	sentAt = reader.serverTime()
+	for reader.more() {
+		id := reader.byte()
+		parcel := LocationParcel{
+			Id:        id &^ crouchingBit,
+			X:         reader.int8(),
+			Y:         reader.int8(),
+			Z:         reader.int8(),
+			Yaw:       reader.byte(),
+			Pitch:     reader.int8(),
+			Crouching: id&crouchingBit != 0,
+		}
+		if !ValidId(int(parcel.Id)) {
+			reader.invalid("player id")
+		}
+		parcels = append(parcels, parcel)
+	}
+	if err = reader.end(); err != nil {
+		return 0, nil, err
+	}
+	return sentAt, parcels, nil
+}
+
+// tells everyone who shot and where from, so the shot can be heard from there
+func EncodeShot(shooterId int, x, y, z int8) []byte {
+	return []byte{byte(ShotHeader), byte(shooterId), byte(x), byte(y), byte(z)}
+}
+
+func DecodeShot(message []byte) (shooterId int, x, y, z int8, err error) {
+	reader := newReader(message, "shot")
+	shooterId, x, y, z = reader.id(), reader.int8(), reader.int8(), reader.int8()
+	if err = reader.end(); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return shooterId, x, y, z, nil
+}
+
+// tells everyone a player started reloading a gun, or swapping to it
+func EncodeAction(playerId int, action Action, gun Gun) []byte {
+	return []byte{byte(ActionHeader), byte(playerId), byte(action), byte(gun)}
+}
+
+func DecodeAction(message []byte) (playerId int, action Action, gun Gun, err error) {
+	reader := newReader(message, "action")
+	playerId = reader.id()
+	action, gun = reader.action()
+	if err = reader.end(); err != nil {
+		return 0, 0, 0, err
+	}
+	return playerId, action, gun, nil
+}
+
+// the top bit of the player id in killed and lose health messages is set
+// when it was a headshot
+const headshotBit = 0x80
+
+// the killer, killed and weapon the kill was made with are followed by the
+// ids of the players who assisted
+func EncodeKilled(killerId, killedId int, weapon Weapon, headshot bool, assisterIds []int) []byte {
+	message := []byte{byte(KilledHeader), byte(killerId), byte(killedId), byte(weapon)}
+	if headshot {
+		message[2] |= headshotBit
+	}
+	for _, id := range assisterIds {
+		message = append(message, byte(id))
+	}
+	return message
+}
+
+func DecodeKilled(message []byte) (killerId, killedId int, weapon Weapon, headshot bool, assisterIds []int, err error) {
+	reader := newReader(message, "killed")
+	killerId = reader.id()
+	killed := reader.byte()
+	killedId = int(killed &^ headshotBit)
+	if reader.err == nil && !ValidId(killedId) {
+		reader.invalid("player id")
+	}
+	weapon = Weapon(reader.byte())
+	if weapon >= Weapons {
+		reader.invalid("weapon")
+	}
+	for reader.more() {
+		assisterIds = append(assisterIds, reader.id())
+	}
+	if err = reader.end(); err != nil {
+		return 0, 0, 0, false, nil, err
+	}
+	return killerId, killedId, weapon, killed&headshotBit != 0, assisterIds, nil
+}
+
+func EncodeTeamPoint(team Team) []byte {
+	return []byte{byte(TeamPointHeader), byte(team)}
+}
+
+func DecodeTeamPoint(message []byte) (Team, error) {
+	reader := newReader(message, "team point")
+	team := Team(reader.byte())
+	if team != A && team != B {
+		reader.fail("Deformed team point message")
+	}
+	if err := reader.end(); err != nil {
+		return A, err
+	}
+	return team, nil
+}
+
+// how long is left of the round, in whole seconds, sent as the round starts
+// and to a player resuming the match
+func EncodeRoundTime(left time.Duration) []byte {
+	seconds := min(max(int((left+time.Second-1)/time.Second), 0), math.MaxUint16)
+	return appendUint16([]byte{byte(RoundTimeHeader)}, uint16(seconds))
+}
+
+func DecodeRoundTime(message []byte) (time.Duration, error) {
+	reader := newReader(message, "round time")
+	seconds := reader.uint16()
+	if err := reader.end(); err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// how long is left before the round that has just started is played, sent
+// after the next round message and to anyone who joins before it is played
+func EncodeGrace(left time.Duration) []byte {
+	seconds := min(max(int((left+time.Second-1)/time.Second), 0), math.MaxUint16)
+	return appendUint16([]byte{byte(GraceHeader)}, uint16(seconds))
+}
+
+func DecodeGrace(message []byte) (time.Duration, error) {
+	reader := newReader(message, "grace")
+	seconds := reader.uint16()
+	if err := reader.end(); err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// sent only to the player who was hit
+func EncodeLoseHealth(damage int, headshot bool) []byte {
+	message := []byte{byte(LoseHealthHeader), byte(damage)}
+	if headshot {
+		message[1] |= headshotBit
+	}
+	return message
+}
+
+func DecodeLoseHealth(message []byte) (damage int, headshot bool, err error) {
+	reader := newReader(message, "lose health")
+	field := reader.byte()
+	if err = reader.end(); err != nil {
+		return 0, false, err
+	}
+	return int(field &^ headshotBit), field&headshotBit != 0, nil
+}
+
+func EncodePlayerDisconnect(id int) []byte {
+	return []byte{byte(PlayerDisconnectHeader), byte(id)}
+}
+
+func DecodePlayerDisconnect(message []byte) (int, error) {
+	reader := newReader(message, "player disconnect")
+	id := reader.id()
+	if err := reader.end(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// everything a rejoining client needs to pick the match back up
+type ResumeState struct {
+	Round, TeamAPoints, TeamBPoints, Health int
+	IsAlive, InPlay                         bool
+	X, Y, Z                                 int8
+	Players                                 []PlayerScore
+}
+
+type PlayerScore struct {
+	Id, Kills, Deaths, Assists int
+	IsAlive                    bool
+}
+
+const (
+	resumeFixedSize = 10
+	playerScoreSize = 5
+)
+
+func EncodeResume(state ResumeState) []byte {
+	message := make([]byte, 0, resumeFixedSize+len(state.Players)*playerScoreSize)
+	message = append(message,
+		byte(ResumeHeader),
+		byte(state.Round), byte(state.TeamAPoints), byte(state.TeamBPoints), byte(state.Health),
+		boolToByte(state.IsAlive), boolToByte(state.InPlay),
+		byte(state.X), byte(state.Y), byte(state.Z),
+	)
+	for _, score := range state.Players {
+		message = append(message, byte(score.Id), byte(score.Kills), byte(score.Deaths), byte(score.Assists), boolToByte(score.IsAlive))
+	}
+	return message
+}
+
+func DecodeResume(message []byte) (ResumeState, error) {
+	reader := newReader(message, "resume")
+	state := ResumeState{
+		Round:       int(reader.byte()),
+		TeamAPoints: int(reader.byte()),
+		TeamBPoints: int(reader.byte()),
+		Health:      int(reader.byte()),
+		IsAlive:     reader.bool(),
+		InPlay:      reader.bool(),
+		X:           reader.int8(),
+		Y:           reader.int8(),
+		Z:           reader.int8(),
+	}
+	for reader.more() {
+		state.Players = append(state.Players, PlayerScore{
+			Id:      reader.id(),
+			Kills:   int(reader.byte()),
+			Deaths:  int(reader.byte()),
+			Assists: int(reader.byte()),
+			IsAlive: reader.bool(),
+		})
+	}
+	if err := reader.end(); err != nil {
+		return ResumeState{}, err
+	}
+	return state, nil
+}
+
+// the map is about to change, sent ahead of the next round
+func EncodeMapChange(name string) []byte {
+	return append([]byte{byte(MapChangeHeader)}, name...)
+}
+
+func DecodeMapChange(message []byte) (string, error) {
+	reader := newReader(message, "map change")
+	name := reader.sized(1, math.MaxInt)
+	if err := reader.end(); err != nil {
+		return "", err
+	}
+	return string(name), nil
+}
+
+// the host says something to everyone in the lobby
+func EncodeSay(text string) []byte {
+	return append([]byte{byte(SayHeader)}, text...)
+}
+
+func DecodeSay(message []byte) (string, error) {
+	reader := newReader(message, "say")
+	text := string(reader.sized(1, MaxSayLength))
+	if reader.err == nil && !ValidSay(text) {
+		reader.invalid("text")
+	}
+	if err := reader.end(); err != nil {
+		return "", err
+	}
+	return text, nil
+}
+
+// sent only to someone watching because they joined mid-match, when a slot
+// has been kept for them at the start of a round, with the token to take it
+// with by rejoining
+func EncodePromoted(id int, token []byte) []byte {
+	return append([]byte{byte(PromotedHeader), byte(id)}, token...)
+}
+
+func DecodePromoted(message []byte) (id int, token []byte, err error) {
+	reader := newReader(message, "promoted")
+	id, token = reader.id(), reader.take(SessionTokenSize)
+	if err = reader.end(); err != nil {
+		return 0, nil, err
+	}
+	return id, token, nil
+}
+
+// sent only to a player whose move was refused, with where the server has
+// them after the move with that sequence number
+func EncodeCorrection(sequence Sequence, x, y, z int8) []byte {
+	message := appendUint16([]byte{byte(CorrectionHeader)}, uint16(sequence))
+	return append(message, byte(x), byte(y), byte(z))
+}
+
+func DecodeCorrection(message []byte) (sequence Sequence, x, y, z int8, err error) {
+	reader := newReader(message, "correction")
+	sequence, x, y, z = Sequence(reader.uint16()), reader.int8(), reader.int8(), reader.int8()
+	if err = reader.end(); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return sequence, x, y, z, nil
+}
+
+// answers a client's ping straight away, echoing its number, with the server
+// time it was answered at so the client can keep its estimate of that in step
+func EncodePong(number uint16, serverTime time.Duration) []byte {
+	return appendServerTime(appendUint16([]byte{byte(PongHeader)}, number), serverTime)
+}
+
+func DecodePong(message []byte) (number uint16, serverTime time.Duration, err error) {
+	reader := newReader(message, "pong")
+	number, serverTime = reader.uint16(), reader.serverTime()
+	if err = reader.end(); err != nil {
+		return 0, 0, err
+	}
+	return number, serverTime, nil
+}
+
+// size of each ping parcel in a pings message
+const PingParcelSize = 3
+
+// a player's round trip time to the server, in milliseconds
+type PingParcel struct {
+	Id   int
+	Ping int
+}
+
+// relays everyone's ping for the statistics board
+func EncodePings(parcels []PingParcel) []byte {
+	message := make([]byte, 0, 1+len(parcels)*PingParcelSize)
+	message = append(message, byte(PingsHeader))
+	for _, parcel := range parcels {
+		message = appendUint16(append(message, byte(parcel.Id)), uint16(min(max(parcel.Ping, 0), MaxPing)))
+	}
+	return message
+}
+
+func DecodePings(message []byte) ([]PingParcel, error) {
+	reader := newReader(message, "pings")
+	var parcels []PingParcel
+	for reader.more() {
+		parcels = append(parcels, PingParcel{Id: reader.id(), Ping: int(reader.uint16())})
+	}
+	if err := reader.end(); err != nil {
+		return nil, err
+	}
+	return parcels, nil
+}
+
+// relays a frame of a teammate's voice
+func EncodeVoice(speakerId int, samples []byte) []byte {
+	return append([]byte{byte(VoiceHeader), byte(speakerId)}, samples...)
+}
+
+func DecodeVoice(message []byte) (speakerId int, samples []byte, err error) {
+	reader := newReader(message, "voice")
+	speakerId = reader.id()
+	samples = reader.sized(1, VoiceFrameSamples)
+	if err = reader.end(); err != nil {
+		return 0, nil, err
+	}
+	return speakerId, samples, nil
+}
+
+// where a grenade is and how it is moving, clients follow its arc from here
+// until the next bounce
+type GrenadeState struct {
+	Id         byte
+	X, Y, Z    int8
+	VX, VY, VZ int8 // velocity scaled by VelocityScalingFactor
+}
+
+func appendGrenadeState(message []byte, state GrenadeState) []byte {
+	return append(message, state.Id, byte(state.X), byte(state.Y), byte(state.Z), byte(state.VX), byte(state.VY), byte(state.VZ))
+}
+
+func (reader *reader) grenadeKind() GrenadeKind {
+	kind := GrenadeKind(reader.byte())
+	if kind >= GrenadeKinds {
+		reader.invalid("grenade kind")
+	}
+	return kind
+}
+
+func (reader *reader) grenadeState() GrenadeState {
+	return GrenadeState{
+		Id: reader.byte(),
+		X:  reader.int8(), Y: reader.int8(), Z: reader.int8(),
+		VX: reader.int8(), VY: reader.int8(), VZ: reader.int8(),
+	}
+}
+
+// someone threw a grenade
+func EncodeGrenadeThrow(throwerId int, kind GrenadeKind, state GrenadeState) []byte {
+	return appendGrenadeState([]byte{byte(GrenadeThrowHeader), byte(throwerId), byte(kind)}, state)
+}
+
+func DecodeGrenadeThrow(message []byte) (throwerId int, kind GrenadeKind, state GrenadeState, err error) {
+	reader := newReader(message, "grenade throw")
+	throwerId = reader.id()
+	kind = reader.grenadeKind()
+	state = reader.grenadeState()
+	if err = reader.end(); err != nil {
+		return 0, 0, GrenadeState{}, err
+	}
+	return throwerId, kind, state, nil
+}
+
+// a grenade bounced off a block and is now going somewhere else
+func EncodeGrenadeBounce(state GrenadeState) []byte {
+	return appendGrenadeState([]byte{byte(GrenadeBounceHeader)}, state)
+}
+
+func DecodeGrenadeBounce(message []byte) (GrenadeState, error) {
+	reader := newReader(message, "grenade bounce")
+	state := reader.grenadeState()
+	if err := reader.end(); err != nil {
+		return GrenadeState{}, err
+	}
+	return state, nil
+}
+
+// a frag grenade went off, anyone hurt by it is told separately
+func EncodeExplosion(grenadeId byte, x, y, z int8) []byte {
+	return encodeDetonation(ExplosionHeader, grenadeId, x, y, z)
+}
+
+func DecodeExplosion(message []byte) (grenadeId byte, x, y, z int8, err error) {
+	return decodeDetonation(message, "explosion")
+}
+
+// a smoke grenade went off, and a cloud is spreading from it
+func EncodeSmoke(grenadeId byte, x, y, z int8) []byte {
+	return encodeDetonation(SmokeHeader, grenadeId, x, y, z)
+}
+
+func DecodeSmoke(message []byte) (grenadeId byte, x, y, z int8, err error) {
+	return decodeDetonation(message, "smoke")
+}
+
+// a flashbang went off, each client works out how badly it is blinded
+func EncodeFlash(grenadeId byte, x, y, z int8) []byte {
+	return encodeDetonation(FlashHeader, grenadeId, x, y, z)
+}
+
+func DecodeFlash(message []byte) (grenadeId byte, x, y, z int8, err error) {
+	return decodeDetonation(message, "flash")
+}
+
+// which grenade went off and where
+func encodeDetonation(header MessageHeader, grenadeId byte, x, y, z int8) []byte {
+	return []byte{byte(header), grenadeId, byte(x), byte(y), byte(z)}
+}
+
+func decodeDetonation(message []byte, name string) (grenadeId byte, x, y, z int8, err error) {
+	reader := newReader(message, name)
+	grenadeId, x, y, z = reader.byte(), reader.int8(), reader.int8(), reader.int8()
+	if err = reader.end(); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return grenadeId, x, y, z, nil
+}
+
+// names of the players in each slot, an empty name is an empty slot, and
+// slots past the end are empty too
+type Roster []string
+
+// the name in a slot, empty if nobody is in it
+func (roster Roster) Name(id int) string {
+	if id < 0 || len(roster) <= id {
+		return ""
+	}
+	return roster[id]
+}
+
+// tells everyone who is playing whenever someone joins or leaves, each name
+// goes after its player's id and length
+func EncodeRoster(roster Roster) []byte {
+	message := []byte{byte(RosterHeader)}
+	for id, name := range roster {
+		if name == "" {
+			continue
+		}
+		message = append(append(message, byte(id), byte(len(name))), name...)
+	}
+	return message
+}
+
+func DecodeRoster(message []byte) (roster Roster, err error) {
+	reader := newReader(message, "roster")
+	for reader.more() {
+		id, name := reader.id(), reader.string()
+		if reader.err == nil && !ValidName(name) {
+			reader.invalid("name")
+		}
+		if reader.err == nil {
+			if len(roster) <= id {
+				roster = append(roster, make(Roster, id+1-len(roster))...)
+			}
+			roster[id] = name
+		}
+	}
+	if err = reader.end(); err != nil {
+		return nil, err
+	}
+	return roster, nil
+}
+
+// someone picked up a health pack, healing by the amount given, health packs
+// are numbered in the order the map lists them
+func EncodeHealthPackTaken(pack, playerId, healed int) []byte {
+	return []byte{byte(HealthPackTakenHeader), byte(pack), byte(playerId), byte(healed)}
+}
+
+func DecodeHealthPackTaken(message []byte) (pack, playerId, healed int, err error) {
+	reader := newReader(message, "health pack taken")
+	pack, playerId, healed = int(reader.byte()), reader.id(), int(reader.byte())
+	if err = reader.end(); err != nil {
+		return 0, 0, 0, err
+	}
+	return pack, playerId, healed, nil
+}
+
+// the health packs that are taken and waiting to come back, sent whenever one
+// comes back and to a player resuming the match
+func EncodeHealthPacks(taken []int) []byte {
+	message := make([]byte, 1, 1+len(taken))
+	message[0] = byte(HealthPacksHeader)
+	for _, pack := range taken {
+		message = append(message, byte(pack))
+	}
+	return message
+}
+
+func DecodeHealthPacks(message []byte) []int {
+	reader := newReader(message, "health packs")
+	var taken []int
+	for reader.more() {
+		taken = append(taken, int(reader.byte()))
+	}
+	return taken
+}
+
+// someone opened or closed a door, doors are numbered in the order the map
+// lists them
+func EncodeDoor(door int, open bool) []byte {
+	return []byte{byte(DoorHeader), byte(door), boolToByte(open)}
+}
+
+func DecodeDoor(message []byte) (door int, open bool, err error) {
+	reader := newReader(message, "door")
+	door, open = int(reader.byte()), reader.bool()
+	if err = reader.end(); err != nil {
+		return 0, false, err
+	}
+	return door, open, nil
+}
+
+// the doors that are open, sent to a player resuming the match and to
+// observers, as every door goes back to how the map has it each round
+func EncodeDoors(open []int) []byte {
+	message := make([]byte, 1, 1+len(open))
+	message[0] = byte(DoorsHeader)
+	for _, door := range open {
+		message = append(message, byte(door))
+	}
+	return message
+}
+
+func DecodeDoors(message []byte) []int {
+	reader := newReader(message, "doors")
+	var open []int
+	for reader.more() {
+		open = append(open, int(reader.byte()))
+	}
+	return open
+}
+
+// a player stepped onto a jump pad, jump pads are numbered in the order the
+// map lists them
+func EncodeLaunch(playerId, pad int) []byte {
+	return []byte{byte(LaunchHeader), byte(playerId), byte(pad)}
+}
+
+func DecodeLaunch(message []byte) (playerId, pad int, err error) {
+	reader := newReader(message, "launch")
+	playerId, pad = reader.id(), int(reader.byte())
+	if err = reader.end(); err != nil {
+		return 0, 0, err
+	}
+	return playerId, pad, nil
+}
+
+// a player stepped into a teleporter and was moved to where it leads, so
+// they are shown there straight away instead of sliding across the map,
+// teleporters are numbered in the order the map lists them
+func EncodeTeleport(playerId, teleporter int) []byte {
+	return []byte{byte(TeleportHeader), byte(playerId), byte(teleporter)}
+}
+
+func DecodeTeleport(message []byte) (playerId, teleporter int, err error) {
+	reader := newReader(message, "teleport")
+	playerId, teleporter = reader.id(), int(reader.byte())
+	if err = reader.end(); err != nil {
+		return 0, 0, err
+	}
+	return playerId, teleporter, nil
+}
+
+// the top bit of the kills in a streak message is set when the player has
+// killed the whole other team by themselves this round
+const aceBit = 0x80
+
+// a player's kill streak reached a milestone, how many enemies they have
+// killed without dying
+func EncodeStreak(playerId, kills int, ace bool) []byte {
+	message := []byte{byte(StreakHeader), byte(playerId), byte(min(max(kills, 0), 0x7F))}
+	if ace {
+		message[2] |= aceBit
+	}
+	return message
+}
+
+func DecodeStreak(message []byte) (playerId, kills int, ace bool, err error) {
+	reader := newReader(message, "streak")
+	playerId = reader.id()
+	field := reader.byte()
+	if err = reader.end(); err != nil {
+		return 0, 0, false, err
+	}
+	return playerId, int(field &^ aceBit), field&aceBit != 0, nil
+}
+
+// a player marked a spot for their team, sent only to that team, the
+// marker included
+func EncodeMarker(playerId int, x, y, z int8) []byte {
+	return []byte{byte(MarkerHeader), byte(playerId), byte(x), byte(y), byte(z)}
+}
+
+func DecodeMarker(message []byte) (playerId int, x, y, z int8, err error) {
+	reader := newReader(message, "marker")
+	playerId, x, y, z = reader.id(), reader.int8(), reader.int8(), reader.int8()
+	if err = reader.end(); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return playerId, x, y, z, nil
+}
+
+// how much health a player has left, sent to their teammates whenever it
+// changes other than by dying or a new round starting
+func EncodeTeammateHealth(playerId, health int) []byte {
+	return []byte{byte(TeammateHealthHeader), byte(playerId), byte(min(max(health, 0), math.MaxUint8))}
+}
+
+func DecodeTeammateHealth(message []byte) (playerId, health int, err error) {
+	reader := newReader(message, "teammate health")
+	playerId, health = reader.id(), int(reader.byte())
+	if err = reader.end(); err != nil {
+		return 0, 0, err
+	}
+	return playerId, health, nil
+}
+
+// a player's money and what they have bought, which they keep until they die
+type Inventory struct {
+	Money    int
+	Primary  Item // NoPrimary if they have none
+	Armor    int
+	Grenades [GrenadeKinds]int
+}
+
+// sent only to the player it belongs to, whenever it changes
+func EncodeInventory(inventory Inventory) []byte {
+	message := appendUint16([]byte{byte(InventoryHeader)}, uint16(inventory.Money))
+	message = append(message, byte(inventory.Primary), byte(inventory.Armor))
+	for _, count := range inventory.Grenades {
+		message = append(message, byte(count))
+	}
+	return message
+}
+
+func DecodeInventory(message []byte) (Inventory, error) {
+	reader := newReader(message, "inventory")
+	inventory := Inventory{
+		Money:   int(reader.uint16()),
+		Primary: Item(reader.byte()),
+		Armor:   int(reader.byte()),
+	}
+	if !inventory.Primary.IsPrimary() && inventory.Primary != NoPrimary {
+		reader.invalid("primary")
+	}
+	for kind := range inventory.Grenades {
+		inventory.Grenades[kind] = int(reader.byte())
+	}
+	if err := reader.end(); err != nil {
+		return Inventory{}, err
+	}
+	return inventory, nil
+}
+
+const playerStatisticsSize = 7
+
+// how a player shot over the whole match, with the damage they dealt to
+// enemies, shots and damage are capped to what fits in the message
+type PlayerStatistics struct {
+	Id, ShotsFired, ShotsHit, Damage int
+}
+
+// the percentage of shots fired that hit an enemy, a shotgun shot hitting
+// more than one counts each of them, so it is capped
+func (player PlayerStatistics) Accuracy() int {
+	if player.ShotsFired == 0 {
+		return 0
+	}
+	return min(player.ShotsHit*100/player.ShotsFired, 100)
+}
+
+// the top bit of the player id in a hit confirm message is set when the hit
+// landed
+const acceptedBit = 0x80
+
+// what the server made of a hit a client sent it: whether it landed, how much
+// it hurt, armor included, and how much health the hit player has left
+type HitConfirmation struct {
+	PlayerId int
+	Accepted bool
+	Headshot bool
+	Damage   int
+	Health   int // 0 if the hit killed them
+}
+
+// sent only to the shooter, for every hit they send
+func EncodeHitConfirm(confirmation HitConfirmation) []byte {
+	message := []byte{byte(HitConfirmHeader), byte(confirmation.PlayerId), byte(min(max(confirmation.Damage, 0), 0x7F)), byte(min(max(confirmation.Health, 0), math.MaxUint8))}
+	if confirmation.Accepted {
+		message[1] |= acceptedBit
+	}
+	if confirmation.Headshot {
+		message[2] |= headshotBit
+	}
+	return message
+}
+
+func DecodeHitConfirm(message []byte) (HitConfirmation, error) {
+	reader := newReader(message, "hit confirm")
+	player, damage := reader.byte(), reader.byte()
+	confirmation := HitConfirmation{
+		PlayerId: int(player &^ acceptedBit),
+		Accepted: player&acceptedBit != 0,
+		Headshot: damage&headshotBit != 0,
+		Damage:   int(damage &^ headshotBit),
+		Health:   int(reader.byte()),
+	}
+	if reader.err == nil && !ValidId(confirmation.PlayerId) {
+		reader.invalid("player id")
+	}
+	if err := reader.end(); err != nil {
+		return HitConfirmation{}, err
+	}
+	return confirmation, nil
+}
+
+// sent to everyone once the match is over, before the last next round message
+func EncodeStatistics(statistics []PlayerStatistics) []byte {
+	message := make([]byte, 0, 1+len(statistics)*playerStatisticsSize)
+	message = append(message, byte(StatisticsHeader))
+	for _, player := range statistics {
+		message = append(message, byte(player.Id))
+		for _, number := range [...]int{player.ShotsFired, player.ShotsHit, player.Damage} {
+			message = appendUint16(message, uint16(min(max(number, 0), math.MaxUint16)))
+		}
+	}
+	return message
+}
+
+func DecodeStatistics(message []byte) ([]PlayerStatistics, error) {
+	reader := newReader(message, "statistics")
+	var statistics []PlayerStatistics
+	for reader.more() {
+		statistics = append(statistics, PlayerStatistics{
+			Id:         reader.id(),
+			ShotsFired: int(reader.uint16()),
+			ShotsHit:   int(reader.uint16()),
+			Damage:     int(reader.uint16()),
+		})
+	}
+	if err := reader.end(); err != nil {
+		return nil, err
+	}
+	return statistics, nil
+}
+
+// how a vote stands, sent to everyone when it is called, whenever someone
+// votes and once it is decided; the target is 0 unless it is a kick vote
+type VoteState struct {
+	Kind            VoteKind
+	CallerId        int
+	TargetId        int
+	Yes, No, Needed int
+	Left            time.Duration // until the vote fails, in whole seconds
+	Result          VoteResult
+}
+
+func EncodeVoteState(state VoteState) []byte {
+	return []byte{
+		byte(VoteHeader), byte(state.Kind), byte(state.CallerId), byte(state.TargetId),
+		byte(state.Yes), byte(state.No), byte(state.Needed),
+		byte(min(max(int(state.Left/time.Second), 0), math.MaxUint8)), byte(state.Result),
+	}
+}
+
+func DecodeVoteState(message []byte) (VoteState, error) {
+	reader := newReader(message, "vote")
+	state := VoteState{
+		Kind:     VoteKind(reader.byte()),
+		CallerId: reader.id(),
+		TargetId: reader.id(),
+		Yes:      int(reader.byte()),
+		No:       int(reader.byte()),
+		Needed:   int(reader.byte()),
+		Left:     time.Duration(reader.byte()) * time.Second,
+		Result:   VoteResult(reader.byte()),
+	}
+	if state.Kind >= VoteKinds {
+		reader.invalid("vote kind")
+	}
+	if state.Result >= VoteResults {
+		reader.invalid("vote result")
+	}
+	if err := reader.end(); err != nil {
+		return VoteState{}, err
+	}
+	return state, nil
+}
+
+// the longest message that can go in a batch, its length has to fit in a byte
+const MaxBatchedSize = math.MaxUint8
+
+// several messages sent in one frame, each with its length ahead of it,
+// batches are not nested
+func EncodeBatch(messages [][]byte) []byte {
+	message := []byte{byte(BatchHeader)}
+	for _, batched := range messages {
+		message = append(append(message, byte(len(batched))), batched...)
+	}
+	return message
+}
+
+func DecodeBatch(message []byte) ([][]byte, error) {
+	reader := newReader(message, "batch")
+	var messages [][]byte
+	for reader.more() {
+		batched := reader.take(int(reader.byte()))
+		switch {
+		case reader.err != nil:
+		case len(batched) == 0:
+			reader.fail("Empty message in batch message")
+		case MessageHeader(batched[0]) == BatchHeader:
+			reader.fail("Batch message in batch message")
+		}
+		messages = append(messages, batched)
+	}
+	if len(messages) == 0 {
+		reader.fail("Empty batch message")
+	}
+	if err := reader.end(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// the messages to send in order, with each run of them short enough to be
+// batched sent as one batch
+func Batch(messages [][]byte) [][]byte {
+	var frames, run [][]byte
+	flush := func() {
+		switch len(run) {
+		case 0:
+		case 1:
+			frames = append(frames, run[0])
+		default:
+			frames = append(frames, EncodeBatch(run))
+		}
+		run = nil
+	}
+	for _, message := range messages {
+		if len(message) > MaxBatchedSize {
+			flush()
+			frames = append(frames, message)
+			continue
+		}
+		run = append(run, message)
+	}
+	flush()
+	return frames
+}
+
+// client sends a frame of its player's voice
+func EncodeVoiceMessage(samples []byte) []byte {
+	return append([]byte{byte(VoiceMessage)}, samples...)
+}
+
+func DecodeVoiceMessage(message []byte) ([]byte, error) {
+	reader := newReader(message, "voice")
+	samples := reader.sized(1, VoiceFrameSamples)
+	if err := reader.end(); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// client throws a grenade the way it is looking, the direction being scaled
+// up to fill an int8
+func EncodeThrow(kind GrenadeKind, dx, dy, dz int8) []byte {
+	return []byte{byte(ThrowMessage), byte(kind), byte(dx), byte(dy), byte(dz)}
+}
+
+func DecodeThrow(message []byte) (kind GrenadeKind, dx, dy, dz int8, err error) {
+	reader := newReader(message, "throw")
+	kind, dx, dy, dz = reader.grenadeKind(), reader.int8(), reader.int8(), reader.int8()
+	if err = reader.end(); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return kind, dx, dy, dz, nil
+}
+
+// client buys an item before the round starts
+func EncodeBuy(item Item) []byte {
+	return []byte{byte(BuyMessage), byte(item)}
+}
+
+func DecodeBuy(message []byte) (Item, error) {
+	reader := newReader(message, "buy")
+	item := Item(reader.byte())
+	if item >= Items {
+		reader.invalid("item")
+	}
+	if err := reader.end(); err != nil {
+		return 0, err
+	}
+	return item, nil
+}
+
+//////// client messages
+
+// client tells the server it hit another player with some of the pellets of
+// a shot, some of which may have been headshots, the server works out the
+// damage; seenAt is the server time of the world the shooter was looking at,
+// which is where lag compensation would rewind to
+func EncodeHit(hitPlayerId int, gun Gun, pellets, headshots int, seenAt time.Duration) []byte {
+	return appendServerTime([]byte{byte(HitMessage), byte(hitPlayerId), byte(gun), byte(pellets), byte(headshots)}, seenAt)
+}
+
+func DecodeHit(message []byte) (hitPlayerId int, gun Gun, pellets, headshots int, seenAt time.Duration, err error) {
+	reader := newReader(message, "hit")
+	hitPlayerId = reader.id()
+	gun = Gun(reader.byte())
+	if gun >= Guns {
+		reader.invalid("gun")
+	}
+	pellets, headshots = int(reader.byte()), int(reader.byte())
+	if headshots > pellets {
+		reader.fail("More headshots than pellets in hit message")
+	}
+	seenAt = reader.serverTime()
+	if err = reader.end(); err != nil {
+		return 0, 0, 0, 0, 0, err
+	}
+	return hitPlayerId, gun, pellets, headshots, seenAt, nil
+}
+
+// client tells the server it shot a gun
+func EncodeShotMessage() []byte {
+	return []byte{byte(ShotMessage)}
+}
+
+// client opens or closes the door in front of it, the server works out which
+func EncodeUse() []byte {
+	return []byte{byte(UseMessage)}
+}
+
+// client marks the spot it is looking at for its team
+func EncodeMark(x, y, z int8) []byte {
+	return []byte{byte(MarkMessage), byte(x), byte(y), byte(z)}
+}
+
+func DecodeMark(message []byte) (x, y, z int8, err error) {
+	reader := newReader(message, "mark")
+	x, y, z = reader.int8(), reader.int8(), reader.int8()
+	if err = reader.end(); err != nil {
+		return 0, 0, 0, err
+	}
+	return x, y, z, nil
+}
+
+// client tells the server it started reloading a gun, or swapping to it
+func EncodeActionMessage(action Action, gun Gun) []byte {
+	return []byte{byte(ActionMessage), byte(action), byte(gun)}
+}
+
+func DecodeActionMessage(message []byte) (Action, Gun, error) {
+	reader := newReader(message, "action")
+	action, gun := reader.action()
+	if err := reader.end(); err != nil {
+		return 0, 0, err
+	}
+	return action, gun, nil
+}
+
+func (reader *reader) action() (Action, Gun) {
+	action, gun := Action(reader.byte()), Gun(reader.byte())
+	if action >= Actions {
+		reader.invalid("action")
+	}
+	if gun >= Guns {
+		reader.invalid("gun")
+	}
+	return action, gun
+}
+
+// client tells the server how far it moved since its last move message, in
+// scaled units, which way it is looking, scaled like in location parcels, and
+// whether it is crouching
+type Move struct {
+	Sequence
+	Dx, Dy, Dz int8
+	Yaw        byte
+	Pitch      int8
+	Crouching  bool
+}
+
+func EncodeMove(move Move) []byte {
+	message := appendUint16([]byte{byte(MoveMessage)}, uint16(move.Sequence))
+	return append(message, byte(move.Dx), byte(move.Dy), byte(move.Dz), move.Yaw, byte(move.Pitch), boolToByte(move.Crouching))
+}
+
+func DecodeMove(message []byte) (Move, error) {
+	reader := newReader(message, "move")
+	move := Move{
+		Sequence:  Sequence(reader.uint16()),
+		Dx:        reader.int8(),
+		Dy:        reader.int8(),
+		Dz:        reader.int8(),
+		Yaw:       reader.byte(),
+		Pitch:     reader.int8(),
+		Crouching: reader.bool(),
+	}
+	if err := reader.end(); err != nil {
+		return Move{}, err
+	}
+	return move, nil
+}
+
+// client asks for a pong to time its round trip, and reports the last round
+// trip it timed in milliseconds so the server can pass it on
+func EncodePing(number uint16, lastPing int) []byte {
+	message := appendUint16([]byte{byte(PingMessage)}, number)
+	return appendUint16(message, uint16(min(max(lastPing, 0), MaxPing)))
+}
+
+func DecodePing(message []byte) (number uint16, lastPing int, err error) {
+	reader := newReader(message, "ping")
+	number, lastPing = reader.uint16(), int(reader.uint16())
+	if err = reader.end(); err != nil {
+		return 0, 0, err
+	}
+	return number, lastPing, nil
+}
+
+// client calls a vote, the target is the player to kick, and 0 for any other
+// kind of vote
+func EncodeCallVote(kind VoteKind, targetId int) []byte {
+	return []byte{byte(CallVoteMessage), byte(kind), byte(targetId)}
+}
+
+func DecodeCallVote(message []byte) (kind VoteKind, targetId int, err error) {
+	reader := newReader(message, "call vote")
+	kind, targetId = VoteKind(reader.byte()), reader.id()
+	if kind >= VoteKinds {
+		reader.invalid("vote kind")
+	}
+	if err = reader.end(); err != nil {
+		return 0, 0, err
+	}
+	return kind, targetId, nil
+}
+
+// client votes for or against the vote being held
+func EncodeBallot(yes bool) []byte {
+	return []byte{byte(BallotMessage), boolToByte(yes)}
+}
+
+func DecodeBallot(message []byte) (bool, error) {
+	reader := newReader(message, "ballot")
+	yes := reader.bool()
+	if err := reader.end(); err != nil {
+		return false, err
+	}
+	return yes, nil
+}
+
+//////// datagrams
+
+// client asks over UDP for locations to be sent to wherever this came from,
+// the session token says who it is
+func EncodeHello(token []byte) []byte {
+	return append(appendUint16(nil, Version), token...)
+}
+
+func DecodeHello(datagram []byte) ([]byte, error) {
+	reader := newHandshakeReader(datagram, "hello")
+	if version := reader.uint16(); reader.err == nil && version != Version {
+		return nil, VersionError{Version: int(version)}
+	}
+	token := reader.take(SessionTokenSize)
+	if err := reader.end(); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// a locations message sent over UDP, numbered so that one arriving after a
+// later one can be dropped
+func EncodeLocationsDatagram(sequence Sequence, locations []byte) []byte {
+	return append(appendUint16(nil, uint16(sequence)), locations...)
+}
+
+func DecodeLocationsDatagram(datagram []byte) (Sequence, []byte, error) {
+	reader := newHandshakeReader(datagram, "locations datagram")
+	sequence := Sequence(reader.uint16())
+	locations := reader.rest()
+	if reader.err == nil && (len(locations) == 0 || MessageHeader(locations[0]) != LocationsHeader) {
+		reader.invalid("header")
+	}
+	if err := reader.end(); err != nil {
+		return 0, nil, err
+	}
+	return sequence, locations, nil
+}
@@ -0,0 +1,551 @@
+package protocol
+
+import (
+	"fmt"
+	"time"
+)
+
+//////// parse
+//////// a whole message decoded into a value of the type for its header, so a
+//////// handler switches on what it was sent instead of reading bytes itself;
+//////// parsing touches nothing but the message, and a value that comes out
+//////// of it has every id and kind in range, whatever the bytes were; a player
+//////// id is only known to be a slot in the largest lobby, so PlayerIds gives
+//////// every one a message names for its handler to check against its own
+
+//////// messages from the server
+
+type NextRoundEvent struct{}
+
+type PlayEvent struct{}
+
+type WarmupEvent struct{}
+
+type RespawnEvent struct {
+	PlayerId int
+	X, Y, Z  int8
+}
+
+type LocationsEvent struct {
+	SentAt  time.Duration // on the server's clock
+	Players []LocationParcel
+}
+
+type ShotEvent struct {
+	ShooterId int
+	X, Y, Z   int8
+}
+
+type ActionEvent struct {
+	PlayerId int
+	Action   Action
+	Gun      Gun
+}
+
+type KilledEvent struct {
+	KillerId, KilledId int
+	Weapon             Weapon
+	Headshot           bool
+	AssisterIds        []int
+}
+
+type TeamPointEvent struct {
+	Team Team
+}
+
+type RoundTimeEvent struct {
+	Left time.Duration
+}
+
+type GraceEvent struct {
+	Left time.Duration
+}
+
+type LoseHealthEvent struct {
+	Damage   int
+	Headshot bool
+}
+
+type PlayerDisconnectEvent struct {
+	Id int
+}
+
+type MapChangeEvent struct {
+	Name string
+}
+
+type SayEvent struct {
+	Text string
+}
+
+type PromotedEvent struct {
+	PlayerId int
+	Token    []byte
+}
+
+type CorrectionEvent struct {
+	Sequence
+	X, Y, Z int8
+}
+
+type PongEvent struct {
+	Number     uint16
+	ServerTime time.Duration
+}
+
+type PingsEvent []PingParcel
+
+type VoiceEvent struct {
+	SpeakerId int
+	Samples   []byte
+}
+
+type GrenadeThrowEvent struct {
+	ThrowerId int
+	Kind      GrenadeKind
+	State     GrenadeState
+}
+
+type GrenadeBounceEvent struct {
+	State GrenadeState
+}
+
+// which grenade went off and where
+type Detonation struct {
+	GrenadeId byte
+	X, Y, Z   int8
+}
+
+type ExplosionEvent Detonation
+
+type SmokeEvent Detonation
+
+type FlashEvent Detonation
+
+type HealthPackTakenEvent struct {
+	Pack, PlayerId, Healed int
+}
+
+type HealthPacksEvent struct {
+	Taken []int
+}
+
+type DoorEvent struct {
+	Door int
+	Open bool
+}
+
+type DoorsEvent struct {
+	Open []int
+}
+
+type LaunchEvent struct {
+	PlayerId int
+	Pad      int
+}
+
+type TeleportEvent struct {
+	PlayerId   int
+	Teleporter int
+}
+
+type StreakEvent struct {
+	PlayerId int
+	Kills    int
+	Ace      bool
+}
+
+type MarkerEvent struct {
+	PlayerId int
+	X, Y, Z  int8
+}
+
+type TeammateHealthEvent struct {
+	PlayerId int
+	Health   int
+}
+
+type StatisticsEvent []PlayerStatistics
+
+// a message from the server as one of the events above, or as a ResumeState,
+// Roster, Inventory, HitConfirmation or VoteState; batches are split before
+// they get here, so one is an error like any other header the client does
+// not expect
+func ParseServerMessage(message []byte) (any, error) {
+	if len(message) == 0 {
+		return nil, ErrEmptyMessage
+	}
+	var err error
+	switch header := MessageHeader(message[0]); header {
+	case NextRoundHeader:
+		return NextRoundEvent{}, decodeHeaderOnly(message, "next round")
+
+	case PlayHeader:
+		return PlayEvent{}, decodeHeaderOnly(message, "play")
+
+	case WarmupHeader:
+		return WarmupEvent{}, decodeHeaderOnly(message, "warmup")
+
+	case RespawnHeader:
+		var event RespawnEvent
+		event.PlayerId, event.X, event.Y, event.Z, err = DecodeRespawn(message)
+		return event, err
+
+	case LocationsHeader:
+		var event LocationsEvent
+		event.SentAt, event.Players, err = DecodeLocations(message)
+		return event, err
+
+	case ShotHeader:
+		var event ShotEvent
+		event.ShooterId, event.X, event.Y, event.Z, err = DecodeShot(message)
+		return event, err
+
+	case ActionHeader:
+		var event ActionEvent
+		event.PlayerId, event.Action, event.Gun, err = DecodeAction(message)
+		return event, err
+
+	case KilledHeader:
+		var event KilledEvent
+		event.KillerId, event.KilledId, event.Weapon, event.Headshot, event.AssisterIds, err = DecodeKilled(message)
+		return event, err
+
+	case TeamPointHeader:
+		var event TeamPointEvent
+		event.Team, err = DecodeTeamPoint(message)
+		return event, err
+
+	case RoundTimeHeader:
+		var event RoundTimeEvent
+		event.Left, err = DecodeRoundTime(message)
+		return event, err
+
+	case GraceHeader:
+		var event GraceEvent
+		event.Left, err = DecodeGrace(message)
+		return event, err
+
+	case LoseHealthHeader:
+		var event LoseHealthEvent
+		event.Damage, event.Headshot, err = DecodeLoseHealth(message)
+		return event, err
+
+	case PlayerDisconnectHeader:
+		var event PlayerDisconnectEvent
+		event.Id, err = DecodePlayerDisconnect(message)
+		return event, err
+
+	case ResumeHeader:
+		return DecodeResume(message)
+
+	case MapChangeHeader:
+		var event MapChangeEvent
+		event.Name, err = DecodeMapChange(message)
+		return event, err
+
+	case SayHeader:
+		var event SayEvent
+		event.Text, err = DecodeSay(message)
+		return event, err
+
+	case PromotedHeader:
+		var event PromotedEvent
+		event.PlayerId, event.Token, err = DecodePromoted(message)
+		return event, err
+
+	case CorrectionHeader:
+		var event CorrectionEvent
+		event.Sequence, event.X, event.Y, event.Z, err = DecodeCorrection(message)
+		return event, err
+
+	case PongHeader:
+		var event PongEvent
+		event.Number, event.ServerTime, err = DecodePong(message)
+		return event, err
+
+	case PingsHeader:
+		var parcels []PingParcel
+		parcels, err = DecodePings(message)
+		return PingsEvent(parcels), err
+
+	case RosterHeader:
+		return DecodeRoster(message)
+
+	case VoiceHeader:
+		var event VoiceEvent
+		event.SpeakerId, event.Samples, err = DecodeVoice(message)
+		return event, err
+
+	case GrenadeThrowHeader:
+		var event GrenadeThrowEvent
+		event.ThrowerId, event.Kind, event.State, err = DecodeGrenadeThrow(message)
+		return event, err
+
+	case GrenadeBounceHeader:
+		var event GrenadeBounceEvent
+		event.State, err = DecodeGrenadeBounce(message)
+		return event, err
+
+	case ExplosionHeader:
+		var event ExplosionEvent
+		event.GrenadeId, event.X, event.Y, event.Z, err = DecodeExplosion(message)
+		return event, err
+
+	case SmokeHeader:
+		var event SmokeEvent
+		event.GrenadeId, event.X, event.Y, event.Z, err = DecodeSmoke(message)
+		return event, err
+
+	case FlashHeader:
+		var event FlashEvent
+		event.GrenadeId, event.X, event.Y, event.Z, err = DecodeFlash(message)
+		return event, err
+
+	case HealthPackTakenHeader:
+		var event HealthPackTakenEvent
+		event.Pack, event.PlayerId, event.Healed, err = DecodeHealthPackTaken(message)
+		return event, err
+
+	case HealthPacksHeader:
+		return HealthPacksEvent{Taken: DecodeHealthPacks(message)}, nil
+
+	case DoorHeader:
+		var event DoorEvent
+		event.Door, event.Open, err = DecodeDoor(message)
+		return event, err
+
+	case DoorsHeader:
+		return DoorsEvent{Open: DecodeDoors(message)}, nil
+
+	case LaunchHeader:
+		var event LaunchEvent
+		event.PlayerId, event.Pad, err = DecodeLaunch(message)
+		return event, err
+
+	case TeleportHeader:
+		var event TeleportEvent
+		event.PlayerId, event.Teleporter, err = DecodeTeleport(message)
+		return event, err
+
+	case StreakHeader:
+		var event StreakEvent
+		event.PlayerId, event.Kills, event.Ace, err = DecodeStreak(message)
+		return event, err
+
+	case MarkerHeader:
+		var event MarkerEvent
+		event.PlayerId, event.X, event.Y, event.Z, err = DecodeMarker(message)
+		return event, err
+
+	case TeammateHealthHeader:
+		var event TeammateHealthEvent
+		event.PlayerId, event.Health, err = DecodeTeammateHealth(message)
+		return event, err
+
+	case InventoryHeader:
+		return DecodeInventory(message)
+
+	case StatisticsHeader:
+		var statistics []PlayerStatistics
+		statistics, err = DecodeStatistics(message)
+		return StatisticsEvent(statistics), err
+
+	case HitConfirmHeader:
+		return DecodeHitConfirm(message)
+
+	case VoteHeader:
+		return DecodeVoteState(message)
+
+	default:
+		return nil, fmt.Errorf("Unexpected %s message", header)
+	}
+}
+
+//////// messages from clients
+
+type HitRequest struct {
+	PlayerId           int
+	Gun                Gun
+	Pellets, Headshots int
+	SeenAt             time.Duration // on the server's clock
+}
+
+type ShotRequest struct{}
+
+type PingRequest struct {
+	Number   uint16
+	LastPing int
+}
+
+type VoiceRequest struct {
+	Samples []byte
+}
+
+type ThrowRequest struct {
+	Kind       GrenadeKind
+	Dx, Dy, Dz int8
+}
+
+type BuyRequest struct {
+	Item Item
+}
+
+type ActionRequest struct {
+	Action Action
+	Gun    Gun
+}
+
+type CallVoteRequest struct {
+	Kind     VoteKind
+	TargetId int
+}
+
+type BallotRequest struct {
+	Yes bool
+}
+
+type UseRequest struct{}
+
+type MarkRequest struct {
+	X, Y, Z int8
+}
+
+// a message from a client as one of the requests above, or as a Move
+func ParseClientMessage(message []byte) (any, error) {
+	if len(message) == 0 {
+		return nil, ErrEmptyMessage
+	}
+	var err error
+	switch header := ClientMessage(message[0]); header {
+	case HitMessage:
+		var request HitRequest
+		request.PlayerId, request.Gun, request.Pellets, request.Headshots, request.SeenAt, err = DecodeHit(message)
+		return request, err
+
+	case ShotMessage:
+		return ShotRequest{}, decodeHeaderOnly(message, "shot")
+
+	case MoveMessage:
+		return DecodeMove(message)
+
+	case PingMessage:
+		var request PingRequest
+		request.Number, request.LastPing, err = DecodePing(message)
+		return request, err
+
+	case VoiceMessage:
+		var request VoiceRequest
+		request.Samples, err = DecodeVoiceMessage(message)
+		return request, err
+
+	case ThrowMessage:
+		var request ThrowRequest
+		request.Kind, request.Dx, request.Dy, request.Dz, err = DecodeThrow(message)
+		return request, err
+
+	case BuyMessage:
+		var request BuyRequest
+		request.Item, err = DecodeBuy(message)
+		return request, err
+
+	case ActionMessage:
+		var request ActionRequest
+		request.Action, request.Gun, err = DecodeActionMessage(message)
+		return request, err
+
+	case CallVoteMessage:
+		var request CallVoteRequest
+		request.Kind, request.TargetId, err = DecodeCallVote(message)
+		return request, err
+
+	case BallotMessage:
+		var request BallotRequest
+		request.Yes, err = DecodeBallot(message)
+		return request, err
+
+	case UseMessage:
+		return UseRequest{}, decodeHeaderOnly(message, "use")
+
+	case MarkMessage:
+		var request MarkRequest
+		request.X, request.Y, request.Z, err = DecodeMark(message)
+		return request, err
+
+	default:
+		return nil, fmt.Errorf("Unexpected %s message", header)
+	}
+}
+
+// a message that is nothing but its header
+func decodeHeaderOnly(message []byte, name string) error {
+	return newReader(message, name).end()
+}
+
+//////// player ids
+
+// every player id in a parsed message, from either side
+func PlayerIds(event any) []int {
+	var ids []int
+	switch event := event.(type) {
+	case LocationsEvent:
+		for _, parcel := range event.Players {
+			ids = append(ids, int(parcel.Id))
+		}
+	case ShotEvent:
+		ids = append(ids, event.ShooterId)
+	case ActionEvent:
+		ids = append(ids, event.PlayerId)
+	case KilledEvent:
+		ids = append(append(ids, event.KillerId, event.KilledId), event.AssisterIds...)
+	case PlayerDisconnectEvent:
+		ids = append(ids, event.Id)
+	case ResumeState:
+		for _, score := range event.Players {
+			ids = append(ids, score.Id)
+		}
+	case PingsEvent:
+		for _, parcel := range event {
+			ids = append(ids, parcel.Id)
+		}
+	case VoiceEvent:
+		ids = append(ids, event.SpeakerId)
+	case GrenadeThrowEvent:
+		ids = append(ids, event.ThrowerId)
+	case HealthPackTakenEvent:
+		ids = append(ids, event.PlayerId)
+	case LaunchEvent:
+		ids = append(ids, event.PlayerId)
+	case TeleportEvent:
+		ids = append(ids, event.PlayerId)
+	case StreakEvent:
+		ids = append(ids, event.PlayerId)
+	case MarkerEvent:
+		ids = append(ids, event.PlayerId)
+	case TeammateHealthEvent:
+		ids = append(ids, event.PlayerId)
+	case StatisticsEvent:
+		for _, player := range event {
+			ids = append(ids, player.Id)
+		}
+	case Roster:
+		for id, name := range event {
+			if name != "" {
+				ids = append(ids, id)
+			}
+		}
+	case HitConfirmation:
+		ids = append(ids, event.PlayerId)
+	case PromotedEvent:
+		ids = append(ids, event.PlayerId)
+	case RespawnEvent:
+		ids = append(ids, event.PlayerId)
+	case VoteState:
+		ids = append(ids, event.CallerId, event.TargetId)
+	case HitRequest:
+		ids = append(ids, event.PlayerId)
+	case CallVoteRequest:
+		ids = append(ids, event.TargetId)
+	}
+	return ids
+}
@@ -0,0 +1,236 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+)
+
+// run with go test -fuzz FuzzParseClientMessage ./internal/protocol, the
+// messages a well behaved client sends are the starting corpus
+func FuzzParseClientMessage(f *testing.F) {
+	for _, message := range [][]byte{
+		EncodeHit(3, Shotgun.Gun(), 8, 2, 1500*time.Millisecond),
+		EncodeShotMessage(),
+		EncodeMove(Move{Sequence: 7, Dx: -3, Dz: 12, Yaw: 200, Pitch: -40, Crouching: true}),
+		EncodePing(12, 80),
+		EncodeVoiceMessage(make([]byte, VoiceFrameSamples)),
+		EncodeThrow(Flash, 10, 20, -30),
+		EncodeBuy(Armor),
+		EncodeActionMessage(Reload, Rifle.Gun()),
+		EncodeCallVote(KickVote, 4),
+		EncodeBallot(true),
+		EncodeUse(),
+		EncodeMark(10, 2, -30),
+	} {
+		f.Add(message)
+	}
+
+	f.Fuzz(func(t *testing.T, message []byte) {
+		request, err := ParseClientMessage(message)
+		if err != nil {
+			return
+		}
+		switch request := request.(type) {
+		case HitRequest:
+			checkIds(t, request.PlayerId)
+			if request.Gun >= Guns || request.Headshots > request.Pellets {
+				t.Errorf("Parsed out of range hit %+v", request)
+			}
+		case ThrowRequest:
+			if request.Kind >= GrenadeKinds {
+				t.Errorf("Parsed out of range throw %+v", request)
+			}
+		case BuyRequest:
+			if request.Item >= Items {
+				t.Errorf("Parsed out of range buy %+v", request)
+			}
+		case ActionRequest:
+			if request.Action >= Actions || request.Gun >= Guns {
+				t.Errorf("Parsed out of range action %+v", request)
+			}
+		case CallVoteRequest:
+			checkIds(t, request.TargetId)
+			if request.Kind >= VoteKinds {
+				t.Errorf("Parsed out of range vote %+v", request)
+			}
+		case VoiceRequest:
+			if len(request.Samples) == 0 || len(request.Samples) > VoiceFrameSamples {
+				t.Errorf("Parsed %d voice samples", len(request.Samples))
+			}
+		case ShotRequest, Move, PingRequest, BallotRequest, UseRequest, MarkRequest:
+		default:
+			t.Errorf("Parsed %T from a client", request)
+		}
+		checkIds(t, PlayerIds(request)...)
+	})
+}
+
+// run with go test -fuzz FuzzParseServerMessage ./internal/protocol, batches
+// are split the way connection.Reader splits them
+func FuzzParseServerMessage(f *testing.F) {
+	state := GrenadeState{Id: 1, X: 2, Y: 3, Z: 4, VX: -5, VY: 6, VZ: -7}
+	roster := make(Roster, 6)
+	roster[0], roster[4] = "alpha", "bravo"
+	for _, message := range [][]byte{
+		{byte(NextRoundHeader)},
+		{byte(PlayHeader)},
+		EncodeLocations(90*time.Second, []LocationParcel{{Id: 1, X: 10, Y: -2, Z: 30, Yaw: 90, Pitch: 5, Crouching: true}}),
+		EncodeShot(2, 1, 2, 3),
+		EncodeAction(5, Swap, Sniper.Gun()),
+		EncodeKilled(0, 4, Handgun.Weapon(), true, []int{1, 2}),
+		EncodeTeamPoint(B),
+		EncodeRoundTime(90 * time.Second),
+		EncodeLoseHealth(30, true),
+		EncodePlayerDisconnect(6),
+		EncodeResume(ResumeState{Round: 3, Health: 100, IsAlive: true, Players: []PlayerScore{{Id: 1, Kills: 2}}}),
+		EncodeMapChange("default"),
+		EncodeSay("Match starts in 5 minutes"),
+		EncodePromoted(4, make([]byte, SessionTokenSize)),
+		EncodeCorrection(9, 1, 2, 3),
+		EncodePong(4, 2*time.Minute),
+		EncodePings([]PingParcel{{Id: 3, Ping: 40}}),
+		EncodeRoster(roster),
+		EncodeVoice(7, make([]byte, VoiceFrameSamples)),
+		EncodeGrenadeThrow(2, Smoke, state),
+		EncodeGrenadeBounce(state),
+		EncodeExplosion(1, 2, 3, 4),
+		EncodeSmoke(1, 2, 3, 4),
+		EncodeFlash(1, 2, 3, 4),
+		EncodeHealthPackTaken(0, 3, 25),
+		EncodeHealthPacks([]int{0, 2}),
+		EncodeDoor(1, true),
+		EncodeDoors([]int{0, 3}),
+		EncodeLaunch(2, 1),
+		EncodeTeleport(5, 0),
+		EncodeStreak(3, 2, true),
+		EncodeMarker(1, -20, 0, 15),
+		EncodeTeammateHealth(2, 1),
+		EncodeGrace(8 * time.Second),
+		EncodeInventory(Inventory{Money: 800, Primary: NoPrimary, Armor: 50}),
+		EncodeStatistics([]PlayerStatistics{{Id: 2, ShotsFired: 10, ShotsHit: 4, Damage: 120}}),
+		EncodeHitConfirm(HitConfirmation{PlayerId: 4, Accepted: true, Headshot: true, Damage: 2, Health: 1}),
+		EncodeWarmup(),
+		EncodeRespawn(3, 10, 0, -20),
+		EncodeVoteState(VoteState{Kind: KickVote, CallerId: 1, TargetId: 4, Yes: 2, No: 1, Needed: 3, Left: 20 * time.Second}),
+		EncodeBatch([][]byte{EncodeTeamPoint(A), EncodePong(1, time.Second)}),
+	} {
+		f.Add(message)
+	}
+
+	f.Fuzz(func(t *testing.T, message []byte) {
+		messages := [][]byte{message}
+		if len(message) > 0 && MessageHeader(message[0]) == BatchHeader {
+			var err error
+			if messages, err = DecodeBatch(message); err != nil {
+				return
+			}
+		}
+		for _, message := range messages {
+			event, err := ParseServerMessage(message)
+			if err != nil {
+				continue
+			}
+			checkEvent(t, event)
+			checkIds(t, PlayerIds(event)...)
+		}
+	})
+}
+
+func checkEvent(t *testing.T, event any) {
+	switch event := event.(type) {
+	case LocationsEvent:
+		for _, parcel := range event.Players {
+			checkIds(t, int(parcel.Id))
+		}
+	case ShotEvent:
+		checkIds(t, event.ShooterId)
+	case ActionEvent:
+		checkIds(t, event.PlayerId)
+		if event.Action >= Actions || event.Gun >= Guns {
+			t.Errorf("Parsed out of range action %+v", event)
+		}
+	case KilledEvent:
+		checkIds(t, append([]int{event.KillerId, event.KilledId}, event.AssisterIds...)...)
+		if event.Weapon >= Weapons {
+			t.Errorf("Parsed out of range weapon %d", event.Weapon)
+		}
+	case TeamPointEvent:
+		if event.Team != A && event.Team != B {
+			t.Errorf("Parsed point for team %d", event.Team)
+		}
+	case PlayerDisconnectEvent:
+		checkIds(t, event.Id)
+	case ResumeState:
+		for _, score := range event.Players {
+			checkIds(t, score.Id)
+		}
+	case PingsEvent:
+		for _, parcel := range event {
+			checkIds(t, parcel.Id)
+		}
+	case VoiceEvent:
+		checkIds(t, event.SpeakerId)
+	case GrenadeThrowEvent:
+		checkIds(t, event.ThrowerId)
+		if event.Kind >= GrenadeKinds {
+			t.Errorf("Parsed out of range grenade kind %d", event.Kind)
+		}
+	case HealthPackTakenEvent:
+		checkIds(t, event.PlayerId)
+	case LaunchEvent:
+		checkIds(t, event.PlayerId)
+	case TeleportEvent:
+		checkIds(t, event.PlayerId)
+	case StreakEvent:
+		checkIds(t, event.PlayerId)
+	case MarkerEvent:
+		checkIds(t, event.PlayerId)
+	case TeammateHealthEvent:
+		checkIds(t, event.PlayerId)
+	case StatisticsEvent:
+		for _, player := range event {
+			checkIds(t, player.Id)
+		}
+	case Roster:
+		for _, name := range event {
+			if name != "" && !ValidName(name) {
+				t.Errorf("Parsed name %q", name)
+			}
+		}
+	case HitConfirmation:
+		checkIds(t, event.PlayerId)
+	case SayEvent:
+		if !ValidSay(event.Text) {
+			t.Errorf("Parsed said %q", event.Text)
+		}
+	case PromotedEvent:
+		checkIds(t, event.PlayerId)
+		if len(event.Token) != SessionTokenSize {
+			t.Errorf("Parsed token of %d bytes", len(event.Token))
+		}
+	case RespawnEvent:
+		checkIds(t, event.PlayerId)
+	case VoteState:
+		checkIds(t, event.CallerId, event.TargetId)
+		if event.Kind >= VoteKinds || event.Result >= VoteResults {
+			t.Errorf("Parsed out of range vote %+v", event)
+		}
+	case Inventory:
+		if !event.Primary.IsPrimary() && event.Primary != NoPrimary {
+			t.Errorf("Parsed primary %d", event.Primary)
+		}
+	case NextRoundEvent, PlayEvent, WarmupEvent, RoundTimeEvent, GraceEvent, LoseHealthEvent, MapChangeEvent, CorrectionEvent,
+		PongEvent, GrenadeBounceEvent, ExplosionEvent, SmokeEvent, FlashEvent, HealthPacksEvent, DoorEvent, DoorsEvent:
+	default:
+		t.Errorf("Parsed %T from the server", event)
+	}
+}
+
+// ids are used to index arrays of every player, so must never be out of range
+func checkIds(t *testing.T, ids ...int) {
+	for _, id := range ids {
+		if !ValidId(id) {
+			t.Errorf("Parsed player id %d", id)
+		}
+	}
+}
@@ -0,0 +1,587 @@
+// Package protocol describes the wire format shared between the client and
+// the server, so that neither side can silently drift from the other.
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+//////// game rules
+
+const (
+	MaxHealth  = 3
+	LastRound  = 10
+	HeadHeight = 0.4 // the top of a player's box is their head, standing or crouching
+)
+
+// how often location information is exchanged, per second, unless the server
+// is started with another rate, which it tells clients as they join
+const (
+	DefaultTickRate = 12
+	MaxTickRate     = 60
+)
+
+// how much the int8s are scaled from their float32 counterpart in location
+// data to save packet space
+const ScalingFactor = 8
+
+//////// teams
+
+type Team int
+
+const (
+	A Team = iota
+	B
+)
+
+// how many players each team has is up to the server, which tells clients as
+// they join; a lobby has a slot for each of them, team A's first
+const (
+	DefaultTeamSize = 3
+	MaxTeamSize     = 8
+	MaxPlayers      = 2 * MaxTeamSize // slots in the largest lobby
+)
+
+func ValidTeamSize(teamSize int) bool {
+	return 1 <= teamSize && teamSize <= MaxTeamSize
+}
+
+// the team a player slot belongs to, in a lobby with teams of that size
+func TeamOf(id, teamSize int) Team {
+	if id < teamSize {
+		return A
+	}
+	return B
+}
+
+// check that a player id refers to a slot the largest lobby has, whether the
+// lobby at hand has it depends on its team size
+func ValidId(id int) bool {
+	return 0 <= id && id < MaxPlayers
+}
+
+// asks the server to pick a free slot on whichever team needs players most
+const AnyId = -1
+
+// asks to watch the match without playing in it, taking no slot, for casting
+// or refereeing; an observer is told everything every player is, and anything
+// it sends is ignored
+const ObserverId = -2
+
+// observers a lobby lets in at once, on top of its players
+const MaxObservers = 4
+
+//////// headers
+
+// first byte of every message the server sends
+type MessageHeader byte
+
+const (
+	NextRoundHeader MessageHeader = iota
+	PlayHeader
+	LocationsHeader
+	ShotHeader
+	KilledHeader
+	TeamPointHeader
+	LoseHealthHeader
+	PlayerDisconnectHeader
+	ResumeHeader
+	MapChangeHeader
+	CorrectionHeader
+	PongHeader
+	PingsHeader
+	RosterHeader
+	VoiceHeader
+	GrenadeThrowHeader
+	GrenadeBounceHeader
+	ExplosionHeader
+	SmokeHeader
+	FlashHeader
+	HealthPackTakenHeader
+	HealthPacksHeader
+	RoundTimeHeader
+	InventoryHeader
+	ActionHeader
+	StatisticsHeader
+	HitConfirmHeader
+	WarmupHeader
+	RespawnHeader
+	VoteHeader
+	SayHeader
+	PromotedHeader
+	DoorHeader
+	DoorsHeader
+	LaunchHeader
+	TeleportHeader
+	StreakHeader
+	MarkerHeader
+	TeammateHealthHeader
+	GraceHeader
+	BatchHeader
+)
+
+func (header MessageHeader) String() string {
+	switch header {
+	case NextRoundHeader:
+		return "next round"
+	case PlayHeader:
+		return "play"
+	case LocationsHeader:
+		return "locations"
+	case ShotHeader:
+		return "shot"
+	case KilledHeader:
+		return "killed"
+	case TeamPointHeader:
+		return "team point"
+	case LoseHealthHeader:
+		return "lose health"
+	case PlayerDisconnectHeader:
+		return "player disconnect"
+	case ResumeHeader:
+		return "resume"
+	case MapChangeHeader:
+		return "map change"
+	case CorrectionHeader:
+		return "correction"
+	case PongHeader:
+		return "pong"
+	case PingsHeader:
+		return "pings"
+	case RosterHeader:
+		return "roster"
+	case VoiceHeader:
+		return "voice"
+	case GrenadeThrowHeader:
+		return "grenade throw"
+	case GrenadeBounceHeader:
+		return "grenade bounce"
+	case ExplosionHeader:
+		return "explosion"
+	case SmokeHeader:
+		return "smoke"
+	case FlashHeader:
+		return "flash"
+	case HealthPackTakenHeader:
+		return "health pack taken"
+	case HealthPacksHeader:
+		return "health packs"
+	case RoundTimeHeader:
+		return "round time"
+	case InventoryHeader:
+		return "inventory"
+	case ActionHeader:
+		return "action"
+	case StatisticsHeader:
+		return "statistics"
+	case HitConfirmHeader:
+		return "hit confirm"
+	case WarmupHeader:
+		return "warmup"
+	case RespawnHeader:
+		return "respawn"
+	case VoteHeader:
+		return "vote"
+	case SayHeader:
+		return "say"
+	case PromotedHeader:
+		return "promoted"
+	case DoorHeader:
+		return "door"
+	case DoorsHeader:
+		return "doors"
+	case LaunchHeader:
+		return "launch"
+	case TeleportHeader:
+		return "teleport"
+	case StreakHeader:
+		return "streak"
+	case MarkerHeader:
+		return "marker"
+	case TeammateHealthHeader:
+		return "teammate health"
+	case GraceHeader:
+		return "grace"
+	case BatchHeader:
+		return "batch"
+	}
+	return fmt.Sprintf("unknown (%d)", byte(header))
+}
+
+// first byte of every message the client sends
+type ClientMessage byte
+
+const (
+	HitMessage ClientMessage = iota
+	ShotMessage
+	MoveMessage
+	PingMessage
+	VoiceMessage
+	ThrowMessage
+	BuyMessage
+	ActionMessage
+	CallVoteMessage
+	BallotMessage
+	UseMessage
+	MarkMessage
+)
+
+func (message ClientMessage) String() string {
+	switch message {
+	case HitMessage:
+		return "hit"
+	case ShotMessage:
+		return "shot"
+	case MoveMessage:
+		return "move"
+	case PingMessage:
+		return "ping"
+	case VoiceMessage:
+		return "voice"
+	case ThrowMessage:
+		return "throw"
+	case BuyMessage:
+		return "buy"
+	case ActionMessage:
+		return "action"
+	case CallVoteMessage:
+		return "call vote"
+	case BallotMessage:
+		return "ballot"
+	case UseMessage:
+		return "use"
+	case MarkMessage:
+		return "mark"
+	}
+	return fmt.Sprintf("unknown (%d)", byte(message))
+}
+
+// bumped whenever what either side sends changes, so a client and server that
+// would misread each other find out when the client joins instead
+const Version = 16
+
+// reply to the client's join request, a success carries the player's slot,
+// the session token needed to resume the match after a disconnect, and the
+// name of the map being played
+type SuccessResponse byte
+
+const (
+	Success SuccessResponse = iota
+	Failure
+	WrongPassword
+)
+
+const SessionTokenSize = 16
+
+// longest name a player can go by, in bytes of UTF-8
+const MaxNameLength = 16
+
+// whether a player can go by a name, an empty name leaves it to the server
+func ValidName(name string) bool {
+	if len(name) > MaxNameLength || !utf8.ValidString(name) {
+		return false
+	}
+	for _, character := range name {
+		if !unicode.IsGraphic(character) {
+			return false
+		}
+	}
+	return true
+}
+
+// longest the host can say to a lobby, in bytes of UTF-8
+const MaxSayLength = 120
+
+// whether the host can say something, which is shown to everyone as it is
+func ValidSay(text string) bool {
+	if text == "" || len(text) > MaxSayLength || !utf8.ValidString(text) {
+		return false
+	}
+	for _, character := range text {
+		if !unicode.IsGraphic(character) {
+			return false
+		}
+	}
+	return true
+}
+
+// how often the server pings each connection at the websocket level, and how
+// long either end waits to hear from the other before giving up on it
+const (
+	KeepaliveInterval = 5 * time.Second
+	KeepaliveTimeout  = 3 * KeepaliveInterval
+)
+
+// how long a player who drops out of a match has to rejoin it before their
+// slot is given up
+const ReconnectGraceTime = 30 * time.Second
+
+// with UDP on, how often a client says hello to be sent locations over UDP,
+// and how long the server keeps sending them there after the last hello
+const (
+	DatagramHelloInterval = time.Second
+	DatagramTimeout       = 5 * DatagramHelloInterval
+)
+
+// large enough for a hello or a locations datagram with every player in it:
+// its sequence, the locations header and server time, and a parcel each
+const MaxDatagramSize = 2 + 1 + 4 + MaxPlayers*LocationParcelSize
+
+// how often clients measure their round trip time to the server
+const PingFrequency = 1
+
+// pings are sent in milliseconds, capped to what fits in the message
+const MaxPing = 0xFFFF
+
+// voice is sent in frames of 8 bit G.711 mu-law samples, and only reaches
+// teammates within range of the speaker
+const (
+	VoiceSampleRate   = 8000
+	VoiceFrameSamples = VoiceSampleRate / 25
+	VoiceRange        = 40 // units
+)
+
+type GrenadeKind byte
+
+const (
+	Frag GrenadeKind = iota
+	Smoke
+	Flash
+	GrenadeKinds // how many kinds of grenade there are
+)
+
+// grenades of each kind a player can carry
+var MaxGrenades = [GrenadeKinds]int{Frag: 2, Smoke: 1, Flash: 1}
+
+// grenade velocities are sent in quarters of a unit per second
+const VelocityScalingFactor = 4
+
+// clamped like Float32ScaleToInt8
+func Float32ScaleToVelocity(number float32) int8 {
+	return int8(min(max(number*VelocityScalingFactor, math.MinInt8), math.MaxInt8))
+}
+
+func VelocityScaleToFloat32(number int8) float32 {
+	return float32(number) / VelocityScalingFactor
+}
+
+//////// economy
+
+// kills and rounds earn money, which buys items before a round starts
+const (
+	StartingMoney   = 800
+	MaxMoney        = 9000
+	KillReward      = 300
+	RoundWinReward  = 1000
+	RoundLossReward = 500
+	MaxArmor        = 2 // armor takes damage before health does
+)
+
+// what can be bought, the primary guns come first
+type Item byte
+
+const (
+	Sniper Item = iota
+	Shotgun
+	SMG
+	Rifle
+	Armor
+	FragGrenade
+	SmokeGrenade
+	FlashGrenade
+	Items // how many items there are
+
+	Primaries = Armor // how many primary guns there are
+	NoPrimary = Items // a player who has not bought a primary gun
+)
+
+var Prices = [Items]int{
+	Sniper:       2500,
+	Shotgun:      1200,
+	SMG:          1300,
+	Rifle:        2700,
+	Armor:        650,
+	FragGrenade:  300,
+	SmokeGrenade: 300,
+	FlashGrenade: 200,
+}
+
+func (item Item) IsPrimary() bool {
+	return item < Primaries
+}
+
+// the kind of grenade bought, false if the item is not a grenade
+func (item Item) GrenadeKind() (GrenadeKind, bool) {
+	if item < FragGrenade || Items <= item {
+		return 0, false
+	}
+	return GrenadeKind(item - FragGrenade), true
+}
+
+func (item Item) String() string {
+	switch item {
+	case Sniper:
+		return "sniper"
+	case Shotgun:
+		return "shotgun"
+	case SMG:
+		return "SMG"
+	case Rifle:
+		return "rifle"
+	case Armor:
+		return "armor"
+	case FragGrenade:
+		return "frag grenade"
+	case SmokeGrenade:
+		return "smoke grenade"
+	case FlashGrenade:
+		return "flashbang"
+	}
+	return fmt.Sprintf("unknown (%d)", byte(item))
+}
+
+//////// guns
+
+// the gun a shot was fired from, each primary gun has the value of the item
+// that buys it, and the handgun everyone carries comes after them
+type Gun byte
+
+const (
+	Handgun = Gun(Primaries)
+	Guns    = Handgun + 1 // how many guns there are
+)
+
+// the gun of a primary item, which must be a primary
+func (item Item) Gun() Gun {
+	return Gun(item)
+}
+
+func (gun Gun) String() string {
+	if gun == Handgun {
+		return "handgun"
+	}
+	return Item(gun).String()
+}
+
+// what a kill was made with, each gun has the value of the gun, and a frag
+// grenade comes after them
+type Weapon byte
+
+const (
+	FragWeapon = Weapon(Guns)
+	Weapons    = FragWeapon + 1 // how many weapons there are
+)
+
+func (gun Gun) Weapon() Weapon {
+	return Weapon(gun)
+}
+
+func (weapon Weapon) String() string {
+	if weapon == FragWeapon {
+		return "frag grenade"
+	}
+	return Gun(weapon).String()
+}
+
+//////// votes
+
+// what players can vote on
+type VoteKind byte
+
+const (
+	KickVote    VoteKind = iota // to kick the target player
+	MapVote                     // to change to the next map in the rotation
+	RestartVote                 // to start the match over from the first round
+	VoteKinds                   // how many kinds of vote there are
+)
+
+func (kind VoteKind) String() string {
+	switch kind {
+	case KickVote:
+		return "kick"
+	case MapVote:
+		return "map"
+	case RestartVote:
+		return "restart"
+	}
+	return fmt.Sprintf("unknown (%d)", byte(kind))
+}
+
+// how a vote stands
+type VoteResult byte
+
+const (
+	VoteOpen VoteResult = iota
+	VotePassed
+	VoteFailed
+	VoteResults // how many results there are
+)
+
+//////// actions
+
+// what a player does with their gun besides shooting it, passed on so that
+// everyone else can see and hear it
+type Action byte
+
+const (
+	Reload Action = iota
+	Swap
+	Actions // how many actions there are
+)
+
+func (action Action) String() string {
+	switch action {
+	case Reload:
+		return "reload"
+	case Swap:
+		return "swap"
+	}
+	return fmt.Sprintf("unknown (%d)", byte(action))
+}
+
+// numbers each move message a client sends, so a correction from the server
+// can say which move it was made against, wrapping around when it runs out
+type Sequence uint16
+
+// whether a sequence number was sent after another, allowing for wrapping
+func (sequence Sequence) After(other Sequence) bool {
+	return int16(sequence-other) > 0
+}
+
+//////// location scaling
+
+// anything out of range is clamped to the furthest that can be sent
+func Float32ScaleToInt8(number float32) int8 {
+	return int8(min(max(number*ScalingFactor, math.MinInt8), math.MaxInt8))
+}
+
+func Int8ScaleToFloat32(number int8) float32 {
+	return float32(number) / ScalingFactor
+}
+
+//////// orientation scaling
+
+// yaw is the angle around the vertical axis in radians, from the X axis
+// towards the Z axis, and a whole turn fits in a byte
+func YawToByte(yaw float32) byte {
+	turns := float64(yaw) / (2 * math.Pi)
+	return byte(int(math.Round((turns - math.Floor(turns)) * 256)))
+}
+
+func ByteToYaw(number byte) float32 {
+	return float32(number) / 256 * 2 * math.Pi
+}
+
+// pitch is the angle above the horizon in radians, a quarter turn up or down
+// fits in an int8
+func PitchToInt8(pitch float32) int8 {
+	return int8(min(max(math.Round(float64(pitch)/(math.Pi/2)*math.MaxInt8), -math.MaxInt8), math.MaxInt8))
+}
+
+func Int8ToPitch(number int8) float32 {
+	return float32(number) / math.MaxInt8 * math.Pi / 2
+}
@@ -0,0 +1,161 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+//////// schema
+//////// every message is its header followed by its fields in order, decoders
+//////// list the fields they expect from a reader, which checks each one is
+//////// there and nothing is left over, instead of counting bytes themselves;
+//////// numbers wider than a byte are sent big endian
+
+// reads the fields of one message in order, the first problem is kept and
+// every field read after it is zero, so a decoder can read all of its fields
+// and check for an error once at the end
+type reader struct {
+	data []byte
+	name string // of the message, for errors
+	err  error
+}
+
+// a reader for a message from the server or a client, past its header
+func newReader(message []byte, name string) *reader {
+	reader := &reader{data: message, name: name}
+	reader.take(1)
+	return reader
+}
+
+// a reader for a handshake message, which has no header
+func newHandshakeReader(message []byte, name string) *reader {
+	return &reader{data: message, name: name}
+}
+
+func (reader *reader) take(size int) []byte {
+	if reader.err != nil {
+		return nil
+	}
+	if len(reader.data) < size {
+		reader.err = fmt.Errorf("Incorrect message size for %s message", reader.name)
+		return nil
+	}
+	field := reader.data[:size]
+	reader.data = reader.data[size:]
+	return field
+}
+
+func (reader *reader) byte() byte {
+	if field := reader.take(1); field != nil {
+		return field[0]
+	}
+	return 0
+}
+
+func (reader *reader) int8() int8 {
+	return int8(reader.byte())
+}
+
+func (reader *reader) bool() bool {
+	return reader.byte() != 0
+}
+
+func (reader *reader) uint16() uint16 {
+	if field := reader.take(2); field != nil {
+		return uint16(field[0])<<8 | uint16(field[1])
+	}
+	return 0
+}
+
+func (reader *reader) uint32() uint32 {
+	if field := reader.take(4); field != nil {
+		return uint32(field[0])<<24 | uint32(field[1])<<16 | uint32(field[2])<<8 | uint32(field[3])
+	}
+	return 0
+}
+
+// how long the lobby's clock had been running, sent in milliseconds
+func (reader *reader) serverTime() time.Duration {
+	return time.Duration(reader.uint32()) * time.Millisecond
+}
+
+// a player id, which must refer to a valid slot
+func (reader *reader) id() int {
+	id := int(reader.byte())
+	if reader.err == nil && !ValidId(id) {
+		reader.err = fmt.Errorf("Invalid player id in %s message", reader.name)
+	}
+	return id
+}
+
+// a string with its length in the byte ahead of it
+func (reader *reader) string() string {
+	return string(reader.take(int(reader.byte())))
+}
+
+// everything left of the message
+func (reader *reader) rest() []byte {
+	if reader.err != nil {
+		return nil
+	}
+	rest := reader.data
+	reader.data = nil
+	return rest
+}
+
+// everything left of the message, which must come to between least and most
+// bytes
+func (reader *reader) sized(least, most int) []byte {
+	if reader.err == nil && (len(reader.data) < least || most < len(reader.data)) {
+		reader.err = fmt.Errorf("Incorrect message size for %s message", reader.name)
+	}
+	return reader.rest()
+}
+
+// whether any of the message is left to read
+func (reader *reader) more() bool {
+	return reader.err == nil && len(reader.data) > 0
+}
+
+// a field was read but does not hold anything valid
+func (reader *reader) invalid(field string) {
+	reader.fail(fmt.Sprintf("Invalid %s in %s message", field, reader.name))
+}
+
+func (reader *reader) fail(problem string) {
+	if reader.err == nil {
+		reader.err = errors.New(problem)
+	}
+}
+
+// the first problem with the message, if any, a message with more to it than
+// was read is the wrong size
+func (reader *reader) end() error {
+	if reader.err == nil && len(reader.data) > 0 {
+		reader.err = fmt.Errorf("Incorrect message size for %s message", reader.name)
+	}
+	return reader.err
+}
+
+// the writing side of the schema, numbers wider than a byte are sent big
+// endian
+func appendUint16(message []byte, number uint16) []byte {
+	return append(message, byte(number>>8), byte(number))
+}
+
+func appendUint32(message []byte, number uint32) []byte {
+	return append(message, byte(number>>24), byte(number>>16), byte(number>>8), byte(number))
+}
+
+func appendServerTime(message []byte, serverTime time.Duration) []byte {
+	return appendUint32(message, uint32(min(max(serverTime.Milliseconds(), 0), math.MaxUint32)))
+}
+
+func boolToByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,10 @@
+// Package resources holds the game's default textures, sounds, music, fonts,
+// shaders and maps, built into the client so it runs from any directory.
+package resources
+
+import "embed"
+
+// laid out as in this directory, such as textures/floor_texture.png
+//
+//go:embed fonts maps music shaders sounds textures
+var Files embed.FS
@@ -0,0 +1,24 @@
+#version 330
+
+in vec2 fragTexCoord;
+in vec3 fragNormal;
+out vec4 finalColor;
+
+uniform sampler2D texture0;
+uniform vec4 colDiffuse;
+
+// the way the sunlight travels, the same as sunDirection in lighting.go
+const vec3 sunDirection = vec3(-0.4, -1.0, -0.25);
+// how lit faces turned away from the sun still are
+const float ambient = 0.45;
+
+void main()
+{
+    vec4 texel = texture(texture0, fragTexCoord) * colDiffuse;
+
+    // faces turned towards the sun are lit fully, others fade to the ambient
+    float diffuse = max(dot(normalize(fragNormal), -normalize(sunDirection)), 0.0);
+    float light = ambient + (1.0 - ambient) * diffuse;
+
+    finalColor = vec4(texel.rgb * light, texel.a);
+}
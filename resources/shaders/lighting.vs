@@ -0,0 +1,19 @@
+#version 330
+
+in vec3 vertexPosition;
+in vec2 vertexTexCoord;
+in vec3 vertexNormal;
+
+uniform mat4 mvp;
+uniform mat4 matNormal;
+
+out vec2 fragTexCoord;
+out vec3 fragNormal;
+
+void main()
+{
+    fragTexCoord = vertexTexCoord;
+    // the normal turned along with the model, for ramps
+    fragNormal = normalize(vec3(matNormal * vec4(vertexNormal, 1.0)));
+    gl_Position = mvp * vec4(vertexPosition, 1.0);
+}